@@ -49,3 +49,38 @@ Selector labels
 app.kubernetes.io/name: {{ include "keptn-service.name" . }}
 app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end }}
+
+{{/*
+Lease based namespace locking is required as soon as more than one replica is running
+*/}}
+{{- define "keptn-service.leaseLockEnabled" -}}
+{{- or .Values.leaseLock.enabled (gt (int .Values.replicaCount) 1) }}
+{{- end }}
+
+{{/*
+Leader election is required as soon as more than one replica is running
+*/}}
+{{- define "keptn-service.leaderElectionEnabled" -}}
+{{- or .Values.leaderElection.enabled (gt (int .Values.replicaCount) 1) }}
+{{- end }}
+
+{{/*
+A config file is mounted if an existing ConfigMap or Secret is referenced, renders an empty string otherwise
+*/}}
+{{- define "keptn-service.configFileEnabled" -}}
+{{- if or .Values.configFile.existingConfigMap .Values.configFile.existingSecret }}true{{ end }}
+{{- end }}
+
+{{/*
+The audit webhook token is mounted if the webhook and its secret are set, renders an empty string otherwise
+*/}}
+{{- define "keptn-service.auditWebhookTokenEnabled" -}}
+{{- if and .Values.audit.webhook.url .Values.audit.webhook.existingSecret }}true{{ end }}
+{{- end }}
+
+{{/*
+The audit query token is mounted if the audit file and the query secret are set, renders an empty string otherwise
+*/}}
+{{- define "keptn-service.auditQueryTokenEnabled" -}}
+{{- if and .Values.audit.file.enabled .Values.audit.query.existingSecret }}true{{ end }}
+{{- end }}
@@ -0,0 +1,697 @@
+// provisionerctl manages the Gitea objects of Keptn projects without going through the HTTP API of the service. It
+// reads the same configuration as the service, i.e. the environment variables and the file referenced by CONFIG_FILE,
+// and is therefore usually run inside the provisioner pod:
+//
+//	kubectl exec deploy/keptn-gitea-provisioner-service -- provisionerctl list -namespace keptn
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/audit"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/config"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner"
+)
+
+// Output formats of the commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// Namespace and project of the doctor command if none are given, the namespace must not be used by Keptn
+const (
+	doctorNamespace = "gitea-provisioner-doctor"
+	doctorProject   = "doctor"
+)
+
+// auditFlushTimeout limits how long the audit events are sent to the webhook before the command exits
+const auditFlushTimeout = 10 * time.Second
+
+// errUsage indicates that the command line was invalid, the usage has already been printed
+var /*const*/ errUsage = errors.New("invalid usage")
+
+// errNotLocked indicates that a command would modify Gitea without excluding concurrent requests of the service
+var /*const*/ errNotLocked = errors.New("the service's namespace locks are not shared without LEASE_LOCK_ENABLED, " +
+	"pass -force to modify Gitea anyway")
+
+// errPreflightFailed indicates that the doctor command found a problem, the report has already been printed
+var /*const*/ errPreflightFailed = errors.New("preflight check failed")
+
+// projectProvisioner contains the operations of the provisioner.GiteaProvisioner that are offered by the commands
+type projectProvisioner interface {
+	ProvisionRepository(namespace string, project string) (*keptn.ProvisionResponse, error)
+	DeleteRepository(namespace string, project string) error
+	RestoreRepository(namespace string, project string) (*keptn.ProvisionResponse, error)
+	AdoptRepository(namespace string, project string, owner string, repository string) (*keptn.ProvisionResponse, error)
+	TransferRepository(namespace string, targetNamespace string, project string) (*keptn.ProvisionResponse, error)
+	RenameRepository(namespace string, project string, newProject string) (*keptn.RenameResponse, error)
+	ListProjects(namespace string) ([]provisioner.ProjectInfo, error)
+	InspectProject(namespace string, project string) (*provisioner.ProjectInfo, error)
+	RotateToken(namespace string, project string) (*keptn.ProvisionResponse, error)
+	CountProjects(namespace string) (int, error)
+	Preflight(namespace string, project string) *provisioner.PreflightReport
+	PlanProvision(namespace string, project string) (*provisioner.Plan, error)
+	PlanDelete(namespace string, project string) (*provisioner.Plan, error)
+}
+
+// cli executes a single command against the provisioner created by newProvisioner
+type cli struct {
+	stdout         io.Writer
+	stderr         io.Writer
+	output         string
+	dryRun         bool
+	newProvisioner func(cfg *config.Config) (projectProvisioner, error)
+	// cfg is loaded before the provisioner is created, it is used for the admission policy
+	cfg *config.Config
+	// repository is the existing Gitea repository of the adopt command as owner/name
+	repository string
+	// targetNamespace is the namespace the transfer command moves the project to
+	targetNamespace string
+	// newProject is the project the rename command renames the repository to
+	newProject string
+}
+
+// command is a subcommand of provisionerctl
+type command struct {
+	name        string
+	description string
+	// needsProject is false for commands that only operate on a namespace
+	needsProject bool
+	// action is the audit action of commands that modify the project, they are recorded in the audit trail
+	action string
+	// plans is true for commands that only print their plan in dry runs, which neither need a lock nor are audited
+	plans bool
+	run   func(c *cli, p projectProvisioner, namespace string, project string) error
+}
+
+var commands = []command{
+	{name: "provision", description: "Provision the repository of a project", needsProject: true, action: audit.ActionProvision, plans: true, run: (*cli).provision},
+	{name: "delete", description: "Delete the repository of a project", needsProject: true, action: audit.ActionDelete, plans: true, run: (*cli).delete},
+	{name: "restore", description: "Restore the repository of a deleted project", needsProject: true, action: audit.ActionRestore, run: (*cli).restore},
+	{name: "adopt", description: "Manage an existing Gitea repository as repository of a project", needsProject: true, action: audit.ActionAdopt, run: (*cli).adopt},
+	{name: "transfer", description: "Move the repository of a project to another namespace", needsProject: true, action: audit.ActionTransfer, run: (*cli).transfer},
+	{name: "rename", description: "Rename the repository of a project to the one of a new project", needsProject: true, action: audit.ActionRename, run: (*cli).rename},
+	{name: "list", description: "List the projects of a namespace, or of all namespaces", run: (*cli).list},
+	{name: "inspect", description: "Show the Gitea objects of a project", needsProject: true, run: (*cli).inspect},
+	{name: "rotate-token", description: "Replace the access token of a project", needsProject: true, action: audit.ActionRotateToken, run: (*cli).rotateToken},
+	{name: "doctor", description: "Provision and delete a throwaway project to validate Gitea", run: (*cli).doctor},
+}
+
+func main() {
+	c := &cli{
+		stdout:         os.Stdout,
+		stderr:         os.Stderr,
+		newProvisioner: newGiteaProvisioner,
+	}
+
+	if err := c.run(os.Args[1:]); err != nil {
+		if !errors.Is(err, errUsage) && !errors.Is(err, errPreflightFailed) {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run parses the global flags and executes the subcommand
+func (c *cli) run(args []string) error {
+	flags := flag.NewFlagSet("provisionerctl", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	configFile := flags.String("config", "", "Path of the configuration file, overrides CONFIG_FILE")
+	flags.StringVar(&c.output, "output", outputTable, "Output format, either table or json")
+	flags.BoolVar(&c.dryRun, "dry-run", false, "Print the planned changes of provision and delete instead of applying them")
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: provisionerctl [-config file] [-output table|json] [-dry-run] <command> [-namespace ns] [-project name] [-force] [-repository owner/name] [-to ns] [-new-project name]\n\nCommands:\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(c.stderr, "  %-14s%s\n", cmd.name, cmd.description)
+		}
+		fmt.Fprintf(c.stderr, "\nFlags:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if c.output != outputTable && c.output != outputJSON {
+		fmt.Fprintf(c.stderr, "Unknown output format %s\n", c.output)
+		flags.Usage()
+		return errUsage
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == flags.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+
+	if cmd == nil {
+		fmt.Fprintf(c.stderr, "Unknown command %s\n", flags.Arg(0))
+		flags.Usage()
+		return errUsage
+	}
+
+	cmdFlags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	cmdFlags.SetOutput(c.stderr)
+	namespace := cmdFlags.String("namespace", "", "Keptn namespace, empty for the default namespace")
+	project := cmdFlags.String("project", "", "Keptn project")
+	force := cmdFlags.Bool("force", false, "Modify Gitea without LEASE_LOCK_ENABLED and delete the repository even if its backup fails")
+	cmdFlags.StringVar(&c.repository, "repository", "", "Existing Gitea repository as owner/name, required by adopt")
+	cmdFlags.StringVar(&c.targetNamespace, "to", "", "Keptn namespace the project is moved to, required by transfer")
+	cmdFlags.StringVar(&c.newProject, "new-project", "", "Keptn project the repository is renamed to, required by rename")
+	if err := cmdFlags.Parse(flags.Args()[1:]); err != nil {
+		return errUsage
+	}
+
+	if cmd.needsProject && *project == "" {
+		fmt.Fprintf(c.stderr, "The command %s requires -project\n", cmd.name)
+		cmdFlags.Usage()
+		return errUsage
+	}
+
+	if *configFile != "" {
+		if err := os.Setenv("CONFIG_FILE", *configFile); err != nil {
+			return fmt.Errorf("unable to set config file: %w", err)
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("unable to load configuration: %w", err)
+	}
+	c.cfg = cfg
+	c.dryRun = c.dryRun || cfg.DryRun
+	cfg.BackupForce = cfg.BackupForce || *force
+
+	// Without leases, the locks of the service are process-local and don't exclude the command
+	modifies := cmd.action != "" && !(c.dryRun && cmd.plans)
+	if modifies && !cfg.LeaseLockEnabled && !*force {
+		return fmt.Errorf("refusing to %s: %w", cmd.name, errNotLocked)
+	}
+
+	p, err := c.newProvisioner(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to create gitea provisioner: %w", err)
+	}
+
+	if !modifies {
+		return cmd.run(c, p, *namespace, *project)
+	}
+
+	// The service rotates the audit file, the command only appends to it
+	recorder, err := cfg.CommandAuditRecorder()
+	if err != nil {
+		return fmt.Errorf("unable to create audit trail: %w", err)
+	}
+
+	err = cmd.run(c, p, *namespace, *project)
+	if recorder != nil && !errors.Is(err, errUsage) {
+		event := newAuditEvent(cmd.action, p, *namespace, *project, err)
+		if cmd.action == audit.ActionRename {
+			renamedAuditEvent(&event, p, c.newProject)
+		}
+		recorder.Record(event)
+
+		ctx, cancel := context.WithTimeout(context.Background(), auditFlushTimeout)
+		defer cancel()
+		if flushErr := recorder.Flush(ctx); flushErr != nil {
+			fmt.Fprintf(c.stderr, "Unable to send all audit events: %s\n", flushErr)
+		}
+	}
+
+	return err
+}
+
+// newAuditEvent creates the audit event of a command that modified the project, the caller is the user that runs
+// provisionerctl
+func newAuditEvent(action string, p projectProvisioner, namespace string, project string, err error) audit.Event {
+	if namespace == "" {
+		namespace = provisioner.DefaultKeptnNamespace
+	}
+
+	event := audit.Event{
+		Time:      time.Now().UTC(),
+		Action:    action,
+		UserAgent: "provisionerctl",
+		Namespace: namespace,
+		Project:   project,
+		Outcome:   audit.OutcomeSuccess,
+	}
+
+	if current, userErr := user.Current(); userErr == nil {
+		event.Caller = current.Username
+	}
+
+	var violation *provisioner.PolicyViolation
+	switch {
+	case errors.As(err, &violation):
+		event.Outcome = audit.OutcomeRejected
+		event.Error = err.Error()
+		return event
+	case err != nil:
+		event.Outcome = audit.OutcomeFailed
+		event.Error = err.Error()
+	}
+
+	if namer, ok := p.(provisioner.ObjectNamer); ok {
+		objects := namer.GiteaObjects(namespace, project)
+		event.GiteaUser = objects.User
+		event.GiteaRepository = objects.Repository
+		event.GiteaAccessToken = objects.AccessToken
+	}
+
+	return event
+}
+
+// provision evaluates the admission policy of the service and provisions the repository
+func (c *cli) provision(p projectProvisioner, namespace string, project string) error {
+	policy, err := provisioner.NewAdmissionPolicy(c.cfg.PolicyOptions(), p)
+	if err != nil {
+		return fmt.Errorf("unable to create admission policy: %w", err)
+	}
+
+	if err := policy.Evaluate(namespace, project); err != nil {
+		return err
+	}
+
+	if c.dryRun {
+		plan, err := p.PlanProvision(namespace, project)
+		if err != nil {
+			return err
+		}
+
+		return c.printPlan(plan)
+	}
+
+	response, err := p.ProvisionRepository(namespace, project)
+	if err != nil {
+		return err
+	}
+
+	return c.printCredentials(response)
+}
+
+// delete deletes the repository and its access token
+func (c *cli) delete(p projectProvisioner, namespace string, project string) error {
+	if c.dryRun {
+		plan, err := p.PlanDelete(namespace, project)
+		if err != nil {
+			return err
+		}
+
+		return c.printPlan(plan)
+	}
+
+	if err := p.DeleteRepository(namespace, project); err != nil {
+		return err
+	}
+
+	if c.output == outputJSON {
+		return c.printJSON(map[string]string{"namespace": namespace, "project": project, "status": "deleted"})
+	}
+
+	fmt.Fprintf(c.stdout, "Deleted project %s\n", project)
+	return nil
+}
+
+// restore evaluates the admission policy of the service and restores the repository of a deleted project
+func (c *cli) restore(p projectProvisioner, namespace string, project string) error {
+	if c.dryRun {
+		return fmt.Errorf("restores don't support dry runs")
+	}
+
+	policy, err := provisioner.NewAdmissionPolicy(c.cfg.PolicyOptions(), p)
+	if err != nil {
+		return fmt.Errorf("unable to create admission policy: %w", err)
+	}
+
+	if err := policy.Evaluate(namespace, project); err != nil {
+		return err
+	}
+
+	response, err := p.RestoreRepository(namespace, project)
+	if err != nil {
+		return err
+	}
+
+	return c.printCredentials(response)
+}
+
+// adopt evaluates the admission policy of the service and moves the existing repository to the project
+func (c *cli) adopt(p projectProvisioner, namespace string, project string) error {
+	owner, repository := splitRepository(c.repository)
+	if owner == "" || repository == "" {
+		fmt.Fprintf(c.stderr, "The command adopt requires -repository owner/name\n")
+		return errUsage
+	}
+
+	if c.dryRun {
+		return fmt.Errorf("adopting a repository doesn't support dry runs")
+	}
+
+	policy, err := provisioner.NewAdmissionPolicy(c.cfg.PolicyOptions(), p)
+	if err != nil {
+		return fmt.Errorf("unable to create admission policy: %w", err)
+	}
+
+	if err := policy.Evaluate(namespace, project); err != nil {
+		return err
+	}
+
+	response, err := p.AdoptRepository(namespace, project, owner, repository)
+	if err != nil {
+		return err
+	}
+
+	return c.printCredentials(response)
+}
+
+// transfer evaluates the admission policy of the service for the target namespace and moves the repository there
+func (c *cli) transfer(p projectProvisioner, namespace string, project string) error {
+	if c.targetNamespace == "" {
+		fmt.Fprintf(c.stderr, "The command transfer requires -to\n")
+		return errUsage
+	}
+
+	if c.dryRun {
+		return fmt.Errorf("transferring a repository doesn't support dry runs")
+	}
+
+	policy, err := provisioner.NewAdmissionPolicy(c.cfg.PolicyOptions(), p)
+	if err != nil {
+		return fmt.Errorf("unable to create admission policy: %w", err)
+	}
+
+	if err := policy.Evaluate(c.targetNamespace, project); err != nil {
+		return err
+	}
+
+	response, err := p.TransferRepository(namespace, c.targetNamespace, project)
+	if err != nil {
+		return err
+	}
+
+	return c.printCredentials(response)
+}
+
+// rename evaluates the name rules of the admission policy for the new project and renames the repository
+func (c *cli) rename(p projectProvisioner, namespace string, project string) error {
+	if c.newProject == "" {
+		fmt.Fprintf(c.stderr, "The command rename requires -new-project\n")
+		return errUsage
+	}
+
+	if c.dryRun {
+		return fmt.Errorf("renaming a repository doesn't support dry runs")
+	}
+
+	policy, err := provisioner.NewAdmissionPolicy(c.cfg.PolicyOptions(), p)
+	if err != nil {
+		return fmt.Errorf("unable to create admission policy: %w", err)
+	}
+
+	if err := policy.EvaluateNames(namespace, c.newProject); err != nil {
+		return err
+	}
+
+	response, err := p.RenameRepository(namespace, project, c.newProject)
+	if err != nil {
+		return err
+	}
+
+	if c.output == outputJSON {
+		return c.printJSON(response)
+	}
+
+	if err := c.printCredentials(&response.ProvisionResponse); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "\n%s\n", response.Redirect)
+	return nil
+}
+
+// renamedAuditEvent records the new project of a rename and its Gitea objects, which are the ones the rename touched
+func renamedAuditEvent(event *audit.Event, p projectProvisioner, newProject string) {
+	event.NewProject = newProject
+
+	namer, ok := p.(provisioner.ObjectNamer)
+	if !ok || event.Outcome == audit.OutcomeRejected {
+		return
+	}
+
+	objects := namer.GiteaObjects(event.Namespace, newProject)
+	event.GiteaRepository = objects.Repository
+	event.GiteaAccessToken = objects.AccessToken
+}
+
+// splitRepository splits owner/name into its parts, both are empty if the value has no slash
+func splitRepository(value string) (string, string) {
+	index := strings.Index(value, "/")
+	if index < 0 {
+		return "", ""
+	}
+
+	return value[:index], value[index+1:]
+}
+
+// list prints the projects of the namespace
+func (c *cli) list(p projectProvisioner, namespace string, _ string) error {
+	projects, err := p.ListProjects(namespace)
+	if err != nil {
+		return err
+	}
+
+	if c.output == outputJSON {
+		return c.printJSON(projects)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tPROJECT\tUSER\tREPOSITORY\tSIZE (KB)")
+	for _, info := range projects {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", info.Namespace, info.Project, info.User, info.Repository, info.SizeKB)
+	}
+
+	return w.Flush()
+}
+
+// inspect prints the Gitea objects of the project and whether they exist
+func (c *cli) inspect(p projectProvisioner, namespace string, project string) error {
+	info, err := p.InspectProject(namespace, project)
+	if err != nil {
+		return err
+	}
+
+	if c.output == outputJSON {
+		return c.printJSON(info)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OBJECT\tNAME\tEXISTS\tDETAILS")
+	fmt.Fprintf(w, "user\t%s\t%t\tnamespace %s\n", info.User, info.UserExists, info.Namespace)
+	fmt.Fprintf(w, "repository\t%s\t%t\t%s\n", info.Repository, info.RepoExists, repositoryDetails(info))
+	fmt.Fprintf(w, "accessToken\t%s\t%t\t%s\n", info.AccessToken, info.TokenExists, tokenDetails(info))
+
+	return w.Flush()
+}
+
+// rotateToken replaces the access token and prints the new credentials
+func (c *cli) rotateToken(p projectProvisioner, namespace string, project string) error {
+	if c.dryRun {
+		return fmt.Errorf("rotating a token doesn't support dry runs")
+	}
+
+	response, err := p.RotateToken(namespace, project)
+	if err != nil {
+		return err
+	}
+
+	return c.printCredentials(response)
+}
+
+// doctor runs the preflight check in a throwaway namespace and prints the report
+func (c *cli) doctor(p projectProvisioner, namespace string, project string) error {
+	if namespace == "" {
+		namespace = doctorNamespace
+	}
+
+	if project == "" {
+		project = doctorProject
+	}
+
+	report := p.Preflight(namespace, project)
+	if c.output == outputJSON {
+		if err := c.printJSON(report); err != nil {
+			return err
+		}
+	} else if err := c.printPreflightReport(report); err != nil {
+		return err
+	}
+
+	if !report.Passed() {
+		return errPreflightFailed
+	}
+
+	return nil
+}
+
+// printPreflightReport prints the result of every step followed by the hints of the failed ones
+func (c *cli) printPreflightReport(report *provisioner.PreflightReport) error {
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAILS")
+
+	var hints []string
+	for _, check := range report.Checks {
+		result := "PASS"
+		switch {
+		case check.Skipped:
+			result = "SKIP"
+		case !check.Passed:
+			result = "FAIL"
+			hints = append(hints, fmt.Sprintf("%s: %s", check.Name, check.Hint))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, result, check.Message)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(hints) > 0 {
+		fmt.Fprintln(c.stdout, "\nHints:")
+		for _, hint := range hints {
+			fmt.Fprintf(c.stdout, "  %s\n", hint)
+		}
+	}
+
+	return nil
+}
+
+// printPlan prints the changes of a dry run
+func (c *cli) printPlan(plan *provisioner.Plan) error {
+	if c.output == outputJSON {
+		return c.printJSON(plan)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tOBJECT\tNAME\tREASON")
+	for _, change := range plan.Changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Action, change.Object, change.Name, change.Reason)
+	}
+
+	return w.Flush()
+}
+
+// printCredentials prints the credentials Keptn needs to access the repository
+func (c *cli) printCredentials(response *keptn.ProvisionResponse) error {
+	if c.output == outputJSON {
+		return c.printJSON(response)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Git remote URL:\t%s\n", response.GitRemoteURL)
+	fmt.Fprintf(w, "Git user:\t%s\n", response.GitUser)
+	fmt.Fprintf(w, "Git token:\t%s\n", response.GitToken)
+
+	return w.Flush()
+}
+
+// printJSON prints the value as indented JSON
+func (c *cli) printJSON(value interface{}) error {
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// repositoryDetails returns the clone URL and size of an existing repository
+func repositoryDetails(info *provisioner.ProjectInfo) string {
+	if !info.RepoExists {
+		return "-"
+	}
+
+	return fmt.Sprintf("%s (%d KB)", info.CloneURL, info.SizeKB)
+}
+
+// tokenDetails returns the last characters of an existing access token
+func tokenDetails(info *provisioner.ProjectInfo) string {
+	if !info.TokenExists {
+		return "-"
+	}
+
+	return "ends with " + info.TokenLastEight
+}
+
+// newGiteaProvisioner creates the provisioner from the configuration. The namespace locks of the service are only
+// respected if lease locking is enabled, otherwise the service shouldn't handle requests of the same namespace
+// concurrently.
+func newGiteaProvisioner(cfg *config.Config) (projectProvisioner, error) {
+	var locker provisioner.NamespaceLocker = provisioner.NewKeyedMutex()
+	var clientset kubernetes.Interface
+
+	if cfg.LeaseLockEnabled || cfg.CredentialSecretsEnabled {
+		restConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load in-cluster config: %w", err)
+		}
+
+		clientset, err = kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create kubernetes client: %w", err)
+		}
+	}
+
+	if cfg.LeaseLockEnabled {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine identity: %w", err)
+		}
+
+		// The identity must differ from the one of the service, which uses the pod name
+		identity := hostname + "-provisionerctl"
+		locker = provisioner.NewLeaseLocker(clientset, cfg.PodNamespace, identity, cfg.LeaseLockDuration, cfg.LeaseLockTimeout)
+	}
+
+	options := cfg.GiteaProvisionerOptions(locker)
+
+	if cfg.CredentialSecretsEnabled {
+		namespace := cfg.CredentialSecretsNamespace
+		if namespace == "" {
+			namespace = cfg.PodNamespace
+		}
+
+		sink, err := provisioner.NewKubernetesSecretSink(clientset, namespace, cfg.CredentialSecretsNameTemplate)
+		if err != nil {
+			return nil, err
+		}
+		options.CredentialSink = sink
+	}
+
+	backupStore, err := cfg.BackupStore()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create backup store: %w", err)
+	}
+	options.Backup.Store = backupStore
+
+	return provisioner.NewGiteaProvisioner(cfg.GiteaEndpoint, cfg.GiteaUser, cfg.GiteaPassword, options)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/audit"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/config"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner"
+)
+
+// fakeProvisioner records the calls of the commands and returns fixed results
+type fakeProvisioner struct {
+	calls     []string
+	preflight []provisioner.PreflightCheck
+}
+
+func (f *fakeProvisioner) ProvisionRepository(namespace string, project string) (*keptn.ProvisionResponse, error) {
+	f.calls = append(f.calls, "provision "+namespace+"/"+project)
+	return &keptn.ProvisionResponse{GitRemoteURL: "http://gitea/keptn/" + project, GitUser: "keptn", GitToken: "token"}, nil
+}
+
+func (f *fakeProvisioner) DeleteRepository(namespace string, project string) error {
+	f.calls = append(f.calls, "delete "+namespace+"/"+project)
+	return nil
+}
+
+func (f *fakeProvisioner) RestoreRepository(namespace string, project string) (*keptn.ProvisionResponse, error) {
+	f.calls = append(f.calls, "restore "+namespace+"/"+project)
+	return &keptn.ProvisionResponse{GitRemoteURL: "http://gitea/keptn/" + project, GitUser: "keptn", GitToken: "restored"}, nil
+}
+
+func (f *fakeProvisioner) AdoptRepository(namespace string, project string, owner string, repository string) (*keptn.ProvisionResponse, error) {
+	f.calls = append(f.calls, "adopt "+owner+"/"+repository+" as "+namespace+"/"+project)
+	return &keptn.ProvisionResponse{GitRemoteURL: "http://gitea/keptn/" + project, GitUser: "keptn", GitToken: "adopted"}, nil
+}
+
+func (f *fakeProvisioner) TransferRepository(namespace string, targetNamespace string, project string) (*keptn.ProvisionResponse, error) {
+	f.calls = append(f.calls, "transfer "+namespace+"/"+project+" to "+targetNamespace)
+	return &keptn.ProvisionResponse{GitRemoteURL: "http://gitea/" + targetNamespace + "/" + project, GitUser: targetNamespace, GitToken: "transferred"}, nil
+}
+
+func (f *fakeProvisioner) RenameRepository(namespace string, project string, newProject string) (*keptn.RenameResponse, error) {
+	f.calls = append(f.calls, "rename "+namespace+"/"+project+" to "+newProject)
+	return &keptn.RenameResponse{
+		ProvisionResponse:    keptn.ProvisionResponse{GitRemoteURL: "http://gitea/keptn/" + newProject, GitUser: "keptn", GitToken: "renamed"},
+		PreviousGitRemoteURL: "http://gitea/keptn/" + project,
+		Redirect:             "Gitea redirects http://gitea/keptn/" + project,
+	}, nil
+}
+
+func (f *fakeProvisioner) ListProjects(namespace string) ([]provisioner.ProjectInfo, error) {
+	f.calls = append(f.calls, "list "+namespace)
+	return []provisioner.ProjectInfo{
+		{Namespace: "keptn", Project: "podtato", User: "keptn", Repository: "podtato", SizeKB: 12},
+	}, nil
+}
+
+func (f *fakeProvisioner) InspectProject(namespace string, project string) (*provisioner.ProjectInfo, error) {
+	f.calls = append(f.calls, "inspect "+namespace+"/"+project)
+	return &provisioner.ProjectInfo{Namespace: "keptn", Project: project, User: "keptn", UserExists: true, Repository: project}, nil
+}
+
+func (f *fakeProvisioner) RotateToken(namespace string, project string) (*keptn.ProvisionResponse, error) {
+	f.calls = append(f.calls, "rotate-token "+namespace+"/"+project)
+	return &keptn.ProvisionResponse{GitRemoteURL: "http://gitea/keptn/" + project, GitUser: "keptn", GitToken: "rotated"}, nil
+}
+
+func (f *fakeProvisioner) CountProjects(namespace string) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeProvisioner) Preflight(namespace string, project string) *provisioner.PreflightReport {
+	f.calls = append(f.calls, "doctor "+namespace+"/"+project)
+	return &provisioner.PreflightReport{Namespace: namespace, Project: project, Checks: f.preflight}
+}
+
+func (f *fakeProvisioner) PlanProvision(namespace string, project string) (*provisioner.Plan, error) {
+	f.calls = append(f.calls, "plan provision "+namespace+"/"+project)
+	return &provisioner.Plan{DryRun: true, Changes: []provisioner.PlannedChange{
+		{Action: provisioner.PlanCreate, Object: provisioner.ObjectRepository, Name: project},
+	}}, nil
+}
+
+func (f *fakeProvisioner) PlanDelete(namespace string, project string) (*provisioner.Plan, error) {
+	f.calls = append(f.calls, "plan delete "+namespace+"/"+project)
+	return &provisioner.Plan{DryRun: true}, nil
+}
+
+func newTestCLI(t *testing.T) (*cli, *fakeProvisioner, *bytes.Buffer) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_USER", "admin")
+	t.Setenv("GITEA_PASSWORD", "secret")
+	t.Setenv("LEASE_LOCK_ENABLED", "true")
+
+	fake := &fakeProvisioner{}
+	stdout := &bytes.Buffer{}
+	return &cli{
+		stdout: stdout,
+		stderr: &bytes.Buffer{},
+		newProvisioner: func(cfg *config.Config) (projectProvisioner, error) {
+			return fake, nil
+		},
+	}, fake, stdout
+}
+
+func TestCLI_Commands(t *testing.T) {
+	tests := []struct {
+		args []string
+		call string
+	}{
+		{args: []string{"provision", "-namespace", "dev", "-project", "podtato"}, call: "provision dev/podtato"},
+		{args: []string{"delete", "-project", "podtato"}, call: "delete /podtato"},
+		{args: []string{"restore", "-project", "podtato"}, call: "restore /podtato"},
+		{args: []string{"adopt", "-project", "podtato", "-repository", "ops/podtato-head"}, call: "adopt ops/podtato-head as /podtato"},
+		{args: []string{"transfer", "-namespace", "dev", "-project", "podtato", "-to", "prod"}, call: "transfer dev/podtato to prod"},
+		{args: []string{"rename", "-project", "podtato", "-new-project", "podtato-head"}, call: "rename /podtato to podtato-head"},
+		{args: []string{"list", "-namespace", "dev"}, call: "list dev"},
+		{args: []string{"inspect", "-project", "podtato"}, call: "inspect /podtato"},
+		{args: []string{"rotate-token", "-project", "podtato"}, call: "rotate-token /podtato"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args[0], func(t *testing.T) {
+			c, fake, stdout := newTestCLI(t)
+			require.NoError(t, c.run(tt.args))
+			assert.Equal(t, []string{tt.call}, fake.calls)
+			assert.NotEmpty(t, stdout.String())
+		})
+	}
+}
+
+func TestCLI_TableOutput(t *testing.T) {
+	c, _, stdout := newTestCLI(t)
+	require.NoError(t, c.run([]string{"list"}))
+
+	assert.Equal(t, "NAMESPACE  PROJECT  USER   REPOSITORY  SIZE (KB)\nkeptn      podtato  keptn  podtato     12\n", stdout.String())
+}
+
+func TestCLI_JSONOutput(t *testing.T) {
+	c, _, stdout := newTestCLI(t)
+	require.NoError(t, c.run([]string{"-output", "json", "rotate-token", "-project", "podtato"}))
+
+	var response keptn.ProvisionResponse
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &response))
+	assert.Equal(t, "rotated", response.GitToken)
+}
+
+func TestCLI_PolicyIsEvaluated(t *testing.T) {
+	c, fake, _ := newTestCLI(t)
+	t.Setenv("POLICY_DENIED_PROJECTS", "forbidden")
+
+	err := c.run([]string{"provision", "-project", "forbidden"})
+	var violation *provisioner.PolicyViolation
+	require.ErrorAs(t, err, &violation)
+	assert.Empty(t, fake.calls)
+}
+
+func TestCLI_InvalidUsage(t *testing.T) {
+	invalid := [][]string{
+		{},
+		{"unknown"},
+		{"inspect"},
+		{"-output", "yaml", "list"},
+		{"adopt", "-project", "podtato"},
+		{"adopt", "-project", "podtato", "-repository", "podtato-head"},
+		{"transfer", "-project", "podtato"},
+		{"rename", "-project", "podtato"},
+	}
+
+	for _, args := range invalid {
+		c, fake, _ := newTestCLI(t)
+		require.ErrorIs(t, c.run(args), errUsage)
+		assert.Empty(t, fake.calls)
+	}
+}
+
+func TestCLI_Doctor(t *testing.T) {
+	c, fake, stdout := newTestCLI(t)
+	fake.preflight = []provisioner.PreflightCheck{
+		{Name: provisioner.PreflightAdminRights, Passed: true},
+		{Name: provisioner.PreflightCloneURL, Message: "wrong host", Hint: "Set ROOT_URL"},
+		{Name: provisioner.PreflightDelete, Passed: true},
+	}
+
+	require.ErrorIs(t, c.run([]string{"doctor"}), errPreflightFailed)
+	assert.Equal(t, []string{"doctor gitea-provisioner-doctor/doctor"}, fake.calls)
+	assert.Equal(t, "CHECK         RESULT  DETAILS\n"+
+		"admin-rights  PASS    \n"+
+		"clone-url     FAIL    wrong host\n"+
+		"delete        PASS    \n"+
+		"\nHints:\n"+
+		"  clone-url: Set ROOT_URL\n", stdout.String())
+}
+
+func TestCLI_DoctorPassed(t *testing.T) {
+	c, fake, stdout := newTestCLI(t)
+	fake.preflight = []provisioner.PreflightCheck{{Name: provisioner.PreflightAdminRights, Passed: true}}
+
+	require.NoError(t, c.run([]string{"-output", "json", "doctor", "-namespace", "check"}))
+
+	var report provisioner.PreflightReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, "check", report.Namespace)
+	assert.True(t, report.Passed())
+}
+
+func TestCLI_DryRun(t *testing.T) {
+	c, fake, stdout := newTestCLI(t)
+	require.NoError(t, c.run([]string{"-dry-run", "provision", "-project", "podtato"}))
+	assert.Equal(t, []string{"plan provision /podtato"}, fake.calls)
+	assert.Equal(t, "ACTION  OBJECT      NAME     REASON\ncreate  repository  podtato  \n", stdout.String())
+
+	// The dry run of the service configuration applies as well
+	c, fake, _ = newTestCLI(t)
+	t.Setenv("DRY_RUN", "true")
+	require.NoError(t, c.run([]string{"delete", "-project", "podtato"}))
+	assert.Equal(t, []string{"plan delete /podtato"}, fake.calls)
+}
+
+func TestCLI_RestoreDryRun(t *testing.T) {
+	c, fake, _ := newTestCLI(t)
+	require.Error(t, c.run([]string{"-dry-run", "restore", "-project", "podtato"}))
+	assert.Empty(t, fake.calls)
+}
+
+func TestCLI_RotateTokenDryRun(t *testing.T) {
+	c, fake, _ := newTestCLI(t)
+	require.Error(t, c.run([]string{"-dry-run", "rotate-token", "-project", "podtato"}))
+
+	t.Setenv("DRY_RUN", "true")
+	require.Error(t, c.run([]string{"rotate-token", "-project", "podtato"}))
+	assert.Empty(t, fake.calls)
+
+	// Only the dry runs of commands that print a plan skip the lease lock guard
+	t.Setenv("LEASE_LOCK_ENABLED", "false")
+	require.ErrorIs(t, c.run([]string{"rotate-token", "-project", "podtato"}), errNotLocked)
+	require.ErrorIs(t, c.run([]string{"restore", "-project", "podtato"}), errNotLocked)
+}
+
+func TestCLI_RequiresLeaseLock(t *testing.T) {
+	c, fake, _ := newTestCLI(t)
+	t.Setenv("LEASE_LOCK_ENABLED", "false")
+
+	require.ErrorIs(t, c.run([]string{"provision", "-project", "podtato"}), errNotLocked)
+	assert.Empty(t, fake.calls)
+
+	// Read-only commands and dry runs don't modify Gitea
+	require.NoError(t, c.run([]string{"inspect", "-project", "podtato"}))
+	require.NoError(t, c.run([]string{"-dry-run", "delete", "-project", "podtato"}))
+
+	require.NoError(t, c.run([]string{"provision", "-project", "podtato", "-force"}))
+	assert.Equal(t, []string{"inspect /podtato", "plan delete /podtato", "provision /podtato"}, fake.calls)
+}
+
+func TestCLI_Audit(t *testing.T) {
+	c, _, _ := newTestCLI(t)
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("AUDIT_LOG_FILE", auditFile)
+	t.Setenv("POLICY_DENIED_PROJECTS", "forbidden")
+
+	require.NoError(t, c.run([]string{"rotate-token", "-namespace", "dev", "-project", "podtato"}))
+	require.NoError(t, c.run([]string{"list"}))
+	require.Error(t, c.run([]string{"provision", "-project", "forbidden"}))
+
+	sink, err := audit.NewFileSink(auditFile, 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	events, err := sink.Query(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	assert.Equal(t, audit.ActionRotateToken, events[0].Action)
+	assert.Equal(t, "dev", events[0].Namespace)
+	assert.Equal(t, "podtato", events[0].Project)
+	assert.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+	assert.Equal(t, "provisionerctl", events[0].UserAgent)
+
+	assert.Equal(t, audit.ActionProvision, events[1].Action)
+	assert.Equal(t, provisioner.DefaultKeptnNamespace, events[1].Namespace)
+	assert.Equal(t, audit.OutcomeRejected, events[1].Outcome)
+	assert.NotEmpty(t, events[1].Error)
+}
+
+func TestCLI_AuditRename(t *testing.T) {
+	c, _, _ := newTestCLI(t)
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("AUDIT_LOG_FILE", auditFile)
+
+	require.NoError(t, c.run([]string{"rename", "-project", "podtato", "-new-project", "podtato-head"}))
+
+	sink, err := audit.NewFileSink(auditFile, 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	events, err := sink.Query(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, audit.ActionRename, events[0].Action)
+	assert.Equal(t, "podtato", events[0].Project)
+	assert.Equal(t, "podtato-head", events[0].NewProject)
+}
+
+func TestCLI_AuditDoesNotRotate(t *testing.T) {
+	c, _, _ := newTestCLI(t)
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("AUDIT_LOG_FILE", auditFile)
+	t.Setenv("AUDIT_LOG_MAX_SIZE_MB", "1")
+
+	// The audit file of the service already exceeds the maximum size
+	sink, err := audit.NewFileSink(auditFile, 0, 0)
+	require.NoError(t, err)
+	for i := 0; i < 1024; i++ {
+		require.NoError(t, sink.Write(audit.Event{Action: audit.ActionProvision, Error: strings.Repeat("x", 1024)}))
+	}
+	require.NoError(t, sink.Close())
+
+	require.NoError(t, c.run([]string{"rotate-token", "-project", "podtato"}))
+
+	// Only the service rotates the file, the command appends its event
+	_, err = os.Stat(auditFile + ".1")
+	assert.True(t, os.IsNotExist(err))
+
+	sink, err = audit.NewFileSink(auditFile, 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	events, err := sink.Query(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1025)
+	assert.Equal(t, audit.ActionRotateToken, events[1024].Action)
+}
+
+func TestCLI_ForceDelete(t *testing.T) {
+	c, fake, _ := newTestCLI(t)
+
+	var forced bool
+	c.newProvisioner = func(cfg *config.Config) (projectProvisioner, error) {
+		forced = cfg.BackupForce
+		return fake, nil
+	}
+
+	require.NoError(t, c.run([]string{"delete", "-project", "podtato", "-force"}))
+	assert.True(t, forced)
+	assert.Equal(t, []string{"delete /podtato"}, fake.calls)
+}
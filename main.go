@@ -1,63 +1,348 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"github.com/kelseyhightower/envconfig"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/audit"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/backup"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/config"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/leader"
 	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner"
 )
 
-var /*const*/ env envConfig
-
-type envConfig struct {
-	// Port on which the provisioner listens on
-	Port int `envconfig:"RCV_PORT" default:"8080"`
-	// The GiteaEndpoint is a required environment variable that describes the URL of the Gitea endpoint
-	GiteaEndpoint string `envconfig:"GITEA_ENDPOINT" required:"true"`
-	// GiteaUser is a required environment variable, which should be the username of the admin user
-	GiteaUser string `envconfig:"GITEA_USER" required:"true"`
-	// GiteaPassword is a required environment variable, which should be the password of the admin user
-	GiteaPassword string `envconfig:"GITEA_PASSWORD" required:"true"`
-	// UsernamePrefix defines the prefix that should be used when creating users in Gitea
-	UsernamePrefix string `envconfig:"USERNAME_PREFIX"`
-	// UserEmailDomain defines the prefix that should be used when creating users in Gitea
-	UserEmailDomain string `envconfig:"USER_EMAIL_DOMAIN"`
-	// ProjectPrefix defines the prefix that should be used when creating projects in Gitea
-	ProjectPrefix string `envconfig:"PROJECT_PREFIX"`
-	// TokenPrefix defines the prefix that should be used when creating tokens in Gitea
-	TokenPrefix string `envconfig:"TOKEN_PREFIX"`
-}
+var /*const*/ env *config.Config
 
 func main() {
-	if err := envconfig.Process("", &env); err != nil {
-		log.Fatalf("Failed to process env var: %s", err)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %s", err)
+	}
+	env = cfg
+
+	var locker provisioner.NamespaceLocker = provisioner.NewKeyedMutex()
+	if env.LeaseLockEnabled {
+		leaseLocker, err := createLeaseLocker()
+		if err != nil {
+			log.Fatalf("Unable to create lease locker: %s", err)
+		}
+
+		// Requests of the same replica wait in-process before competing for the lease
+		locker = provisioner.NewChainedLocker(locker, leaseLocker)
 	}
 
-	giteaOptions := provisioner.GiteaProvisionerOptions{
-		UsernamePrefix:  env.UsernamePrefix,
-		UserEmailDomain: env.UserEmailDomain,
-		ProjectPrefix:   env.ProjectPrefix,
-		TokenPrefix:     env.TokenPrefix,
+	credentialSink, err := createCredentialSink()
+	if err != nil {
+		log.Fatalf("Unable to create credential sink: %s", err)
 	}
 
-	repoProvisioner, err := provisioner.NewGiteaProvisioner(env.GiteaEndpoint, env.GiteaUser, env.GiteaPassword, &giteaOptions)
+	backupStore, err := env.BackupStore()
+	if err != nil {
+		log.Fatalf("Unable to create backup store: %s", err)
+	}
+
+	giteaProvisioner, err := newGiteaProvisioner(env, locker, credentialSink, backupStore)
 	if err != nil {
 		log.Fatalf("Unable to create gitea provisioner: %s", err)
 	}
 
+	repoProvisioner := provisioner.NewReloadableProvisioner(giteaProvisioner)
+
+	policy, err := provisioner.NewAdmissionPolicy(env.PolicyOptions(), repoProvisioner)
+	if err != nil {
+		log.Fatalf("Unable to create admission policy: %s", err)
+	}
+
+	auditRecorder, auditQuerier, err := env.AuditRecorder()
+	if err != nil {
+		log.Fatalf("Unable to create audit trail: %s", err)
+	}
+
+	trustedProxies, err := audit.ParseTrustedProxies(env.AuditTrustedProxies)
+	if err != nil {
+		log.Fatalf("Unable to parse trusted proxies: %s", err)
+	}
+
+	eventPublisher, err := createEventPublisher()
+	if err != nil {
+		log.Fatalf("Unable to create Keptn event publisher: %s", err)
+	}
+
+	// Queued and running jobs are drained on shutdown like in-flight requests
+	operations := provisioner.NewOperationTracker()
+
+	// Jobs are kept in memory of the replica that accepted them and couldn't be polled from the other replicas, so async
+	// requests are rejected as soon as the namespaces are locked across replicas
+	var jobQueue *provisioner.JobQueue
+	if env.LeaseLockEnabled {
+		log.Printf("Async requests are rejected, jobs can't be shared between replicas if lease locking is enabled\n")
+	} else {
+		jobQueue = provisioner.NewJobQueue(env.JobOptions(operations))
+	}
+
 	provisionerHandler := provisioner.ProvisionHandler{
-		Provisioner: repoProvisioner,
+		Provisioner:    repoProvisioner,
+		Policy:         policy,
+		Audit:          auditRecorder,
+		TrustedProxies: trustedProxies,
+		Events:         eventPublisher,
+		DryRun:         env.DryRun,
+		Jobs:           jobQueue,
+	}
+
+	healthHandler := provisioner.HealthHandler{
+		Checker:       repoProvisioner,
+		CacheDuration: env.ReadinessCacheDuration,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repository", operations.Track(provisionerHandler.HandleProvisionRepoRequest))
+	mux.HandleFunc("/repository/restore", operations.Track(provisionerHandler.HandleRestoreRequest))
+	mux.HandleFunc("/repository/rename", operations.Track(provisionerHandler.HandleRenameRequest))
+	if jobQueue != nil {
+		mux.HandleFunc(provisioner.JobsPath, jobQueue.HandleJobRequest)
 	}
+	mux.HandleFunc("/healthz", healthHandler.HandleHealthz)
+	mux.HandleFunc("/readyz", healthHandler.HandleReadyz)
 
-	http.HandleFunc("/repository", provisionerHandler.HandleProvisionRepoRequest)
+	// The audit trail is only served to clients that authenticate with the query token
+	if auditQuerier != nil && env.AuditQueryToken != "" {
+		auditHandler := audit.Handler{Querier: auditQuerier, Token: env.AuditQueryToken}
+		mux.HandleFunc("/audit", auditHandler.HandleAuditRequest)
+	}
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", env.Port),
+		Handler: mux,
+	}
+
+	elector, err := createElector()
+	if err != nil {
+		log.Fatalf("Unable to create leader elector: %s", err)
+	}
+
+	// A dry run only reads from Gitea, so the jobs that delete users, tokens or repositories are skipped
+	scheduler := leader.Scheduler{ReadOnly: env.DryRun}
+	scheduler.Add(leader.Job{Name: "orphan-cleanup", Interval: env.OrphanCleanupInterval, Run: repoProvisioner.CleanupOrphanedUsers, Modifies: true})
+	scheduler.Add(leader.Job{Name: "token-sweep", Interval: env.TokenSweepInterval, Run: repoProvisioner.SweepStaleTokens, Modifies: true})
+	scheduler.Add(leader.Job{Name: "inventory", Interval: env.InventoryInterval, Run: repoProvisioner.LogInventory})
+	scheduler.Add(leader.Job{Name: "graveyard-purge", Interval: env.GraveyardPurgeInterval, Run: repoProvisioner.PurgeGraveyard, Modifies: true})
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	backgroundDone := make(chan struct{})
+	go func() {
+		defer close(backgroundDone)
+		elector.Run(backgroundCtx, scheduler.Run)
+	}()
 
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", env.Port), nil); err != nil {
-		log.Fatalf("Failed to serve git provisioning service at endpoint: %s", err)
+	// The workers are stopped with the background jobs, after the queued jobs have been drained
+	if jobQueue != nil {
+		go jobQueue.Run(backgroundCtx)
+	}
+
+	if env.Reloadable() {
+		// Restart-required changes are only reported once, relative to the last applied configuration
+		applied := env
+		watcher := config.Watcher{
+			Interval: env.ConfigReloadInterval,
+			Load:     config.Load,
+			Current:  env,
+			Apply: func(newConfig *config.Config) error {
+				if err := reloadProvisioner(repoProvisioner, locker, credentialSink, backupStore, applied, newConfig); err != nil {
+					return err
+				}
+
+				applied = newConfig
+				return nil
+			},
+		}
+
+		go watcher.Run(backgroundCtx)
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to serve git provisioning service at endpoint: %s", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+
+	log.Printf("Received signal %s, draining in-flight requests for up to %s\n", sig, env.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), env.ShutdownTimeout)
+	defer cancel()
+
+	// Shutdown stops accepting new connections and waits until the in-flight requests have finished or the timeout
+	// expired. Afterwards, the tracker waits for the async jobs, which outlive their requests, and reports the
+	// operations that are abandoned.
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Unable to gracefully shut down http server: %s\n", err)
+	}
+
+	for _, operation := range operations.Wait(ctx) {
+		log.Printf("Abandoned in-flight operation: %s\n", operation)
+	}
+
+	// The audit webhook and Keptn events of the drained operations are still queued
+	if auditRecorder != nil {
+		if err := auditRecorder.Flush(ctx); err != nil {
+			log.Printf("Unable to send all audit events: %s\n", err)
+		}
+	}
+
+	if eventPublisher != nil {
+		if err := eventPublisher.Flush(ctx); err != nil {
+			log.Printf("Unable to publish all Keptn events: %s\n", err)
+		}
+	}
+
+	// Stop the background jobs and release the leadership such that another replica can take over immediately
+	stopBackground()
+	select {
+	case <-backgroundDone:
+	case <-ctx.Done():
+		log.Printf("Background jobs did not stop in time: %s\n", scheduler.Jobs())
 	}
 
 	os.Exit(0)
 }
+
+// newGiteaProvisioner creates a provisioner from the given configuration, the locker, credential sink and backup store
+// are shared between all provisioners that are created on reload
+func newGiteaProvisioner(cfg *config.Config, locker provisioner.NamespaceLocker, credentialSink provisioner.CredentialSink, backupStore backup.Store) (*provisioner.GiteaProvisioner, error) {
+	options := cfg.GiteaProvisionerOptions(locker)
+	options.CredentialSink = credentialSink
+	options.Backup.Store = backupStore
+
+	return provisioner.NewGiteaProvisioner(cfg.GiteaEndpoint, cfg.GiteaUser, cfg.GiteaPassword, options)
+}
+
+// reloadProvisioner creates a provisioner from the new configuration and swaps it in, in-flight operations finish
+// with the previous provisioner while sharing the same locker. The settings that changed since the applied
+// configuration but require a restart are logged.
+func reloadProvisioner(repoProvisioner *provisioner.ReloadableProvisioner, locker provisioner.NamespaceLocker, credentialSink provisioner.CredentialSink, backupStore backup.Store, applied *config.Config, newConfig *config.Config) error {
+	giteaProvisioner, err := newGiteaProvisioner(newConfig, locker, credentialSink, backupStore)
+	if err != nil {
+		return fmt.Errorf("unable to create gitea provisioner: %w", err)
+	}
+
+	repoProvisioner.Swap(giteaProvisioner)
+
+	if changes := applied.RestartRequiredChanges(newConfig); len(changes) > 0 {
+		log.Printf("Changed settings %s are only applied after a restart\n", strings.Join(changes, ", "))
+	}
+
+	return nil
+}
+
+// createKubernetesClient creates a Kubernetes client using the in-cluster configuration
+func createKubernetesClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load in-cluster config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kubernetes client: %w", err)
+	}
+
+	return clientset, nil
+}
+
+// replicaIdentity returns the name of the pod, which uniquely identifies the replica when competing for leases
+func replicaIdentity() (string, error) {
+	if env.PodName != "" {
+		return env.PodName, nil
+	}
+
+	identity, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// createLeaseLocker creates a provisioner.LeaseLocker using the in-cluster Kubernetes configuration
+func createLeaseLocker() (*provisioner.LeaseLocker, error) {
+	clientset, err := createKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := replicaIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	return provisioner.NewLeaseLocker(clientset, env.PodNamespace, identity, env.LeaseLockDuration, env.LeaseLockTimeout), nil
+}
+
+// createCredentialSink creates the provisioner.CredentialSink that receives a copy of the provisioned credentials, nil
+// is returned if no sink is enabled
+func createCredentialSink() (provisioner.CredentialSink, error) {
+	if !env.CredentialSecretsEnabled {
+		return nil, nil
+	}
+
+	clientset, err := createKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := env.CredentialSecretsNamespace
+	if namespace == "" {
+		namespace = env.PodNamespace
+	}
+
+	sink, err := provisioner.NewKubernetesSecretSink(clientset, namespace, env.CredentialSecretsNameTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// createEventPublisher creates the keptn.EventPublisher for the upstream lifecycle events, nil is returned if no Keptn
+// API endpoint is configured
+func createEventPublisher() (*keptn.EventPublisher, error) {
+	if env.KeptnAPIEndpoint == "" {
+		return nil, nil
+	}
+
+	return keptn.NewEventPublisher(env.KeptnAPIEndpoint, env.KeptnAPIToken)
+}
+
+// createElector creates the leader.Elector which decides whether this replica runs the background jobs
+func createElector() (leader.Elector, error) {
+	if !env.LeaderElectionEnabled {
+		return leader.AlwaysLeader{}, nil
+	}
+
+	clientset, err := createKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := replicaIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	return leader.NewLeaseElector(clientset, env.PodNamespace, env.LeaderElectionLeaseName, identity, env.LeaderElectionLeaseDuration), nil
+}
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// ErrQueueFull indicates that an event has been dropped because the queue of an AsyncSink is full
+var /*const*/ ErrQueueFull = errors.New("the audit event queue is full")
+
+// DefaultAsyncQueueSize limits the number of events an AsyncSink buffers if no size is configured
+const DefaultAsyncQueueSize = 1000
+
+// AsyncSink writes the events into another sink in the background, such that a slow sink, e.g. a WebhookSink, doesn't
+// delay the request that is recorded
+type AsyncSink struct {
+	sink   Sink
+	events chan Event
+	// pending counts the queued events and the event that is being written, idle is signalled once it drops to 0
+	mutex   sync.Mutex
+	idle    *sync.Cond
+	pending int
+}
+
+// NewAsyncSink creates an AsyncSink that buffers up to queueSize events for the given sink, DefaultAsyncQueueSize is
+// used if queueSize is 0. The events are written by a goroutine that runs for the lifetime of the process.
+func NewAsyncSink(sink Sink, queueSize int) *AsyncSink {
+	if queueSize <= 0 {
+		queueSize = DefaultAsyncQueueSize
+	}
+
+	async := &AsyncSink{
+		sink:   sink,
+		events: make(chan Event, queueSize),
+	}
+	async.idle = sync.NewCond(&async.mutex)
+
+	go async.run()
+
+	return async
+}
+
+// run writes the queued events into the sink, failures are logged since the request has already been answered
+func (a *AsyncSink) run() {
+	for event := range a.events {
+		if err := a.sink.Write(event); err != nil {
+			log.Printf("Unable to write audit event of %s for project %s: %s\n", event.Action, event.Project, err)
+		}
+
+		a.done()
+	}
+}
+
+// Write queues the event, ErrQueueFull is returned if the event has been dropped
+func (a *AsyncSink) Write(event Event) error {
+	a.mutex.Lock()
+	a.pending++
+	a.mutex.Unlock()
+
+	select {
+	case a.events <- event:
+		return nil
+	default:
+		a.done()
+		return ErrQueueFull
+	}
+}
+
+// done removes an event from the pending events
+func (a *AsyncSink) done() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.pending--
+	if a.pending == 0 {
+		a.idle.Broadcast()
+	}
+}
+
+// Flush waits until all queued events have been written or the context is done
+func (a *AsyncSink) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		for a.pending > 0 {
+			a.idle.Wait()
+		}
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
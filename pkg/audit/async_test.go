@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSink records the events once it has been released
+type blockingSink struct {
+	release chan struct{}
+	mutex   sync.Mutex
+	events  []Event
+}
+
+func (b *blockingSink) Write(event Event) error {
+	<-b.release
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.events = append(b.events, event)
+	return nil
+}
+
+func TestAsyncSink_Write(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	async := NewAsyncSink(sink, 1)
+
+	// The first event is taken by the writer, the second one waits in the queue
+	require.NoError(t, async.Write(Event{Project: "one"}))
+	require.Eventually(t, func() bool {
+		return len(async.events) == 0
+	}, 5*time.Second, 5*time.Millisecond)
+	require.NoError(t, async.Write(Event{Project: "two"}))
+	assert.ErrorIs(t, async.Write(Event{Project: "three"}), ErrQueueFull)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, async.Flush(ctx), context.DeadlineExceeded)
+
+	close(sink.release)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, NewRecorder(async).Flush(ctx))
+
+	require.Len(t, sink.events, 2)
+	assert.Equal(t, "one", sink.events[0].Project)
+	assert.Equal(t, "two", sink.events[1].Project)
+}
@@ -0,0 +1,226 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Actions that are recorded in the audit trail
+const (
+	ActionProvision = "provision"
+	ActionDelete    = "delete"
+	ActionRestore   = "restore"
+	ActionRename    = "rename"
+	// ActionAdopt, ActionTransfer and ActionRotateToken are only performed by provisionerctl
+	ActionAdopt       = "adopt"
+	ActionTransfer    = "transfer"
+	ActionRotateToken = "rotate-token"
+)
+
+// Outcomes of a recorded request
+const (
+	// OutcomeSuccess indicates that the request succeeded
+	OutcomeSuccess = "success"
+	// OutcomeRejected indicates that the request was rejected without modifying Gitea, e.g. because of a policy
+	OutcomeRejected = "rejected"
+	// OutcomeFailed indicates that the request failed, Gitea might have been modified partially
+	OutcomeFailed = "failed"
+)
+
+// Event is a single entry of the audit trail
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// DryRun is true if the request only computed a plan without modifying Gitea
+	DryRun bool `json:"dryRun,omitempty"`
+	// Caller is the identity of the caller as forwarded by a trusted authenticating proxy, empty if unknown
+	Caller    string `json:"caller,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	// SourceIP is the address of the peer, ForwardedFor contains the X-Forwarded-For header if set
+	SourceIP     string `json:"sourceIP"`
+	ForwardedFor string `json:"forwardedFor,omitempty"`
+	Namespace    string `json:"namespace"`
+	Project      string `json:"project"`
+	// NewProject is the project a rename moved the repository to
+	NewProject string `json:"newProject,omitempty"`
+	Outcome    string `json:"outcome"`
+	StatusCode int    `json:"statusCode"`
+	Error      string `json:"error,omitempty"`
+	// GiteaUser, GiteaRepository and GiteaAccessToken are the names of the Gitea objects the request touched
+	GiteaUser        string `json:"giteaUser,omitempty"`
+	GiteaRepository  string `json:"giteaRepository,omitempty"`
+	GiteaAccessToken string `json:"giteaAccessToken,omitempty"`
+}
+
+// Sink receives every event of the audit trail
+type Sink interface {
+	Write(event Event) error
+}
+
+// Filter selects events of the audit trail, empty fields match all events
+type Filter struct {
+	Namespace string
+	// Since and Until are inclusive bounds of the event time
+	Since time.Time
+	Until time.Time
+}
+
+// Matches returns true if the event is selected by the filter
+func (f Filter) Matches(event Event) bool {
+	if f.Namespace != "" && event.Namespace != f.Namespace {
+		return false
+	}
+
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && event.Time.After(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+// flusher is a Sink that writes its events in the background
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Querier returns the events of the audit trail that match the filter in chronological order
+type Querier interface {
+	Query(filter Filter) ([]Event, error)
+}
+
+// Recorder writes the events of the audit trail into all of its sinks
+type Recorder struct {
+	sinks []Sink
+}
+
+// NewRecorder creates a Recorder that writes into the given sinks
+func NewRecorder(sinks ...Sink) *Recorder {
+	return &Recorder{sinks: sinks}
+}
+
+// Record writes the event into all sinks, a failing sink doesn't prevent the event from being written into the others
+func (r *Recorder) Record(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	for _, sink := range r.sinks {
+		if err := sink.Write(event); err != nil {
+			log.Printf("Unable to write audit event of %s for project %s: %s\n", event.Action, event.Project, err)
+		}
+	}
+}
+
+// Flush waits until the sinks that write in the background have written all events or the context is done
+func (r *Recorder) Flush(ctx context.Context) error {
+	for _, sink := range r.sinks {
+		if flusher, ok := sink.(flusher); ok {
+			if err := flusher.Flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// TrustedProxies are the networks of the authenticating proxies in front of the service, only requests from these
+// networks may set the caller of an event
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR ranges
+func ParseTrustedProxies(values []string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s", value)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %w", value, err)
+		}
+
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+// Contains returns true if the given IP address belongs to a trusted proxy
+func (t TrustedProxies) Contains(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewEvent creates an event for the given action and fills in the caller information from the request. The caller
+// identity is taken from the X-Forwarded-User or X-Remote-User header, which is only trusted if the request has been
+// sent by one of the trusted proxies. Any client can set these headers, so the caller stays empty without proxies.
+func NewEvent(action string, req *http.Request, trustedProxies TrustedProxies) Event {
+	sourceIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		sourceIP = req.RemoteAddr
+	}
+
+	var caller string
+	if trustedProxies.Contains(sourceIP) {
+		caller = req.Header.Get("X-Forwarded-User")
+		if caller == "" {
+			caller = req.Header.Get("X-Remote-User")
+		}
+	}
+
+	return Event{
+		Time:         time.Now().UTC(),
+		Action:       action,
+		Caller:       caller,
+		UserAgent:    req.UserAgent(),
+		SourceIP:     sourceIP,
+		ForwardedFor: strings.TrimSpace(req.Header.Get("X-Forwarded-For")),
+	}
+}
+
+// OutcomeOf returns the outcome of a request with the given status code, 424 indicates a failure of Gitea and is
+// therefore not considered a rejection
+func OutcomeOf(statusCode int) string {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return OutcomeSuccess
+	case statusCode >= 400 && statusCode < 500 && statusCode != http.StatusFailedDependency:
+		return OutcomeRejected
+	default:
+		return OutcomeFailed
+	}
+}
@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// FileSink appends the events as JSON lines to a file. Once the file exceeds its maximum size, it is rotated to
+// <path>.1, existing backups are shifted and the oldest backup beyond maxBackups is deleted.
+type FileSink struct {
+	mutex      sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileSink opens or creates the audit file at the given path, a maxSize of 0 disables the rotation
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	sink := &FileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// open opens the audit file in append mode and determines its current size
+func (f *FileSink) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open audit file %s: %w", f.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to stat audit file %s: %w", f.path, err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write appends the event to the audit file, the file is rotated first if the event would exceed its maximum size
+func (f *FileSink) Write(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	written, err := f.file.Write(line)
+	f.size += int64(written)
+	if err != nil {
+		return fmt.Errorf("unable to write audit file %s: %w", f.path, err)
+	}
+
+	return nil
+}
+
+// rotate shifts all backups by one, moves the current file to the first backup and opens a new file
+func (f *FileSink) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("unable to close audit file %s: %w", f.path, err)
+	}
+
+	if f.maxBackups > 0 {
+		for index := f.maxBackups - 1; index > 0; index-- {
+			err := os.Rename(f.backupPath(index), f.backupPath(index+1))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("unable to rotate audit file %s: %w", f.backupPath(index), err)
+			}
+		}
+
+		if err := os.Rename(f.path, f.backupPath(1)); err != nil {
+			return fmt.Errorf("unable to rotate audit file %s: %w", f.path, err)
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return fmt.Errorf("unable to rotate audit file %s: %w", f.path, err)
+	}
+
+	return f.open()
+}
+
+// backupPath returns the path of the backup with the given index, 1 is the most recent backup
+func (f *FileSink) backupPath(index int) string {
+	return fmt.Sprintf("%s.%d", f.path, index)
+}
+
+// Query reads the backups and the current audit file and returns all events that match the filter, oldest first
+func (f *FileSink) Query(filter Filter) ([]Event, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	paths := make([]string, 0, f.maxBackups+1)
+	for index := f.maxBackups; index > 0; index-- {
+		paths = append(paths, f.backupPath(index))
+	}
+	paths = append(paths, f.path)
+
+	events := []Event{}
+	for _, path := range paths {
+		matches, err := readEvents(path, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, matches...)
+	}
+
+	return events, nil
+}
+
+// Close closes the audit file
+func (f *FileSink) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.file.Close()
+}
+
+// readEvents returns the events of a single audit file that match the filter, a missing file contains no events
+func readEvents(path string, filter Filter) ([]Event, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// e.g. a line that has been cut off by a crash, the remaining events are still returned
+			log.Printf("Skipping invalid line in audit file %s: %s\n", path, err)
+			continue
+		}
+
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read audit file %s: %w", path, err)
+	}
+
+	return events, nil
+}
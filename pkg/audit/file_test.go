@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink_WriteAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path, 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	start := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, sink.Write(Event{Time: start, Action: ActionProvision, Namespace: "keptn", Project: "one"}))
+	require.NoError(t, sink.Write(Event{Time: start.Add(time.Hour), Action: ActionProvision, Namespace: "other", Project: "two"}))
+	require.NoError(t, sink.Write(Event{Time: start.Add(2 * time.Hour), Action: ActionDelete, Namespace: "keptn", Project: "one"}))
+
+	events, err := sink.Query(Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "one", events[0].Project)
+	assert.Equal(t, ActionDelete, events[2].Action)
+
+	events, err = sink.Query(Filter{Namespace: "keptn"})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	events, err = sink.Query(Filter{Since: start.Add(time.Hour), Until: start.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "two", events[0].Project)
+}
+
+func TestFileSink_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	// Every event is larger than the maximum size, such that the file is rotated before every write
+	sink, err := NewFileSink(path, 10, 2)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	for _, project := range []string{"one", "two", "three", "four"} {
+		require.NoError(t, sink.Write(Event{Action: ActionProvision, Namespace: "keptn", Project: project}))
+	}
+
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	events, err := sink.Query(Filter{})
+	require.NoError(t, err)
+
+	var projects []string
+	for _, event := range events {
+		projects = append(projects, event.Project)
+	}
+	assert.Equal(t, []string{"two", "three", "four"}, projects)
+}
+
+func TestFileSink_AppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, ioutil.WriteFile(path, []byte("{\"project\":\"existing\"}\n{\"project\":\"cut\n"), 0600))
+
+	sink, err := NewFileSink(path, 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(Event{Project: "new"}))
+
+	// The invalid line is skipped
+	events, err := sink.Query(Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "existing", events[0].Project)
+	assert.Equal(t, "new", events[1].Project)
+}
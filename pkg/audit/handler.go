@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handler serves the audit trail of a Querier
+type Handler struct {
+	Querier Querier
+	// Token has to be sent as bearer token, the audit trail reveals the callers and projects of all namespaces
+	Token string
+}
+
+// HandleAuditRequest returns the events that match the query parameters namespace, since and until (RFC 3339) as
+// JSON array, oldest first. The following status codes are generated:
+//   - 200	With the matching events
+//   - 400	If since or until is not a valid RFC 3339 timestamp
+//   - 401	If the request doesn't contain the token as bearer token, or no token is configured
+//   - 405	If the method is not GET
+//   - 500	If the audit trail can't be read
+func (h *Handler) HandleAuditRequest(w http.ResponseWriter, req *http.Request) {
+	if !h.authorized(req) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseFilter(req)
+	if err != nil {
+		log.Printf("Invalid audit query: %s\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.Querier.Query(filter)
+	if err != nil {
+		log.Printf("Unable to query audit trail: %s\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, err := json.Marshal(events)
+	if err != nil {
+		log.Printf("Unable to marshal reponse: %s\n", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Encountered error while writing response body: %s\n", err.Error())
+	}
+}
+
+// authorized returns true if the request contains the configured token, requests are never authorized without token
+func (h *Handler) authorized(req *http.Request) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if h.Token == "" || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) == 1
+}
+
+// parseFilter creates the Filter from the query parameters of the request
+func parseFilter(req *http.Request) (Filter, error) {
+	query := req.URL.Query()
+	filter := Filter{Namespace: query.Get("namespace")}
+
+	bounds := []struct {
+		name   string
+		target *time.Time
+	}{
+		{name: "since", target: &filter.Since},
+		{name: "until", target: &filter.Until},
+	}
+
+	for _, bound := range bounds {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid %s: %w", bound.name, err)
+		}
+
+		*bound.target = parsed
+	}
+
+	return filter, nil
+}
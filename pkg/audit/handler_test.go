@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_HandleAuditRequest(t *testing.T) {
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	start := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, sink.Write(Event{Time: start, Action: ActionProvision, Namespace: "keptn", Project: "one"}))
+	require.NoError(t, sink.Write(Event{Time: start.Add(time.Hour), Action: ActionProvision, Namespace: "keptn", Project: "two"}))
+	require.NoError(t, sink.Write(Event{Time: start.Add(time.Hour), Action: ActionProvision, Namespace: "other", Project: "three"}))
+
+	handler := Handler{Querier: sink, Token: "secret"}
+
+	request := httptest.NewRequest(http.MethodGet, "/audit?namespace=keptn&since=2022-03-01T12:30:00Z", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response := httptest.NewRecorder()
+	handler.HandleAuditRequest(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var events []Event
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, "two", events[0].Project)
+
+	// No match returns an empty list
+	request = httptest.NewRequest(http.MethodGet, "/audit?until=2022-01-01T00:00:00Z", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response = httptest.NewRecorder()
+	handler.HandleAuditRequest(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "[]", response.Body.String())
+
+	request = httptest.NewRequest(http.MethodGet, "/audit?since=yesterday", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response = httptest.NewRecorder()
+	handler.HandleAuditRequest(response, request)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	request = httptest.NewRequest(http.MethodDelete, "/audit", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response = httptest.NewRecorder()
+	handler.HandleAuditRequest(response, request)
+	assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+}
+
+func TestHandler_Unauthorized(t *testing.T) {
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+	}{
+		{name: "missing token", token: "secret"},
+		{name: "wrong token", token: "secret", authorization: "Bearer other"},
+		{name: "no configured token", authorization: "Bearer "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := Handler{Querier: sink, Token: test.token}
+
+			request := httptest.NewRequest(http.MethodGet, "/audit", nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			response := httptest.NewRecorder()
+			handler.HandleAuditRequest(response, request)
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		})
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/repository", nil)
+	request.RemoteAddr = "10.0.0.1:43210"
+	request.Header.Set("X-Forwarded-User", "alice")
+	request.Header.Set("X-Forwarded-For", "192.168.0.1")
+	request.Header.Set("User-Agent", "shipyard-controller")
+
+	trustedProxies, err := ParseTrustedProxies([]string{"10.0.0.0/24", "fd00::1"})
+	require.NoError(t, err)
+
+	event := NewEvent(ActionProvision, request, trustedProxies)
+	assert.Equal(t, "alice", event.Caller)
+	assert.Equal(t, "10.0.0.1", event.SourceIP)
+	assert.Equal(t, "192.168.0.1", event.ForwardedFor)
+	assert.Equal(t, "shipyard-controller", event.UserAgent)
+
+	// Any other client can forge the caller headers
+	request.RemoteAddr = "10.0.1.1:43210"
+	event = NewEvent(ActionProvision, request, trustedProxies)
+	assert.Empty(t, event.Caller)
+	assert.Empty(t, NewEvent(ActionProvision, request, nil).Caller)
+
+	request.RemoteAddr = "[fd00::1]:43210"
+	request.Header.Del("X-Forwarded-User")
+	request.Header.Set("X-Remote-User", "bob")
+	assert.Equal(t, "bob", NewEvent(ActionProvision, request, trustedProxies).Caller)
+
+	_, err = ParseTrustedProxies([]string{"proxy"})
+	require.Error(t, err)
+
+	assert.Equal(t, OutcomeSuccess, OutcomeOf(http.StatusCreated))
+	assert.Equal(t, OutcomeRejected, OutcomeOf(http.StatusConflict))
+	assert.Equal(t, OutcomeFailed, OutcomeOf(http.StatusFailedDependency))
+}
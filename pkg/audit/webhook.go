@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// DefaultWebhookTimeout is the timeout of a single webhook request if no client is configured
+const DefaultWebhookTimeout = 5 * time.Second
+
+// WebhookSink posts every event as JSON to an HTTP endpoint, e.g. of a SIEM
+type WebhookSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewWebhookSink creates a WebhookSink that posts to the given URL. If token is set, it is sent as bearer token. The
+// client may be nil, in which case a client with DefaultWebhookTimeout is used.
+func NewWebhookSink(url string, token string, client *http.Client) *WebhookSink {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+
+	return &WebhookSink{
+		url:    url,
+		token:  token,
+		client: client,
+	}
+}
+
+// Write posts the event to the webhook, every status code except 2xx is considered a failure
+func (w *WebhookSink) Write(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to marshal audit event: %w", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create audit webhook request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if w.token != "" {
+		request.Header.Set("Authorization", "Bearer "+w.token)
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("unable to send audit event: %w", err)
+	}
+	defer response.Body.Close()
+
+	// Drain the body such that the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook returned unexpected status code %d", response.StatusCode)
+	}
+
+	return nil
+}
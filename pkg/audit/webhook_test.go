@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSink_Write(t *testing.T) {
+	var received []Event
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+
+		var event Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received = append(received, event)
+
+		if event.Project == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, "secret", nil)
+
+	require.NoError(t, sink.Write(Event{Action: ActionProvision, Namespace: "keptn", Project: "project"}))
+	require.Error(t, sink.Write(Event{Action: ActionProvision, Namespace: "keptn", Project: "fail"}))
+
+	require.Len(t, received, 2)
+	assert.Equal(t, "project", received[0].Project)
+	assert.Equal(t, "Bearer secret", authorization)
+}
+
+func TestRecorder_FailingSink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	fileSink, err := NewFileSink(t.TempDir()+"/audit.jsonl", 0, 0)
+	require.NoError(t, err)
+	defer fileSink.Close()
+
+	// The event is written into the file although the webhook fails
+	recorder := NewRecorder(NewWebhookSink(server.URL, "", nil), fileSink)
+	recorder.Record(Event{Action: ActionDelete, Namespace: "keptn", Project: "project"})
+
+	events, err := fileSink.Query(Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.False(t, events[0].Time.IsZero())
+}
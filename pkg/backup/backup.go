@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound indicates that the store has no object with the given key or no backup of a project
+var /*const*/ ErrNotFound = errors.New("backup not found")
+
+// keyTimeFormat is the format of the deletion time that is part of the keys of a backup
+const keyTimeFormat = "20060102T150405Z"
+
+// Manifest describes a backup, it is written next to the bundle once the bundle has been stored
+type Manifest struct {
+	Namespace  string    `json:"namespace"`
+	Project    string    `json:"project"`
+	Owner      string    `json:"owner"`
+	Repository string    `json:"repository"`
+	DeletedAt  time.Time `json:"deletedAt"`
+	// Bundle is the key of the git bundle, it is empty if the repository had no commits
+	Bundle string `json:"bundle,omitempty"`
+}
+
+// Store persists the files of a backup
+type Store interface {
+	// Put writes the content under the given key, an existing object is replaced
+	Put(ctx context.Context, key string, content io.ReadSeeker) error
+	// Get opens the object of the key, ErrNotFound is returned if it doesn't exist
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns the keys that start with the given prefix in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Source is the repository that is exported, Username and Password authenticate the mirror clone
+type Source struct {
+	CloneURL string
+	Username string
+	Password string
+	// Empty repositories have no commits and can't be bundled
+	Empty bool
+}
+
+// BundleFunc writes a git bundle with all references of the source into the given file
+type BundleFunc func(ctx context.Context, source Source, file string) error
+
+// PushFunc pushes all branches and tags of the git bundle in file into the empty target repository
+type PushFunc func(ctx context.Context, file string, target Source) error
+
+// keyPrefix returns the common prefix of the keys of a backup, <namespace>/<project>/<deletion time>
+func keyPrefix(manifest Manifest) string {
+	return path.Join(manifest.Namespace, manifest.Project, manifest.DeletedAt.UTC().Format(keyTimeFormat))
+}
+
+// Export bundles the source with the given BundleFunc and writes the bundle and the manifest into the store. The
+// manifest is written last, such that only complete backups have a manifest.
+func Export(ctx context.Context, store Store, bundle BundleFunc, manifest Manifest, source Source) (*Manifest, error) {
+	prefix := keyPrefix(manifest)
+
+	if !source.Empty {
+		directory, err := ioutil.TempDir("", "gitea-backup-")
+		if err != nil {
+			return nil, fmt.Errorf("unable to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(directory)
+
+		file := filepath.Join(directory, "repository.bundle")
+		if err := bundle(ctx, source, file); err != nil {
+			return nil, err
+		}
+
+		content, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open bundle: %w", err)
+		}
+		defer content.Close()
+
+		manifest.Bundle = prefix + ".bundle"
+		if err := store.Put(ctx, manifest.Bundle, content); err != nil {
+			return nil, fmt.Errorf("unable to store bundle %s: %w", manifest.Bundle, err)
+		}
+	}
+
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal backup manifest: %w", err)
+	}
+
+	if err := store.Put(ctx, prefix+".json", bytes.NewReader(encoded)); err != nil {
+		return nil, fmt.Errorf("unable to store backup manifest %s.json: %w", prefix, err)
+	}
+
+	return &manifest, nil
+}
+
+// LatestManifest returns the manifest of the most recent backup of the project, ErrNotFound is returned if the project
+// has no backup. The deletion time is part of the keys, such that the last key in lexical order is the latest backup.
+func LatestManifest(ctx context.Context, store Store, namespace string, project string) (*Manifest, error) {
+	prefix := path.Join(namespace, project) + "/"
+
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list backups of project %s: %w", project, err)
+	}
+
+	latest := ""
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		if strings.HasSuffix(name, ".json") && !strings.Contains(name, "/") && key > latest {
+			latest = key
+		}
+	}
+
+	if latest == "" {
+		return nil, ErrNotFound
+	}
+
+	content, err := store.Get(ctx, latest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read backup manifest %s: %w", latest, err)
+	}
+	defer content.Close()
+
+	manifest := &Manifest{}
+	if err := json.NewDecoder(content).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("unable to decode backup manifest %s: %w", latest, err)
+	}
+
+	return manifest, nil
+}
+
+// Import downloads the bundle of the manifest and pushes it into the target repository with the given PushFunc,
+// backups of repositories without commits have no bundle and leave the target empty
+func Import(ctx context.Context, store Store, push PushFunc, manifest Manifest, target Source) error {
+	if manifest.Bundle == "" {
+		return nil
+	}
+
+	content, err := store.Get(ctx, manifest.Bundle)
+	if err != nil {
+		return fmt.Errorf("unable to read bundle %s: %w", manifest.Bundle, err)
+	}
+	defer content.Close()
+
+	directory, err := ioutil.TempDir("", "gitea-restore-")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(directory)
+
+	file := filepath.Join(directory, "repository.bundle")
+	bundle, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("unable to create bundle file: %w", err)
+	}
+
+	if _, err := io.Copy(bundle, content); err != nil {
+		bundle.Close()
+		return fmt.Errorf("unable to download bundle %s: %w", manifest.Bundle, err)
+	}
+
+	if err := bundle.Close(); err != nil {
+		return fmt.Errorf("unable to download bundle %s: %w", manifest.Bundle, err)
+	}
+
+	return push(ctx, file, target)
+}
@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBundle is a BundleFunc that writes a fixed content instead of invoking git
+func writeBundle(ctx context.Context, source Source, file string) error {
+	return ioutil.WriteFile(file, []byte("bundle of "+source.CloneURL), 0600)
+}
+
+func TestExport(t *testing.T) {
+	directory := t.TempDir()
+	store, err := NewLocalStore(directory)
+	require.NoError(t, err)
+
+	manifest := Manifest{
+		Namespace:  "keptn",
+		Project:    "podtato",
+		Owner:      "keptn",
+		Repository: "podtato",
+		DeletedAt:  time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC),
+	}
+
+	exported, err := Export(context.Background(), store, writeBundle, manifest, Source{CloneURL: "http://gitea/keptn/podtato.git"})
+	require.NoError(t, err)
+	assert.Equal(t, "keptn/podtato/20220301T123000Z.bundle", exported.Bundle)
+
+	bundle, err := ioutil.ReadFile(filepath.Join(directory, "keptn", "podtato", "20220301T123000Z.bundle"))
+	require.NoError(t, err)
+	assert.Equal(t, "bundle of http://gitea/keptn/podtato.git", string(bundle))
+
+	content, err := ioutil.ReadFile(filepath.Join(directory, "keptn", "podtato", "20220301T123000Z.json"))
+	require.NoError(t, err)
+
+	var stored Manifest
+	require.NoError(t, json.Unmarshal(content, &stored))
+	assert.Equal(t, *exported, stored)
+}
+
+func TestExport_EmptyRepository(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	failingBundle := func(ctx context.Context, source Source, file string) error {
+		return errors.New("empty repositories can't be bundled")
+	}
+
+	exported, err := Export(context.Background(), store, failingBundle, Manifest{Namespace: "keptn", Project: "podtato"}, Source{Empty: true})
+	require.NoError(t, err)
+	assert.Empty(t, exported.Bundle)
+}
+
+func TestExport_BundleFails(t *testing.T) {
+	directory := t.TempDir()
+	store, err := NewLocalStore(directory)
+	require.NoError(t, err)
+
+	failingBundle := func(ctx context.Context, source Source, file string) error {
+		return errors.New("repository not found")
+	}
+
+	_, err = Export(context.Background(), store, failingBundle, Manifest{Namespace: "keptn", Project: "podtato"}, Source{})
+	require.Error(t, err)
+
+	// No manifest is written for an incomplete backup
+	files, err := filepath.Glob(filepath.Join(directory, "keptn", "podtato", "*"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestLocalStore_InvalidKey(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	assert.Error(t, store.Put(context.Background(), "../escape.json", nil))
+}
+
+func TestLocalStore_GetAndList(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put(context.Background(), "keptn/podtato/20220301T123000Z.json", strings.NewReader("{}")))
+	require.NoError(t, store.Put(context.Background(), "keptn/podtato-2/20220301T123000Z.json", strings.NewReader("{}")))
+
+	keys, err := store.List(context.Background(), "keptn/podtato/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"keptn/podtato/20220301T123000Z.json"}, keys)
+
+	content, err := store.Get(context.Background(), keys[0])
+	require.NoError(t, err)
+	defer content.Close()
+
+	body, err := ioutil.ReadAll(content)
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(body))
+
+	_, err = store.Get(context.Background(), "keptn/podtato/missing.json")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLatestManifest(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, deletedAt := range []time.Time{
+		time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC),
+		time.Date(2022, 4, 1, 8, 0, 0, 0, time.UTC),
+	} {
+		_, err := Export(context.Background(), store, writeBundle, Manifest{Namespace: "keptn", Project: "podtato", DeletedAt: deletedAt}, Source{})
+		require.NoError(t, err)
+	}
+
+	manifest, err := LatestManifest(context.Background(), store, "keptn", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, "keptn/podtato/20220401T080000Z.bundle", manifest.Bundle)
+
+	_, err = LatestManifest(context.Background(), store, "keptn", "other")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestImport(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	manifest, err := Export(context.Background(), store, writeBundle, Manifest{Namespace: "keptn", Project: "podtato"}, Source{CloneURL: "http://gitea/keptn/podtato.git"})
+	require.NoError(t, err)
+
+	var pushed string
+	push := func(ctx context.Context, file string, target Source) error {
+		content, err := ioutil.ReadFile(file)
+		pushed = string(content) + " to " + target.CloneURL
+		return err
+	}
+
+	require.NoError(t, Import(context.Background(), store, push, *manifest, Source{CloneURL: "http://gitea/keptn/restored.git"}))
+	assert.Equal(t, "bundle of http://gitea/keptn/podtato.git to http://gitea/keptn/restored.git", pushed)
+}
+
+func TestImport_EmptyRepository(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	failingPush := func(ctx context.Context, file string, target Source) error {
+		return errors.New("nothing to push")
+	}
+
+	assert.NoError(t, Import(context.Background(), store, failingPush, Manifest{Namespace: "keptn", Project: "podtato"}, Source{}))
+}
@@ -0,0 +1,100 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Bundler creates git bundles with the git binary
+type Bundler struct {
+	// Git is the path of the git binary, git is looked up in the PATH if empty
+	Git string
+	// Env is appended to the environment of every git command, e.g. GIT_SSL_CAINFO
+	Env []string
+}
+
+// Bundle mirror-clones the source into a temporary directory and writes a bundle with all its references into file.
+// The credentials are passed as HTTP header in the environment, such that they neither show up in the process list nor
+// in the remote URL of the clone.
+func (b Bundler) Bundle(ctx context.Context, source Source, file string) error {
+	directory, err := ioutil.TempDir("", "gitea-mirror-")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(directory)
+
+	mirror := filepath.Join(directory, "repository.git")
+	if err := b.run(ctx, source, "", "clone", "--mirror", "--quiet", source.CloneURL, mirror); err != nil {
+		return fmt.Errorf("unable to clone %s: %w", source.CloneURL, err)
+	}
+
+	if err := b.run(ctx, source, mirror, "bundle", "create", "--quiet", file, "--all"); err != nil {
+		return fmt.Errorf("unable to bundle %s: %w", source.CloneURL, err)
+	}
+
+	return nil
+}
+
+// Push fetches the branches and tags of the bundle into a temporary bare repository and pushes them into the target.
+// Other references of the mirror, e.g. the refs/pull/* of Gitea, are left out since Gitea rejects pushes to them.
+func (b Bundler) Push(ctx context.Context, file string, target Source) error {
+	directory, err := ioutil.TempDir("", "gitea-restore-")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(directory)
+
+	repository := filepath.Join(directory, "repository.git")
+	if err := b.run(ctx, Source{}, "", "init", "--bare", "--quiet", repository); err != nil {
+		return fmt.Errorf("unable to create temporary repository: %w", err)
+	}
+
+	refspecs := []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+	if err := b.run(ctx, Source{}, repository, append([]string{"fetch", "--quiet", file}, refspecs...)...); err != nil {
+		return fmt.Errorf("unable to read bundle: %w", err)
+	}
+
+	if err := b.run(ctx, target, repository, append([]string{"push", "--quiet", target.CloneURL}, refspecs...)...); err != nil {
+		return fmt.Errorf("unable to push to %s: %w", target.CloneURL, err)
+	}
+
+	return nil
+}
+
+// run executes a git command, stderr is part of the returned error
+func (b Bundler) run(ctx context.Context, source Source, directory string, args ...string) error {
+	git := b.Git
+	if git == "" {
+		git = "git"
+	}
+
+	command := exec.CommandContext(ctx, git, args...)
+	command.Dir = directory
+	command.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	command.Env = append(command.Env, b.Env...)
+
+	if source.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(source.Username + ":" + source.Password))
+		command.Env = append(command.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	}
+
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// git runs a git command in the given directory
+func git(t *testing.T, directory string, args ...string) string {
+	command := exec.Command("git", args...)
+	command.Dir = directory
+	output, err := command.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	return string(output)
+}
+
+func TestBundler_Bundle(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repository := t.TempDir()
+	git(t, repository, "init", "--quiet")
+	git(t, repository, "-c", "user.name=keptn", "-c", "user.email=keptn@provisioner.local", "commit", "--quiet", "--allow-empty", "-m", "initial commit")
+
+	file := filepath.Join(t.TempDir(), "repository.bundle")
+	require.NoError(t, Bundler{}.Bundle(context.Background(), Source{CloneURL: repository}, file))
+
+	// The bundle can be verified and cloned without the original repository
+	git(t, repository, "bundle", "verify", "--quiet", file)
+	git(t, t.TempDir(), "clone", "--quiet", file, "restored")
+}
+
+func TestBundler_Push(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repository := t.TempDir()
+	git(t, repository, "init", "--quiet")
+	git(t, repository, "-c", "user.name=keptn", "-c", "user.email=keptn@provisioner.local", "commit", "--quiet", "--allow-empty", "-m", "initial commit")
+	git(t, repository, "tag", "v1")
+
+	file := filepath.Join(t.TempDir(), "repository.bundle")
+	require.NoError(t, Bundler{}.Bundle(context.Background(), Source{CloneURL: repository}, file))
+
+	target := filepath.Join(t.TempDir(), "target.git")
+	git(t, filepath.Dir(target), "init", "--bare", "--quiet", target)
+	require.NoError(t, Bundler{}.Push(context.Background(), file, Source{CloneURL: target}))
+
+	// Branches and tags of the original repository are restored with their commits
+	assert.Equal(t, git(t, repository, "rev-parse", "HEAD", "v1"), git(t, target, "rev-parse", "HEAD", "v1"))
+}
+
+func TestBundler_BundleUnknownRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	file := filepath.Join(t.TempDir(), "repository.bundle")
+	require.Error(t, Bundler{}.Bundle(context.Background(), Source{CloneURL: filepath.Join(t.TempDir(), "missing")}, file))
+}
@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// partialPrefix is the prefix of the temporary files of Put, they are not listed
+const partialPrefix = ".partial-"
+
+// LocalStore writes the backups into a directory, e.g. on a persistent volume
+type LocalStore struct {
+	directory string
+}
+
+// NewLocalStore creates a LocalStore, the directory is created if it doesn't exist
+func NewLocalStore(directory string) (*LocalStore, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create backup directory %s: %w", directory, err)
+	}
+
+	return &LocalStore{directory: directory}, nil
+}
+
+// path returns the file of the key, keys must not leave the directory
+func (l *LocalStore) path(key string) (string, error) {
+	file := filepath.Join(l.directory, filepath.FromSlash(key))
+	if !strings.HasPrefix(file, filepath.Clean(l.directory)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid backup key %s", key)
+	}
+
+	return file, nil
+}
+
+// Put writes the content into a temporary file and renames it, such that a failed write leaves no partial file
+func (l *LocalStore) Put(ctx context.Context, key string, content io.ReadSeeker) error {
+	file, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("unable to create directory for %s: %w", key, err)
+	}
+
+	temporary, err := ioutil.TempFile(filepath.Dir(file), partialPrefix)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", key, err)
+	}
+	defer os.Remove(temporary.Name())
+
+	if _, err := io.Copy(temporary, content); err != nil {
+		temporary.Close()
+		return fmt.Errorf("unable to write %s: %w", key, err)
+	}
+
+	if err := temporary.Close(); err != nil {
+		return fmt.Errorf("unable to write %s: %w", key, err)
+	}
+
+	if err := os.Rename(temporary.Name(), file); err != nil {
+		return fmt.Errorf("unable to write %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Get opens the file of the key
+func (l *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", key, err)
+	}
+
+	return content, nil
+}
+
+// List walks the directory and returns the keys of all files with the prefix, partial files of Put are skipped
+func (l *LocalStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+
+	err := filepath.Walk(l.directory, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), partialPrefix) {
+			return nil
+		}
+
+		relative, err := filepath.Rel(l.directory, file)
+		if err != nil {
+			return err
+		}
+
+		if key := filepath.ToSlash(relative); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list backup directory %s: %w", l.directory, err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
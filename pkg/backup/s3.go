@@ -0,0 +1,298 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultS3Region is used for signing if no region is configured, MinIO accepts it regardless of its own region
+const DefaultS3Region = "us-east-1"
+
+// amzDateFormat is the format of the X-Amz-Date header
+const amzDateFormat = "20060102T150405Z"
+
+// emptyPayloadHash is the SHA-256 of an empty payload, it is signed for requests without body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Options configure the S3Store
+type S3Options struct {
+	// Endpoint is the URL of the S3 API, e.g. https://s3.eu-central-1.amazonaws.com or http://minio.minio:9000
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// HTTPClient is used for all requests, http.DefaultClient is used if nil
+	HTTPClient *http.Client
+}
+
+// S3Store writes the backups into a bucket of an S3-compatible object storage, objects are addressed path-style
+// (<endpoint>/<bucket>/<key>) such that MinIO works without DNS setup
+type S3Store struct {
+	endpoint string
+	options  S3Options
+	now      func() time.Time
+}
+
+// NewS3Store creates an S3Store from the given options
+func NewS3Store(options S3Options) (*S3Store, error) {
+	endpoint, err := url.Parse(options.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("S3 endpoint %s is not an absolute URL", options.Endpoint)
+	}
+
+	if options.Bucket == "" {
+		return nil, fmt.Errorf("the S3 bucket is required")
+	}
+
+	if options.Region == "" {
+		options.Region = DefaultS3Region
+	}
+
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+
+	return &S3Store{
+		endpoint: strings.TrimSuffix(options.Endpoint, "/"),
+		options:  options,
+		now:      time.Now,
+	}, nil
+}
+
+// Put uploads the content with a single PUT request, the payload is hashed beforehand because it is part of the
+// signature
+func (s *S3Store) Put(ctx context.Context, key string, content io.ReadSeeker) error {
+	hash := sha256.New()
+	size, err := io.Copy(hash, content)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", key, err)
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to read %s: %w", key, err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), ioutil.NopCloser(content))
+	if err != nil {
+		return fmt.Errorf("unable to create S3 request: %w", err)
+	}
+	request.ContentLength = size
+
+	response, err := s.do(request, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return fmt.Errorf("unable to upload %s: %w", key, err)
+	}
+	defer response.Body.Close()
+
+	// Drain the body such that the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	return nil
+}
+
+// Get downloads the object with a single GET request, the caller has to close the body
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create S3 request: %w", err)
+	}
+
+	response, err := s.do(request, emptyPayloadHash)
+	var statusErr *s3StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s: %w", key, err)
+	}
+
+	return response.Body, nil
+}
+
+// listBucketResult is the part of the ListObjectsV2 response that is used by List
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the keys with the prefix with ListObjectsV2, truncated results are continued until all keys are listed
+func (s *S3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	continuationToken := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		// The query is encoded the same way as it is signed
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+"/"+s3Escape(s.options.Bucket, false)+"?"+canonicalQuery(query), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create S3 request: %w", err)
+		}
+
+		response, err := s.do(request, emptyPayloadHash)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list objects with prefix %s: %w", prefix, err)
+		}
+
+		result := listBucketResult{}
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode the objects with prefix %s: %w", prefix, err)
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// objectURL returns the path-style URL of the object
+func (s *S3Store) objectURL(key string) string {
+	return s.endpoint + "/" + s3Escape(s.options.Bucket, false) + "/" + s3Escape(key, true)
+}
+
+// s3StatusError is returned by do if S3 responds with a status code other than 2xx
+type s3StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error returns the status code and the S3 error body
+func (e *s3StatusError) Error() string {
+	return fmt.Sprintf("S3 returned unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
+// do signs and sends the request, every status code except 2xx is returned as error containing the S3 error code
+func (s *S3Store) do(request *http.Request, payloadHash string) (*http.Response, error) {
+	signV4(request, payloadHash, s.options.AccessKey, s.options.SecretKey, s.options.Region, s.now())
+
+	response, err := s.options.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, &s3StatusError{StatusCode: response.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	return response, nil
+}
+
+// signV4 adds the X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers of the AWS Signature Version 4 to the
+// request. The host and all headers that are set at this point are signed.
+func signV4(request *http.Request, payloadHash string, accessKey string, secretKey string, region string, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	date := amzDate[:8]
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	signingKey := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(signingKey, stringToSign)),
+	))
+}
+
+// canonicalQuery returns the query parameters sorted by name, with names and values escaped
+func canonicalQuery(query url.Values) string {
+	var parameters []string
+	for name, values := range query {
+		for _, value := range values {
+			parameters = append(parameters, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+
+	sort.Strings(parameters)
+	return strings.Join(parameters, "&")
+}
+
+// s3Escape percent-encodes all characters except the unreserved ones, slashes are kept if keepSlash is set
+func s3Escape(value string, keepSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && keepSlash:
+			escaped.WriteByte(b)
+		default:
+			escaped.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+
+	return escaped.String()
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,721 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/audit"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/backup"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/secrets"
+)
+
+// Config contains all settings of the provisioner. Settings are read from environment variables first and are then
+// overridden by the optional YAML configuration file referenced by CONFIG_FILE.
+type Config struct {
+	// ConfigFile is the path of the YAML configuration file, which is watched for changes if set
+	ConfigFile string `envconfig:"CONFIG_FILE" yaml:"-"`
+	// ConfigReloadInterval defines how often the configuration file and the secrets are checked for changes
+	ConfigReloadInterval time.Duration `envconfig:"CONFIG_RELOAD_INTERVAL" default:"10s" yaml:"-"`
+
+	// Port on which the provisioner listens on
+	Port int `envconfig:"RCV_PORT" default:"8080" yaml:"port"`
+	// The GiteaEndpoint is required and describes the URL of the Gitea endpoint
+	GiteaEndpoint string `envconfig:"GITEA_ENDPOINT" yaml:"giteaEndpoint"`
+	// GiteaUser should be the username of the admin user, it is only optional if GiteaToken or OAuth2 is used
+	GiteaUser string `envconfig:"GITEA_USER" yaml:"giteaUser"`
+	// GiteaPassword should be the password of the admin user, it is only optional if GiteaToken or OAuth2 is used
+	GiteaPassword string `envconfig:"GITEA_PASSWORD" yaml:"giteaPassword"`
+	// GiteaPasswordFile is a file containing the password of the admin user, it overrides GiteaPassword
+	GiteaPasswordFile string `envconfig:"GITEA_PASSWORD_FILE" yaml:"giteaPasswordFile"`
+	// GiteaToken is an access token of the admin user which is used instead of the password
+	GiteaToken string `envconfig:"GITEA_TOKEN" yaml:"giteaToken"`
+	// GiteaTokenFile is a file containing the access token of the admin user, it overrides GiteaToken
+	GiteaTokenFile string `envconfig:"GITEA_TOKEN_FILE" yaml:"giteaTokenFile"`
+	// GiteaOAuth2TokenURL enables the OAuth2 client credentials flow for fetching access tokens of the admin user
+	GiteaOAuth2TokenURL string `envconfig:"GITEA_OAUTH2_TOKEN_URL" yaml:"giteaOAuth2TokenURL"`
+	// GiteaOAuth2ClientID is the client id used for the OAuth2 client credentials flow
+	GiteaOAuth2ClientID string `envconfig:"GITEA_OAUTH2_CLIENT_ID" yaml:"giteaOAuth2ClientID"`
+	// GiteaOAuth2ClientSecret is the client secret used for the OAuth2 client credentials flow
+	GiteaOAuth2ClientSecret string `envconfig:"GITEA_OAUTH2_CLIENT_SECRET" yaml:"giteaOAuth2ClientSecret"`
+	// GiteaOAuth2ClientSecretFile is a file containing the OAuth2 client secret, it overrides GiteaOAuth2ClientSecret
+	GiteaOAuth2ClientSecretFile string `envconfig:"GITEA_OAUTH2_CLIENT_SECRET_FILE" yaml:"giteaOAuth2ClientSecretFile"`
+	// GiteaOAuth2Scopes is a comma separated list of scopes requested in the OAuth2 client credentials flow
+	GiteaOAuth2Scopes []string `envconfig:"GITEA_OAUTH2_SCOPES" yaml:"giteaOAuth2Scopes"`
+	// GiteaCAFile is a PEM encoded CA bundle that is trusted in addition to the system CAs
+	GiteaCAFile string `envconfig:"GITEA_CA_FILE" yaml:"giteaCAFile"`
+	// GiteaClientCertFile is a PEM encoded client certificate used for mTLS
+	GiteaClientCertFile string `envconfig:"GITEA_CLIENT_CERT_FILE" yaml:"giteaClientCertFile"`
+	// GiteaClientKeyFile is the PEM encoded key of the client certificate used for mTLS
+	GiteaClientKeyFile string `envconfig:"GITEA_CLIENT_KEY_FILE" yaml:"giteaClientKeyFile"`
+	// GiteaInsecureSkipVerify disables the verification of the Gitea server certificate
+	GiteaInsecureSkipVerify bool `envconfig:"GITEA_INSECURE_SKIP_VERIFY" default:"false" yaml:"giteaInsecureSkipVerify"`
+	// GiteaHTTPProxy is the proxy used for http connections to Gitea, overrides HTTP_PROXY
+	GiteaHTTPProxy string `envconfig:"GITEA_HTTP_PROXY" yaml:"giteaHTTPProxy"`
+	// GiteaHTTPSProxy is the proxy used for https connections to Gitea, overrides HTTPS_PROXY
+	GiteaHTTPSProxy string `envconfig:"GITEA_HTTPS_PROXY" yaml:"giteaHTTPSProxy"`
+	// GiteaNoProxy is a comma separated list of hosts that are reached without proxy, overrides NO_PROXY
+	GiteaNoProxy string `envconfig:"GITEA_NO_PROXY" yaml:"giteaNoProxy"`
+	// UsernamePrefix defines the prefix that should be used when creating users in Gitea
+	UsernamePrefix string `envconfig:"USERNAME_PREFIX" yaml:"usernamePrefix"`
+	// UserEmailDomain defines the prefix that should be used when creating users in Gitea
+	UserEmailDomain string `envconfig:"USER_EMAIL_DOMAIN" yaml:"userEmailDomain"`
+	// ProjectPrefix defines the prefix that should be used when creating projects in Gitea
+	ProjectPrefix string `envconfig:"PROJECT_PREFIX" yaml:"projectPrefix"`
+	// TokenPrefix defines the prefix that should be used when creating tokens in Gitea
+	TokenPrefix string `envconfig:"TOKEN_PREFIX" yaml:"tokenPrefix"`
+	// RetryMaxRetries defines how often idempotent requests against Gitea are retried on transient errors, the first
+	// attempt is not counted
+	RetryMaxRetries int `envconfig:"GITEA_RETRY_MAX_RETRIES" default:"3" yaml:"retryMaxRetries"`
+	// RetryInitialBackoff defines the upper bound of the first jittered backoff between two retries
+	RetryInitialBackoff time.Duration `envconfig:"GITEA_RETRY_INITIAL_BACKOFF" default:"200ms" yaml:"retryInitialBackoff"`
+	// RetryMaxBackoff defines the upper bound of all jittered backoffs between two retries
+	RetryMaxBackoff time.Duration `envconfig:"GITEA_RETRY_MAX_BACKOFF" default:"2s" yaml:"retryMaxBackoff"`
+	// CircuitBreakerThreshold defines after how many consecutive failures requests to Gitea are rejected, 0 disables it
+	CircuitBreakerThreshold int `envconfig:"GITEA_CIRCUIT_BREAKER_THRESHOLD" default:"5" yaml:"circuitBreakerThreshold"`
+	// CircuitBreakerOpenDuration defines how long requests to Gitea are rejected once the circuit breaker opened
+	CircuitBreakerOpenDuration time.Duration `envconfig:"GITEA_CIRCUIT_BREAKER_OPEN_DURATION" default:"30s" yaml:"circuitBreakerOpenDuration"`
+	// ReadinessCacheDuration defines how long the result of the Gitea readiness check is cached
+	ReadinessCacheDuration time.Duration `envconfig:"READINESS_CACHE_DURATION" default:"10s" yaml:"readinessCacheDuration"`
+	// ShutdownTimeout defines how long in-flight requests are drained on shutdown, must be below the pod's
+	// terminationGracePeriodSeconds
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"55s" yaml:"shutdownTimeout"`
+	// LeaseLockEnabled enables Kubernetes Lease based locking of namespaces, required when running multiple replicas
+	LeaseLockEnabled bool `envconfig:"LEASE_LOCK_ENABLED" default:"false" yaml:"leaseLockEnabled"`
+	// LeaseLockDuration defines after which time a lease of a crashed replica expires
+	LeaseLockDuration time.Duration `envconfig:"LEASE_LOCK_DURATION" default:"15s" yaml:"leaseLockDuration"`
+	// LeaseLockTimeout defines how long a request waits for the lease of a namespace
+	LeaseLockTimeout time.Duration `envconfig:"LEASE_LOCK_TIMEOUT" default:"30s" yaml:"leaseLockTimeout"`
+	// LeaderElectionEnabled enables the election of a leader which runs the background jobs, required when running
+	// multiple replicas
+	LeaderElectionEnabled bool `envconfig:"LEADER_ELECTION_ENABLED" default:"false" yaml:"leaderElectionEnabled"`
+	// LeaderElectionLeaseName is the name of the Kubernetes Lease used for the leader election
+	LeaderElectionLeaseName string `envconfig:"LEADER_ELECTION_LEASE_NAME" default:"keptn-gitea-provisioner-leader" yaml:"leaderElectionLeaseName"`
+	// LeaderElectionLeaseDuration defines after which time a new leader is elected if the current one dies
+	LeaderElectionLeaseDuration time.Duration `envconfig:"LEADER_ELECTION_LEASE_DURATION" default:"15s" yaml:"leaderElectionLeaseDuration"`
+	// OrphanCleanupInterval defines how often users without repositories are deleted, 0 disables the job and is the
+	// default because the job deletes users
+	OrphanCleanupInterval time.Duration `envconfig:"ORPHAN_CLEANUP_INTERVAL" default:"0" yaml:"orphanCleanupInterval"`
+	// TokenSweepInterval defines how often access tokens without repositories are deleted, 0 disables the job
+	TokenSweepInterval time.Duration `envconfig:"TOKEN_SWEEP_INTERVAL" default:"1h" yaml:"tokenSweepInterval"`
+	// InventoryInterval defines how often the number of managed users and repositories is logged, 0 disables the job
+	InventoryInterval time.Duration `envconfig:"INVENTORY_INTERVAL" default:"15m" yaml:"inventoryInterval"`
+	// PodName is used as identity of the replica when acquiring leases
+	PodName string `envconfig:"POD_NAME" yaml:"podName"`
+	// PodNamespace is the Kubernetes namespace in which leases are created
+	PodNamespace string `envconfig:"POD_NAMESPACE" default:"default" yaml:"podNamespace"`
+	// CredentialSecretsEnabled enables writing a copy of the credentials of every provisioned project into a
+	// Kubernetes Secret
+	CredentialSecretsEnabled bool `envconfig:"CREDENTIAL_SECRETS_ENABLED" default:"false" yaml:"credentialSecretsEnabled"`
+	// CredentialSecretsNamespace is the Kubernetes namespace of the credential secrets, defaults to PodNamespace
+	CredentialSecretsNamespace string `envconfig:"CREDENTIAL_SECRETS_NAMESPACE" yaml:"credentialSecretsNamespace"`
+	// CredentialSecretsNameTemplate is the template of the credential secret names, it can refer to {{ .Namespace }}
+	// and {{ .Project }}
+	CredentialSecretsNameTemplate string `envconfig:"CREDENTIAL_SECRETS_NAME_TEMPLATE" yaml:"credentialSecretsNameTemplate"`
+	// PolicyAllowedNamespaces is a comma separated list of namespaces that are allowed to provision repositories
+	PolicyAllowedNamespaces []string `envconfig:"POLICY_ALLOWED_NAMESPACES" yaml:"policyAllowedNamespaces"`
+	// PolicyDeniedNamespaces is a comma separated list of namespaces that must not provision repositories
+	PolicyDeniedNamespaces []string `envconfig:"POLICY_DENIED_NAMESPACES" yaml:"policyDeniedNamespaces"`
+	// PolicyNamespacePattern is a regular expression every namespace must match
+	PolicyNamespacePattern string `envconfig:"POLICY_NAMESPACE_PATTERN" yaml:"policyNamespacePattern"`
+	// PolicyDeniedNamespacePattern is a regular expression no namespace must match
+	PolicyDeniedNamespacePattern string `envconfig:"POLICY_DENIED_NAMESPACE_PATTERN" yaml:"policyDeniedNamespacePattern"`
+	// PolicyAllowedProjects is a comma separated list of projects that are allowed to be provisioned
+	PolicyAllowedProjects []string `envconfig:"POLICY_ALLOWED_PROJECTS" yaml:"policyAllowedProjects"`
+	// PolicyDeniedProjects is a comma separated list of projects that must not be provisioned
+	PolicyDeniedProjects []string `envconfig:"POLICY_DENIED_PROJECTS" yaml:"policyDeniedProjects"`
+	// PolicyProjectPattern is a regular expression every project name must match
+	PolicyProjectPattern string `envconfig:"POLICY_PROJECT_PATTERN" yaml:"policyProjectPattern"`
+	// PolicyDeniedProjectPattern is a regular expression no project name must match
+	PolicyDeniedProjectPattern string `envconfig:"POLICY_DENIED_PROJECT_PATTERN" yaml:"policyDeniedProjectPattern"`
+	// PolicyReservedNames is a comma separated list of names that can neither be used as namespace nor as project
+	PolicyReservedNames []string `envconfig:"POLICY_RESERVED_NAMES" yaml:"policyReservedNames"`
+	// PolicyMaxProjectsPerNamespace limits the number of repositories per namespace, 0 disables the limit
+	PolicyMaxProjectsPerNamespace int `envconfig:"POLICY_MAX_PROJECTS_PER_NAMESPACE" default:"0" yaml:"policyMaxProjectsPerNamespace"`
+	// QuotaMaxRepositories limits the number of repositories per namespace while holding the namespace lock and is set
+	// as repository limit of the Gitea users, 0 disables the quota
+	QuotaMaxRepositories int `envconfig:"QUOTA_MAX_REPOSITORIES" default:"0" yaml:"quotaMaxRepositories"`
+	// QuotaMaxTotalSizeMB limits the summed up size of all repositories of a namespace, 0 disables the quota
+	QuotaMaxTotalSizeMB int64 `envconfig:"QUOTA_MAX_TOTAL_SIZE_MB" default:"0" yaml:"quotaMaxTotalSizeMB"`
+	// QuotaStatusCode is returned when a namespace exceeded a quota, either 403 or 429
+	QuotaStatusCode int `envconfig:"QUOTA_STATUS_CODE" default:"403" yaml:"quotaStatusCode"`
+	// VaultAddress enables reading the Gitea credentials from a HashiCorp Vault KV v2 secret, keys of the secret
+	// (giteaPassword, giteaToken, giteaOAuth2ClientSecret, keptnAPIToken, auditWebhookToken, auditQueryToken,
+	// backupS3AccessKey, backupS3SecretKey) override the other settings
+	VaultAddress string `envconfig:"VAULT_ADDR" yaml:"vaultAddress"`
+	// VaultToken is the token used to authenticate against Vault
+	VaultToken string `envconfig:"VAULT_TOKEN" yaml:"vaultToken"`
+	// VaultTokenFile is a file containing the Vault token, e.g. written by a Vault agent, it overrides VaultToken
+	VaultTokenFile string `envconfig:"VAULT_TOKEN_FILE" yaml:"vaultTokenFile"`
+	// VaultCAFile is a PEM encoded CA bundle that is trusted in addition to the system CAs when connecting to Vault
+	VaultCAFile string `envconfig:"VAULT_CACERT" yaml:"vaultCAFile"`
+	// VaultKVMount is the path the KV v2 secrets engine is mounted at
+	VaultKVMount string `envconfig:"VAULT_KV_MOUNT" default:"secret" yaml:"vaultKVMount"`
+	// VaultSecretPath is the path of the secret containing the Gitea credentials
+	VaultSecretPath string `envconfig:"VAULT_SECRET_PATH" yaml:"vaultSecretPath"`
+	// AuditLogFile enables writing the audit trail as JSON lines into the given file, which can be queried with
+	// GET /audit. The file only contains the events of this replica and must not be shared with other replicas,
+	// provisionerctl appends its events without rotating the file.
+	AuditLogFile string `envconfig:"AUDIT_LOG_FILE" yaml:"auditLogFile"`
+	// AuditLogMaxSizeMB defines the size after which the audit file is rotated, 0 disables the rotation
+	AuditLogMaxSizeMB int64 `envconfig:"AUDIT_LOG_MAX_SIZE_MB" default:"100" yaml:"auditLogMaxSizeMB"`
+	// AuditLogMaxBackups defines how many rotated audit files are kept
+	AuditLogMaxBackups int `envconfig:"AUDIT_LOG_MAX_BACKUPS" default:"5" yaml:"auditLogMaxBackups"`
+	// AuditWebhookURL enables posting every event of the audit trail to the given URL
+	AuditWebhookURL string `envconfig:"AUDIT_WEBHOOK_URL" yaml:"auditWebhookURL"`
+	// AuditWebhookToken is sent as bearer token to the audit webhook
+	AuditWebhookToken string `envconfig:"AUDIT_WEBHOOK_TOKEN" yaml:"auditWebhookToken"`
+	// AuditWebhookTokenFile is a file containing the audit webhook token, it overrides AuditWebhookToken
+	AuditWebhookTokenFile string `envconfig:"AUDIT_WEBHOOK_TOKEN_FILE" yaml:"auditWebhookTokenFile"`
+	// AuditQueryToken enables GET /audit for clients that send it as bearer token, the endpoint is disabled if empty
+	AuditQueryToken string `envconfig:"AUDIT_QUERY_TOKEN" yaml:"auditQueryToken"`
+	// AuditQueryTokenFile is a file containing the audit query token, it overrides AuditQueryToken
+	AuditQueryTokenFile string `envconfig:"AUDIT_QUERY_TOKEN_FILE" yaml:"auditQueryTokenFile"`
+	// AuditTrustedProxies is a comma separated list of IP addresses and CIDR ranges of the authenticating proxies that
+	// set the X-Forwarded-User or X-Remote-User header, the headers of other clients are ignored
+	AuditTrustedProxies []string `envconfig:"AUDIT_TRUSTED_PROXIES" yaml:"auditTrustedProxies"`
+	// KeptnAPIEndpoint enables publishing upstream lifecycle events to Keptn, it can refer to the Keptn
+	// {{ .Namespace }}, e.g. http://api-gateway-nginx.{{ .Namespace }}/api
+	KeptnAPIEndpoint string `envconfig:"KEPTN_API_ENDPOINT" yaml:"keptnAPIEndpoint"`
+	// KeptnAPIToken is used to authenticate against the Keptn API
+	KeptnAPIToken string `envconfig:"KEPTN_API_TOKEN" yaml:"keptnAPIToken"`
+	// KeptnAPITokenFile is a file containing the Keptn API token, it overrides KeptnAPIToken
+	KeptnAPITokenFile string `envconfig:"KEPTN_API_TOKEN_FILE" yaml:"keptnAPITokenFile"`
+	// DryRun makes every request return the plan of the changes instead of modifying Gitea, the background jobs that
+	// delete users, tokens or repositories are skipped
+	DryRun bool `envconfig:"DRY_RUN" default:"false" yaml:"dryRun"`
+	// DeletionPolicy defines what happens to the repository of a deleted project: delete, archive or graveyard
+	DeletionPolicy string `envconfig:"DELETION_POLICY" default:"delete" yaml:"deletionPolicy"`
+	// GraveyardOrganization receives the repositories of deleted projects with the graveyard policy
+	GraveyardOrganization string `envconfig:"GRAVEYARD_ORGANIZATION" default:"keptn-graveyard" yaml:"graveyardOrganization"`
+	// GraveyardRetention defines how long repositories are kept in the graveyard, 0 keeps them forever
+	GraveyardRetention time.Duration `envconfig:"GRAVEYARD_RETENTION" default:"720h" yaml:"graveyardRetention"`
+	// GraveyardPurgeInterval defines how often expired repositories are purged from the graveyard, 0 disables the job
+	GraveyardPurgeInterval time.Duration `envconfig:"GRAVEYARD_PURGE_INTERVAL" default:"1h" yaml:"graveyardPurgeInterval"`
+	// BackupDirectory enables writing a git bundle and manifest of every repository into the directory before it is
+	// deleted
+	BackupDirectory string `envconfig:"BACKUP_DIRECTORY" yaml:"backupDirectory"`
+	// BackupS3Endpoint enables writing the backups into a bucket of an S3-compatible storage, e.g. MinIO
+	BackupS3Endpoint string `envconfig:"BACKUP_S3_ENDPOINT" yaml:"backupS3Endpoint"`
+	// BackupS3Bucket is the bucket the backups are written into
+	BackupS3Bucket string `envconfig:"BACKUP_S3_BUCKET" yaml:"backupS3Bucket"`
+	// BackupS3Region is used to sign the requests to the S3 storage
+	BackupS3Region string `envconfig:"BACKUP_S3_REGION" default:"us-east-1" yaml:"backupS3Region"`
+	// BackupS3AccessKey and BackupS3SecretKey authenticate against the S3 storage
+	BackupS3AccessKey string `envconfig:"BACKUP_S3_ACCESS_KEY" yaml:"backupS3AccessKey"`
+	BackupS3SecretKey string `envconfig:"BACKUP_S3_SECRET_KEY" yaml:"backupS3SecretKey"`
+	// BackupS3AccessKeyFile and BackupS3SecretKeyFile are files containing the S3 credentials, they override
+	// BackupS3AccessKey and BackupS3SecretKey
+	BackupS3AccessKeyFile string `envconfig:"BACKUP_S3_ACCESS_KEY_FILE" yaml:"backupS3AccessKeyFile"`
+	BackupS3SecretKeyFile string `envconfig:"BACKUP_S3_SECRET_KEY_FILE" yaml:"backupS3SecretKeyFile"`
+	// BackupForce deletes repositories even if their backup failed
+	BackupForce bool `envconfig:"BACKUP_FORCE" default:"false" yaml:"backupForce"`
+	// BackupTimeout limits the duration of the backup of a single repository
+	BackupTimeout time.Duration `envconfig:"BACKUP_TIMEOUT" default:"5m" yaml:"backupTimeout"`
+	// JobWorkers limits the number of async provisioning requests that run concurrently
+	JobWorkers int `envconfig:"JOB_WORKERS" default:"4" yaml:"jobWorkers"`
+	// JobQueueSize limits the number of async provisioning requests that wait for a worker, further ones are rejected
+	JobQueueSize int `envconfig:"JOB_QUEUE_SIZE" default:"100" yaml:"jobQueueSize"`
+	// JobRetention defines how long the result of an async provisioning request can be polled
+	JobRetention time.Duration `envconfig:"JOB_RETENTION" default:"1h" yaml:"jobRetention"`
+}
+
+// secretSetting describes a setting that can be read from a file or a secrets.Source
+type secretSetting struct {
+	// key is used to look up the secret in a secrets.Source
+	key   string
+	value *string
+	file  string
+}
+
+// minLeaseLockDuration is the shortest lease duration that can be renewed in time, Leases store their duration in
+// whole seconds and are renewed every third of it
+const minLeaseLockDuration = 3 * time.Second
+
+// restartRequiredFields lists the settings that are only applied on startup, all other settings are reloaded
+var /*const*/ restartRequiredFields = []string{
+	"Port", "ReadinessCacheDuration", "ShutdownTimeout",
+	"LeaseLockEnabled", "LeaseLockDuration", "LeaseLockTimeout",
+	"LeaderElectionEnabled", "LeaderElectionLeaseName", "LeaderElectionLeaseDuration",
+	"OrphanCleanupInterval", "TokenSweepInterval", "InventoryInterval", "GraveyardPurgeInterval",
+	"PodName", "PodNamespace",
+	"CredentialSecretsEnabled", "CredentialSecretsNamespace", "CredentialSecretsNameTemplate",
+	"PolicyAllowedNamespaces", "PolicyDeniedNamespaces", "PolicyNamespacePattern", "PolicyDeniedNamespacePattern",
+	"PolicyAllowedProjects", "PolicyDeniedProjects", "PolicyProjectPattern", "PolicyDeniedProjectPattern",
+	"PolicyReservedNames", "PolicyMaxProjectsPerNamespace",
+	"AuditLogFile", "AuditLogMaxSizeMB", "AuditLogMaxBackups", "AuditWebhookURL", "AuditWebhookToken",
+	"AuditWebhookTokenFile", "AuditQueryToken", "AuditQueryTokenFile", "AuditTrustedProxies",
+	"KeptnAPIEndpoint", "KeptnAPIToken", "KeptnAPITokenFile", "DryRun",
+	"BackupDirectory", "BackupS3Endpoint", "BackupS3Bucket", "BackupS3Region", "BackupS3AccessKey", "BackupS3SecretKey",
+	"BackupS3AccessKeyFile", "BackupS3SecretKeyFile",
+	"JobWorkers", "JobQueueSize", "JobRetention",
+}
+
+// Load reads the configuration from the environment and overrides it with the YAML file referenced by CONFIG_FILE.
+// Afterwards, secrets are read from the configured files and Vault. The returned configuration has been validated.
+func Load() (*Config, error) {
+	config := &Config{}
+	if err := envconfig.Process("", config); err != nil {
+		return nil, fmt.Errorf("unable to process env vars: %w", err)
+	}
+
+	if config.ConfigFile != "" {
+		content, err := ioutil.ReadFile(config.ConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config file: %w", err)
+		}
+
+		if err := config.merge(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.resolveSecrets(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Reloadable returns true if the configuration is read from files or secret sources that can change at runtime
+func (c *Config) Reloadable() bool {
+	return c.ConfigFile != "" || c.GiteaPasswordFile != "" || c.GiteaTokenFile != "" ||
+		c.GiteaOAuth2ClientSecretFile != "" || c.KeptnAPITokenFile != "" || c.AuditWebhookTokenFile != "" ||
+		c.AuditQueryTokenFile != "" || c.BackupS3AccessKeyFile != "" || c.BackupS3SecretKeyFile != "" ||
+		c.VaultAddress != ""
+}
+
+// merge overrides the settings with the ones that are defined in the given YAML document, unknown keys are rejected
+// to catch typos that would otherwise be silently ignored
+func (c *Config) merge(content []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("unable to parse config file: %w", err)
+	}
+
+	return nil
+}
+
+// secretSources creates the configured secrets.Source implementations
+func (c *Config) secretSources() ([]secrets.Source, error) {
+	if c.VaultAddress == "" {
+		return nil, nil
+	}
+
+	if c.VaultSecretPath == "" {
+		return nil, fmt.Errorf("invalid config: vaultSecretPath is required if vaultAddress is set")
+	}
+
+	httpClient, err := provisioner.NewHTTPClient(&provisioner.TransportOptions{CAFile: c.VaultCAFile})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create vault http client: %w", err)
+	}
+
+	vaultToken := c.VaultToken
+	if c.VaultTokenFile != "" {
+		// Validates that the token file is readable, the source itself re-reads it on every request
+		if vaultToken, err = secrets.ReadFile(c.VaultTokenFile); err != nil {
+			return nil, fmt.Errorf("unable to read vaultTokenFile: %w", err)
+		}
+	}
+
+	if vaultToken == "" {
+		return nil, fmt.Errorf("invalid config: vaultToken or vaultTokenFile is required if vaultAddress is set")
+	}
+
+	return []secrets.Source{secrets.NewVaultSource(secrets.VaultOptions{
+		Address:    c.VaultAddress,
+		Token:      c.VaultToken,
+		TokenFile:  c.VaultTokenFile,
+		Mount:      c.VaultKVMount,
+		Path:       c.VaultSecretPath,
+		HTTPClient: httpClient,
+	})}, nil
+}
+
+// resolveSecrets reads the secret settings from their files and afterwards from the secret sources, such that a
+// secret source has the highest precedence
+func (c *Config) resolveSecrets() error {
+	settings := []secretSetting{
+		{key: "giteaPassword", value: &c.GiteaPassword, file: c.GiteaPasswordFile},
+		{key: "giteaToken", value: &c.GiteaToken, file: c.GiteaTokenFile},
+		{key: "giteaOAuth2ClientSecret", value: &c.GiteaOAuth2ClientSecret, file: c.GiteaOAuth2ClientSecretFile},
+		{key: "keptnAPIToken", value: &c.KeptnAPIToken, file: c.KeptnAPITokenFile},
+		{key: "auditWebhookToken", value: &c.AuditWebhookToken, file: c.AuditWebhookTokenFile},
+		{key: "auditQueryToken", value: &c.AuditQueryToken, file: c.AuditQueryTokenFile},
+		{key: "backupS3AccessKey", value: &c.BackupS3AccessKey, file: c.BackupS3AccessKeyFile},
+		{key: "backupS3SecretKey", value: &c.BackupS3SecretKey, file: c.BackupS3SecretKeyFile},
+	}
+
+	for _, setting := range settings {
+		if setting.file == "" {
+			continue
+		}
+
+		value, err := secrets.ReadFile(setting.file)
+		if err != nil {
+			return fmt.Errorf("unable to read %sFile: %w", setting.key, err)
+		}
+
+		*setting.value = value
+	}
+
+	sources, err := c.secretSources()
+	if err != nil {
+		return err
+	}
+
+	for _, source := range sources {
+		// All settings are read from the same version of the secrets, even if they are rotated meanwhile
+		snapshot, err := source.Snapshot()
+		if err != nil {
+			return fmt.Errorf("unable to read secrets: %w", err)
+		}
+
+		for _, setting := range settings {
+			value, found, err := snapshot.Lookup(setting.key)
+			if err != nil {
+				return fmt.Errorf("unable to look up %s: %w", setting.key, err)
+			}
+
+			if found {
+				*setting.value = value
+			}
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the configuration is complete and consistent
+func (c *Config) Validate() error {
+	if c.GiteaEndpoint == "" {
+		return fmt.Errorf("invalid config: giteaEndpoint is required")
+	}
+
+	if endpoint, err := url.Parse(c.GiteaEndpoint); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return fmt.Errorf("invalid config: giteaEndpoint %s is not an absolute URL", c.GiteaEndpoint)
+	}
+
+	if c.GiteaPassword == "" && c.GiteaToken == "" && c.GiteaOAuth2TokenURL == "" {
+		return fmt.Errorf("invalid config: one of giteaPassword, giteaToken or giteaOAuth2TokenURL is required")
+	}
+
+	if c.GiteaPassword != "" && c.GiteaToken == "" && c.GiteaOAuth2TokenURL == "" && c.GiteaUser == "" {
+		return fmt.Errorf("invalid config: giteaUser is required for password authentication")
+	}
+
+	if c.GiteaOAuth2TokenURL != "" && (c.GiteaOAuth2ClientID == "" || c.GiteaOAuth2ClientSecret == "") {
+		return fmt.Errorf("invalid config: giteaOAuth2ClientID and giteaOAuth2ClientSecret are required for OAuth2")
+	}
+
+	if (c.GiteaClientCertFile == "") != (c.GiteaClientKeyFile == "") {
+		return fmt.Errorf("invalid config: giteaClientCertFile and giteaClientKeyFile must be set together")
+	}
+
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid config: port %d is out of range", c.Port)
+	}
+
+	if c.RetryMaxRetries < 0 || c.CircuitBreakerThreshold < 0 || c.PolicyMaxProjectsPerNamespace < 0 {
+		return fmt.Errorf("invalid config: retryMaxRetries, circuitBreakerThreshold and policyMaxProjectsPerNamespace must not be negative")
+	}
+
+	if c.QuotaMaxRepositories < 0 || c.QuotaMaxTotalSizeMB < 0 {
+		return fmt.Errorf("invalid config: quotaMaxRepositories and quotaMaxTotalSizeMB must not be negative")
+	}
+
+	if c.AuditLogMaxSizeMB < 0 || c.AuditLogMaxBackups < 0 {
+		return fmt.Errorf("invalid config: auditLogMaxSizeMB and auditLogMaxBackups must not be negative")
+	}
+
+	if c.JobWorkers < 0 || c.JobQueueSize < 0 {
+		return fmt.Errorf("invalid config: jobWorkers and jobQueueSize must not be negative")
+	}
+
+	if c.AuditWebhookURL != "" {
+		if webhook, err := url.Parse(c.AuditWebhookURL); err != nil || webhook.Scheme == "" || webhook.Host == "" {
+			return fmt.Errorf("invalid config: auditWebhookURL %s is not an absolute URL", c.AuditWebhookURL)
+		}
+	}
+
+	if _, err := audit.ParseTrustedProxies(c.AuditTrustedProxies); err != nil {
+		return fmt.Errorf("invalid config: auditTrustedProxies: %w", err)
+	}
+
+	if c.QuotaStatusCode != 0 && c.QuotaStatusCode != http.StatusForbidden && c.QuotaStatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("invalid config: quotaStatusCode must be %d or %d", http.StatusForbidden, http.StatusTooManyRequests)
+	}
+
+	if c.KeptnAPIEndpoint != "" && c.KeptnAPIToken == "" {
+		return fmt.Errorf("invalid config: keptnAPIToken is required if keptnAPIEndpoint is set")
+	}
+
+	switch c.DeletionPolicy {
+	case "", provisioner.DeletionPolicyDelete, provisioner.DeletionPolicyArchive, provisioner.DeletionPolicyGraveyard:
+	default:
+		return fmt.Errorf("invalid config: deletionPolicy must be %s, %s or %s", provisioner.DeletionPolicyDelete,
+			provisioner.DeletionPolicyArchive, provisioner.DeletionPolicyGraveyard,
+		)
+	}
+
+	if c.BackupDirectory != "" && c.BackupS3Endpoint != "" {
+		return fmt.Errorf("invalid config: only one of backupDirectory and backupS3Endpoint can be set")
+	}
+
+	if c.BackupS3Endpoint != "" {
+		if endpoint, err := url.Parse(c.BackupS3Endpoint); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			return fmt.Errorf("invalid config: backupS3Endpoint %s is not an absolute URL", c.BackupS3Endpoint)
+		}
+
+		if c.BackupS3Bucket == "" || c.BackupS3AccessKey == "" || c.BackupS3SecretKey == "" {
+			return fmt.Errorf("invalid config: backupS3Bucket, backupS3AccessKey and backupS3SecretKey are required if backupS3Endpoint is set")
+		}
+	}
+
+	patterns := map[string]string{
+		"policyNamespacePattern":       c.PolicyNamespacePattern,
+		"policyDeniedNamespacePattern": c.PolicyDeniedNamespacePattern,
+		"policyProjectPattern":         c.PolicyProjectPattern,
+		"policyDeniedProjectPattern":   c.PolicyDeniedProjectPattern,
+	}
+
+	for name, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid config: %s is not a valid regular expression: %w", name, err)
+		}
+	}
+
+	durations := map[string]time.Duration{
+		"retryInitialBackoff":         c.RetryInitialBackoff,
+		"retryMaxBackoff":             c.RetryMaxBackoff,
+		"circuitBreakerOpenDuration":  c.CircuitBreakerOpenDuration,
+		"readinessCacheDuration":      c.ReadinessCacheDuration,
+		"shutdownTimeout":             c.ShutdownTimeout,
+		"leaseLockDuration":           c.LeaseLockDuration,
+		"leaseLockTimeout":            c.LeaseLockTimeout,
+		"leaderElectionLeaseDuration": c.LeaderElectionLeaseDuration,
+		"orphanCleanupInterval":       c.OrphanCleanupInterval,
+		"tokenSweepInterval":          c.TokenSweepInterval,
+		"inventoryInterval":           c.InventoryInterval,
+		"graveyardRetention":          c.GraveyardRetention,
+		"graveyardPurgeInterval":      c.GraveyardPurgeInterval,
+		"backupTimeout":               c.BackupTimeout,
+		"jobRetention":                c.JobRetention,
+	}
+
+	for name, duration := range durations {
+		if duration < 0 {
+			return fmt.Errorf("invalid config: %s must not be negative", name)
+		}
+	}
+
+	// The leases are renewed in fractions of their duration and stored in whole seconds
+	if c.LeaseLockEnabled && c.LeaseLockDuration < minLeaseLockDuration {
+		return fmt.Errorf("invalid config: leaseLockDuration must be at least %s if leaseLockEnabled is set", minLeaseLockDuration)
+	}
+
+	if c.LeaseLockEnabled && c.LeaseLockTimeout <= 0 {
+		return fmt.Errorf("invalid config: leaseLockTimeout must be positive if leaseLockEnabled is set")
+	}
+
+	if c.LeaderElectionEnabled && c.LeaderElectionLeaseDuration <= 0 {
+		return fmt.Errorf("invalid config: leaderElectionLeaseDuration must be positive if leaderElectionEnabled is set")
+	}
+
+	return nil
+}
+
+// RestartRequiredChanges returns the names of the settings that differ from the given configuration but are only
+// applied on startup
+func (c *Config) RestartRequiredChanges(other *Config) []string {
+	current := reflect.ValueOf(c).Elem()
+	updated := reflect.ValueOf(other).Elem()
+
+	var changes []string
+	for _, field := range restartRequiredFields {
+		if !reflect.DeepEqual(current.FieldByName(field).Interface(), updated.FieldByName(field).Interface()) {
+			changes = append(changes, field)
+		}
+	}
+
+	sort.Strings(changes)
+	return changes
+}
+
+// GiteaProvisionerOptions creates the options of the provisioner.GiteaProvisioner from the configuration, the locker
+// is passed in such that it can be shared between provisioners that are created on reload
+func (c *Config) GiteaProvisionerOptions(locker provisioner.NamespaceLocker) *provisioner.GiteaProvisionerOptions {
+	options := &provisioner.GiteaProvisionerOptions{
+		UsernamePrefix:  c.UsernamePrefix,
+		UserEmailDomain: c.UserEmailDomain,
+		ProjectPrefix:   c.ProjectPrefix,
+		TokenPrefix:     c.TokenPrefix,
+		Resilience: &provisioner.ResilienceOptions{
+			MaxRetries:       c.RetryMaxRetries,
+			InitialBackoff:   c.RetryInitialBackoff,
+			MaxBackoff:       c.RetryMaxBackoff,
+			FailureThreshold: c.CircuitBreakerThreshold,
+			OpenDuration:     c.CircuitBreakerOpenDuration,
+		},
+		Locker: locker,
+		Quota: &provisioner.QuotaOptions{
+			MaxRepositories: c.QuotaMaxRepositories,
+			MaxTotalSizeKB:  c.QuotaMaxTotalSizeMB * 1024,
+			StatusCode:      c.QuotaStatusCode,
+			// The namespace lock is only held by the provisioner, which evaluates the rule again without races
+			MaxProjectsPerNamespace: c.PolicyMaxProjectsPerNamespace,
+		},
+		Deletion: &provisioner.DeletionOptions{
+			Policy:                c.DeletionPolicy,
+			GraveyardOrganization: c.GraveyardOrganization,
+			GraveyardRetention:    c.GraveyardRetention,
+		},
+		Backup: &provisioner.BackupOptions{
+			Force:   c.BackupForce,
+			Timeout: c.BackupTimeout,
+		},
+		Authentication: &provisioner.AuthenticationOptions{
+			Token: c.GiteaToken,
+		},
+		Transport: &provisioner.TransportOptions{
+			CAFile:             c.GiteaCAFile,
+			ClientCertFile:     c.GiteaClientCertFile,
+			ClientKeyFile:      c.GiteaClientKeyFile,
+			InsecureSkipVerify: c.GiteaInsecureSkipVerify,
+			HTTPProxy:          c.GiteaHTTPProxy,
+			HTTPSProxy:         c.GiteaHTTPSProxy,
+			NoProxy:            c.GiteaNoProxy,
+		},
+	}
+
+	if c.GiteaOAuth2TokenURL != "" {
+		options.Authentication.OAuth2 = &provisioner.OAuth2Options{
+			TokenURL:     c.GiteaOAuth2TokenURL,
+			ClientID:     c.GiteaOAuth2ClientID,
+			ClientSecret: c.GiteaOAuth2ClientSecret,
+			Scopes:       c.GiteaOAuth2Scopes,
+		}
+	}
+
+	return options
+}
+
+// BackupStore creates the backup.Store of the configured directory or S3 bucket, nil is returned if backups are
+// disabled
+func (c *Config) BackupStore() (backup.Store, error) {
+	if c.BackupDirectory != "" {
+		store, err := backup.NewLocalStore(c.BackupDirectory)
+		if err != nil {
+			return nil, err
+		}
+
+		return store, nil
+	}
+
+	if c.BackupS3Endpoint == "" {
+		return nil, nil
+	}
+
+	// The requests are bounded by the backup timeout, which is applied to the whole backup
+	store, err := backup.NewS3Store(backup.S3Options{
+		Endpoint:  c.BackupS3Endpoint,
+		Bucket:    c.BackupS3Bucket,
+		Region:    c.BackupS3Region,
+		AccessKey: c.BackupS3AccessKey,
+		SecretKey: c.BackupS3SecretKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// AuditRecorder creates the audit.Recorder with all configured sinks and the audit.Querier of the audit file, both are
+// nil if no sink is configured. The webhook is called in the background, such that a slow webhook doesn't delay the
+// recorded operations, call Flush on the recorder before exiting.
+func (c *Config) AuditRecorder() (*audit.Recorder, audit.Querier, error) {
+	return c.auditRecorder(c.AuditLogMaxSizeMB * 1024 * 1024)
+}
+
+// CommandAuditRecorder creates the audit.Recorder of a command that runs next to the service, e.g. provisionerctl in
+// the service pod. The command only appends to the audit file and never rotates it, such that the service remains
+// the only process that renames the file. An event may end up in the most recent backup if the service rotates the
+// file while the command runs.
+func (c *Config) CommandAuditRecorder() (*audit.Recorder, error) {
+	recorder, _, err := c.auditRecorder(0)
+	return recorder, err
+}
+
+// auditRecorder creates the audit.Recorder and audit.Querier, the audit file is rotated after maxSize bytes unless
+// maxSize is 0
+func (c *Config) auditRecorder(maxSize int64) (*audit.Recorder, audit.Querier, error) {
+	var sinks []audit.Sink
+	var querier audit.Querier
+
+	if c.AuditLogFile != "" {
+		fileSink, err := audit.NewFileSink(c.AuditLogFile, maxSize, c.AuditLogMaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sinks = append(sinks, fileSink)
+		querier = fileSink
+	}
+
+	if c.AuditWebhookURL != "" {
+		sinks = append(sinks, audit.NewAsyncSink(audit.NewWebhookSink(c.AuditWebhookURL, c.AuditWebhookToken, nil), 0))
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil, nil
+	}
+
+	return audit.NewRecorder(sinks...), querier, nil
+}
+
+// PolicyOptions creates the options of the provisioner.AdmissionPolicy from the configuration
+func (c *Config) PolicyOptions() provisioner.PolicyOptions {
+	return provisioner.PolicyOptions{
+		AllowedNamespaces:       c.PolicyAllowedNamespaces,
+		DeniedNamespaces:        c.PolicyDeniedNamespaces,
+		NamespacePattern:        c.PolicyNamespacePattern,
+		DeniedNamespacePattern:  c.PolicyDeniedNamespacePattern,
+		AllowedProjects:         c.PolicyAllowedProjects,
+		DeniedProjects:          c.PolicyDeniedProjects,
+		ProjectPattern:          c.PolicyProjectPattern,
+		DeniedProjectPattern:    c.PolicyDeniedProjectPattern,
+		ReservedNames:           c.PolicyReservedNames,
+		MaxProjectsPerNamespace: c.PolicyMaxProjectsPerNamespace,
+	}
+}
+
+// JobOptions creates the options of the provisioner.JobQueue from the configuration, the tracker drains the queued and
+// running jobs on shutdown
+func (c *Config) JobOptions(operations *provisioner.OperationTracker) provisioner.JobOptions {
+	return provisioner.JobOptions{
+		Workers:    c.JobWorkers,
+		QueueSize:  c.JobQueueSize,
+		Retention:  c.JobRetention,
+		Operations: operations,
+	}
+}
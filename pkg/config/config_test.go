@@ -0,0 +1,397 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes the YAML content into a config file and points CONFIG_FILE to it
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	t.Setenv("CONFIG_FILE", path)
+
+	return path
+}
+
+func TestLoad_EnvOnly(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_USER", "admin")
+	t.Setenv("GITEA_PASSWORD", "secret")
+
+	config, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://gitea:3000", config.GiteaEndpoint)
+	assert.Equal(t, 8080, config.Port)
+	assert.Equal(t, 30*time.Second, config.CircuitBreakerOpenDuration)
+}
+
+func TestLoad_FileOverridesEnv(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_USER", "admin")
+	t.Setenv("GITEA_PASSWORD", "secret")
+	writeConfigFile(t, `
+giteaPassword: rotated
+usernamePrefix: keptn-
+giteaOAuth2Scopes: [admin, repo]
+circuitBreakerOpenDuration: 1m
+`)
+
+	config, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://gitea:3000", config.GiteaEndpoint)
+	assert.Equal(t, "admin", config.GiteaUser)
+	assert.Equal(t, "rotated", config.GiteaPassword)
+	assert.Equal(t, "keptn-", config.UsernamePrefix)
+	assert.Equal(t, []string{"admin", "repo"}, config.GiteaOAuth2Scopes)
+	assert.Equal(t, time.Minute, config.CircuitBreakerOpenDuration)
+	assert.Equal(t, 3, config.RetryMaxRetries)
+}
+
+func TestLoad_EmptyFile(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	writeConfigFile(t, "")
+
+	_, err := Load()
+	require.NoError(t, err)
+}
+
+func TestLoad_InvalidFile(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "unknown key", content: "usernamePrefx: keptn-"},
+		{name: "invalid duration", content: "retryMaxBackoff: soon"},
+		{name: "invalid endpoint", content: "giteaEndpoint: gitea"},
+		{name: "negative duration", content: "leaseLockTimeout: -1s"},
+		{name: "zero lease lock duration", content: "leaseLockEnabled: true\nleaseLockDuration: 0s"},
+		{name: "sub-second lease lock duration", content: "leaseLockEnabled: true\nleaseLockDuration: 500ms"},
+		{name: "zero lease lock timeout", content: "leaseLockEnabled: true\nleaseLockTimeout: 0s"},
+		{name: "zero leader election lease duration", content: "leaderElectionEnabled: true\nleaderElectionLeaseDuration: 0s"},
+		{name: "incomplete mTLS", content: "giteaClientCertFile: /etc/tls.crt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeConfigFile(t, test.content)
+
+			_, err := Load()
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestConfig_Validate_Credentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "password", config: Config{GiteaUser: "admin", GiteaPassword: "secret"}},
+		{name: "password without user", config: Config{GiteaPassword: "secret"}, wantErr: true},
+		{name: "token without user", config: Config{GiteaToken: "token"}},
+		{name: "oauth2", config: Config{GiteaOAuth2TokenURL: "http://idp/token", GiteaOAuth2ClientID: "id", GiteaOAuth2ClientSecret: "secret"}},
+		{name: "oauth2 without secret", config: Config{GiteaOAuth2TokenURL: "http://idp/token", GiteaOAuth2ClientID: "id"}, wantErr: true},
+		{name: "no credentials", config: Config{}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.GiteaEndpoint = "http://gitea:3000"
+			test.config.Port = 8080
+
+			err := test.config.Validate()
+			if test.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConfig_RestartRequiredChanges(t *testing.T) {
+	current := &Config{Port: 8080, GiteaPassword: "secret", InventoryInterval: time.Hour}
+	updated := &Config{Port: 9090, GiteaPassword: "rotated", InventoryInterval: time.Minute}
+
+	assert.Equal(t, []string{"InventoryInterval", "Port"}, current.RestartRequiredChanges(updated))
+	assert.Empty(t, current.RestartRequiredChanges(current))
+}
+
+func TestConfig_GiteaProvisionerOptions(t *testing.T) {
+	config := &Config{
+		UsernamePrefix:      "keptn-",
+		GiteaToken:          "token",
+		GiteaOAuth2TokenURL: "http://idp/token",
+		GiteaCAFile:         "/etc/ca.crt",
+		RetryMaxRetries:     5,
+	}
+
+	options := config.GiteaProvisionerOptions(nil)
+
+	assert.Equal(t, "keptn-", options.UsernamePrefix)
+	assert.Equal(t, "token", options.Authentication.Token)
+	assert.Equal(t, "http://idp/token", options.Authentication.OAuth2.TokenURL)
+	assert.Equal(t, "/etc/ca.crt", options.Transport.CAFile)
+	assert.Equal(t, 5, options.Resilience.MaxRetries)
+}
+
+func TestLoad_SecretFiles(t *testing.T) {
+	directory := t.TempDir()
+	tokenFile := filepath.Join(directory, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600))
+
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "env-token")
+	t.Setenv("GITEA_TOKEN_FILE", tokenFile)
+
+	config, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "file-token", config.GiteaToken)
+
+	t.Setenv("GITEA_TOKEN_FILE", filepath.Join(directory, "missing"))
+	_, err = Load()
+	require.Error(t, err)
+}
+
+func TestLoad_KeptnAPITokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "keptn-api-token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600))
+
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("KEPTN_API_ENDPOINT", "http://api-gateway-nginx.keptn/api")
+	t.Setenv("KEPTN_API_TOKEN_FILE", tokenFile)
+
+	config, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "file-token", config.KeptnAPIToken)
+	assert.True(t, config.Reloadable())
+}
+
+func TestLoad_Vault(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.URL.Path != "/v1/kv/data/gitea" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"data":{"data":{"giteaPassword":"vault-password"}}}`))
+	}))
+	defer vault.Close()
+
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_USER", "admin")
+	t.Setenv("GITEA_PASSWORD", "env-password")
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_KV_MOUNT", "kv")
+	t.Setenv("VAULT_SECRET_PATH", "gitea")
+
+	// Without a token the secret can't be read
+	_, err := Load()
+	require.Error(t, err)
+
+	t.Setenv("VAULT_TOKEN", "root")
+	config, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "vault-password", config.GiteaPassword)
+	assert.True(t, config.Reloadable())
+}
+
+func TestLoad_Policy(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("POLICY_RESERVED_NAMES", "admin,api")
+	t.Setenv("POLICY_MAX_PROJECTS_PER_NAMESPACE", "10")
+
+	config, err := Load()
+	require.NoError(t, err)
+
+	options := config.PolicyOptions()
+	assert.Equal(t, []string{"admin", "api"}, options.ReservedNames)
+	assert.Equal(t, 10, options.MaxProjectsPerNamespace)
+
+	t.Setenv("POLICY_PROJECT_PATTERN", "[a-z")
+	_, err = Load()
+	require.Error(t, err)
+}
+
+func TestLoad_Jobs(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("JOB_WORKERS", "2")
+	t.Setenv("JOB_RETENTION", "10m")
+
+	config, err := Load()
+	require.NoError(t, err)
+
+	options := config.JobOptions(nil)
+	assert.Equal(t, 2, options.Workers)
+	assert.Equal(t, 100, options.QueueSize)
+	assert.Equal(t, 10*time.Minute, options.Retention)
+
+	t.Setenv("JOB_QUEUE_SIZE", "-1")
+	_, err = Load()
+	require.Error(t, err)
+}
+
+func TestLoad_Quota(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("QUOTA_MAX_REPOSITORIES", "5")
+	t.Setenv("QUOTA_MAX_TOTAL_SIZE_MB", "2")
+	t.Setenv("POLICY_MAX_PROJECTS_PER_NAMESPACE", "3")
+
+	config, err := Load()
+	require.NoError(t, err)
+
+	options := config.GiteaProvisionerOptions(nil)
+	require.NotNil(t, options.Quota)
+	assert.Equal(t, 5, options.Quota.MaxRepositories)
+	assert.Equal(t, int64(2048), options.Quota.MaxTotalSizeKB)
+	assert.Equal(t, http.StatusForbidden, options.Quota.StatusCode)
+	assert.Equal(t, 3, options.Quota.MaxProjectsPerNamespace)
+
+	t.Setenv("QUOTA_STATUS_CODE", "500")
+	_, err = Load()
+	require.Error(t, err)
+}
+
+func TestLoad_Audit(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("AUDIT_LOG_FILE", "/var/log/gitea-provisioner/audit.jsonl")
+
+	config, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), config.AuditLogMaxSizeMB)
+	assert.Equal(t, 5, config.AuditLogMaxBackups)
+
+	t.Setenv("AUDIT_TRUSTED_PROXIES", "10.0.0.0/8,192.168.0.1")
+	config, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.0.1"}, config.AuditTrustedProxies)
+
+	t.Setenv("AUDIT_TRUSTED_PROXIES", "proxy")
+	_, err = Load()
+	require.Error(t, err)
+
+	t.Setenv("AUDIT_TRUSTED_PROXIES", "")
+	t.Setenv("AUDIT_WEBHOOK_URL", "siem.example.com/events")
+	_, err = Load()
+	require.Error(t, err)
+}
+
+func TestLoad_AuditTokenFiles(t *testing.T) {
+	directory := t.TempDir()
+	webhookTokenFile := filepath.Join(directory, "webhook-token")
+	require.NoError(t, ioutil.WriteFile(webhookTokenFile, []byte("webhook-token\n"), 0600))
+	queryTokenFile := filepath.Join(directory, "query-token")
+	require.NoError(t, ioutil.WriteFile(queryTokenFile, []byte("query-token\n"), 0600))
+
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("AUDIT_WEBHOOK_TOKEN", "env-token")
+	t.Setenv("AUDIT_WEBHOOK_TOKEN_FILE", webhookTokenFile)
+	t.Setenv("AUDIT_QUERY_TOKEN_FILE", queryTokenFile)
+
+	config, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "webhook-token", config.AuditWebhookToken)
+	assert.Equal(t, "query-token", config.AuditQueryToken)
+
+	t.Setenv("AUDIT_QUERY_TOKEN_FILE", filepath.Join(directory, "missing"))
+	_, err = Load()
+	require.Error(t, err)
+}
+
+func TestLoad_DeletionPolicy(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("DELETION_POLICY", "graveyard")
+
+	config, err := Load()
+	require.NoError(t, err)
+
+	options := config.GiteaProvisionerOptions(nil)
+	require.NotNil(t, options.Deletion)
+	assert.Equal(t, "graveyard", options.Deletion.Policy)
+	assert.Equal(t, "keptn-graveyard", options.Deletion.GraveyardOrganization)
+	assert.Equal(t, 30*24*time.Hour, options.Deletion.GraveyardRetention)
+
+	t.Setenv("DELETION_POLICY", "shred")
+	_, err = Load()
+	require.Error(t, err)
+}
+
+func TestLoad_Backup(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+
+	config, err := Load()
+	require.NoError(t, err)
+
+	store, err := config.BackupStore()
+	require.NoError(t, err)
+	assert.Nil(t, store)
+
+	t.Setenv("BACKUP_S3_ENDPOINT", "http://minio.minio:9000")
+	t.Setenv("BACKUP_S3_BUCKET", "backups")
+	t.Setenv("BACKUP_S3_ACCESS_KEY", "access")
+	t.Setenv("BACKUP_S3_SECRET_KEY", "secret")
+	t.Setenv("BACKUP_FORCE", "true")
+
+	config, err = Load()
+	require.NoError(t, err)
+
+	store, err = config.BackupStore()
+	require.NoError(t, err)
+	assert.NotNil(t, store)
+
+	options := config.GiteaProvisionerOptions(nil)
+	require.NotNil(t, options.Backup)
+	assert.True(t, options.Backup.Force)
+	assert.Equal(t, 5*time.Minute, options.Backup.Timeout)
+
+	t.Setenv("BACKUP_DIRECTORY", t.TempDir())
+	_, err = Load()
+	require.Error(t, err)
+}
+
+func TestLoad_BackupS3CredentialFiles(t *testing.T) {
+	directory := t.TempDir()
+	accessKeyFile := filepath.Join(directory, "access-key")
+	require.NoError(t, ioutil.WriteFile(accessKeyFile, []byte("file-access\n"), 0600))
+	secretKeyFile := filepath.Join(directory, "secret-key")
+	require.NoError(t, ioutil.WriteFile(secretKeyFile, []byte("file-secret\n"), 0600))
+
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("BACKUP_S3_ENDPOINT", "http://minio.minio:9000")
+	t.Setenv("BACKUP_S3_BUCKET", "backups")
+	t.Setenv("BACKUP_S3_ACCESS_KEY_FILE", accessKeyFile)
+	t.Setenv("BACKUP_S3_SECRET_KEY_FILE", secretKeyFile)
+
+	config, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "file-access", config.BackupS3AccessKey)
+	assert.Equal(t, "file-secret", config.BackupS3SecretKey)
+
+	t.Setenv("BACKUP_S3_SECRET_KEY_FILE", filepath.Join(directory, "missing"))
+	_, err = Load()
+	require.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"time"
+)
+
+// The Watcher periodically reloads the configuration and applies it if it changed. Since the configuration file,
+// secret files and secret sources are all part of the loaded configuration, changes of any of them are detected.
+// Polling is used instead of file system notifications since ConfigMaps and Secrets are updated by atomically
+// swapping symlinks and Vault doesn't notify about changes.
+type Watcher struct {
+	// Interval between two reloads of the configuration
+	Interval time.Duration
+	// Load reads and validates the configuration, a failing Load keeps the current configuration
+	Load func() (*Config, error)
+	// Apply is called with every new, valid configuration, a failing Apply keeps the current configuration and is
+	// retried on the next check
+	Apply func(config *Config) error
+	// Current is the configuration that has already been applied, Apply is called for the first loaded
+	// configuration if it is not set
+	Current *Config
+
+	lastErr      string
+	lastApplyErr string
+}
+
+// Run reloads the configuration every Interval until the context is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// Check reloads the configuration and returns true if a changed configuration has been applied
+func (w *Watcher) Check() bool {
+	config, err := w.Load()
+	if err != nil {
+		// The same error is only reported once to not flood the log every interval
+		if err.Error() != w.lastErr {
+			log.Printf("Rejected changed configuration, keeping the current one: %s\n", err)
+			w.lastErr = err.Error()
+		}
+
+		return false
+	}
+	w.lastErr = ""
+
+	if w.Current != nil && reflect.DeepEqual(config, w.Current) {
+		return false
+	}
+
+	// A failing configuration is retried on every check, e.g. after a transient error of Gitea, but the same error is
+	// only reported once
+	if err := w.Apply(config); err != nil {
+		if err.Error() != w.lastApplyErr {
+			log.Printf("Unable to apply changed configuration, keeping the current one: %s\n", err)
+			w.lastApplyErr = err.Error()
+		}
+
+		return false
+	}
+	w.lastApplyErr = ""
+	w.Current = config
+
+	log.Printf("Applied changed configuration\n")
+	return true
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher_Check(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_USER", "admin")
+	path := writeConfigFile(t, "giteaPassword: secret")
+
+	var applied []string
+	watcher := Watcher{
+		Load: Load,
+		Apply: func(config *Config) error {
+			applied = append(applied, config.GiteaPassword)
+			return nil
+		},
+	}
+
+	// The first check applies the configuration since no current configuration is set
+	assert.True(t, watcher.Check())
+	assert.False(t, watcher.Check())
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("giteaPassword: rotated"), 0600))
+	assert.True(t, watcher.Check())
+
+	// An invalid config is rejected and not applied
+	require.NoError(t, ioutil.WriteFile(path, []byte("giteaEndpoint: not-a-url"), 0600))
+	assert.False(t, watcher.Check())
+
+	assert.Equal(t, []string{"secret", "rotated"}, applied)
+}
+
+func TestWatcher_Check_SecretFile(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600))
+
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_USER", "admin")
+	t.Setenv("GITEA_PASSWORD_FILE", passwordFile)
+
+	current, err := Load()
+	require.NoError(t, err)
+	assert.True(t, current.Reloadable())
+
+	var applied []string
+	watcher := Watcher{
+		Load:    Load,
+		Current: current,
+		Apply: func(config *Config) error {
+			applied = append(applied, config.GiteaPassword)
+			return nil
+		},
+	}
+
+	assert.False(t, watcher.Check())
+
+	require.NoError(t, ioutil.WriteFile(passwordFile, []byte("rotated\n"), 0600))
+	assert.True(t, watcher.Check())
+	assert.Equal(t, []string{"rotated"}, applied)
+}
+
+func TestWatcher_Check_ApplyFails(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_USER", "admin")
+	writeConfigFile(t, "giteaPassword: secret")
+
+	calls := 0
+	var applyErr error = errors.New("gitea not reachable")
+	watcher := Watcher{
+		Load: Load,
+		Apply: func(config *Config) error {
+			calls++
+			return applyErr
+		},
+	}
+
+	assert.False(t, watcher.Check())
+	assert.Nil(t, watcher.Current)
+
+	// The configuration is applied again until it succeeds
+	applyErr = nil
+	assert.True(t, watcher.Check())
+	assert.False(t, watcher.Check())
+	assert.Equal(t, 2, calls)
+}
+
+func TestWatcher_Check_MissingFile(t *testing.T) {
+	t.Setenv("GITEA_ENDPOINT", "http://gitea:3000")
+	t.Setenv("GITEA_TOKEN", "token")
+	t.Setenv("CONFIG_FILE", "/does/not/exist.yaml")
+
+	watcher := Watcher{
+		Load: Load,
+		Apply: func(config *Config) error {
+			t.Fatal("apply must not be called")
+			return nil
+		},
+	}
+
+	assert.False(t, watcher.Check())
+}
@@ -0,0 +1,205 @@
+package keptn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/keptn/go-utils/pkg/api/models"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+)
+
+// Types of the CloudEvents that are sent on provisioning lifecycle changes
+const (
+	UpstreamProvisionedEventType = "sh.keptn.event.upstream.provisioned"
+	UpstreamDeletedEventType     = "sh.keptn.event.upstream.deleted"
+	UpstreamFailedEventType      = "sh.keptn.event.upstream.failed"
+)
+
+// EventSource is the source of all events sent by the provisioner
+const EventSource = "keptn-gitea-provisioner-service"
+
+// DefaultEventTimeout is the timeout of a single request against the Keptn API
+const DefaultEventTimeout = 5 * time.Second
+
+// DefaultEventQueueSize limits the number of events that wait to be sent by Enqueue
+const DefaultEventQueueSize = 1000
+
+// ErrEventQueueFull indicates that an event has been dropped because the queue of the EventPublisher is full
+var /*const*/ ErrEventQueueFull = errors.New("the Keptn event queue is full")
+
+// apiTokenHeader is the header the Keptn API token is sent in
+const apiTokenHeader = "x-token"
+
+// UpstreamEventData is the data of the upstream lifecycle events, it never contains the access token
+type UpstreamEventData struct {
+	Project   string `json:"project"`
+	Namespace string `json:"namespace"`
+	// Action is either provision, delete, restore or rename, the project of a rename is the new project
+	Action       string `json:"action"`
+	GitRemoteURL string `json:"gitRemoteURL,omitempty"`
+	GitUser      string `json:"gitUser,omitempty"`
+	// Message describes why the action failed
+	Message string `json:"message,omitempty"`
+}
+
+// EventSender sends an event to the Keptn API, it is implemented by api.APIHandler
+type EventSender interface {
+	SendEvent(event models.KeptnContextExtendedCE) (*models.EventContext, *models.Error)
+}
+
+// queuedEvent is an event that waits to be sent by the EventPublisher
+type queuedEvent struct {
+	eventType string
+	data      UpstreamEventData
+}
+
+// EventPublisher sends the upstream lifecycle events to the Keptn API of the namespace the upstream belongs to
+type EventPublisher struct {
+	endpoint  *template.Template
+	token     string
+	newSender func(endpoint string, token string) (EventSender, error)
+	queue     chan queuedEvent
+	// pending counts the queued events and the event that is being sent, idle is signalled once it drops to 0
+	mutex   sync.Mutex
+	idle    *sync.Cond
+	pending int
+}
+
+// NewEventPublisher creates an EventPublisher. The endpoint of the Keptn API is rendered from endpointTemplate, which
+// can refer to the Keptn {{ .Namespace }}, e.g. http://api-gateway-nginx.{{ .Namespace }}/api. The events of Enqueue
+// are sent by a goroutine that runs for the lifetime of the process.
+func NewEventPublisher(endpointTemplate string, token string) (*EventPublisher, error) {
+	endpoint, err := template.New("keptn-api-endpoint").Option("missingkey=error").Parse(endpointTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Keptn API endpoint template: %w", err)
+	}
+
+	publisher := &EventPublisher{
+		endpoint:  endpoint,
+		token:     token,
+		newSender: newAPISender,
+		queue:     make(chan queuedEvent, DefaultEventQueueSize),
+	}
+	publisher.idle = sync.NewCond(&publisher.mutex)
+
+	go publisher.run()
+
+	return publisher, nil
+}
+
+// run sends the queued events, failures are logged since the request has already been answered
+func (e *EventPublisher) run() {
+	for event := range e.queue {
+		if err := e.Publish(event.eventType, event.data); err != nil {
+			log.Printf("Unable to publish event for project %s: %s\n", event.data.Project, err)
+		}
+
+		e.done()
+	}
+}
+
+// Enqueue queues the event such that it is sent in the background, ErrEventQueueFull is returned if the event has
+// been dropped
+func (e *EventPublisher) Enqueue(eventType string, data UpstreamEventData) error {
+	e.mutex.Lock()
+	e.pending++
+	e.mutex.Unlock()
+
+	select {
+	case e.queue <- queuedEvent{eventType: eventType, data: data}:
+		return nil
+	default:
+		e.done()
+		return ErrEventQueueFull
+	}
+}
+
+// done removes an event from the pending events
+func (e *EventPublisher) done() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.pending--
+	if e.pending == 0 {
+		e.idle.Broadcast()
+	}
+}
+
+// Flush waits until all queued events have been sent or the context is done
+func (e *EventPublisher) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+		for e.pending > 0 {
+			e.idle.Wait()
+		}
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newAPISender creates an api.APIHandler for the given Keptn API endpoint
+func newAPISender(endpoint string, token string) (EventSender, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("keptn API endpoint %s is not an absolute URL", endpoint)
+	}
+
+	httpClient := &http.Client{Timeout: DefaultEventTimeout}
+	return api.NewAuthenticatedAPIHandler(endpoint, token, apiTokenHeader, httpClient, parsed.Scheme), nil
+}
+
+// Endpoint returns the endpoint of the Keptn API of the given namespace
+func (e *EventPublisher) Endpoint(namespace string) (string, error) {
+	var endpoint bytes.Buffer
+	if err := e.endpoint.Execute(&endpoint, struct{ Namespace string }{Namespace: namespace}); err != nil {
+		return "", fmt.Errorf("unable to render Keptn API endpoint: %w", err)
+	}
+
+	return endpoint.String(), nil
+}
+
+// Publish sends an event of the given type with the data to the Keptn API of the namespace of the data
+func (e *EventPublisher) Publish(eventType string, data UpstreamEventData) error {
+	endpoint, err := e.Endpoint(data.Namespace)
+	if err != nil {
+		return err
+	}
+
+	sender, err := e.newSender(endpoint, e.token)
+	if err != nil {
+		return err
+	}
+
+	source := EventSource
+	_, apiErr := sender.SendEvent(models.KeptnContextExtendedCE{
+		Contenttype:        "application/json",
+		Data:               data,
+		Source:             &source,
+		Specversion:        "1.0",
+		Shkeptnspecversion: "0.2.4",
+		Time:               time.Now().UTC(),
+		Type:               &eventType,
+	})
+	if apiErr != nil {
+		return fmt.Errorf("unable to send %s event: %s", eventType, apiErr.GetMessage())
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package keptn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receivedEvent is the part of the CloudEvent that is checked by the tests
+type receivedEvent struct {
+	Type   string            `json:"type"`
+	Source string            `json:"source"`
+	Data   UpstreamEventData `json:"data"`
+}
+
+func TestEventPublisher_Publish(t *testing.T) {
+	var received []receivedEvent
+	var paths []string
+	var tokens []string
+
+	// Stand-in for the Keptn API of the namespace
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		tokens = append(tokens, r.Header.Get("x-token"))
+
+		var event receivedEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received = append(received, event)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"keptnContext":"4b1c9d1c-8c5c-4c4f-9f2b-0b1f1b3c1a2d"}`))
+	}))
+	defer server.Close()
+
+	publisher, err := NewEventPublisher(server.URL+"/{{ .Namespace }}/api", "api-token")
+	require.NoError(t, err)
+
+	err = publisher.Publish(UpstreamProvisionedEventType, UpstreamEventData{
+		Project:      "podtato-head",
+		Namespace:    "keptn",
+		Action:       "provision",
+		GitRemoteURL: "http://gitea:3000/keptn/podtato-head.git",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, received, 1)
+	assert.Equal(t, "/keptn/api/v1/event", paths[0])
+	assert.Equal(t, "api-token", tokens[0])
+	assert.Equal(t, UpstreamProvisionedEventType, received[0].Type)
+	assert.Equal(t, EventSource, received[0].Source)
+	assert.Equal(t, "podtato-head", received[0].Data.Project)
+	assert.Equal(t, "http://gitea:3000/keptn/podtato-head.git", received[0].Data.GitRemoteURL)
+}
+
+func TestEventPublisher_PublishFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code":401,"message":"invalid token"}`))
+	}))
+	defer server.Close()
+
+	publisher, err := NewEventPublisher(server.URL+"/api", "wrong-token")
+	require.NoError(t, err)
+
+	err = publisher.Publish(UpstreamDeletedEventType, UpstreamEventData{Project: "podtato-head", Namespace: "keptn"})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), UpstreamDeletedEventType))
+}
+
+func TestEventPublisher_Enqueue(t *testing.T) {
+	var mutex sync.Mutex
+	var received []receivedEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event receivedEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+
+		mutex.Lock()
+		received = append(received, event)
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"keptnContext":"4b1c9d1c-8c5c-4c4f-9f2b-0b1f1b3c1a2d"}`))
+	}))
+	defer server.Close()
+
+	publisher, err := NewEventPublisher(server.URL+"/api", "api-token")
+	require.NoError(t, err)
+
+	require.NoError(t, publisher.Enqueue(UpstreamProvisionedEventType, UpstreamEventData{Project: "one", Namespace: "keptn"}))
+	require.NoError(t, publisher.Enqueue(UpstreamDeletedEventType, UpstreamEventData{Project: "two", Namespace: "keptn"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, publisher.Flush(ctx))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, received, 2)
+	assert.Equal(t, "one", received[0].Data.Project)
+	assert.Equal(t, UpstreamDeletedEventType, received[1].Type)
+}
+
+func TestEventPublisher_Endpoint(t *testing.T) {
+	publisher, err := NewEventPublisher("http://api-gateway-nginx.{{ .Namespace }}/api", "token")
+	require.NoError(t, err)
+
+	endpoint, err := publisher.Endpoint("keptn-dev")
+	require.NoError(t, err)
+	assert.Equal(t, "http://api-gateway-nginx.keptn-dev/api", endpoint)
+
+	_, err = NewEventPublisher("http://{{ .Namespace", "token")
+	require.Error(t, err)
+
+	publisher, err = NewEventPublisher("api-gateway-nginx/api", "token")
+	require.NoError(t, err)
+	require.Error(t, publisher.Publish(UpstreamDeletedEventType, UpstreamEventData{Namespace: "keptn"}))
+}
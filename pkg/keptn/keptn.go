@@ -12,3 +12,20 @@ type ProvisionResponse struct {
 	GitToken     string `json:"gitToken"`
 	GitUser      string `json:"gitUser"`
 }
+
+// RenameRequest represents the request body of a rename, NewProject is the project the repository is renamed to
+type RenameRequest struct {
+	Project    string `json:"project"`
+	Namespace  string `json:"namespace"`
+	NewProject string `json:"newProject"`
+}
+
+// RenameResponse contains the credentials of the renamed repository like a ProvisionResponse, and how the git server
+// treats the previous remote URL
+type RenameResponse struct {
+	ProvisionResponse
+	// PreviousGitRemoteURL is the remote URL of the repository before the rename
+	PreviousGitRemoteURL string `json:"previousGitRemoteURL"`
+	// Redirect describes the redirect of the previous remote URL
+	Redirect string `json:"redirect"`
+}
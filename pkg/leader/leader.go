@@ -0,0 +1,175 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Elector decides whether the current replica is allowed to run singleton background work
+type Elector interface {
+	// Run blocks until the context is done and calls onStartedLeading with a context that is cancelled as soon as the
+	// leadership is lost
+	Run(ctx context.Context, onStartedLeading func(ctx context.Context))
+}
+
+// AlwaysLeader is an Elector for single replica deployments, the replica is always the leader
+type AlwaysLeader struct{}
+
+// Run calls onStartedLeading immediately and blocks until it returns
+func (AlwaysLeader) Run(ctx context.Context, onStartedLeading func(ctx context.Context)) {
+	onStartedLeading(ctx)
+}
+
+// LeaseElector is an Elector that uses a Kubernetes Lease to elect a single leader among all replicas
+type LeaseElector struct {
+	config leaderelection.LeaderElectionConfig
+}
+
+// NewLeaseElector creates a new LeaseElector that competes for the Lease with the given name in the given Kubernetes
+// namespace. The identity must be unique among all replicas (e.g. the pod name).
+func NewLeaseElector(client kubernetes.Interface, namespace string, name string, identity string, leaseDuration time.Duration) *LeaseElector {
+	return &LeaseElector{
+		config: leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+				},
+				Client: client.CoordinationV1(),
+				LockConfig: resourcelock.ResourceLockConfig{
+					Identity: identity,
+				},
+			},
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   leaseDuration * 2 / 3,
+			RetryPeriod:     leaseDuration / 6,
+			ReleaseOnCancel: true,
+			Name:            name,
+		},
+	}
+}
+
+// Run campaigns for the leadership until the context is done, if the leadership is lost the replica stops its work
+// and campaigns again
+func (e *LeaseElector) Run(ctx context.Context, onStartedLeading func(ctx context.Context)) {
+	identity := e.config.Lock.Identity()
+
+	config := e.config
+	config.Callbacks = leaderelection.LeaderCallbacks{
+		OnStartedLeading: func(ctx context.Context) {
+			log.Printf("%s started leading\n", identity)
+			onStartedLeading(ctx)
+		},
+		OnStoppedLeading: func() {
+			log.Printf("%s stopped leading\n", identity)
+		},
+		OnNewLeader: func(leader string) {
+			if leader != identity {
+				log.Printf("%s is the current leader\n", leader)
+			}
+		},
+	}
+
+	elector, err := leaderelection.NewLeaderElector(config)
+	if err != nil {
+		log.Printf("Unable to create leader elector: %s\n", err)
+		return
+	}
+
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+}
+
+// Job is a background task that must only be executed by one replica at a time
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+	// Modifies is true for jobs that change external state, e.g. delete objects in Gitea
+	Modifies bool
+}
+
+// Scheduler executes a set of Jobs periodically
+type Scheduler struct {
+	// ReadOnly ignores the jobs that modify external state, e.g. during a dry run
+	ReadOnly bool
+
+	jobs []Job
+}
+
+// Add registers a job at the scheduler, jobs with an interval <= 0 and modifying jobs of a read-only scheduler are
+// ignored
+func (s *Scheduler) Add(job Job) {
+	if job.Interval <= 0 {
+		return
+	}
+
+	if s.ReadOnly && job.Modifies {
+		log.Printf("Skipping background job %s, it modifies external state and the scheduler is read-only\n", job.Name)
+		return
+	}
+
+	s.jobs = append(s.jobs, job)
+}
+
+// Jobs returns the names of all registered jobs
+func (s *Scheduler) Jobs() []string {
+	names := make([]string, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		names = append(names, job.Name)
+	}
+
+	return names
+}
+
+// Run executes every registered job immediately and then in its interval until the context is done
+func (s *Scheduler) Run(ctx context.Context) {
+	done := make(chan struct{})
+	for _, job := range s.jobs {
+		go func(job Job) {
+			defer func() { done <- struct{}{} }()
+			runPeriodically(ctx, job)
+		}(job)
+	}
+
+	for range s.jobs {
+		<-done
+	}
+}
+
+// runPeriodically runs the job until the context is done, errors are logged and don't stop the job
+func runPeriodically(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := runJob(ctx, job); err != nil && ctx.Err() == nil {
+			log.Printf("Background job %s failed: %s\n", job.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJob runs the job once and converts a panic into an error, such that a broken job doesn't kill the service
+func runJob(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return job.Run(ctx)
+}
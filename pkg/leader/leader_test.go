@@ -0,0 +1,112 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler_ReadOnly(t *testing.T) {
+	run := func(ctx context.Context) error {
+		return nil
+	}
+
+	scheduler := Scheduler{ReadOnly: true}
+	scheduler.Add(Job{Name: "inventory", Interval: time.Minute, Run: run})
+	scheduler.Add(Job{Name: "cleanup", Interval: time.Minute, Run: run, Modifies: true})
+
+	assert.Equal(t, []string{"inventory"}, scheduler.Jobs())
+
+	scheduler = Scheduler{}
+	scheduler.Add(Job{Name: "cleanup", Interval: time.Minute, Run: run, Modifies: true})
+
+	assert.Equal(t, []string{"cleanup"}, scheduler.Jobs())
+}
+
+func TestScheduler_RunsJobsUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var mutex sync.Mutex
+	runs := map[string]int{}
+	count := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			runs[name]++
+			if runs["failing"] >= 2 && runs["panicking"] >= 2 {
+				cancel()
+			}
+
+			if name == "panicking" {
+				panic("broken job")
+			}
+
+			return fmt.Errorf("job %s failed", name)
+		}
+	}
+
+	scheduler := Scheduler{}
+	scheduler.Add(Job{Name: "failing", Interval: time.Millisecond, Run: count("failing")})
+	scheduler.Add(Job{Name: "panicking", Interval: time.Millisecond, Run: count("panicking")})
+	scheduler.Add(Job{Name: "disabled", Interval: 0, Run: count("disabled")})
+
+	assert.Equal(t, []string{"failing", "panicking"}, scheduler.Jobs())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		AlwaysLeader{}.Run(ctx, scheduler.Run)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler did not stop")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.GreaterOrEqual(t, runs["failing"], 2)
+	assert.GreaterOrEqual(t, runs["panicking"], 2)
+	assert.Equal(t, 0, runs["disabled"])
+}
+
+func TestLeaseElector_OnlyOneLeader(t *testing.T) {
+	clientset := k8sfake.NewSimpleClientset()
+	first := NewLeaseElector(clientset, "keptn", "provisioner-leader", "replica-1", 3*time.Second)
+	second := NewLeaseElector(clientset, "keptn", "provisioner-leader", "replica-2", 3*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leading := make(chan string, 2)
+	run := func(elector *LeaseElector, identity string) {
+		elector.Run(ctx, func(ctx context.Context) {
+			leading <- identity
+			<-ctx.Done()
+		})
+	}
+
+	go run(first, "replica-1")
+
+	select {
+	case identity := <-leading:
+		require.Equal(t, "replica-1", identity)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no leader was elected")
+	}
+
+	go run(second, "replica-2")
+
+	select {
+	case identity := <-leading:
+		t.Fatalf("%s must not lead while replica-1 holds the lease", identity)
+	case <-time.After(time.Second):
+	}
+}
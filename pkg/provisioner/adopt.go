@@ -0,0 +1,163 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"code.gitea.io/sdk/gitea"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+)
+
+// AdoptRepository puts an existing Gitea repository, e.g. created by hand before the provisioner was installed, under
+// the management of the provisioner. The repository is transferred to the user of the namespace, renamed to the
+// repository name of the project and gets the description of a provisioned repository, such that it is treated like
+// a provisioned repository afterwards. A new access token is issued for the project, the token of a namespace that
+// provisioned the repository for the same project before is revoked.
+func (h *GiteaProvisioner) AdoptRepository(namespace string, project string, owner string, repository string) (*keptn.ProvisionResponse, error) {
+	if project == "" {
+		return nil, fmt.Errorf("%w: unable to adopt a repository for a project with an empty name", ErrInvalidRequest)
+	}
+
+	if owner == "" || repository == "" {
+		return nil, fmt.Errorf("%w: the owner and name of the adopted repository are required", ErrInvalidRequest)
+	}
+
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	response, previousOwner, err := h.adoptRepository(namespace, project, owner, repository)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// The namespace that provisioned the repository before lost its access with the transfer, its token and user are
+	// cleaned up under its own lock. A failed cleanup only leaves an unused token or user behind.
+	if previousOwner != nil {
+		previousNamespace := h.namespaceOfUser(previousOwner)
+		if err := h.releasePreviousOwner(previousNamespace, project); err != nil {
+			log.Printf("Unable to clean up namespace %s after the adoption of project %s: %s\n", previousNamespace, project, err)
+		}
+	}
+
+	return response, nil
+}
+
+// adoptRepository adopts the repository while holding the lock of the namespace. If the repository has been
+// provisioned for the same project by another namespace, its managed user is returned as well.
+func (h *GiteaProvisioner) adoptRepository(namespace string, project string, owner string, repository string) (*keptn.ProvisionResponse, *gitea.User, error) {
+	objects := h.GiteaObjects(namespace, project)
+
+	source, err := h.getRepository(owner, repository)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Repositories that are already provisioned for a different project must not be taken over
+	provisioned := strings.HasPrefix(source.Description, projectDescriptionPrefix)
+	if provisioned && h.projectOfRepository(source) != project {
+		return nil, nil, fmt.Errorf("%w: repository %s/%s is already provisioned for project %s",
+			ErrNameCollision, owner, repository, h.projectOfRepository(source),
+		)
+	}
+
+	// Adopting a repository that is already in place only marks it as provisioned
+	inPlace := owner == objects.User && repository == objects.Repository
+	if !inPlace {
+		_, err := h.getRepository(objects.User, objects.Repository)
+		if err == nil {
+			return nil, nil, fmt.Errorf("%w: %s/%s", ErrRepositoryAlreadyExists, objects.User, objects.Repository)
+		}
+
+		if !errors.Is(err, ErrRepositoryDoesNotExist) {
+			return nil, nil, err
+		}
+	}
+
+	var previousOwner *gitea.User
+	if owner != objects.User {
+		if err := h.checkQuota(namespace); err != nil {
+			return nil, nil, err
+		}
+
+		if provisioned {
+			previousOwner, err = h.managedOwner(owner)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if _, err := h.CreateUser(namespace); err != nil {
+		return nil, nil, fmt.Errorf("unable to create user: %w", err)
+	}
+
+	if owner != objects.User {
+		_, _, err := h.client.TransferRepo(owner, repository, gitea.TransferRepoOption{NewOwner: objects.User})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to transfer repository %s/%s to %s: %w", owner, repository, objects.User, err)
+		}
+	}
+
+	description := projectDescription(project)
+	option := gitea.EditRepoOption{Description: &description}
+	if repository != objects.Repository {
+		option.Name = &objects.Repository
+	}
+
+	adopted, _, err := h.client.EditRepo(objects.User, repository, option)
+	if err != nil {
+		// Transfer the repository back, such that the adoption can be retried
+		if owner != objects.User {
+			if _, _, transferErr := h.client.TransferRepo(objects.User, repository, gitea.TransferRepoOption{NewOwner: owner}); transferErr != nil {
+				log.Printf("Unable to transfer repository %s/%s back to %s: %s\n", objects.User, repository, owner, transferErr)
+			}
+		}
+
+		return nil, nil, fmt.Errorf("unable to rename repository %s/%s to %s: %w", objects.User, repository, objects.Repository, err)
+	}
+
+	log.Printf("Adopted repository %s/%s as %s/%s for project %s\n", owner, repository, objects.User, objects.Repository, project)
+
+	response, err := h.issueToken(namespace, project, adopted.CloneURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return response, previousOwner, nil
+}
+
+// managedOwner returns the owner of a repository if it is a user created by the provisioner, nil otherwise
+func (h *GiteaProvisioner) managedOwner(owner string) (*gitea.User, error) {
+	user, r, err := h.client.GetUserInfo(owner)
+	if r != nil && r.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user info for user %s: %w", owner, err)
+	}
+
+	if !h.isManagedUser(user) || !h.isProvisionedUser(user) {
+		return nil, nil
+	}
+
+	return user, nil
+}
+
+// releasePreviousOwner revokes the token of the project in the namespace that provisioned an adopted repository before
+func (h *GiteaProvisioner) releasePreviousOwner(namespace string, project string) error {
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return h.releaseProject(namespace, project)
+}
@@ -0,0 +1,129 @@
+package provisioner
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+)
+
+func TestGiteaProvisioner_AdoptRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	name := "project-podtato"
+	description := projectDescription("podtato")
+	giteaClient.EXPECT().GetRepo("ops", "podtato-head").Times(1).Return(&gitea.Repository{Name: "podtato-head"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	expectNewUser(giteaClient)
+	giteaClient.EXPECT().TransferRepo("ops", "podtato-head", gitea.TransferRepoOption{NewOwner: "keptn-dev"}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusAccepted), nil)
+	giteaClient.EXPECT().EditRepo("keptn-dev", "podtato-head", gitea.EditRepoOption{Name: &name, Description: &description}).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn-dev/project-podtato.git"}, createResponse(http.StatusOK), nil)
+	expectNewToken(giteaClient)
+
+	response, err := giteaProvisioner.AdoptRepository("dev", "podtato", "ops", "podtato-head")
+	require.NoError(t, err)
+	assert.Equal(t, "http://gitea/keptn-dev/project-podtato.git", response.GitRemoteURL)
+	assert.Equal(t, "keptn-dev", response.GitUser)
+	assert.Equal(t, "restored-token", response.GitToken)
+}
+
+func TestGiteaProvisioner_AdoptRepositoryInPlace(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	// The repository already has the provisioned name, it is neither transferred nor renamed
+	description := projectDescription("podtato")
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(1).Return(&gitea.User{UserName: "keptn-dev"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().EditRepo("keptn-dev", "project-podtato", gitea.EditRepoOption{Description: &description}).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn-dev/project-podtato.git"}, createResponse(http.StatusOK), nil)
+	expectNewToken(giteaClient)
+
+	_, err := giteaProvisioner.AdoptRepository("dev", "podtato", "keptn-dev", "project-podtato")
+	require.NoError(t, err)
+}
+
+func TestGiteaProvisioner_AdoptRepositoryConflicts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("ops", "missing").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	_, err := giteaProvisioner.AdoptRepository("dev", "podtato", "ops", "missing")
+	assert.ErrorIs(t, err, ErrRepositoryDoesNotExist)
+
+	// The project already has a repository
+	giteaClient.EXPECT().GetRepo("ops", "podtato-head").Times(1).Return(&gitea.Repository{Name: "podtato-head"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	_, err = giteaProvisioner.AdoptRepository("dev", "podtato", "ops", "podtato-head")
+	assert.ErrorIs(t, err, ErrRepositoryAlreadyExists)
+
+	// The repository is provisioned for a different project
+	giteaClient.EXPECT().GetRepo("keptn-prod", "project-other").Times(1).Return(&gitea.Repository{Name: "project-other", Description: projectDescription("other")}, createResponse(http.StatusOK), nil)
+	_, err = giteaProvisioner.AdoptRepository("dev", "podtato", "keptn-prod", "project-other")
+	assert.ErrorIs(t, err, ErrNameCollision)
+
+	_, err = giteaProvisioner.AdoptRepository("dev", "podtato", "", "podtato-head")
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func TestGiteaProvisioner_AdoptRepositoryRenameFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("ops", "podtato-head").Times(1).Return(&gitea.Repository{Name: "podtato-head"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	expectNewUser(giteaClient)
+	gomock.InOrder(
+		giteaClient.EXPECT().TransferRepo("ops", "podtato-head", gitea.TransferRepoOption{NewOwner: "keptn-dev"}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusAccepted), nil),
+		giteaClient.EXPECT().EditRepo("keptn-dev", "podtato-head", gomock.Any()).Times(1).Return(nil, createResponse(http.StatusInternalServerError), errors.New("500 Internal Server Error")),
+		// The repository is transferred back, such that the adoption can be retried
+		giteaClient.EXPECT().TransferRepo("keptn-dev", "podtato-head", gitea.TransferRepoOption{NewOwner: "ops"}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusAccepted), nil),
+	)
+	giteaClient.EXPECT().CreateAccessToken(gomock.Any()).Times(0)
+
+	_, err := giteaProvisioner.AdoptRepository("dev", "podtato", "ops", "podtato-head")
+	require.Error(t, err)
+}
+
+func TestGiteaProvisioner_AdoptRepositoryOfAnotherNamespace(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	// The repository has been provisioned for the same project by the prod namespace
+	giteaClient.EXPECT().GetRepo("keptn-prod", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato", Description: projectDescription("podtato")}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().GetUserInfo("keptn-prod").Times(1).Return(&gitea.User{UserName: "keptn-prod", FullName: "prod", Email: "keptn-prod@provisioner.local"}, createResponse(http.StatusOK), nil)
+	expectNewUser(giteaClient)
+	giteaClient.EXPECT().TransferRepo("keptn-prod", "project-podtato", gitea.TransferRepoOption{NewOwner: "keptn-dev"}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusAccepted), nil)
+	giteaClient.EXPECT().EditRepo("keptn-dev", "project-podtato", gomock.Any()).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn-dev/project-podtato.git"}, createResponse(http.StatusOK), nil)
+	expectNewToken(giteaClient)
+
+	// The token of the prod namespace is revoked and its user deleted, since it owns no other repository
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(1).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminDeleteUser("keptn-prod").Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	response, err := giteaProvisioner.AdoptRepository("dev", "podtato", "keptn-prod", "project-podtato")
+	require.NoError(t, err)
+	assert.Equal(t, "restored-token", response.GitToken)
+}
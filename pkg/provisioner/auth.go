@@ -0,0 +1,150 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"code.gitea.io/sdk/gitea"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// ErrMissingCredentials indicates that neither a password, an access token nor OAuth2 client credentials are configured
+var /*const*/ ErrMissingCredentials = errors.New("no credentials for the Gitea admin user configured")
+
+// oauth2PasswordPlaceholder is set as basic auth password until the transport replaces it with the current OAuth2 token
+const oauth2PasswordPlaceholder = "x-oauth2-token"
+
+// AuthenticationOptions defines how the provisioner authenticates against Gitea if no admin password should be used
+type AuthenticationOptions struct {
+	// Token is an access token of the admin user, it is used instead of the admin password
+	Token string
+	// OAuth2 enables fetching access tokens of the admin user with the OAuth2 client credentials flow
+	OAuth2 *OAuth2Options
+}
+
+// OAuth2Options contains the configuration of the OAuth2 client credentials flow
+type OAuth2Options struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// oauth2BasicAuthTransport replaces the basic auth password of every request with the current OAuth2 access token
+type oauth2BasicAuthTransport struct {
+	base        http.RoundTripper
+	tokenSource oauth2.TokenSource
+}
+
+// RoundTrip fetches a (cached) OAuth2 access token and uses it as basic auth password
+func (t *oauth2BasicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch OAuth2 access token: %w", err)
+	}
+
+	username, _, ok := req.BasicAuth()
+	request := req.Clone(req.Context())
+	if ok {
+		request.SetBasicAuth(username, token.AccessToken)
+	} else {
+		request.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}
+
+	return t.base.RoundTrip(request)
+}
+
+// combineClientOptions merges multiple gitea.ClientOption into a single one
+func combineClientOptions(options ...gitea.ClientOption) gitea.ClientOption {
+	return func(client *gitea.Client) error {
+		for _, option := range options {
+			if err := option(client); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// buildCredentials creates the gitea.ClientOption that authenticates the admin user.
+//
+// Gitea only allows to manage access tokens of a user with basic auth, but accepts access tokens (and OAuth2 tokens)
+// as basic auth password. Therefore, tokens are always sent as basic auth password of the admin user, which keeps the
+// sudo-based token creation for namespace users working without knowing the admin password.
+func buildCredentials(adminUsername string, adminPassword string, auth *AuthenticationOptions, httpClient *http.Client) (gitea.ClientOption, error) {
+	if auth != nil && auth.OAuth2 != nil {
+		config := clientcredentials.Config{
+			ClientID:     auth.OAuth2.ClientID,
+			ClientSecret: auth.OAuth2.ClientSecret,
+			TokenURL:     auth.OAuth2.TokenURL,
+			Scopes:       auth.OAuth2.Scopes,
+		}
+
+		base := httpClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+
+		// The token endpoint must be reached with the same transport (e.g. proxy, TLS) as Gitea itself
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: base})
+		oauth2Client := &http.Client{
+			Transport: &oauth2BasicAuthTransport{base: base, tokenSource: config.TokenSource(ctx)},
+			Timeout:   httpClient.Timeout,
+		}
+
+		return combineClientOptions(
+			gitea.SetHTTPClient(oauth2Client),
+			gitea.SetBasicAuth(adminUsername, oauth2PasswordPlaceholder),
+		), nil
+	}
+
+	if auth != nil && auth.Token != "" {
+		return combineClientOptions(
+			gitea.SetHTTPClient(httpClient),
+			gitea.SetBasicAuth(adminUsername, auth.Token),
+		), nil
+	}
+
+	if adminPassword == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	return combineClientOptions(
+		gitea.SetHTTPClient(httpClient),
+		gitea.SetBasicAuth(adminUsername, adminPassword),
+	), nil
+}
+
+// resolveAdminUsername queries the name of the user the configured token or OAuth2 client belongs to, this allows
+// to omit the admin username if the admin is authenticated by a token
+func resolveAdminUsername(endpoint string, auth *AuthenticationOptions, httpClient *http.Client, clientBuilder func(url string, options ...gitea.ClientOption) (GiteaClient, error)) (string, error) {
+	if auth == nil || (auth.Token == "" && auth.OAuth2 == nil) {
+		return "", fmt.Errorf("%w: the admin username is required for password authentication", ErrMissingCredentials)
+	}
+
+	// Without a username the OAuth2 transport sends the access token as bearer token
+	credentials, err := buildCredentials("", "", auth, httpClient)
+	if err != nil {
+		return "", err
+	}
+
+	if auth.OAuth2 == nil {
+		credentials = combineClientOptions(gitea.SetHTTPClient(httpClient), gitea.SetToken(auth.Token))
+	}
+
+	client, err := clientBuilder(endpoint, credentials)
+	if err != nil {
+		return "", fmt.Errorf("unable to create Gitea Client: %w", err)
+	}
+
+	user, _, err := client.GetMyUserInfo()
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve the admin username: %w", err)
+	}
+
+	return user.UserName, nil
+}
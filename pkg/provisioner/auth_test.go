@@ -0,0 +1,98 @@
+package provisioner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// newFakeGiteaServer creates a http server that answers the version and user info requests of the gitea client and
+// records the credentials of every request
+func newFakeGiteaServer(t *testing.T, credentials *[]string) *httptest.Server {
+	var mutex sync.Mutex
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/version", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version":"1.16.8"}`))
+	})
+	mux.HandleFunc("/api/v1/user", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if username, password, ok := r.BasicAuth(); ok {
+			*credentials = append(*credentials, "basic "+username+":"+password)
+		} else {
+			*credentials = append(*credentials, r.Header.Get("Authorization"))
+		}
+
+		_, _ = w.Write([]byte(`{"login":"gitea-admin","is_admin":true}`))
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"oauth2-access-token","token_type":"bearer","expires_in":3600}`))
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestNewGiteaProvisioner_PasswordAuthentication(t *testing.T) {
+	var credentials []string
+	server := newFakeGiteaServer(t, &credentials)
+	defer server.Close()
+
+	giteaProvisioner, err := NewGiteaProvisioner(server.URL, "admin", "secret", &GiteaProvisionerOptions{})
+	require.NoError(t, err)
+	require.NoError(t, giteaProvisioner.CheckHealth())
+
+	assert.Equal(t, []string{"basic admin:secret"}, credentials)
+}
+
+func TestNewGiteaProvisioner_MissingCredentials(t *testing.T) {
+	_, err := NewGiteaProvisioner("http://gitea:3000", "admin", "", &GiteaProvisionerOptions{})
+	require.ErrorIs(t, err, ErrMissingCredentials)
+
+	_, err = NewGiteaProvisioner("http://gitea:3000", "", "secret", &GiteaProvisionerOptions{})
+	require.ErrorIs(t, err, ErrMissingCredentials)
+}
+
+func TestNewGiteaProvisioner_TokenAuthentication(t *testing.T) {
+	var credentials []string
+	server := newFakeGiteaServer(t, &credentials)
+	defer server.Close()
+
+	giteaProvisioner, err := NewGiteaProvisioner(server.URL, "", "", &GiteaProvisionerOptions{
+		Authentication: &AuthenticationOptions{Token: "admin-token"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, giteaProvisioner.CheckHealth())
+
+	// The username is resolved with the token, afterwards the token is used as basic auth password such that
+	// sudo-based token creation is allowed by Gitea
+	assert.Equal(t, []string{"token admin-token", "basic gitea-admin:admin-token"}, credentials)
+}
+
+func TestNewGiteaProvisioner_OAuth2Authentication(t *testing.T) {
+	var credentials []string
+	server := newFakeGiteaServer(t, &credentials)
+	defer server.Close()
+
+	giteaProvisioner, err := NewGiteaProvisioner(server.URL, "", "", &GiteaProvisionerOptions{
+		Authentication: &AuthenticationOptions{
+			OAuth2: &OAuth2Options{
+				TokenURL:     server.URL + "/oauth/token",
+				ClientID:     "provisioner",
+				ClientSecret: "client-secret",
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, giteaProvisioner.CheckHealth())
+
+	assert.Equal(t, []string{"Bearer oauth2-access-token", "basic gitea-admin:oauth2-access-token"}, credentials)
+}
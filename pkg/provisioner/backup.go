@@ -0,0 +1,152 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"code.gitea.io/sdk/gitea"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/backup"
+)
+
+// ErrBackupFailed indicates that the backup before a deletion failed, the repository has not been deleted
+var /*const*/ ErrBackupFailed = errors.New("unable to back up the repository")
+
+// The purposes of the temporary access tokens, they are part of the token name
+const (
+	temporaryTokenBackup  = "backup"
+	temporaryTokenRestore = "restore"
+)
+
+// DefaultBackupTimeout limits the duration of a backup if no timeout is configured
+const DefaultBackupTimeout = 5 * time.Minute
+
+// BackupOptions enable a backup of every repository before it is deleted
+type BackupOptions struct {
+	// Store receives a git bundle and a manifest of the repository, backups are disabled if nil
+	Store backup.Store
+	// Force deletes the repository even if its backup failed
+	Force bool
+	// Timeout limits the duration of a backup, DefaultBackupTimeout is used if 0
+	Timeout time.Duration
+}
+
+// timeout returns the maximum duration of a backup
+func (o BackupOptions) timeout() time.Duration {
+	if o.Timeout <= 0 {
+		return DefaultBackupTimeout
+	}
+
+	return o.Timeout
+}
+
+// repositoryURL returns the clone URL of the repository based on the configured endpoint, the clone URL reported by
+// Gitea might not be reachable from the provisioner
+func (h *GiteaProvisioner) repositoryURL(owner string, repository string) string {
+	return strings.TrimSuffix(h.endpoint, "/") + "/" + owner + "/" + repository + ".git"
+}
+
+// backupRepository exports the repository of the project into the backup store before it is removed with the given
+// deletion policy. The archive policy keeps the repository and is skipped, as well as missing repositories and
+// repositories of other projects whose deletion fails anyway. A failed backup returns ErrBackupFailed unless the deletion is forced.
+func (h *GiteaProvisioner) backupRepository(namespace string, project string, policy string) error {
+	if h.backup.Store == nil || policy == DeletionPolicyArchive {
+		return nil
+	}
+
+	err := h.exportRepository(namespace, project)
+	if err == nil {
+		return nil
+	}
+
+	if h.backup.Force {
+		log.Printf("Deleting project %s of namespace %s without backup: %s\n", project, namespaceOrDefault(namespace), err)
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrBackupFailed, err)
+}
+
+// exportRepository writes a bundle and manifest of the repository into the backup store, the mirror clone is
+// authenticated with a temporary access token of the namespace user
+func (h *GiteaProvisioner) exportRepository(namespace string, project string) error {
+	objects := h.GiteaObjects(namespace, project)
+
+	repository, err := h.getProjectRepository(objects.User, project)
+	if errors.Is(err, ErrRepositoryDoesNotExist) || errors.Is(err, ErrNameCollision) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	deletedAt := time.Now().UTC()
+	return h.withTemporaryToken(objects.User, temporaryTokenBackup, func(token string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), h.backup.timeout())
+		defer cancel()
+
+		manifest, err := backup.Export(ctx, h.backup.Store, h.bundleFunc, backup.Manifest{
+			Namespace:  namespaceOrDefault(namespace),
+			Project:    project,
+			Owner:      objects.User,
+			Repository: objects.Repository,
+			DeletedAt:  deletedAt,
+		}, backup.Source{
+			CloneURL: h.repositoryURL(objects.User, objects.Repository),
+			Username: objects.User,
+			Password: token,
+			Empty:    repository.Empty,
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Backed up repository %s/%s of project %s at %s\n", objects.User, objects.Repository, project, manifest.DeletedAt)
+		return nil
+	})
+}
+
+// isTemporaryToken returns true if the access token has been created by withTemporaryToken
+func (h *GiteaProvisioner) isTemporaryToken(name string) bool {
+	for _, purpose := range []string{temporaryTokenBackup, temporaryTokenRestore} {
+		createdAt := strings.TrimPrefix(name, h.TokenPrefix+purpose+"-")
+		if createdAt == name {
+			continue
+		}
+
+		if _, err := time.Parse(graveyardTimeFormat, createdAt); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withTemporaryToken creates an access token of the user for the git operations of a backup or restore, runs fn with
+// it and deletes the token afterwards. The token has the token prefix, such that the token sweep removes it if it is
+// left behind.
+func (h *GiteaProvisioner) withTemporaryToken(username string, purpose string, fn func(token string) error) error {
+	userClient, err := h.newClientFunc(h.endpoint, h.credentials, gitea.SetSudo(username))
+	if err != nil {
+		return fmt.Errorf("unable to create gitea client: %w", err)
+	}
+
+	tokenName := h.TokenPrefix + purpose + "-" + time.Now().UTC().Format(graveyardTimeFormat)
+	token, _, err := userClient.CreateAccessToken(gitea.CreateAccessTokenOption{Name: tokenName})
+	if err != nil {
+		return fmt.Errorf("unable to create access token for the %s: %w", purpose, err)
+	}
+
+	defer func() {
+		if _, err := userClient.DeleteAccessToken(tokenName); err != nil {
+			log.Printf("Unable to delete access token %s of user %s: %s\n", tokenName, username, err)
+		}
+	}()
+
+	return fn(token.Token)
+}
@@ -0,0 +1,143 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/backup"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+)
+
+// newBackupProvisioner creates a provisioner that writes its backups into the returned directory, the bundles contain
+// the source instead of the repository
+func newBackupProvisioner(t *testing.T, giteaClient *fake.MockGiteaClient, bundleErr error) (*GiteaProvisioner, string) {
+	directory := t.TempDir()
+	store, err := backup.NewLocalStore(directory)
+	require.NoError(t, err)
+
+	giteaProvisioner := newPreflightProvisioner(giteaClient)
+	giteaProvisioner.backup = BackupOptions{Store: store}
+	giteaProvisioner.bundleFunc = func(ctx context.Context, source backup.Source, file string) error {
+		if bundleErr != nil {
+			return bundleErr
+		}
+
+		return ioutil.WriteFile(file, []byte(source.CloneURL+" "+source.Username+":"+source.Password), 0600)
+	}
+
+	return giteaProvisioner, directory
+}
+
+// expectBackupToken sets up the expectations of the temporary access token of a backup
+func expectBackupToken(t *testing.T, giteaClient *fake.MockGiteaClient) {
+	giteaClient.EXPECT().CreateAccessToken(gomock.Any()).Times(1).DoAndReturn(func(opt gitea.CreateAccessTokenOption) (*gitea.AccessToken, *gitea.Response, error) {
+		assert.True(t, strings.HasPrefix(opt.Name, "token-backup-"))
+		return &gitea.AccessToken{Name: opt.Name, Token: "backup-token"}, createResponse(http.StatusCreated), nil
+	})
+	giteaClient.EXPECT().DeleteAccessToken(prefixMatcher("token-backup-")).Times(1).Return(createResponse(http.StatusNoContent), nil)
+}
+
+// prefixMatcher is a gomock.Matcher for strings with the given prefix
+type prefixMatcher string
+
+// Matches returns true if x is a string with the prefix
+func (p prefixMatcher) Matches(x interface{}) bool {
+	name, ok := x.(string)
+	return ok && strings.HasPrefix(name, string(p))
+}
+
+// String describes the matcher
+func (p prefixMatcher) String() string {
+	return "has prefix " + string(p)
+}
+
+func TestGiteaProvisioner_DeleteRepositoryWithBackup(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner, directory := newBackupProvisioner(t, giteaClient, nil)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(2).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	expectBackupToken(t, giteaClient)
+	giteaClient.EXPECT().DeleteRepo("keptn-dev", "project-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(1).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminDeleteUser("keptn-dev").Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	require.NoError(t, giteaProvisioner.DeleteRepository("dev", "podtato"))
+
+	bundles, err := filepath.Glob(filepath.Join(directory, "dev", "podtato", "*.bundle"))
+	require.NoError(t, err)
+	require.Len(t, bundles, 1)
+
+	content, err := ioutil.ReadFile(bundles[0])
+	require.NoError(t, err)
+	assert.Equal(t, "http://gitea-http.gitea:3000/keptn-dev/project-podtato.git keptn-dev:backup-token", string(content))
+
+	manifests, err := filepath.Glob(filepath.Join(directory, "dev", "podtato", "*.json"))
+	require.NoError(t, err)
+	assert.Len(t, manifests, 1)
+}
+
+func TestGiteaProvisioner_DeleteRepositoryBackupFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner, _ := newBackupProvisioner(t, giteaClient, errors.New("git clone failed"))
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	expectBackupToken(t, giteaClient)
+
+	// Nothing is deleted without a backup
+	assert.ErrorIs(t, giteaProvisioner.DeleteRepository("dev", "podtato"), ErrBackupFailed)
+}
+
+func TestGiteaProvisioner_DeleteRepositoryBackupForced(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner, _ := newBackupProvisioner(t, giteaClient, errors.New("git clone failed"))
+	giteaProvisioner.backup.Force = true
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(2).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	expectBackupToken(t, giteaClient)
+	giteaClient.EXPECT().DeleteRepo("keptn-dev", "project-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(1).Return([]*gitea.Repository{{Name: "project-other"}}, createResponse(http.StatusOK), nil)
+
+	require.NoError(t, giteaProvisioner.DeleteRepository("dev", "podtato"))
+}
+
+func TestGiteaProvisioner_DeleteRepositoryBackupSkippedForArchive(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner, directory := newBackupProvisioner(t, giteaClient, nil)
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyArchive}
+
+	// The repository is only read by the archive policy, no backup token is created
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().EditRepo("keptn-dev", "project-podtato", gomock.Any()).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(1).Return([]*gitea.Repository{{Name: "project-podtato"}}, createResponse(http.StatusOK), nil)
+
+	require.NoError(t, giteaProvisioner.DeleteRepository("dev", "podtato"))
+
+	files, err := filepath.Glob(filepath.Join(directory, "*"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
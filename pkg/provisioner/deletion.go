@@ -0,0 +1,235 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.gitea.io/sdk/gitea"
+)
+
+// Policies that define what DeleteRepository does with the repository of a project
+const (
+	// DeletionPolicyDelete permanently deletes the repository
+	DeletionPolicyDelete = "delete"
+	// DeletionPolicyArchive archives the repository, it stays owned by the user of the namespace
+	DeletionPolicyArchive = "archive"
+	// DeletionPolicyGraveyard transfers the repository into the graveyard organization, where it is purged after the
+	// retention period
+	DeletionPolicyGraveyard = "graveyard"
+)
+
+// DefaultGraveyardOrganization is the organization that receives the repositories with the graveyard policy
+const DefaultGraveyardOrganization = "keptn-graveyard"
+
+// graveyardTimeFormat is the format of the deletion time that is appended to the names of graveyard repositories
+const graveyardTimeFormat = "20060102150405"
+
+// DeletionOptions define what happens to the repository of a deleted project
+type DeletionOptions struct {
+	// Policy is one of DeletionPolicyDelete (default), DeletionPolicyArchive and DeletionPolicyGraveyard
+	Policy string
+	// GraveyardOrganization receives the repositories with the graveyard policy, it is created if it doesn't exist
+	GraveyardOrganization string
+	// GraveyardRetention is the time after which repositories are purged from the graveyard, 0 keeps them forever
+	GraveyardRetention time.Duration
+}
+
+// policy returns the deletion policy, hard deletion is the default
+func (o DeletionOptions) policy() string {
+	if o.Policy == "" {
+		return DeletionPolicyDelete
+	}
+
+	return o.Policy
+}
+
+// graveyardOrganization returns the name of the graveyard organization
+func (o DeletionOptions) graveyardOrganization() string {
+	if o.GraveyardOrganization == "" {
+		return DefaultGraveyardOrganization
+	}
+
+	return o.GraveyardOrganization
+}
+
+// graveyardName returns the name of a repository in the graveyard, it consists of the owner, the repository name and
+// the deletion time such that repositories of different namespaces and deletions don't collide
+func graveyardName(owner string, repository string, deletedAt time.Time) string {
+	suffix := "-" + deletedAt.UTC().Format(graveyardTimeFormat)
+	name := owner + "-" + repository
+
+	if len(name)+len(suffix) > repositoryNameRules.maxLength {
+		name = name[:repositoryNameRules.maxLength-len(suffix)]
+	}
+
+	return name + suffix
+}
+
+// graveyardDeletionTime returns the deletion time of a graveyard repository, false if the name doesn't end with one
+func graveyardDeletionTime(name string) (time.Time, bool) {
+	index := strings.LastIndex(name, "-")
+	if index < 0 {
+		return time.Time{}, false
+	}
+
+	deletedAt, err := time.Parse(graveyardTimeFormat, name[index+1:])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return deletedAt, true
+}
+
+// removeRepository removes the repository of the project according to the deletion policy, ErrRepositoryDoesNotExist
+// is returned if the repository doesn't exist or has already been archived. The repository is looked up first, such
+// that a name that Gitea redirects to a renamed repository, or the repository of a different project, isn't removed.
+func (h *GiteaProvisioner) removeRepository(username string, project string, policy string) error {
+	existing, err := h.getProjectRepository(username, project)
+	if err != nil {
+		return err
+	}
+
+	switch policy {
+	case DeletionPolicyArchive:
+		return h.archiveRepository(username, existing)
+	case DeletionPolicyGraveyard:
+		return h.buryRepository(username, existing.Name)
+	}
+
+	r, err := h.client.DeleteRepo(username, existing.Name)
+	if err != nil && r == nil {
+		return fmt.Errorf("unable to delete the repository: %w", err)
+	}
+
+	// Project does not exist, relay the status code only
+	if r.StatusCode == http.StatusNotFound {
+		return ErrRepositoryDoesNotExist
+	}
+
+	return nil
+}
+
+// archiveRepository makes the repository read-only, an already archived repository counts as deleted
+func (h *GiteaProvisioner) archiveRepository(username string, existing *gitea.Repository) error {
+	if existing.Archived {
+		return ErrRepositoryDoesNotExist
+	}
+
+	archived := true
+	_, _, err := h.client.EditRepo(username, existing.Name, gitea.EditRepoOption{Archived: &archived})
+	if err != nil {
+		return fmt.Errorf("unable to archive repository %s/%s: %w", username, existing.Name, err)
+	}
+
+	return nil
+}
+
+// buryRepository renames the repository with the deletion time and transfers it into the graveyard organization
+func (h *GiteaProvisioner) buryRepository(username string, repository string) error {
+	organization, err := h.ensureGraveyard()
+	if err != nil {
+		return err
+	}
+
+	name := graveyardName(username, repository, time.Now())
+	_, r, err := h.client.EditRepo(username, repository, gitea.EditRepoOption{Name: &name})
+	if r != nil && r.StatusCode == http.StatusNotFound {
+		return ErrRepositoryDoesNotExist
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to rename repository %s/%s: %w", username, repository, err)
+	}
+
+	_, _, err = h.client.TransferRepo(username, name, gitea.TransferRepoOption{NewOwner: organization})
+	if err != nil {
+		// Restore the original name, such that the deletion can be retried
+		if _, _, renameErr := h.client.EditRepo(username, name, gitea.EditRepoOption{Name: &repository}); renameErr != nil {
+			log.Printf("Unable to restore the name of repository %s/%s: %s\n", username, name, renameErr)
+		}
+
+		return fmt.Errorf("unable to transfer repository %s/%s to %s: %w", username, name, organization, err)
+	}
+
+	log.Printf("Moved repository %s/%s to %s/%s\n", username, repository, organization, name)
+	return nil
+}
+
+// ensureGraveyard creates the private graveyard organization if it doesn't exist and returns its name
+func (h *GiteaProvisioner) ensureGraveyard() (string, error) {
+	organization := h.deletion.graveyardOrganization()
+
+	_, r, err := h.client.GetOrg(organization)
+	if err == nil {
+		return organization, nil
+	}
+
+	if r == nil || r.StatusCode != http.StatusNotFound {
+		return "", fmt.Errorf("unable to get organization %s: %w", organization, err)
+	}
+
+	_, _, err = h.client.CreateOrg(gitea.CreateOrgOption{
+		Name:        organization,
+		Description: "Repositories of deleted Keptn projects",
+		Visibility:  gitea.VisibleTypePrivate,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to create organization %s: %w", organization, err)
+	}
+
+	return organization, nil
+}
+
+// PurgeGraveyard permanently deletes the repositories in the graveyard organization whose retention period expired
+func (h *GiteaProvisioner) PurgeGraveyard(ctx context.Context) error {
+	if h.deletion.GraveyardRetention <= 0 {
+		return nil
+	}
+
+	organization := h.deletion.graveyardOrganization()
+	threshold := time.Now().Add(-h.deletion.GraveyardRetention)
+
+	for page := 1; ; page++ {
+		repositories, r, err := h.client.ListOrgRepos(organization, gitea.ListOrgReposOptions{
+			ListOptions: gitea.ListOptions{Page: page, PageSize: listPageSize},
+		})
+		if r != nil && r.StatusCode == http.StatusNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to list repositories of organization %s: %w", organization, err)
+		}
+
+		purged := 0
+		for _, repository := range repositories {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			deletedAt, ok := graveyardDeletionTime(repository.Name)
+			if !ok || deletedAt.After(threshold) {
+				continue
+			}
+
+			log.Printf("Purging repository %s/%s, which was deleted at %s\n", organization, repository.Name, deletedAt)
+			if _, err := h.client.DeleteRepo(organization, repository.Name); err != nil {
+				return fmt.Errorf("unable to purge repository %s/%s: %w", organization, repository.Name, err)
+			}
+			purged++
+		}
+
+		// Purged repositories shift the following ones onto the current page
+		if purged > 0 {
+			page--
+		}
+
+		if len(repositories) < listPageSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+)
+
+func TestGraveyardName(t *testing.T) {
+	deletedAt := time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	name := graveyardName("keptn-dev", "project-podtato", deletedAt)
+	assert.Equal(t, "keptn-dev-project-podtato-20220301123000", name)
+
+	parsed, ok := graveyardDeletionTime(name)
+	require.True(t, ok)
+	assert.Equal(t, deletedAt, parsed)
+
+	long := graveyardName("keptn-dev", strings.Repeat("a", 100), deletedAt)
+	assert.Len(t, long, repositoryNameRules.maxLength)
+	assert.True(t, strings.HasSuffix(long, "-20220301123000"))
+
+	_, ok = graveyardDeletionTime("project-podtato")
+	assert.False(t, ok)
+}
+
+func TestGiteaProvisioner_DeleteRepositoryArchive(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyArchive}
+
+	archived := true
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().EditRepo("keptn-dev", "project-podtato", gitea.EditRepoOption{Archived: &archived}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(1).Return([]*gitea.Repository{
+		{Name: "project-podtato", Archived: true},
+	}, createResponse(http.StatusOK), nil)
+
+	// The user is kept, since it still owns the archived repository
+	require.NoError(t, giteaProvisioner.DeleteRepository("dev", "podtato"))
+}
+
+func TestGiteaProvisioner_DeleteRepositoryAlreadyArchived(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyArchive}
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(2).Return(&gitea.Repository{Name: "project-podtato", Archived: true}, createResponse(http.StatusOK), nil)
+
+	assert.ErrorIs(t, giteaProvisioner.DeleteRepository("dev", "podtato"), ErrRepositoryDoesNotExist)
+
+	_, err := giteaProvisioner.PlanDelete("dev", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryDoesNotExist)
+}
+
+func TestGiteaProvisioner_ProvisionArchivedRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	archivedRepository := &gitea.Repository{Name: "project-podtato", Description: projectDescription("podtato"), Archived: true}
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(2).Return(&gitea.User{UserName: "keptn-dev"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminCreateRepo("keptn-dev", gomock.Any()).Times(1).Return(nil, createResponse(http.StatusConflict), errors.New("409 Conflict"))
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(2).Return(archivedRepository, createResponse(http.StatusOK), nil)
+
+	// Provisioning an archived project again points at the restore instead of a plain conflict
+	_, err := giteaProvisioner.ProvisionRepository("dev", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryArchived)
+
+	_, err = giteaProvisioner.PlanProvision("dev", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryArchived)
+}
+
+func TestProvisionHandler_ArchivedRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	provisioner.EXPECT().ProvisionRepository("keptn", "project").Times(1).Return(nil, ErrRepositoryArchived)
+
+	handler := ProvisionHandler{
+		Provisioner: provisioner,
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository",
+		strings.NewReader(`{"namespace":"keptn","project":"project"}`),
+	)
+	response := httptest.NewRecorder()
+
+	handler.HandleProvisionRepoRequest(response, request)
+	require.Equal(t, http.StatusConflict, response.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	assert.Equal(t, ErrRepositoryArchived.Error(), body["message"])
+}
+
+func TestGiteaProvisioner_DeleteRepositoryGraveyard(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyGraveyard, GraveyardOrganization: "graveyard"}
+
+	var buriedName string
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetOrg("graveyard").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().CreateOrg(gomock.Any()).Times(1).DoAndReturn(func(opt gitea.CreateOrgOption) (*gitea.Organization, *gitea.Response, error) {
+		assert.Equal(t, "graveyard", opt.Name)
+		assert.Equal(t, gitea.VisibleTypePrivate, opt.Visibility)
+		return &gitea.Organization{}, createResponse(http.StatusCreated), nil
+	})
+	giteaClient.EXPECT().EditRepo("keptn-dev", "project-podtato", gomock.Any()).Times(1).DoAndReturn(func(owner string, repo string, opt gitea.EditRepoOption) (*gitea.Repository, *gitea.Response, error) {
+		require.NotNil(t, opt.Name)
+		buriedName = *opt.Name
+		return &gitea.Repository{}, createResponse(http.StatusOK), nil
+	})
+	giteaClient.EXPECT().TransferRepo("keptn-dev", gomock.Any(), gitea.TransferRepoOption{NewOwner: "graveyard"}).Times(1).DoAndReturn(func(owner string, repo string, opt gitea.TransferRepoOption) (*gitea.Repository, *gitea.Response, error) {
+		assert.Equal(t, buriedName, repo)
+		return &gitea.Repository{}, createResponse(http.StatusAccepted), nil
+	})
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(1).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminDeleteUser("keptn-dev").Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	require.NoError(t, giteaProvisioner.DeleteRepository("dev", "podtato"))
+	assert.True(t, strings.HasPrefix(buriedName, "keptn-dev-project-podtato-"))
+}
+
+func TestGiteaProvisioner_DeleteRepositoryGraveyardTransferFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyGraveyard}
+
+	original := "project-podtato"
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetOrg(DefaultGraveyardOrganization).Times(1).Return(&gitea.Organization{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().EditRepo("keptn-dev", "project-podtato", gomock.Any()).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().TransferRepo("keptn-dev", gomock.Any(), gomock.Any()).Times(1).Return(nil, createResponse(http.StatusForbidden), errors.New("403 Forbidden"))
+	giteaClient.EXPECT().EditRepo("keptn-dev", gomock.Any(), gitea.EditRepoOption{Name: &original}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusOK), nil)
+
+	// The token and the user are kept, such that the deletion can be retried
+	assert.Error(t, giteaProvisioner.DeleteRepository("dev", "podtato"))
+}
+
+func TestGiteaProvisioner_PlanDeleteArchive(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyArchive}
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListAccessTokens(gomock.Any()).Times(1).Return([]*gitea.AccessToken{
+		{Name: "token-podtato"},
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListUserRepos("keptn-dev", gomock.Any()).Times(1).Return([]*gitea.Repository{
+		{Name: "project-podtato"},
+	}, createResponse(http.StatusOK), nil)
+
+	plan, err := giteaProvisioner.PlanDelete("dev", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"archive repository project-podtato", "delete accessToken token-podtato", "keep user keptn-dev",
+	}, planChanges(plan))
+}
+
+func TestGiteaProvisioner_PurgeGraveyard(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyGraveyard, GraveyardRetention: 24 * time.Hour}
+
+	expired := graveyardName("keptn-dev", "project-old", time.Now().Add(-48*time.Hour))
+	retained := graveyardName("keptn-dev", "project-new", time.Now().Add(-time.Hour))
+
+	giteaClient.EXPECT().ListOrgRepos(DefaultGraveyardOrganization, gomock.Any()).Times(1).Return([]*gitea.Repository{
+		{Name: expired}, {Name: retained}, {Name: "unrelated"},
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteRepo(DefaultGraveyardOrganization, expired).Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	require.NoError(t, giteaProvisioner.PurgeGraveyard(context.Background()))
+}
+
+func TestGiteaProvisioner_PurgeGraveyardDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	// Without a retention, nothing is read from Gitea
+	require.NoError(t, giteaProvisioner.PurgeGraveyard(context.Background()))
+
+	giteaProvisioner.deletion = DeletionOptions{GraveyardRetention: time.Hour}
+	giteaClient.EXPECT().ListOrgRepos(DefaultGraveyardOrganization, gomock.Any()).Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+
+	require.NoError(t, giteaProvisioner.PurgeGraveyard(context.Background()))
+}
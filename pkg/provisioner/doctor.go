@@ -0,0 +1,209 @@
+package provisioner
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Names of the steps of the preflight check
+const (
+	PreflightAdminRights      = "admin-rights"
+	PreflightNamespaceUnused  = "namespace-unused"
+	PreflightCreateUser       = "create-user"
+	PreflightCreateRepository = "create-repository"
+	PreflightCreateToken      = "create-access-token"
+	PreflightCloneURL         = "clone-url"
+	PreflightDelete           = "delete"
+	// PreflightConnectivity is only reported if Gitea failed between the steps, e.g. because it became unreachable
+	PreflightConnectivity = "connectivity"
+)
+
+// PreflightCheck is the result of a single step of the preflight check
+type PreflightCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Skipped is true if the step wasn't executed because a previous step failed
+	Skipped bool   `json:"skipped,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Hint describes how a failed step can be fixed
+	Hint string `json:"hint,omitempty"`
+}
+
+// PreflightReport is the result of a full provision and delete cycle against the Gitea server
+type PreflightReport struct {
+	Namespace string           `json:"namespace"`
+	Project   string           `json:"project"`
+	Checks    []PreflightCheck `json:"checks"`
+}
+
+// Passed returns true if all steps of the preflight check passed
+func (r *PreflightReport) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// preflightSteps are all steps in the order of their execution
+var preflightSteps = []string{
+	PreflightAdminRights, PreflightNamespaceUnused, PreflightCreateUser, PreflightCreateRepository,
+	PreflightCreateToken, PreflightCloneURL, PreflightDelete,
+}
+
+// preflightHints are the remediation hints of the steps
+var preflightHints = map[string]string{
+	PreflightAdminRights: "Configure the credentials of a Gitea site administrator (GITEA_USER and GITEA_PASSWORD, " +
+		"GITEA_TOKEN or OAuth2)",
+	PreflightNamespaceUnused: "The user of the namespace already exists, run the check with a namespace that isn't used " +
+		"by Keptn",
+	PreflightCreateUser: "Check that the administrator is allowed to create users and that Gitea accepts the email " +
+		"domain USER_EMAIL_DOMAIN, e.g. [service] EMAIL_DOMAIN_WHITELIST in app.ini",
+	PreflightCreateRepository: "Check that users are allowed to own repositories, e.g. [repository] MAX_CREATION_LIMIT " +
+		"in app.ini, and that QUOTA_MAX_REPOSITORIES isn't too small",
+	PreflightCreateToken: "Gitea must accept the Sudo header of the administrator, check that proxies in front of Gitea " +
+		"forward it and that the credentials are not restricted",
+	PreflightCloneURL: "Set [server] ROOT_URL in app.ini to the URL Keptn uses to reach Gitea, which is usually " +
+		"GITEA_ENDPOINT",
+	PreflightDelete: "Check that the administrator is allowed to delete repositories and users, and remove the " +
+		"leftovers of the check manually",
+	PreflightConnectivity: "Gitea couldn't be reached or returned an unexpected error, check GITEA_ENDPOINT, proxies " +
+		"in front of Gitea and the Gitea logs, then run the check again",
+}
+
+// preflightRun collects the results of the steps of a preflight check
+type preflightRun struct {
+	report *PreflightReport
+}
+
+// pass records a passed step
+func (p *preflightRun) pass(name string, message string) {
+	p.report.Checks = append(p.report.Checks, PreflightCheck{Name: name, Passed: true, Message: message})
+}
+
+// fail records a failed step and marks the given remaining steps as skipped
+func (p *preflightRun) fail(name string, err error, skipped ...string) {
+	p.report.Checks = append(p.report.Checks, PreflightCheck{
+		Name:    name,
+		Message: err.Error(),
+		Hint:    preflightHints[name],
+	})
+
+	for _, step := range skipped {
+		p.report.Checks = append(p.report.Checks, PreflightCheck{Name: step, Skipped: true})
+	}
+}
+
+// Preflight provisions and deletes a repository for the given project in a namespace that must not be used by Keptn.
+// The report lists every step in order, steps after a failed one are skipped, but created objects are always deleted.
+func (h *GiteaProvisioner) Preflight(namespace string, project string) *PreflightReport {
+	run := &preflightRun{report: &PreflightReport{Namespace: namespaceOrDefault(namespace), Project: project}}
+	username := h.GetUsername(namespace)
+
+	if err := h.CheckHealth(); err != nil {
+		run.fail(PreflightAdminRights, err, preflightSteps[1:]...)
+		return run.report
+	}
+	run.pass(PreflightAdminRights, "")
+
+	// Only an existing user means that the namespace is used, other errors don't tell anything about the namespace
+	_, r, err := h.client.GetUserInfo(username)
+	switch {
+	case r != nil && r.StatusCode == http.StatusOK:
+		run.fail(PreflightNamespaceUnused, fmt.Errorf("user %s already exists", username), preflightSteps[2:]...)
+		return run.report
+	case r == nil || r.StatusCode != http.StatusNotFound:
+		if err == nil && r != nil {
+			err = fmt.Errorf("unexpected status code %d", r.StatusCode)
+		}
+		run.fail(PreflightConnectivity, fmt.Errorf("unable to look up user %s: %w", username, err), preflightSteps[1:]...)
+		return run.report
+	}
+	run.pass(PreflightNamespaceUnused, "")
+
+	if _, err := h.CreateUser(namespace); err != nil {
+		run.fail(PreflightCreateUser, err, preflightSteps[3:len(preflightSteps)-1]...)
+		h.cleanupPreflightUser(run, username)
+		return run.report
+	}
+	run.pass(PreflightCreateUser, username)
+
+	cloneURL, err := h.CreateRepository(namespace, project)
+	if err != nil {
+		run.fail(PreflightCreateRepository, err, preflightSteps[4:len(preflightSteps)-1]...)
+		h.cleanupPreflightUser(run, username)
+		return run.report
+	}
+	run.pass(PreflightCreateRepository, h.GetProjectName(project))
+
+	if _, err := h.CreateToken(namespace, project); err != nil {
+		run.fail(PreflightCreateToken, err)
+	} else {
+		run.pass(PreflightCreateToken, h.GetAccessTokenName(project))
+	}
+
+	if err := h.checkCloneURL(cloneURL); err != nil {
+		run.fail(PreflightCloneURL, err)
+	} else {
+		run.pass(PreflightCloneURL, cloneURL)
+	}
+
+	// The deletion also removes the access token and the user, since it owns no other repository. The repository is
+	// always deleted permanently without backup, an archive or graveyard would keep the doctor namespace in use.
+	if err := h.deleteProject(namespace, project, DeletionPolicyDelete, false); err != nil {
+		run.fail(PreflightDelete, err)
+		return run.report
+	}
+	run.pass(PreflightDelete, "")
+
+	return run.report
+}
+
+// cleanupPreflightUser deletes the user of a preflight check that failed before the repository was created
+func (h *GiteaProvisioner) cleanupPreflightUser(run *preflightRun, username string) {
+	r, err := h.client.AdminDeleteUser(username)
+	if err == nil || (r != nil && r.StatusCode == http.StatusNotFound) {
+		run.pass(PreflightDelete, "")
+		return
+	}
+
+	run.fail(PreflightDelete, fmt.Errorf("unable to delete user %s: %w", username, err))
+}
+
+// checkCloneURL returns an error if the clone URL doesn't point to the host and port of the Gitea endpoint
+func (h *GiteaProvisioner) checkCloneURL(cloneURL string) error {
+	endpoint, err := url.Parse(h.endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to parse gitea endpoint %s: %w", h.endpoint, err)
+	}
+
+	clone, err := url.Parse(cloneURL)
+	if err != nil {
+		return fmt.Errorf("unable to parse clone URL %s: %w", cloneURL, err)
+	}
+
+	if hostPort(clone) != hostPort(endpoint) {
+		return fmt.Errorf("clone URL %s doesn't point to the gitea endpoint %s", cloneURL, h.endpoint)
+	}
+
+	return nil
+}
+
+// hostPort returns the host and port of the URL, the port defaults to the one of the scheme
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "http":
+			port = "80"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
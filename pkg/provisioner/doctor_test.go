@@ -0,0 +1,156 @@
+package provisioner
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+)
+
+func newPreflightProvisioner(giteaClient *fake.MockGiteaClient) *GiteaProvisioner {
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.endpoint = "http://gitea-http.gitea:3000/"
+	return giteaProvisioner
+}
+
+// checkResults returns the name and result of every step of the report
+func checkResults(report *PreflightReport) []string {
+	var results []string
+	for _, check := range report.Checks {
+		result := "pass"
+		switch {
+		case check.Skipped:
+			result = "skip"
+		case !check.Passed:
+			result = "fail"
+		}
+		results = append(results, check.Name+" "+result)
+	}
+
+	return results
+}
+
+// expectPreflightProvisioning sets up the expectations of a successful provisioning of the doctor project
+func expectPreflightProvisioning(giteaClient *fake.MockGiteaClient, cloneURL string) {
+	giteaClient.EXPECT().GetMyUserInfo().Times(1).Return(&gitea.User{UserName: "admin", IsAdmin: true}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetUserInfo("keptn-doctor").Times(2).Return(nil, createResponse(http.StatusNotFound), nil)
+	giteaClient.EXPECT().AdminCreateUser(gomock.Any()).Times(1).Return(&gitea.User{}, createResponse(http.StatusCreated), nil)
+	giteaClient.EXPECT().AdminCreateRepo("keptn-doctor", gomock.Any()).Times(1).Return(&gitea.Repository{CloneURL: cloneURL}, createResponse(http.StatusCreated), nil)
+	giteaClient.EXPECT().CreateAccessToken(gomock.Any()).Times(1).Return(&gitea.AccessToken{Token: "token"}, createResponse(http.StatusCreated), nil)
+	giteaClient.EXPECT().GetRepo("keptn-doctor", "project-check").Times(1).Return(&gitea.Repository{Name: "project-check"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteRepo("keptn-doctor", "project-check").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().DeleteAccessToken("token-check").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(1).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminDeleteUser("keptn-doctor").Times(1).Return(createResponse(http.StatusNoContent), nil)
+}
+
+func TestGiteaProvisioner_Preflight(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newPreflightProvisioner(giteaClient)
+	expectPreflightProvisioning(giteaClient, "http://gitea-http.gitea:3000/keptn-doctor/project-check.git")
+
+	report := giteaProvisioner.Preflight("doctor", "check")
+	assert.True(t, report.Passed())
+	assert.Equal(t, []string{
+		"admin-rights pass", "namespace-unused pass", "create-user pass", "create-repository pass",
+		"create-access-token pass", "clone-url pass", "delete pass",
+	}, checkResults(report))
+}
+
+func TestGiteaProvisioner_PreflightCloneURLMismatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newPreflightProvisioner(giteaClient)
+	expectPreflightProvisioning(giteaClient, "http://localhost:3000/keptn-doctor/project-check.git")
+
+	report := giteaProvisioner.Preflight("doctor", "check")
+	assert.False(t, report.Passed())
+	assert.Equal(t, []string{
+		"admin-rights pass", "namespace-unused pass", "create-user pass", "create-repository pass",
+		"create-access-token pass", "clone-url fail", "delete pass",
+	}, checkResults(report))
+	assert.Contains(t, report.Checks[5].Hint, "ROOT_URL")
+}
+
+func TestGiteaProvisioner_PreflightRepositoryCreationFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newPreflightProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetMyUserInfo().Times(1).Return(&gitea.User{UserName: "admin", IsAdmin: true}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetUserInfo("keptn-doctor").Times(2).Return(nil, createResponse(http.StatusNotFound), nil)
+	giteaClient.EXPECT().AdminCreateUser(gomock.Any()).Times(1).Return(&gitea.User{}, createResponse(http.StatusCreated), nil)
+	giteaClient.EXPECT().AdminCreateRepo("keptn-doctor", gomock.Any()).Times(1).Return(nil, createResponse(http.StatusForbidden), nil)
+	giteaClient.EXPECT().AdminDeleteUser("keptn-doctor").Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	report := giteaProvisioner.Preflight("doctor", "check")
+	assert.Equal(t, []string{
+		"admin-rights pass", "namespace-unused pass", "create-user pass", "create-repository fail",
+		"create-access-token skip", "clone-url skip", "delete pass",
+	}, checkResults(report))
+}
+
+func TestGiteaProvisioner_PreflightNamespaceInUse(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newPreflightProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetMyUserInfo().Times(1).Return(&gitea.User{UserName: "admin", IsAdmin: true}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetUserInfo("keptn-keptn").Times(1).Return(&gitea.User{UserName: "keptn-keptn"}, createResponse(http.StatusOK), nil)
+
+	// Nothing may be created or deleted in a namespace that is in use
+	report := giteaProvisioner.Preflight("", "check")
+	require.False(t, report.Passed())
+	assert.Equal(t, "namespace-unused fail", checkResults(report)[1])
+	assert.Len(t, report.Checks, len(preflightSteps))
+}
+
+func TestGiteaProvisioner_PreflightUserLookupFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newPreflightProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetMyUserInfo().Times(1).Return(&gitea.User{UserName: "admin", IsAdmin: true}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetUserInfo("keptn-doctor").Times(1).Return(nil, nil, errors.New("connection refused"))
+
+	// A transport error doesn't mean that the namespace is in use
+	report := giteaProvisioner.Preflight("doctor", "check")
+	require.False(t, report.Passed())
+
+	results := checkResults(report)
+	assert.Equal(t, []string{"admin-rights pass", "connectivity fail", "namespace-unused skip"}, results[:3])
+	assert.Contains(t, report.Checks[1].Message, "connection refused")
+	assert.Equal(t, preflightHints[PreflightConnectivity], report.Checks[1].Hint)
+}
+
+func TestGiteaProvisioner_PreflightWithoutAdminRights(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newPreflightProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetMyUserInfo().Times(1).Return(&gitea.User{UserName: "user"}, createResponse(http.StatusOK), nil)
+
+	report := giteaProvisioner.Preflight("doctor", "check")
+	require.False(t, report.Passed())
+	assert.Equal(t, "admin-rights fail", checkResults(report)[0])
+	assert.NotEmpty(t, report.Checks[0].Hint)
+}
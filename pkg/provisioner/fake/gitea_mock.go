@@ -81,6 +81,37 @@ func (mr *MockGiteaClientMockRecorder) AdminDeleteUser(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdminDeleteUser", reflect.TypeOf((*MockGiteaClient)(nil).AdminDeleteUser), arg0)
 }
 
+// AdminEditUser mocks base method.
+func (m *MockGiteaClient) AdminEditUser(arg0 string, arg1 gitea.EditUserOption) (*gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdminEditUser", arg0, arg1)
+	ret0, _ := ret[0].(*gitea.Response)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdminEditUser indicates an expected call of AdminEditUser.
+func (mr *MockGiteaClientMockRecorder) AdminEditUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdminEditUser", reflect.TypeOf((*MockGiteaClient)(nil).AdminEditUser), arg0, arg1)
+}
+
+// AdminListUsers mocks base method.
+func (m *MockGiteaClient) AdminListUsers(arg0 gitea.AdminListUsersOptions) ([]*gitea.User, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdminListUsers", arg0)
+	ret0, _ := ret[0].([]*gitea.User)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// AdminListUsers indicates an expected call of AdminListUsers.
+func (mr *MockGiteaClientMockRecorder) AdminListUsers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdminListUsers", reflect.TypeOf((*MockGiteaClient)(nil).AdminListUsers), arg0)
+}
+
 // CreateAccessToken mocks base method.
 func (m *MockGiteaClient) CreateAccessToken(arg0 gitea.CreateAccessTokenOption) (*gitea.AccessToken, *gitea.Response, error) {
 	m.ctrl.T.Helper()
@@ -97,6 +128,22 @@ func (mr *MockGiteaClientMockRecorder) CreateAccessToken(arg0 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccessToken", reflect.TypeOf((*MockGiteaClient)(nil).CreateAccessToken), arg0)
 }
 
+// CreateOrg mocks base method.
+func (m *MockGiteaClient) CreateOrg(arg0 gitea.CreateOrgOption) (*gitea.Organization, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrg", arg0)
+	ret0, _ := ret[0].(*gitea.Organization)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CreateOrg indicates an expected call of CreateOrg.
+func (mr *MockGiteaClientMockRecorder) CreateOrg(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrg", reflect.TypeOf((*MockGiteaClient)(nil).CreateOrg), arg0)
+}
+
 // DeleteAccessToken mocks base method.
 func (m *MockGiteaClient) DeleteAccessToken(arg0 interface{}) (*gitea.Response, error) {
 	m.ctrl.T.Helper()
@@ -127,6 +174,70 @@ func (mr *MockGiteaClientMockRecorder) DeleteRepo(arg0, arg1 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRepo", reflect.TypeOf((*MockGiteaClient)(nil).DeleteRepo), arg0, arg1)
 }
 
+// EditRepo mocks base method.
+func (m *MockGiteaClient) EditRepo(arg0, arg1 string, arg2 gitea.EditRepoOption) (*gitea.Repository, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditRepo", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*gitea.Repository)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// EditRepo indicates an expected call of EditRepo.
+func (mr *MockGiteaClientMockRecorder) EditRepo(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditRepo", reflect.TypeOf((*MockGiteaClient)(nil).EditRepo), arg0, arg1, arg2)
+}
+
+// GetMyUserInfo mocks base method.
+func (m *MockGiteaClient) GetMyUserInfo() (*gitea.User, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMyUserInfo")
+	ret0, _ := ret[0].(*gitea.User)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetMyUserInfo indicates an expected call of GetMyUserInfo.
+func (mr *MockGiteaClientMockRecorder) GetMyUserInfo() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMyUserInfo", reflect.TypeOf((*MockGiteaClient)(nil).GetMyUserInfo))
+}
+
+// GetOrg mocks base method.
+func (m *MockGiteaClient) GetOrg(arg0 string) (*gitea.Organization, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrg", arg0)
+	ret0, _ := ret[0].(*gitea.Organization)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetOrg indicates an expected call of GetOrg.
+func (mr *MockGiteaClientMockRecorder) GetOrg(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrg", reflect.TypeOf((*MockGiteaClient)(nil).GetOrg), arg0)
+}
+
+// GetRepo mocks base method.
+func (m *MockGiteaClient) GetRepo(arg0, arg1 string) (*gitea.Repository, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRepo", arg0, arg1)
+	ret0, _ := ret[0].(*gitea.Repository)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetRepo indicates an expected call of GetRepo.
+func (mr *MockGiteaClientMockRecorder) GetRepo(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRepo", reflect.TypeOf((*MockGiteaClient)(nil).GetRepo), arg0, arg1)
+}
+
 // GetUserInfo mocks base method.
 func (m *MockGiteaClient) GetUserInfo(arg0 string) (*gitea.User, *gitea.Response, error) {
 	m.ctrl.T.Helper()
@@ -143,6 +254,22 @@ func (mr *MockGiteaClientMockRecorder) GetUserInfo(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserInfo", reflect.TypeOf((*MockGiteaClient)(nil).GetUserInfo), arg0)
 }
 
+// ListAccessTokens mocks base method.
+func (m *MockGiteaClient) ListAccessTokens(arg0 gitea.ListAccessTokensOptions) ([]*gitea.AccessToken, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccessTokens", arg0)
+	ret0, _ := ret[0].([]*gitea.AccessToken)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListAccessTokens indicates an expected call of ListAccessTokens.
+func (mr *MockGiteaClientMockRecorder) ListAccessTokens(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccessTokens", reflect.TypeOf((*MockGiteaClient)(nil).ListAccessTokens), arg0)
+}
+
 // ListMyRepos mocks base method.
 func (m *MockGiteaClient) ListMyRepos(arg0 gitea.ListReposOptions) ([]*gitea.Repository, *gitea.Response, error) {
 	m.ctrl.T.Helper()
@@ -158,3 +285,51 @@ func (mr *MockGiteaClientMockRecorder) ListMyRepos(arg0 interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMyRepos", reflect.TypeOf((*MockGiteaClient)(nil).ListMyRepos), arg0)
 }
+
+// ListOrgRepos mocks base method.
+func (m *MockGiteaClient) ListOrgRepos(arg0 string, arg1 gitea.ListOrgReposOptions) ([]*gitea.Repository, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListOrgRepos", arg0, arg1)
+	ret0, _ := ret[0].([]*gitea.Repository)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListOrgRepos indicates an expected call of ListOrgRepos.
+func (mr *MockGiteaClientMockRecorder) ListOrgRepos(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOrgRepos", reflect.TypeOf((*MockGiteaClient)(nil).ListOrgRepos), arg0, arg1)
+}
+
+// ListUserRepos mocks base method.
+func (m *MockGiteaClient) ListUserRepos(arg0 string, arg1 gitea.ListReposOptions) ([]*gitea.Repository, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserRepos", arg0, arg1)
+	ret0, _ := ret[0].([]*gitea.Repository)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListUserRepos indicates an expected call of ListUserRepos.
+func (mr *MockGiteaClientMockRecorder) ListUserRepos(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserRepos", reflect.TypeOf((*MockGiteaClient)(nil).ListUserRepos), arg0, arg1)
+}
+
+// TransferRepo mocks base method.
+func (m *MockGiteaClient) TransferRepo(arg0, arg1 string, arg2 gitea.TransferRepoOption) (*gitea.Repository, *gitea.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransferRepo", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*gitea.Repository)
+	ret1, _ := ret[1].(*gitea.Response)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// TransferRepo indicates an expected call of TransferRepo.
+func (mr *MockGiteaClientMockRecorder) TransferRepo(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferRepo", reflect.TypeOf((*MockGiteaClient)(nil).TransferRepo), arg0, arg1, arg2)
+}
@@ -62,3 +62,33 @@ func (mr *MockGitProvisionerMockRecorder) ProvisionRepository(arg0, arg1 interfa
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProvisionRepository", reflect.TypeOf((*MockGitProvisioner)(nil).ProvisionRepository), arg0, arg1)
 }
+
+// RenameRepository mocks base method.
+func (m *MockGitProvisioner) RenameRepository(arg0, arg1, arg2 string) (*keptn.RenameResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenameRepository", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*keptn.RenameResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenameRepository indicates an expected call of RenameRepository.
+func (mr *MockGitProvisionerMockRecorder) RenameRepository(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameRepository", reflect.TypeOf((*MockGitProvisioner)(nil).RenameRepository), arg0, arg1, arg2)
+}
+
+// RestoreRepository mocks base method.
+func (m *MockGitProvisioner) RestoreRepository(arg0, arg1 string) (*keptn.ProvisionResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreRepository", arg0, arg1)
+	ret0, _ := ret[0].(*keptn.ProvisionResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreRepository indicates an expected call of RestoreRepository.
+func (mr *MockGitProvisionerMockRecorder) RestoreRepository(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreRepository", reflect.TypeOf((*MockGitProvisioner)(nil).RestoreRepository), arg0, arg1)
+}
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+	"log"
 	"net/http"
 
 	"code.gitea.io/sdk/gitea"
 
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/backup"
 	"keptn-sandbox/keptn-gitea-provisioner/pkg/utils"
 )
 
@@ -20,16 +22,30 @@ const DefaultKeptnNamespace = "keptn"
 // DefaultUserEmailDomain is the default E-Mail domain used for users
 const DefaultUserEmailDomain = "keptn-gitea-auto-provisioner.local"
 
+// ErrMissingAdminRights indicates that the configured Gitea user is not an administrator
+var /*const*/ ErrMissingAdminRights = errors.New("the configured Gitea user has no admin rights")
+
 // GiteaClient represents the interface of the Gitea client that is needed for the provisioner
 type GiteaClient interface {
+	GetMyUserInfo() (*gitea.User, *gitea.Response, error)
 	GetUserInfo(user string) (*gitea.User, *gitea.Response, error)
 	AdminCreateUser(opt gitea.CreateUserOption) (*gitea.User, *gitea.Response, error)
+	AdminEditUser(user string, opt gitea.EditUserOption) (*gitea.Response, error)
 	AdminCreateRepo(username string, opt gitea.CreateRepoOption) (*gitea.Repository, *gitea.Response, error)
+	GetRepo(owner string, reponame string) (*gitea.Repository, *gitea.Response, error)
 	DeleteRepo(username string, repository string) (*gitea.Response, error)
 	CreateAccessToken(opt gitea.CreateAccessTokenOption) (*gitea.AccessToken, *gitea.Response, error)
 	DeleteAccessToken(value interface{}) (*gitea.Response, error)
 	ListMyRepos(opt gitea.ListReposOptions) ([]*gitea.Repository, *gitea.Response, error)
 	AdminDeleteUser(user string) (*gitea.Response, error)
+	AdminListUsers(opt gitea.AdminListUsersOptions) ([]*gitea.User, *gitea.Response, error)
+	ListUserRepos(user string, opt gitea.ListReposOptions) ([]*gitea.Repository, *gitea.Response, error)
+	ListAccessTokens(opts gitea.ListAccessTokensOptions) ([]*gitea.AccessToken, *gitea.Response, error)
+	EditRepo(owner string, reponame string, opt gitea.EditRepoOption) (*gitea.Repository, *gitea.Response, error)
+	TransferRepo(owner string, reponame string, opt gitea.TransferRepoOption) (*gitea.Repository, *gitea.Response, error)
+	GetOrg(orgname string) (*gitea.Organization, *gitea.Response, error)
+	CreateOrg(opt gitea.CreateOrgOption) (*gitea.Organization, *gitea.Response, error)
+	ListOrgRepos(org string, opt gitea.ListOrgReposOptions) ([]*gitea.Repository, *gitea.Response, error)
 }
 
 //go:generate mockgen -destination=fake/gitea_mock.go -package=fake . GiteaClient
@@ -41,6 +57,13 @@ type GiteaProvisioner struct {
 	credentials     gitea.ClientOption
 	client          GiteaClient
 	newClientFunc   func(url string, options ...gitea.ClientOption) (GiteaClient, error)
+	locker          NamespaceLocker
+	credentialSink  CredentialSink
+	quota           QuotaOptions
+	deletion        DeletionOptions
+	backup          BackupOptions
+	bundleFunc      backup.BundleFunc
+	pushFunc        backup.PushFunc
 	UsernamePrefix  string
 	UserEmailDomain string
 	ProjectPrefix   string
@@ -54,29 +77,80 @@ type GiteaProvisionerOptions struct {
 	ProjectPrefix   string
 	TokenPrefix     string
 	ClientBuilder   func(url string, options ...gitea.ClientOption) (GiteaClient, error)
+	// Resilience enables retries and a circuit breaker for all requests against Gitea if set
+	Resilience *ResilienceOptions
+	// Locker serializes operations on the same namespace, an in-process KeyedMutex is used if not set
+	Locker NamespaceLocker
+	// Authentication allows to authenticate with an admin access token or OAuth2 instead of the admin password
+	Authentication *AuthenticationOptions
+	// Transport configures TLS and proxy settings of all connections to Gitea, including the sudo clients
+	Transport *TransportOptions
+	// CredentialSink receives a copy of the credentials of every provisioned repository if set
+	CredentialSink CredentialSink
+	// Quota limits the repositories of every namespace if set
+	Quota *QuotaOptions
+	// Deletion defines what happens to the repository of a deleted project, it is deleted permanently if not set
+	Deletion *DeletionOptions
+	// Backup enables a backup of every repository before it is deleted if its store is set
+	Backup *BackupOptions
 }
 
-// NewGiteaProvisioner creates a new gitea provisioner service with the given credentials and options
+// NewGiteaProvisioner creates a new gitea provisioner service with the given credentials and options. The admin
+// password may be empty if an access token or OAuth2 client is configured in the options, in that case the admin
+// username is also optional and resolved from Gitea.
 func NewGiteaProvisioner(giteaEndpoint string, adminUsername string, adminPassword string, options *GiteaProvisionerOptions) (*GiteaProvisioner, error) {
 	clientBuilder := func(url string, options ...gitea.ClientOption) (GiteaClient, error) {
 		return gitea.NewClient(url, options...)
 	}
 
-	if options.ClientBuilder != nil {
+	if options != nil && options.ClientBuilder != nil {
 		clientBuilder = options.ClientBuilder
 	}
 
-	clientCredentials := gitea.SetBasicAuth(adminUsername, adminPassword)
+	if options != nil && options.Resilience != nil {
+		clientBuilder = NewResilientClientBuilder(clientBuilder, *options.Resilience)
+	}
+
+	var authentication *AuthenticationOptions
+	var transport *TransportOptions
+	if options != nil {
+		authentication = options.Authentication
+		transport = options.Transport
+	}
+
+	httpClient, err := NewHTTPClient(transport)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create http client: %w", err)
+	}
+
+	if adminUsername == "" {
+		username, err := resolveAdminUsername(giteaEndpoint, authentication, httpClient, clientBuilder)
+		if err != nil {
+			return nil, err
+		}
+
+		adminUsername = username
+	}
+
+	clientCredentials, err := buildCredentials(adminUsername, adminPassword, authentication, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
 	giteaClient, err := clientBuilder(giteaEndpoint, clientCredentials)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Gitea Client: %w", err)
 	}
 
+	bundler := backup.Bundler{Env: gitEnvironment(transport)}
 	provisioner := GiteaProvisioner{
 		endpoint:      giteaEndpoint,
 		credentials:   clientCredentials,
 		client:        giteaClient,
 		newClientFunc: clientBuilder,
+		locker:        NewKeyedMutex(),
+		bundleFunc:    bundler.Bundle,
+		pushFunc:      bundler.Push,
 	}
 
 	// If options are set, apply them to the provisioner
@@ -85,6 +159,24 @@ func NewGiteaProvisioner(giteaEndpoint string, adminUsername string, adminPasswo
 		provisioner.UserEmailDomain = options.UserEmailDomain
 		provisioner.ProjectPrefix = options.ProjectPrefix
 		provisioner.TokenPrefix = options.TokenPrefix
+
+		if options.Locker != nil {
+			provisioner.locker = options.Locker
+		}
+
+		provisioner.credentialSink = options.CredentialSink
+
+		if options.Quota != nil {
+			provisioner.quota = *options.Quota
+		}
+
+		if options.Deletion != nil {
+			provisioner.deletion = *options.Deletion
+		}
+
+		if options.Backup != nil {
+			provisioner.backup = *options.Backup
+		}
 	}
 
 	// Make sure the e-mail domain is set, because otherwise account creation will fail
@@ -95,6 +187,24 @@ func NewGiteaProvisioner(giteaEndpoint string, adminUsername string, adminPasswo
 	return &provisioner, nil
 }
 
+// CheckHealth verifies that Gitea is reachable and that the configured credentials belong to an admin user
+func (h *GiteaProvisioner) CheckHealth() error {
+	user, r, err := h.client.GetMyUserInfo()
+	if err != nil {
+		return fmt.Errorf("unable to get user info of the configured admin user: %w", err)
+	}
+
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d when querying the configured admin user", r.StatusCode)
+	}
+
+	if !user.IsAdmin {
+		return fmt.Errorf("%w: %s", ErrMissingAdminRights, user.UserName)
+	}
+
+	return nil
+}
+
 // CreateUser creates a user if it doesn't exist already for the given Keptn namespace
 func (h *GiteaProvisioner) CreateUser(namespace string) (string, error) {
 
@@ -112,10 +222,11 @@ func (h *GiteaProvisioner) CreateUser(namespace string) (string, error) {
 	if user == nil || r.StatusCode == http.StatusNotFound {
 		passwordChangePolicy := false
 
+		// The full name records the namespace, since the username may be a sanitized version of it
 		_, r, err := h.client.AdminCreateUser(gitea.CreateUserOption{
 			LoginName:          username,
 			Username:           username,
-			FullName:           username,
+			FullName:           namespaceOrDefault(namespace),
 			Email:              fmt.Sprintf("%s@%s", username, h.UserEmailDomain),
 			Password:           password,
 			MustChangePassword: &passwordChangePolicy,
@@ -132,11 +243,31 @@ func (h *GiteaProvisioner) CreateUser(namespace string) (string, error) {
 				username, r.StatusCode,
 			)
 		}
+
+		if err := h.applyUserQuota(username); err != nil {
+			return "", err
+		}
+
+		return username, nil
+	}
+
+	if err := checkUserNamespace(user, namespace); err != nil {
+		return "", err
 	}
 
 	return username, nil
 }
 
+// checkUserNamespace returns ErrNameCollision if the existing user has been created for a different namespace
+func checkUserNamespace(user *gitea.User, namespace string) error {
+	// Users of older versions have their username as full name
+	if user.FullName != "" && user.FullName != user.UserName && user.FullName != namespaceOrDefault(namespace) {
+		return fmt.Errorf("%w: user %s belongs to namespace %s", ErrNameCollision, user.UserName, user.FullName)
+	}
+
+	return nil
+}
+
 // CreateToken creates an access token that has read/write privileges for the given project
 func (h *GiteaProvisioner) CreateToken(namespace string, project string) (string, error) {
 	// Note: we must change the client to use a different user:
@@ -161,16 +292,13 @@ func (h *GiteaProvisioner) CreateToken(namespace string, project string) (string
 
 // CreateRepository creates a repository in the Gitea server
 func (h *GiteaProvisioner) CreateRepository(namespace string, project string) (string, error) {
+	username := h.GetUsername(namespace)
 	projectName := h.GetProjectName(project)
-	projectDesc := fmt.Sprintf(
-		"Repository was automatically provisioned by keptn-gitea-GitProvisioner for project %s",
-		projectName,
-	)
 
 	// Note: Keptn requires a completely empty git repository where the default branch is set to master
-	repo, r, err := h.client.AdminCreateRepo(h.GetUsername(namespace), gitea.CreateRepoOption{
+	repo, r, err := h.client.AdminCreateRepo(username, gitea.CreateRepoOption{
 		Name:          projectName,
-		Description:   projectDesc,
+		Description:   projectDescription(project),
 		Private:       true,
 		IssueLabels:   "",
 		AutoInit:      false,
@@ -187,8 +315,19 @@ func (h *GiteaProvisioner) CreateRepository(namespace string, project string) (s
 		return "", fmt.Errorf("unable to create project \"%s\": %w", projectName, err)
 	}
 
-	// Project already exists, relay the status code only
+	// Project already exists, relay the status code only unless the repository belongs to a different project
 	if r.StatusCode == http.StatusConflict {
+		existing, _, err := h.client.GetRepo(username, projectName)
+		if err == nil && existing != nil && h.projectOfRepository(existing) != project {
+			return "", fmt.Errorf("%w: repository %s/%s belongs to project %s",
+				ErrNameCollision, username, projectName, h.projectOfRepository(existing),
+			)
+		}
+
+		if err == nil && existing != nil && existing.Archived {
+			return "", fmt.Errorf("%w: %s/%s", ErrRepositoryArchived, username, projectName)
+		}
+
 		return "", ErrRepositoryAlreadyExists
 	}
 
@@ -203,47 +342,94 @@ func (h *GiteaProvisioner) CreateRepository(namespace string, project string) (s
 	return repo.CloneURL, nil
 }
 
-// GetUsername returns the username that is used by the gitea upstream server to identify a Keptn namespace
-func (h *GiteaProvisioner) GetUsername(namespace string) string {
-	// Use default Keptn namespace if no one is defined, to avoid creating users that
-	// have more or less an empty name if no prefix was defined
-	if namespace == "" {
-		namespace = DefaultKeptnNamespace
+// lockNamespace acquires the lock for the user of the given namespace, such that user creation and cleanup cannot
+// interleave. If no locker is configured nothing is locked.
+func (h *GiteaProvisioner) lockNamespace(namespace string) (func(), error) {
+	if h.locker == nil {
+		return func() {}, nil
+	}
+
+	unlock, err := h.locker.Lock(h.GetUsername(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("unable to lock namespace %s: %w", namespace, err)
 	}
 
-	return fmt.Sprintf("%s%s", h.UsernamePrefix, namespace)
+	return unlock, nil
+}
+
+// GetUsername returns the username that is used by the gitea upstream server to identify a Keptn namespace. Namespaces
+// that Gitea does not accept as username (e.g. too long) are sanitized and suffixed with a hash, see giteaName.
+func (h *GiteaProvisioner) GetUsername(namespace string) string {
+	return giteaName(h.UsernamePrefix, namespaceOrDefault(namespace), usernameRules)
 }
 
 // GetProjectName returns the name of the project in the gitea upstream repository
 func (h *GiteaProvisioner) GetProjectName(project string) string {
-	return fmt.Sprintf("%s%s", h.ProjectPrefix, project)
+	return giteaName(h.ProjectPrefix, project, repositoryNameRules)
 }
 
 // GetAccessTokenName returns the name of the access token that as read/write privileges for the specified project
 func (h *GiteaProvisioner) GetAccessTokenName(project string) string {
-	return fmt.Sprintf("%s%s", h.TokenPrefix, project)
+	return giteaName(h.TokenPrefix, project, accessTokenNameRules)
+}
+
+// GiteaObjects returns the names of the user, repository and access token of the given project
+func (h *GiteaProvisioner) GiteaObjects(namespace string, project string) GiteaObjects {
+	return GiteaObjects{
+		User:        h.GetUsername(namespace),
+		Repository:  h.GetProjectName(project),
+		AccessToken: h.GetAccessTokenName(project),
+	}
+}
+
+// namespaceOrDefault returns the default Keptn namespace if no namespace is defined, to avoid creating users that
+// have more or less an empty name if no prefix was defined
+func namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return DefaultKeptnNamespace
+	}
+
+	return namespace
 }
 
-// DeleteRepository deletes a given repository and all associated resources that where created with that repository
+// DeleteRepository deletes a given repository and all associated resources that where created with that repository,
+// the repository itself is deleted, archived or moved to the graveyard depending on the DeletionOptions
 func (h *GiteaProvisioner) DeleteRepository(namespace string, project string) error {
+	return h.deleteProject(namespace, project, h.deletion.policy(), true)
+}
 
+// deleteProject deletes the project with the given deletion policy, the repository is backed up first if withBackup
+// is set and a backup store is configured
+func (h *GiteaProvisioner) deleteProject(namespace string, project string, policy string, withBackup bool) error {
 	if project == "" {
 		return fmt.Errorf("%w: unable to delete project with an empty name", ErrInvalidRequest)
 	}
 
-	username := h.GetUsername(namespace)
-	accessToken := h.GetAccessTokenName(project)
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	r, err := h.client.DeleteRepo(username, project)
-	if err != nil && r == nil {
-		return fmt.Errorf("unable to delete the repository: %w", err)
+	if withBackup {
+		if err := h.backupRepository(namespace, project, policy); err != nil {
+			return err
+		}
 	}
 
-	// Project does not exist, relay the status code only
-	if r.StatusCode == http.StatusNotFound {
-		return ErrRepositoryDoesNotExist
+	if err := h.removeRepository(h.GetUsername(namespace), project, policy); err != nil {
+		return err
 	}
 
+	return h.releaseProject(namespace, project)
+}
+
+// releaseProject removes what the namespace still holds of a project whose repository has been removed or moved away:
+// the access token, the user if it owns no other repository and the copy of the credentials
+func (h *GiteaProvisioner) releaseProject(namespace string, project string) error {
+	username := h.GetUsername(namespace)
+	accessToken := h.GetAccessTokenName(project)
+
 	// Note: to delete a access token we have to use sudo mode:
 	userClient, err := h.newClientFunc(h.endpoint, h.credentials, gitea.SetSudo(username))
 	if err != nil {
@@ -252,13 +438,13 @@ func (h *GiteaProvisioner) DeleteRepository(namespace string, project string) er
 
 	_, err = userClient.DeleteAccessToken(accessToken)
 	if err != nil {
-		return fmt.Errorf("unable to delete the access token: ")
+		return fmt.Errorf("unable to delete the access token: %w", err)
 	}
 
 	// Check if user has no repositories:
 	repos, r, err := userClient.ListMyRepos(gitea.ListReposOptions{})
 	if err != nil {
-		return fmt.Errorf("unable to query all user repositories for cleanup: %s", err)
+		return fmt.Errorf("unable to query all user repositories for cleanup: %w", err)
 	}
 
 	if r.StatusCode != http.StatusOK {
@@ -269,7 +455,14 @@ func (h *GiteaProvisioner) DeleteRepository(namespace string, project string) er
 	if len(repos) == 0 {
 		_, err := h.client.AdminDeleteUser(username)
 		if err != nil {
-			return fmt.Errorf("unable to delete user %s", username)
+			return fmt.Errorf("unable to delete user %s: %w", username, err)
+		}
+	}
+
+	// The copy of the credentials is best effort, the repository has already been removed at this point
+	if h.credentialSink != nil {
+		if err := h.credentialSink.Delete(namespace, project); err != nil {
+			log.Printf("Unable to delete the credential copy of project %s: %s\n", project, err)
 		}
 	}
 
@@ -284,8 +477,18 @@ func (h *GiteaProvisioner) ProvisionRepository(namespace string, project string)
 		return nil, fmt.Errorf("%w: unable to create project with an empty name", ErrInvalidRequest)
 	}
 
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := h.checkQuota(namespace); err != nil {
+		return nil, err
+	}
+
 	if _, err := h.CreateUser(namespace); err != nil {
-		return nil, fmt.Errorf("unable to create user: %s\n", err.Error())
+		return nil, fmt.Errorf("unable to create user: %w", err)
 	}
 
 	repository, err := h.CreateRepository(namespace, project)
@@ -295,6 +498,10 @@ func (h *GiteaProvisioner) ProvisionRepository(namespace string, project string)
 			return nil, ErrRepositoryAlreadyExists
 		}
 
+		if errors.Is(err, ErrNameCollision) || errors.Is(err, ErrRepositoryArchived) {
+			return nil, err
+		}
+
 		return nil, fmt.Errorf("unable to create repository: %w", err)
 	}
 
@@ -304,9 +511,18 @@ func (h *GiteaProvisioner) ProvisionRepository(namespace string, project string)
 		return nil, fmt.Errorf("unable to create token: %w", err)
 	}
 
-	return &keptn.ProvisionResponse{
+	response := &keptn.ProvisionResponse{
 		GitRemoteURL: repository,
 		GitToken:     token,
 		GitUser:      username,
-	}, nil
+	}
+
+	// The copy of the credentials is best effort, failing the request would leave an already created repository behind
+	if h.credentialSink != nil {
+		if err := h.credentialSink.Store(namespace, project, response); err != nil {
+			log.Printf("Unable to store the credential copy of project %s: %s\n", project, err)
+		}
+	}
+
+	return response, nil
 }
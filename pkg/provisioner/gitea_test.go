@@ -2,6 +2,7 @@ package provisioner
 
 import (
 	"code.gitea.io/sdk/gitea"
+	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -97,6 +98,10 @@ func TestGiteaProvisioner_UnableToCreateRepository(t *testing.T) {
 
 	namespace := "keptn"
 	giteaClient.EXPECT().AdminCreateRepo(namespace, gomock.Any()).Times(1).Return(nil, createResponse(http.StatusConflict), nil)
+	giteaClient.EXPECT().GetRepo(namespace, "repository").Times(1).Return(&gitea.Repository{
+		Name:        "repository",
+		Description: projectDescription("repository"),
+	}, createResponse(http.StatusOK), nil)
 
 	repo, err := giteaProvisioner.CreateRepository(namespace, "repository")
 	require.Error(t, err)
@@ -143,6 +148,7 @@ func TestGiteaProvisioner_DeleteRepository(t *testing.T) {
 		},
 	}
 
+	giteaClient.EXPECT().GetRepo("some-username", "project1").Times(1).Return(&gitea.Repository{Name: "project1"}, createResponse(http.StatusOK), nil)
 	giteaClient.EXPECT().DeleteRepo("some-username", "project1").Times(1).Return(createResponse(http.StatusOK), nil)
 	giteaClient.EXPECT().DeleteAccessToken("project1").Times(1).Return(nil, nil)
 	giteaClient.EXPECT().ListMyRepos(gitea.ListReposOptions{}).Times(1).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
@@ -152,6 +158,28 @@ func TestGiteaProvisioner_DeleteRepository(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestGiteaProvisioner_DeleteRepositoryWithPrefix(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client:        giteaClient,
+		ProjectPrefix: "project-",
+		TokenPrefix:   "token-",
+		newClientFunc: func(url string, options ...gitea.ClientOption) (GiteaClient, error) {
+			return giteaClient, nil
+		},
+	}
+
+	giteaClient.EXPECT().GetRepo("keptn", "project-project1").Times(1).Return(&gitea.Repository{Name: "project-project1"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteRepo("keptn", "project-project1").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().DeleteAccessToken("token-project1").Times(1).Return(nil, nil)
+	giteaClient.EXPECT().ListMyRepos(gitea.ListReposOptions{}).Times(1).Return([]*gitea.Repository{{}}, createResponse(http.StatusOK), nil)
+
+	require.NoError(t, giteaProvisioner.DeleteRepository("keptn", "project1"))
+}
+
 func TestGiteaProvisioner_ProvisionRepository(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -209,6 +237,7 @@ func TestGiteaProvisioner_ProvisionRepositoryConflict(t *testing.T) {
 	giteaClient.EXPECT().GetUserInfo("user").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
 	giteaClient.EXPECT().AdminCreateUser(gomock.Any()).Times(1).Return(nil, createResponse(http.StatusCreated), nil)
 	giteaClient.EXPECT().AdminCreateRepo("user", gomock.Any()).Times(1).Return(nil, createResponse(http.StatusConflict), nil)
+	giteaClient.EXPECT().GetRepo("user", "some-keptn-project").Times(1).Return(&gitea.Repository{Name: "some-keptn-project"}, createResponse(http.StatusOK), nil)
 	giteaClient.EXPECT().CreateAccessToken(gomock.Any()).Times(0)
 
 	provisionRepository, err := giteaProvisioner.ProvisionRepository("user", "some-keptn-project")
@@ -322,3 +351,22 @@ func TestGiteaProvisioner_CreateTokenGiteaProblem(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, "", token)
 }
+
+func TestGiteaProvisioner_CheckHealth(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+	}
+
+	giteaClient.EXPECT().GetMyUserInfo().Times(1).Return(&gitea.User{UserName: "admin", IsAdmin: true}, createResponse(http.StatusOK), nil)
+	require.NoError(t, giteaProvisioner.CheckHealth())
+
+	giteaClient.EXPECT().GetMyUserInfo().Times(1).Return(&gitea.User{UserName: "someone", IsAdmin: false}, createResponse(http.StatusOK), nil)
+	require.ErrorIs(t, giteaProvisioner.CheckHealth(), ErrMissingAdminRights)
+
+	giteaClient.EXPECT().GetMyUserInfo().Times(1).Return(nil, createResponse(http.StatusUnauthorized), fmt.Errorf("401 Unauthorized"))
+	require.Error(t, giteaProvisioner.CheckHealth())
+}
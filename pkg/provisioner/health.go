@@ -0,0 +1,114 @@
+package provisioner
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrHealthCheckTimeout indicates that the upstream didn't answer the readiness check in time
+var /*const*/ ErrHealthCheckTimeout = errors.New("the health check of the upstream timed out")
+
+// DefaultHealthCheckTimeout limits how long a probe waits for the upstream if no timeout is configured, it must be
+// below the timeoutSeconds of the readiness probe
+const DefaultHealthCheckTimeout = 3 * time.Second
+
+// HealthChecker is implemented by provisioners that are able to verify that their upstream is usable
+type HealthChecker interface {
+	// CheckHealth returns an error if the upstream is not reachable or the credentials are not sufficient
+	CheckHealth() error
+}
+
+// The HealthHandler provides liveness and readiness endpoints for Kubernetes probes, the result of the readiness check
+// is cached for CacheDuration to avoid hammering the upstream with probe requests
+type HealthHandler struct {
+	Checker       HealthChecker
+	CacheDuration time.Duration
+	// Timeout limits how long a probe waits for the upstream, DefaultHealthCheckTimeout is used if 0
+	Timeout time.Duration
+
+	mutex     sync.Mutex
+	checkedAt time.Time
+	lastErr   error
+	// running is closed once the check that is currently running has finished
+	running chan struct{}
+	now     func() time.Time
+}
+
+// HandleHealthz handles the liveness probe, which succeeds as long as the process is able to serve http requests
+func (h *HealthHandler) HandleHealthz(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleReadyz handles the readiness probe and will generate the following status codes:
+//   - 200  If the upstream is reachable and the configured credentials have admin rights
+//   - 503  If the upstream is not reachable or the credentials are not sufficient
+func (h *HealthHandler) HandleReadyz(w http.ResponseWriter, req *http.Request) {
+	if err := h.check(); err != nil {
+		log.Printf("Readiness check failed: %s\n", err.Error())
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// check returns the cached result of the last health check or executes a new one if the cache has expired. The upstream
+// is checked outside the lock and concurrent probes share the running check, such that a slow upstream fails the
+// probes after the timeout instead of stalling them.
+func (h *HealthHandler) check() error {
+	h.mutex.Lock()
+
+	if !h.checkedAt.IsZero() && h.currentTime().Sub(h.checkedAt) < h.CacheDuration {
+		defer h.mutex.Unlock()
+		return h.lastErr
+	}
+
+	if h.running == nil {
+		running := make(chan struct{})
+		h.running = running
+
+		go func() {
+			err := h.Checker.CheckHealth()
+
+			h.mutex.Lock()
+			h.lastErr = err
+			h.checkedAt = h.currentTime()
+			h.running = nil
+			h.mutex.Unlock()
+
+			close(running)
+		}()
+	}
+
+	running := h.running
+	h.mutex.Unlock()
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-running:
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		return h.lastErr
+	case <-timer.C:
+		return ErrHealthCheckTimeout
+	}
+}
+
+// currentTime returns the current time of the injected clock
+func (h *HealthHandler) currentTime() time.Time {
+	if h.now != nil {
+		return h.now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,93 @@
+package provisioner
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type countingHealthChecker struct {
+	calls int
+	err   error
+}
+
+func (c *countingHealthChecker) CheckHealth() error {
+	c.calls++
+	return c.err
+}
+
+func TestHealthHandler_Healthz(t *testing.T) {
+	handler := HealthHandler{}
+	request, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+	response := httptest.NewRecorder()
+
+	handler.HandleHealthz(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+}
+
+func TestHealthHandler_Readyz(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	checker := &countingHealthChecker{}
+	handler := HealthHandler{
+		Checker:       checker,
+		CacheDuration: 10 * time.Second,
+		now:           func() time.Time { return now },
+	}
+
+	probe := func() int {
+		request, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+		response := httptest.NewRecorder()
+		handler.HandleReadyz(response, request)
+		return response.Code
+	}
+
+	assert.Equal(t, http.StatusOK, probe())
+
+	// Result is cached, a failing upstream is not noticed until the cache expires
+	checker.err = fmt.Errorf("connection refused")
+	now = now.Add(5 * time.Second)
+	assert.Equal(t, http.StatusOK, probe())
+	assert.Equal(t, 1, checker.calls)
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, probe())
+	assert.Equal(t, 2, checker.calls)
+}
+
+// blockingHealthChecker blocks every check until release is closed
+type blockingHealthChecker struct {
+	release chan struct{}
+}
+
+func (b *blockingHealthChecker) CheckHealth() error {
+	<-b.release
+	return nil
+}
+
+func TestHealthHandler_ReadyzTimeout(t *testing.T) {
+	checker := &blockingHealthChecker{release: make(chan struct{})}
+	handler := HealthHandler{
+		Checker:       checker,
+		CacheDuration: time.Minute,
+		Timeout:       10 * time.Millisecond,
+	}
+
+	probe := func() int {
+		request, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+		response := httptest.NewRecorder()
+		handler.HandleReadyz(response, request)
+		return response.Code
+	}
+
+	// Concurrent probes don't wait for each other while the upstream hangs
+	assert.Equal(t, http.StatusServiceUnavailable, probe())
+	assert.Equal(t, http.StatusServiceUnavailable, probe())
+
+	close(checker.release)
+	assert.Eventually(t, func() bool {
+		return probe() == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+}
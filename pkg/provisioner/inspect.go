@@ -0,0 +1,233 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"code.gitea.io/sdk/gitea"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+)
+
+// ProjectInfo describes the Gitea objects of a provisioned Keptn project
+type ProjectInfo struct {
+	Namespace string `json:"namespace"`
+	Project   string `json:"project"`
+	// User, Repository and AccessToken are the Gitea names, they are set even if the objects don't exist
+	User       string `json:"user"`
+	UserExists bool   `json:"userExists"`
+	Repository string `json:"repository"`
+	RepoExists bool   `json:"repositoryExists"`
+	CloneURL   string `json:"cloneURL,omitempty"`
+	SizeKB     int    `json:"sizeKB"`
+	// Archived is true if the repository has been archived by the archive deletion policy
+	Archived    bool   `json:"archived,omitempty"`
+	AccessToken string `json:"accessToken"`
+	TokenExists bool   `json:"accessTokenExists"`
+	// TokenLastEight are the last eight characters of the access token, the token itself can't be read from Gitea
+	TokenLastEight string `json:"accessTokenLastEight,omitempty"`
+}
+
+// namespaceOfUser returns the Keptn namespace of a user created by the provisioner. The namespace is stored as full
+// name, users of older versions fall back to the username without the prefix.
+func (h *GiteaProvisioner) namespaceOfUser(user *gitea.User) string {
+	if user.FullName != "" && user.FullName != user.UserName {
+		return user.FullName
+	}
+
+	return strings.TrimPrefix(user.UserName, h.UsernamePrefix)
+}
+
+// InspectProject returns the state of the Gitea objects that belong to the given project
+func (h *GiteaProvisioner) InspectProject(namespace string, project string) (*ProjectInfo, error) {
+	objects := h.GiteaObjects(namespace, project)
+	info := &ProjectInfo{
+		Namespace:   namespaceOrDefault(namespace),
+		Project:     project,
+		User:        objects.User,
+		Repository:  objects.Repository,
+		AccessToken: objects.AccessToken,
+	}
+
+	_, r, err := h.client.GetUserInfo(objects.User)
+	if r != nil && r.StatusCode == http.StatusNotFound {
+		return info, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user info for user %s: %w", objects.User, err)
+	}
+	info.UserExists = true
+
+	repository, err := h.getRepository(objects.User, objects.Repository)
+	if err != nil && !errors.Is(err, ErrRepositoryDoesNotExist) {
+		return nil, err
+	}
+
+	if err == nil {
+		info.RepoExists = true
+		info.CloneURL = repository.CloneURL
+		info.SizeKB = repository.Size
+		info.Archived = repository.Archived
+	}
+
+	token, err := h.findAccessToken(objects.User, objects.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != nil {
+		info.TokenExists = true
+		info.TokenLastEight = token.TokenLastEight
+	}
+
+	return info, nil
+}
+
+// findAccessToken returns the access token of the user with the given name, nil if it doesn't exist
+func (h *GiteaProvisioner) findAccessToken(username string, name string) (*gitea.AccessToken, error) {
+	userClient, err := h.newClientFunc(h.endpoint, h.credentials, gitea.SetSudo(username))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create gitea client: %w", err)
+	}
+
+	for page := 1; ; page++ {
+		tokens, _, err := userClient.ListAccessTokens(gitea.ListAccessTokensOptions{
+			ListOptions: gitea.ListOptions{Page: page, PageSize: listPageSize},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list access tokens of user %s: %w", username, err)
+		}
+
+		for _, token := range tokens {
+			if token.Name == name {
+				return token, nil
+			}
+		}
+
+		if len(tokens) < listPageSize {
+			return nil, nil
+		}
+	}
+}
+
+// ListProjects returns all projects provisioned for the given namespace, or for all namespaces if it is empty. The
+// access tokens are not part of the result.
+func (h *GiteaProvisioner) ListProjects(namespace string) ([]ProjectInfo, error) {
+	var users []*gitea.User
+	if namespace != "" {
+		username := h.GetUsername(namespace)
+		user, r, err := h.client.GetUserInfo(username)
+		if r != nil && r.StatusCode == http.StatusNotFound {
+			return []ProjectInfo{}, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to get user info for user %s: %w", username, err)
+		}
+		users = []*gitea.User{user}
+	} else {
+		managedUsers, err := h.ListManagedUsers()
+		if err != nil {
+			return nil, err
+		}
+		users = managedUsers
+	}
+
+	projects := []ProjectInfo{}
+	for _, user := range users {
+		repositories, err := h.ListUserRepositories(user.UserName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repository := range repositories {
+			project := h.projectOfRepository(repository)
+			projects = append(projects, ProjectInfo{
+				Namespace:   h.namespaceOfUser(user),
+				Project:     project,
+				User:        user.UserName,
+				UserExists:  true,
+				Repository:  repository.Name,
+				RepoExists:  true,
+				CloneURL:    repository.CloneURL,
+				SizeKB:      repository.Size,
+				Archived:    repository.Archived,
+				AccessToken: h.GetAccessTokenName(project),
+			})
+		}
+	}
+
+	return projects, nil
+}
+
+// RotateToken replaces the access token of the given project and returns the new credentials. Keptn keeps using the
+// previous token until the credentials of the project are updated, e.g. with keptn update project.
+func (h *GiteaProvisioner) RotateToken(namespace string, project string) (*keptn.ProvisionResponse, error) {
+	if project == "" {
+		return nil, fmt.Errorf("%w: unable to rotate the token of a project with an empty name", ErrInvalidRequest)
+	}
+
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	username := h.GetUsername(namespace)
+	repository, err := h.getProjectRepository(username, project)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.issueToken(namespace, project, repository.CloneURL)
+}
+
+// revokeToken deletes the access token of the project, a missing token is ignored
+func (h *GiteaProvisioner) revokeToken(namespace string, project string) error {
+	userClient, err := h.newClientFunc(h.endpoint, h.credentials, gitea.SetSudo(h.GetUsername(namespace)))
+	if err != nil {
+		return fmt.Errorf("unable to create gitea client: %w", err)
+	}
+
+	r, err := userClient.DeleteAccessToken(h.GetAccessTokenName(project))
+	if err != nil && (r == nil || r.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("unable to delete the access token: %w", err)
+	}
+
+	return nil
+}
+
+// issueToken replaces the access token of the project with a new one and returns the credentials of the repository,
+// the old token may not exist
+func (h *GiteaProvisioner) issueToken(namespace string, project string, cloneURL string) (*keptn.ProvisionResponse, error) {
+	if err := h.revokeToken(namespace, project); err != nil {
+		return nil, err
+	}
+
+	// The token name is fixed per project, so the old token has to be deleted before the new one can be created
+	username := h.GetUsername(namespace)
+	token, err := h.CreateToken(namespace, project)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create token, the previous token of project %s has been revoked and the "+
+			"project has no working token until the token is rotated again: %w", project, err)
+	}
+
+	response := &keptn.ProvisionResponse{
+		GitRemoteURL: cloneURL,
+		GitToken:     token,
+		GitUser:      username,
+	}
+
+	// The copy of the credentials is best effort, the token has already been replaced at this point
+	if h.credentialSink != nil {
+		if err := h.credentialSink.Store(namespace, project, response); err != nil {
+			log.Printf("Unable to store the credential copy of project %s: %s\n", project, err)
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,179 @@
+package provisioner
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+)
+
+func newInspectProvisioner(giteaClient *fake.MockGiteaClient) *GiteaProvisioner {
+	return &GiteaProvisioner{
+		client: giteaClient,
+		newClientFunc: func(url string, options ...gitea.ClientOption) (GiteaClient, error) {
+			return giteaClient, nil
+		},
+		locker:          NewKeyedMutex(),
+		UsernamePrefix:  "keptn-",
+		UserEmailDomain: "provisioner.local",
+		ProjectPrefix:   "project-",
+		TokenPrefix:     "token-",
+	}
+}
+
+func TestGiteaProvisioner_InspectProject(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetUserInfo("keptn-keptn").Times(1).Return(&gitea.User{UserName: "keptn-keptn"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-keptn", "project-podtato").Times(1).Return(&gitea.Repository{
+		Name:     "project-podtato",
+		CloneURL: "http://gitea/keptn-keptn/project-podtato.git",
+		Size:     42,
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListAccessTokens(gomock.Any()).Times(1).Return([]*gitea.AccessToken{
+		{ID: 1, Name: "token-other", TokenLastEight: "00000000"},
+		{ID: 2, Name: "token-podtato", TokenLastEight: "12345678"},
+	}, createResponse(http.StatusOK), nil)
+
+	info, err := giteaProvisioner.InspectProject("", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, &ProjectInfo{
+		Namespace:      "keptn",
+		Project:        "podtato",
+		User:           "keptn-keptn",
+		UserExists:     true,
+		Repository:     "project-podtato",
+		RepoExists:     true,
+		CloneURL:       "http://gitea/keptn-keptn/project-podtato.git",
+		SizeKB:         42,
+		AccessToken:    "token-podtato",
+		TokenExists:    true,
+		TokenLastEight: "12345678",
+	}, info)
+}
+
+func TestGiteaProvisioner_InspectProjectWithoutUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+
+	info, err := giteaProvisioner.InspectProject("dev", "podtato")
+	require.NoError(t, err)
+	assert.False(t, info.UserExists)
+	assert.False(t, info.RepoExists)
+	assert.False(t, info.TokenExists)
+	assert.Equal(t, "project-podtato", info.Repository)
+}
+
+func TestGiteaProvisioner_ListProjects(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().AdminListUsers(gomock.Any()).Times(1).Return([]*gitea.User{
+		{UserName: "keptn-keptn", FullName: "keptn", Email: "keptn-keptn@provisioner.local"},
+		{UserName: "keptn-legacy", FullName: "keptn-legacy", Email: "keptn-legacy@provisioner.local"},
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListUserRepos("keptn-keptn", gomock.Any()).Times(1).Return([]*gitea.Repository{
+		{Name: "project-podtato", Description: projectDescription("podtato"), Size: 10},
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListUserRepos("keptn-legacy", gomock.Any()).Times(1).Return([]*gitea.Repository{
+		{Name: "project-sockshop"},
+	}, createResponse(http.StatusOK), nil)
+
+	projects, err := giteaProvisioner.ListProjects("")
+	require.NoError(t, err)
+	require.Len(t, projects, 2)
+	assert.Equal(t, "keptn", projects[0].Namespace)
+	assert.Equal(t, "podtato", projects[0].Project)
+	assert.Equal(t, 10, projects[0].SizeKB)
+	assert.Equal(t, "legacy", projects[1].Namespace)
+	assert.Equal(t, "sockshop", projects[1].Project)
+	assert.Equal(t, "token-sockshop", projects[1].AccessToken)
+}
+
+func TestGiteaProvisioner_ListProjectsOfUnknownNamespace(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+
+	projects, err := giteaProvisioner.ListProjects("dev")
+	require.NoError(t, err)
+	assert.Empty(t, projects)
+}
+
+func TestGiteaProvisioner_RotateToken(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("keptn-keptn", "project-podtato").Times(1).Return(&gitea.Repository{
+		Name:     "project-podtato",
+		CloneURL: "http://gitea/keptn-keptn/project-podtato.git",
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().CreateAccessToken(gitea.CreateAccessTokenOption{Name: "token-podtato"}).Times(1).
+		Return(&gitea.AccessToken{Token: "new-token"}, createResponse(http.StatusCreated), nil)
+
+	response, err := giteaProvisioner.RotateToken("keptn", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, "new-token", response.GitToken)
+	assert.Equal(t, "keptn-keptn", response.GitUser)
+	assert.Equal(t, "http://gitea/keptn-keptn/project-podtato.git", response.GitRemoteURL)
+}
+
+func TestGiteaProvisioner_RotateTokenCreateFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("keptn-keptn", "project-podtato").Times(1).Return(&gitea.Repository{
+		Name:     "project-podtato",
+		CloneURL: "http://gitea/keptn-keptn/project-podtato.git",
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().CreateAccessToken(gitea.CreateAccessTokenOption{Name: "token-podtato"}).Times(1).
+		Return(nil, createResponse(http.StatusInternalServerError), errors.New("internal error"))
+
+	// The old token is gone, the error has to tell that the project has no working token
+	_, err := giteaProvisioner.RotateToken("keptn", "podtato")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has no working token")
+}
+
+func TestGiteaProvisioner_RotateTokenOfUnknownProject(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("keptn-keptn", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+
+	_, err := giteaProvisioner.RotateToken("keptn", "podtato")
+	require.ErrorIs(t, err, ErrRepositoryDoesNotExist)
+}
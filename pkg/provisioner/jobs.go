@@ -0,0 +1,429 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrJobQueueFull indicates that an async request has been rejected because all workers are busy and the queue is full
+var /*const*/ ErrJobQueueFull = errors.New("the job queue is full")
+
+// AsyncHeader is the request header that makes a provisioning request return a Job instead of waiting for the result
+const AsyncHeader = "X-Async"
+
+// JobsPath is the path of the job status endpoint, the ID of the job is appended
+const JobsPath = "/jobs/"
+
+const (
+	// DefaultJobWorkers limits the number of concurrent jobs if no limit is configured
+	DefaultJobWorkers = 4
+	// DefaultJobQueueSize limits the number of waiting jobs if no limit is configured
+	DefaultJobQueueSize = 100
+	// DefaultJobRetention defines how long finished jobs are kept if no retention is configured
+	DefaultJobRetention = time.Hour
+)
+
+// secretResponseFields are the fields of a job response that are only returned by the first successful poll
+var secretResponseFields = []string{"gitToken"}
+
+// The states of a Job
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobOptions configure the JobQueue
+type JobOptions struct {
+	// Workers limits the number of jobs that run concurrently, DefaultJobWorkers is used if 0
+	Workers int
+	// QueueSize limits the number of jobs that wait for a worker, DefaultJobQueueSize is used if 0
+	QueueSize int
+	// Retention defines how long a finished job can be polled, DefaultJobRetention is used if 0
+	Retention time.Duration
+	// Operations registers every job until it has finished, such that queued jobs are drained on shutdown as well
+	Operations *OperationTracker
+}
+
+// workers returns the number of workers
+func (o JobOptions) workers() int {
+	if o.Workers <= 0 {
+		return DefaultJobWorkers
+	}
+
+	return o.Workers
+}
+
+// queueSize returns the capacity of the queue
+func (o JobOptions) queueSize() int {
+	if o.QueueSize <= 0 {
+		return DefaultJobQueueSize
+	}
+
+	return o.QueueSize
+}
+
+// retention returns how long finished jobs are kept
+func (o JobOptions) retention() time.Duration {
+	if o.Retention <= 0 {
+		return DefaultJobRetention
+	}
+
+	return o.Retention
+}
+
+// Job is the progress of an async request, once it has finished it contains the response of the synchronous request
+type Job struct {
+	ID        string `json:"id"`
+	Action    string `json:"action"`
+	Namespace string `json:"namespace"`
+	Project   string `json:"project"`
+	Status    string `json:"status"`
+	// QueuePosition is the position of a queued job, 1 is the next job that is picked up by a worker
+	QueuePosition int        `json:"queuePosition,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+	// StatusCode is the status code the synchronous request would have returned
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// RetryAfter is the Retry-After header in seconds the synchronous request would have returned, e.g. with 503 if
+	// the upstream Gitea server is considered unavailable
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// Response is the body the synchronous request would have returned, e.g. the keptn.ProvisionResponse. The access
+	// token is removed once the job has been polled successfully, ResponseRedacted is set afterwards.
+	Response         json.RawMessage `json:"response,omitempty"`
+	ResponseRedacted bool            `json:"responseRedacted,omitempty"`
+
+	// sequence orders the queued jobs
+	sequence uint64
+}
+
+// jobResult is the outcome of a job as it would have been written by the synchronous request
+type jobResult struct {
+	statusCode int
+	body       []byte
+	error      string
+	retryAfter int
+}
+
+// queuedJob is a job that waits for a worker
+type queuedJob struct {
+	id     string
+	action string
+	run    func() jobResult
+	finish func()
+}
+
+// JobQueue runs async requests in a bounded pool of workers and keeps their Job until the retention expired. Jobs are
+// kept in memory, so they can only be polled from the replica that accepted the request.
+type JobQueue struct {
+	options  JobOptions
+	queue    chan *queuedJob
+	mutex    sync.Mutex
+	jobs     map[string]*Job
+	sequence uint64
+	now      func() time.Time
+}
+
+// NewJobQueue creates a JobQueue with the given options, the jobs are processed once Run has been called
+func NewJobQueue(options JobOptions) *JobQueue {
+	return &JobQueue{
+		options: options,
+		queue:   make(chan *queuedJob, options.queueSize()),
+		jobs:    map[string]*Job{},
+		now:     time.Now,
+	}
+}
+
+// Run processes the queued jobs with the configured number of workers until the context is done, running jobs are
+// finished before Run returns
+func (q *JobQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < q.options.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.queue:
+					q.execute(job)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// submit queues a job for the given request, ErrJobQueueFull is returned if the queue has no capacity left
+func (q *JobQueue) submit(action string, namespace string, project string, run func() jobResult) (Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.prune()
+
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:        id,
+		Action:    action,
+		Namespace: namespace,
+		Project:   project,
+		Status:    JobQueued,
+		CreatedAt: q.now().UTC(),
+		sequence:  q.sequence,
+	}
+
+	finish := func() {}
+	if q.options.Operations != nil {
+		finish = q.options.Operations.Begin(fmt.Sprintf("%s job %s for project \"%s\" in namespace \"%s\"", action, id, project, namespace))
+	}
+
+	select {
+	case q.queue <- &queuedJob{id: id, action: action, run: run, finish: finish}:
+	default:
+		finish()
+		return Job{}, ErrJobQueueFull
+	}
+
+	q.sequence++
+	q.jobs[id] = job
+
+	return q.snapshot(job), nil
+}
+
+// execute runs the job and records its result, a job fails if the synchronous request wouldn't have returned 2xx
+func (q *JobQueue) execute(queued *queuedJob) {
+	defer queued.finish()
+
+	q.update(queued.id, func(job *Job) {
+		startedAt := q.now().UTC()
+		job.Status = JobRunning
+		job.StartedAt = &startedAt
+	})
+
+	result := queued.run()
+
+	q.update(queued.id, func(job *Job) {
+		finishedAt := q.now().UTC()
+		job.FinishedAt = &finishedAt
+		job.StatusCode = result.statusCode
+		job.Error = result.error
+		job.RetryAfter = result.retryAfter
+
+		job.Status = JobFailed
+		if result.statusCode >= 200 && result.statusCode < 300 {
+			job.Status = JobSucceeded
+		}
+
+		if len(result.body) > 0 && json.Valid(result.body) {
+			job.Response = result.body
+		}
+	})
+
+	log.Printf("Finished %s job %s with status code %d\n", queued.action, queued.id, result.statusCode)
+}
+
+// update modifies the job with the given ID while holding the lock
+func (q *JobQueue) update(id string, modify func(job *Job)) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if job, ok := q.jobs[id]; ok {
+		modify(job)
+	}
+}
+
+// Get returns the job with the given ID, false is returned if it doesn't exist or its retention expired
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.prune()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return q.snapshot(job), true
+}
+
+// poll returns the job with the given ID like Get and removes the secrets from the response of a finished job while
+// holding the same lock, such that only one of several concurrent polls returns the access token
+func (q *JobQueue) poll(id string) (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.prune()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	result := q.snapshot(job)
+	if job.FinishedAt != nil {
+		q.redact(job)
+	}
+
+	return result, true
+}
+
+// redact removes the secrets from the response of the job, such that the access token isn't kept in memory and can't
+// be polled again for the retention of the job, the lock must be held
+func (q *JobQueue) redact(job *Job) {
+	if len(job.Response) == 0 {
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(job.Response, &fields); err != nil {
+		return
+	}
+
+	redacted := false
+	for _, field := range secretResponseFields {
+		if _, ok := fields[field]; ok {
+			delete(fields, field)
+			redacted = true
+		}
+	}
+
+	if !redacted {
+		return
+	}
+
+	response, err := json.Marshal(fields)
+	if err != nil {
+		log.Printf("Unable to redact the response of job %s: %s\n", job.ID, err)
+		job.Response = nil
+	} else {
+		job.Response = response
+	}
+	job.ResponseRedacted = true
+}
+
+// snapshot returns a copy of the job with its current queue position, the lock must be held
+func (q *JobQueue) snapshot(job *Job) Job {
+	result := *job
+	if job.Status != JobQueued {
+		return result
+	}
+
+	for _, other := range q.jobs {
+		if other.Status == JobQueued && other.sequence <= job.sequence {
+			result.QueuePosition++
+		}
+	}
+
+	return result
+}
+
+// prune removes the finished jobs whose retention expired, the lock must be held
+func (q *JobQueue) prune() {
+	expiry := q.now().Add(-q.options.retention())
+
+	for id, job := range q.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(expiry) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// HandleJobRequest handles a GET http request of JobsPath followed by the ID of a job, the access token of a finished
+// job is only part of the body of the first poll. It will generate the following status codes:
+//   - 200  The Job is part of the body, the job is finished if its status is succeeded or failed
+//   - 404  If the job doesn't exist, its retention expired or it has been accepted by another replica
+//   - 405  If the request is not a GET request
+func (q *JobQueue) HandleJobRequest(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, ok := q.poll(strings.TrimPrefix(req.URL.Path, JobsPath))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("Unable to marshal job: %s\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Encountered error while writing response body: %s\n", err.Error())
+	}
+}
+
+// newJobID returns a random ID that can't be guessed, such that the jobs of other callers can't be polled
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("unable to generate job ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// bufferedResponse is the http.ResponseWriter of a job, it keeps the response of the synchronous handler
+type bufferedResponse struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+// newBufferedResponse creates a bufferedResponse that defaults to 200 like a http.ResponseWriter
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: http.Header{}, statusCode: http.StatusOK}
+}
+
+// Header returns the headers, only the Retry-After header is part of the job
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+// Write appends the data to the body
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+// WriteHeader records the status code
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	b.statusCode = statusCode
+}
+
+// retryAfter returns the seconds of the Retry-After header, 0 if it isn't set
+func (b *bufferedResponse) retryAfter() int {
+	seconds, err := strconv.Atoi(b.header.Get("Retry-After"))
+	if err != nil {
+		return 0
+	}
+
+	return seconds
+}
@@ -0,0 +1,232 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runJobQueue processes the jobs of the queue until the test has finished
+func runJobQueue(t *testing.T, queue *JobQueue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		queue.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitForJob polls the job until it has finished
+func waitForJob(t *testing.T, queue *JobQueue, id string) Job {
+	var job Job
+	require.Eventually(t, func() bool {
+		var ok bool
+		job, ok = queue.Get(id)
+		require.True(t, ok)
+		return job.FinishedAt != nil
+	}, 5*time.Second, 5*time.Millisecond)
+
+	return job
+}
+
+func TestJobQueue_Run(t *testing.T) {
+	queue := NewJobQueue(JobOptions{Workers: 1})
+
+	succeeded, err := queue.submit("provision", "keptn", "test", func() jobResult {
+		return jobResult{statusCode: http.StatusCreated, body: []byte(`{"gitUser":"keptn"}`)}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, JobQueued, succeeded.Status)
+	assert.Equal(t, 1, succeeded.QueuePosition)
+
+	failed, err := queue.submit("provision", "keptn", "other", func() jobResult {
+		return jobResult{statusCode: http.StatusConflict, error: ErrRepositoryAlreadyExists.Error()}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, failed.QueuePosition)
+	assert.NotEqual(t, succeeded.ID, failed.ID)
+
+	runJobQueue(t, queue)
+
+	job := waitForJob(t, queue, succeeded.ID)
+	assert.Equal(t, JobSucceeded, job.Status)
+	assert.Equal(t, http.StatusCreated, job.StatusCode)
+	assert.JSONEq(t, `{"gitUser":"keptn"}`, string(job.Response))
+	assert.NotNil(t, job.StartedAt)
+	assert.Zero(t, job.QueuePosition)
+
+	job = waitForJob(t, queue, failed.ID)
+	assert.Equal(t, JobFailed, job.Status)
+	assert.Equal(t, http.StatusConflict, job.StatusCode)
+	assert.Equal(t, ErrRepositoryAlreadyExists.Error(), job.Error)
+	assert.Empty(t, job.Response)
+}
+
+func TestJobQueue_Full(t *testing.T) {
+	operations := NewOperationTracker()
+	queue := NewJobQueue(JobOptions{QueueSize: 1, Operations: operations})
+
+	run := func() jobResult {
+		return jobResult{statusCode: http.StatusCreated}
+	}
+
+	job, err := queue.submit("provision", "keptn", "test", run)
+	require.NoError(t, err)
+
+	_, err = queue.submit("provision", "keptn", "other", run)
+	assert.ErrorIs(t, err, ErrJobQueueFull)
+
+	// Only the queued job has to be drained on shutdown
+	inFlight := operations.InFlight()
+	require.Len(t, inFlight, 1)
+	assert.Contains(t, inFlight[0], `provision job `+job.ID+` for project "test" in namespace "keptn"`)
+
+	runJobQueue(t, queue)
+	waitForJob(t, queue, job.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, operations.Wait(ctx))
+}
+
+func TestJobQueue_Retention(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	queue := NewJobQueue(JobOptions{Retention: time.Minute})
+	queue.now = func() time.Time {
+		return now
+	}
+
+	job, err := queue.submit("provision", "keptn", "test", func() jobResult {
+		return jobResult{statusCode: http.StatusCreated}
+	})
+	require.NoError(t, err)
+
+	runJobQueue(t, queue)
+	waitForJob(t, queue, job.ID)
+
+	now = now.Add(time.Minute)
+	_, ok := queue.Get(job.ID)
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = queue.Get(job.ID)
+	assert.False(t, ok)
+}
+
+func TestJobQueue_HandleJobRequest(t *testing.T) {
+	queue := NewJobQueue(JobOptions{})
+
+	job, err := queue.submit("provision", "keptn", "test", func() jobResult {
+		return jobResult{statusCode: http.StatusCreated}
+	})
+	require.NoError(t, err)
+
+	request, _ := http.NewRequest(http.MethodGet, JobsPath+job.ID, nil)
+	response := httptest.NewRecorder()
+	queue.HandleJobRequest(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	body := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	assert.Equal(t, job.ID, body["id"])
+	assert.Equal(t, JobQueued, body["status"])
+	assert.Equal(t, float64(1), body["queuePosition"])
+
+	request, _ = http.NewRequest(http.MethodGet, JobsPath+"unknown", nil)
+	response = httptest.NewRecorder()
+	queue.HandleJobRequest(response, request)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	request, _ = http.NewRequest(http.MethodDelete, JobsPath+job.ID, nil)
+	response = httptest.NewRecorder()
+	queue.HandleJobRequest(response, request)
+	assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+}
+
+func TestJobQueue_HandleJobRequestRedactsToken(t *testing.T) {
+	queue := NewJobQueue(JobOptions{})
+
+	job, err := queue.submit("provision", "keptn", "test", func() jobResult {
+		return jobResult{statusCode: http.StatusCreated, body: []byte(`{"gitUser":"keptn","gitToken":"secret-token"}`)}
+	})
+	require.NoError(t, err)
+
+	runJobQueue(t, queue)
+	waitForJob(t, queue, job.ID)
+
+	poll := func() Job {
+		request, _ := http.NewRequest(http.MethodGet, JobsPath+job.ID, nil)
+		response := httptest.NewRecorder()
+		queue.HandleJobRequest(response, request)
+		require.Equal(t, http.StatusOK, response.Code)
+
+		var polled Job
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &polled))
+		return polled
+	}
+
+	// Only the first poll returns the token
+	polled := poll()
+	assert.JSONEq(t, `{"gitUser":"keptn","gitToken":"secret-token"}`, string(polled.Response))
+	assert.False(t, polled.ResponseRedacted)
+
+	polled = poll()
+	assert.JSONEq(t, `{"gitUser":"keptn"}`, string(polled.Response))
+	assert.True(t, polled.ResponseRedacted)
+
+	stored, ok := queue.Get(job.ID)
+	require.True(t, ok)
+	assert.NotContains(t, string(stored.Response), "secret-token")
+}
+
+func TestJobQueue_HandleJobRequestConcurrentPolls(t *testing.T) {
+	queue := NewJobQueue(JobOptions{})
+
+	job, err := queue.submit("provision", "keptn", "test", func() jobResult {
+		return jobResult{statusCode: http.StatusCreated, body: []byte(`{"gitUser":"keptn","gitToken":"secret-token"}`)}
+	})
+	require.NoError(t, err)
+
+	runJobQueue(t, queue)
+	waitForJob(t, queue, job.ID)
+
+	polls := 20
+	tokens := make(chan bool, polls)
+
+	var wg sync.WaitGroup
+	for i := 0; i < polls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			request, _ := http.NewRequest(http.MethodGet, JobsPath+job.ID, nil)
+			response := httptest.NewRecorder()
+			queue.HandleJobRequest(response, request)
+			tokens <- strings.Contains(response.Body.String(), "secret-token")
+		}()
+	}
+	wg.Wait()
+	close(tokens)
+
+	// Exactly one of the concurrent polls returns the token
+	returned := 0
+	for token := range tokens {
+		if token {
+			returned++
+		}
+	}
+	assert.Equal(t, 1, returned)
+}
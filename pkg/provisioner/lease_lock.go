@@ -0,0 +1,243 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// leaseNamePrefix is prepended to the hashed lock key to form the name of the Kubernetes Lease
+const leaseNamePrefix = "gitea-provisioner-lock-"
+
+// leaseKeyAnnotation stores the original, unhashed lock key on the Lease for debugging purposes
+const leaseKeyAnnotation = "keptn.sh/gitea-provisioner-lock-key"
+
+// errLeaseNotHeld is returned if a Lease that should be modified has been taken over by another identity
+var /*const*/ errLeaseNotHeld = errors.New("lease is no longer held")
+
+// LeaseLocker is a NamespaceLocker backed by Kubernetes Leases, it allows multiple replicas of the provisioner to
+// serialize operations on the same Keptn namespace
+type LeaseLocker struct {
+	client         kubernetes.Interface
+	namespace      string
+	identity       string
+	leaseDuration  time.Duration
+	acquireTimeout time.Duration
+	retryInterval  time.Duration
+	renewInterval  time.Duration
+	now            func() time.Time
+}
+
+// NewLeaseLocker creates a LeaseLocker that creates Leases in the given Kubernetes namespace and identifies itself with
+// the given identity (e.g. the pod name). Leases are renewed while held and expire after leaseDuration if a replica dies.
+// The configuration requires a leaseDuration of at least three seconds, shorter durations are renewed every second.
+func NewLeaseLocker(client kubernetes.Interface, namespace string, identity string, leaseDuration time.Duration, acquireTimeout time.Duration) *LeaseLocker {
+	renewInterval := leaseDuration / 3
+	if renewInterval < time.Second {
+		renewInterval = time.Second
+	}
+
+	return &LeaseLocker{
+		client:         client,
+		namespace:      namespace,
+		identity:       identity,
+		leaseDuration:  leaseDuration,
+		acquireTimeout: acquireTimeout,
+		retryInterval:  time.Second,
+		renewInterval:  renewInterval,
+		now:            time.Now,
+	}
+}
+
+// leaseDurationSeconds returns the lease duration in whole seconds as stored on the Lease, fractions are rounded up such
+// that other holders never consider the Lease expired before this replica does
+func (l *LeaseLocker) leaseDurationSeconds() int32 {
+	return int32(math.Ceil(l.leaseDuration.Seconds()))
+}
+
+// leaseName returns a valid Kubernetes resource name for the given key
+func leaseName(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return leaseNamePrefix + hex.EncodeToString(hash[:])[:16]
+}
+
+// Lock blocks until the Lease for the given key has been acquired or the acquire timeout has been reached
+func (l *LeaseLocker) Lock(key string) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.acquireTimeout)
+	defer cancel()
+
+	name := leaseName(key)
+	for {
+		acquired, err := l.tryAcquire(ctx, name, key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to acquire lease %s for %s: %w", name, key, err)
+		}
+
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out while waiting for lease %s for %s", name, key)
+		case <-time.After(l.retryInterval):
+		}
+	}
+
+	stop := make(chan struct{})
+	lost := make(chan struct{})
+	go l.renew(name, stop, lost)
+
+	return func() {
+		close(stop)
+
+		select {
+		case <-lost:
+			log.Printf("Lease %s for %s was lost before the operation finished, it is not released\n", name, key)
+		default:
+			l.release(name)
+		}
+	}, nil
+}
+
+// tryAcquire creates or takes over the Lease if it is free or expired, conflicts are reported as not acquired
+func (l *LeaseLocker) tryAcquire(ctx context.Context, name string, key string) (bool, error) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(l.now())
+	durationSeconds := l.leaseDurationSeconds()
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err := leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Annotations: map[string]string{leaseKeyAnnotation: key},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+
+		if k8serrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+
+		return err == nil, err
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if l.isHeldByOther(lease) {
+		return false, nil
+	}
+
+	lease.Spec.HolderIdentity = &l.identity
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if k8serrors.IsConflict(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// isHeldByOther returns true if the Lease is held by another identity and has not expired yet
+func (l *LeaseLocker) isHeldByOther(lease *coordinationv1.Lease) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || *spec.HolderIdentity == l.identity {
+		return false
+	}
+
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return false
+	}
+
+	expiry := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+	return l.now().Before(expiry)
+}
+
+// renew periodically extends the Lease until the stop channel is closed. Failed renewals are retried until the Lease
+// has been taken over or would have expired, then the lost channel is closed and the Lease isn't treated as held anymore.
+func (l *LeaseLocker) renew(name string, stop chan struct{}, lost chan struct{}) {
+	ticker := time.NewTicker(l.renewInterval)
+	defer ticker.Stop()
+
+	renewed := l.now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := l.update(name, func(lease *coordinationv1.Lease) {
+				now := metav1.NewMicroTime(l.now())
+				lease.Spec.RenewTime = &now
+			})
+			if err == nil {
+				renewed = l.now()
+				continue
+			}
+
+			if errors.Is(err, errLeaseNotHeld) || !l.now().Before(renewed.Add(l.leaseDuration)) {
+				log.Printf("Lost lease %s, operations on its namespace are no longer serialized: %s\n", name, err)
+				close(lost)
+				return
+			}
+
+			log.Printf("Unable to renew lease %s, retrying: %s\n", name, err)
+		}
+	}
+}
+
+// release gives up the Lease such that other replicas don't have to wait until it expires, errors are only logged since
+// the Lease expires anyway
+func (l *LeaseLocker) release(name string) {
+	err := l.update(name, func(lease *coordinationv1.Lease) {
+		lease.Spec.HolderIdentity = nil
+		lease.Spec.AcquireTime = nil
+		lease.Spec.RenewTime = nil
+	})
+	if err != nil {
+		log.Printf("Unable to release lease %s: %s\n", name, err)
+	}
+}
+
+// update modifies the Lease if it is still held by this identity, errLeaseNotHeld is returned if it has been taken over
+func (l *LeaseLocker) update(name string, modify func(lease *coordinationv1.Lease)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.leaseDuration)
+	defer cancel()
+
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get lease %s: %w", name, err)
+	}
+
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.identity {
+		return fmt.Errorf("%w by %s", errLeaseNotHeld, l.identity)
+	}
+
+	modify(lease)
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to update lease %s: %w", name, err)
+	}
+
+	return nil
+}
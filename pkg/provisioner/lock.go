@@ -0,0 +1,90 @@
+package provisioner
+
+import (
+	"sync"
+)
+
+// NamespaceLocker serializes operations that touch the resources of the same Keptn namespace, such that e.g. the
+// creation of a user and the cleanup of the same user cannot interleave
+type NamespaceLocker interface {
+	// Lock blocks until the lock for the given key has been acquired, the returned function releases the lock
+	Lock(key string) (func(), error)
+}
+
+// keyedMutexEntry is a mutex that is reference counted, such that it can be removed once nobody uses it anymore
+type keyedMutexEntry struct {
+	mutex sync.Mutex
+	refs  int
+}
+
+// KeyedMutex is an in-process NamespaceLocker that holds a separate mutex for each key
+type KeyedMutex struct {
+	mutex   sync.Mutex
+	entries map[string]*keyedMutexEntry
+}
+
+// NewKeyedMutex creates a new KeyedMutex
+func NewKeyedMutex() *KeyedMutex {
+	return &KeyedMutex{
+		entries: map[string]*keyedMutexEntry{},
+	}
+}
+
+// Lock acquires the mutex for the given key, it never returns an error
+func (k *KeyedMutex) Lock(key string) (func(), error) {
+	k.mutex.Lock()
+	entry, ok := k.entries[key]
+	if !ok {
+		entry = &keyedMutexEntry{}
+		k.entries[key] = entry
+	}
+	entry.refs++
+	k.mutex.Unlock()
+
+	entry.mutex.Lock()
+
+	return func() {
+		entry.mutex.Unlock()
+
+		k.mutex.Lock()
+		defer k.mutex.Unlock()
+
+		entry.refs--
+		if entry.refs == 0 {
+			delete(k.entries, key)
+		}
+	}, nil
+}
+
+// ChainedLocker acquires the locks of multiple NamespaceLocker in order and releases them in reverse order, this is
+// used to take a cheap in-process lock before competing for a distributed one
+type ChainedLocker struct {
+	lockers []NamespaceLocker
+}
+
+// NewChainedLocker creates a new ChainedLocker from the given lockers
+func NewChainedLocker(lockers ...NamespaceLocker) *ChainedLocker {
+	return &ChainedLocker{lockers: lockers}
+}
+
+// Lock acquires all locks for the given key, if one of them fails the already acquired locks are released
+func (c *ChainedLocker) Lock(key string) (func(), error) {
+	unlockFuncs := make([]func(), 0, len(c.lockers))
+	unlockAll := func() {
+		for i := len(unlockFuncs) - 1; i >= 0; i-- {
+			unlockFuncs[i]()
+		}
+	}
+
+	for _, locker := range c.lockers {
+		unlock, err := locker.Lock(key)
+		if err != nil {
+			unlockAll()
+			return nil, err
+		}
+
+		unlockFuncs = append(unlockFuncs, unlock)
+	}
+
+	return unlockAll, nil
+}
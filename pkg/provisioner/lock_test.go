@@ -0,0 +1,146 @@
+package provisioner
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex_SerializesSameKey(t *testing.T) {
+	locker := NewKeyedMutex()
+
+	var mutex sync.Mutex
+	var events []string
+	record := func(event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}
+
+	unlock, err := locker.Lock("keptn")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		unlock, _ := locker.Lock("keptn")
+		record("second")
+		unlock()
+	}()
+
+	// A different key must not be blocked
+	otherUnlock, err := locker.Lock("other")
+	require.NoError(t, err)
+	otherUnlock()
+
+	time.Sleep(10 * time.Millisecond)
+	record("first")
+	unlock()
+	<-done
+
+	assert.Equal(t, []string{"first", "second"}, events)
+	assert.Empty(t, locker.entries)
+}
+
+type failingLocker struct{}
+
+func (f failingLocker) Lock(string) (func(), error) {
+	return nil, context.DeadlineExceeded
+}
+
+func TestChainedLocker_ReleasesOnError(t *testing.T) {
+	keyedMutex := NewKeyedMutex()
+	locker := NewChainedLocker(keyedMutex, failingLocker{})
+
+	_, err := locker.Lock("keptn")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The in-process lock must have been released again
+	assert.Empty(t, keyedMutex.entries)
+}
+
+func TestLeaseLocker_AcquireAndRelease(t *testing.T) {
+	clientset := k8sfake.NewSimpleClientset()
+	first := NewLeaseLocker(clientset, "keptn", "replica-1", 15*time.Second, 50*time.Millisecond)
+	second := NewLeaseLocker(clientset, "keptn", "replica-2", 15*time.Second, 50*time.Millisecond)
+	second.retryInterval = 10 * time.Millisecond
+
+	unlock, err := first.Lock("user-keptn")
+	require.NoError(t, err)
+
+	lease, err := clientset.CoordinationV1().Leases("keptn").Get(context.Background(), leaseName("user-keptn"), metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "replica-1", *lease.Spec.HolderIdentity)
+	assert.Equal(t, "user-keptn", lease.Annotations[leaseKeyAnnotation])
+
+	// The lease is held by the first replica
+	_, err = second.Lock("user-keptn")
+	require.Error(t, err)
+
+	unlock()
+
+	unlock, err = second.Lock("user-keptn")
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestLeaseLocker_TakeOverExpiredLease(t *testing.T) {
+	clientset := k8sfake.NewSimpleClientset()
+	crashed := NewLeaseLocker(clientset, "keptn", "replica-1", 15*time.Second, time.Second)
+	_, err := crashed.Lock("user-keptn")
+	require.NoError(t, err)
+
+	second := NewLeaseLocker(clientset, "keptn", "replica-2", 15*time.Second, time.Second)
+	second.now = func() time.Time { return time.Now().Add(time.Minute) }
+
+	unlock, err := second.Lock("user-keptn")
+	require.NoError(t, err)
+	defer unlock()
+
+	lease, err := clientset.CoordinationV1().Leases("keptn").Get(context.Background(), leaseName("user-keptn"), metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "replica-2", *lease.Spec.HolderIdentity)
+}
+
+func TestLeaseLocker_StopsRenewingLostLease(t *testing.T) {
+	clientset := k8sfake.NewSimpleClientset()
+	locker := NewLeaseLocker(clientset, "keptn", "replica-1", 15*time.Second, time.Second)
+	locker.renewInterval = 10 * time.Millisecond
+
+	unlock, err := locker.Lock("user-keptn")
+	require.NoError(t, err)
+
+	// Another replica takes over the lease, e.g. because this one couldn't renew it in time
+	leases := clientset.CoordinationV1().Leases("keptn")
+	lease, err := leases.Get(context.Background(), leaseName("user-keptn"), metav1.GetOptions{})
+	require.NoError(t, err)
+	other := "replica-2"
+	lease.Spec.HolderIdentity = &other
+	_, err = leases.Update(context.Background(), lease, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	// The renewal notices the takeover and stops, the lease isn't touched anymore
+	time.Sleep(50 * time.Millisecond)
+	clientset.ClearActions()
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, clientset.Actions())
+
+	// The lost lease isn't released
+	unlock()
+	assert.Empty(t, clientset.Actions())
+
+	lease, err = leases.Get(context.Background(), leaseName("user-keptn"), metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "replica-2", *lease.Spec.HolderIdentity)
+}
+
+func TestLeaseLocker_RoundsUpLeaseDuration(t *testing.T) {
+	locker := NewLeaseLocker(k8sfake.NewSimpleClientset(), "keptn", "replica-1", 3500*time.Millisecond, time.Second)
+
+	assert.Equal(t, int32(4), locker.leaseDurationSeconds())
+}
@@ -0,0 +1,291 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"code.gitea.io/sdk/gitea"
+)
+
+// listPageSize is the page size used when iterating over all users, repositories or tokens
+const listPageSize = 50
+
+// isManagedUser returns true if the given Gitea user has been created by the provisioner, which is detected by the
+// username prefix and the e-mail domain that is used in CreateUser
+func (h *GiteaProvisioner) isManagedUser(user *gitea.User) bool {
+	emailSuffix := "@" + strings.ToLower(h.UserEmailDomain)
+
+	return strings.HasPrefix(user.UserName, h.UsernamePrefix) &&
+		strings.HasSuffix(strings.ToLower(user.Email), emailSuffix)
+}
+
+// isProvisionedUser returns true if the managed user can be deleted safely, because the username prefix identifies it
+// or its full name is the namespace that has been stored by CreateUser. Without a username prefix, the e-mail domain
+// alone doesn't tell provisioned users apart from human users. Admins are never considered provisioned users.
+func (h *GiteaProvisioner) isProvisionedUser(user *gitea.User) bool {
+	if user.IsAdmin {
+		return false
+	}
+
+	if h.UsernamePrefix != "" {
+		return true
+	}
+
+	return user.FullName != "" && h.GetUsername(user.FullName) == user.UserName
+}
+
+// ListManagedUsers returns all users in Gitea that have been created by the provisioner
+func (h *GiteaProvisioner) ListManagedUsers() ([]*gitea.User, error) {
+	var managedUsers []*gitea.User
+
+	for page := 1; ; page++ {
+		users, _, err := h.client.AdminListUsers(gitea.AdminListUsersOptions{
+			ListOptions: gitea.ListOptions{Page: page, PageSize: listPageSize},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list users: %w", err)
+		}
+
+		for _, user := range users {
+			if h.isManagedUser(user) {
+				managedUsers = append(managedUsers, user)
+			}
+		}
+
+		if len(users) < listPageSize {
+			return managedUsers, nil
+		}
+	}
+}
+
+// ListUserRepositories returns all repositories that are owned by the given user, a user that doesn't exist owns no
+// repositories
+func (h *GiteaProvisioner) ListUserRepositories(username string) ([]*gitea.Repository, error) {
+	var repositories []*gitea.Repository
+
+	for page := 1; ; page++ {
+		repos, r, err := h.client.ListUserRepos(username, gitea.ListReposOptions{
+			ListOptions: gitea.ListOptions{Page: page, PageSize: listPageSize},
+		})
+		if r != nil && r.StatusCode == http.StatusNotFound {
+			return repositories, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to list repositories of user %s: %w", username, err)
+		}
+
+		repositories = append(repositories, repos...)
+
+		if len(repos) < listPageSize {
+			return repositories, nil
+		}
+	}
+}
+
+// CountProjects returns the number of repositories of the user of the given namespace, archived repositories belong
+// to deleted projects and are not counted like for the quotas
+func (h *GiteaProvisioner) CountProjects(namespace string) (int, error) {
+	repos, err := h.ListUserRepositories(h.GetUsername(namespace))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, repo := range repos {
+		if !repo.Archived {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CleanupOrphanedUsers deletes all users created by the provisioner that don't own any repository anymore, e.g.
+// because a deletion failed after the repository was removed. Managed users that can't be identified as provisioned
+// users are skipped.
+func (h *GiteaProvisioner) CleanupOrphanedUsers(ctx context.Context) error {
+	users, err := h.ListManagedUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !h.isProvisionedUser(user) {
+			log.Printf("Skipping orphan cleanup of user %s, it is not marked as provisioned user\n", user.UserName)
+			continue
+		}
+
+		if err := h.cleanupUserIfOrphaned(user.UserName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanupUserIfOrphaned deletes the given user while holding its lock if it doesn't own any repository
+func (h *GiteaProvisioner) cleanupUserIfOrphaned(username string) error {
+	if h.locker != nil {
+		unlock, err := h.locker.Lock(username)
+		if err != nil {
+			return fmt.Errorf("unable to lock user %s: %w", username, err)
+		}
+		defer unlock()
+	}
+
+	repos, err := h.ListUserRepositories(username)
+	if err != nil {
+		return err
+	}
+
+	if len(repos) > 0 {
+		return nil
+	}
+
+	log.Printf("Deleting orphaned user %s\n", username)
+	r, err := h.client.AdminDeleteUser(username)
+	if err != nil && (r == nil || r.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("unable to delete orphaned user %s: %w", username, err)
+	}
+
+	return nil
+}
+
+// SweepStaleTokens deletes all access tokens of users created by the provisioner whose repository doesn't exist
+// anymore, e.g. because a provisioning request was aborted between creating the token and returning it to Keptn.
+// Managed users that can't be identified as provisioned users are skipped like in CleanupOrphanedUsers.
+func (h *GiteaProvisioner) SweepStaleTokens(ctx context.Context) error {
+	users, err := h.ListManagedUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !h.isProvisionedUser(user) {
+			log.Printf("Skipping token sweep of user %s, it is not marked as provisioned user\n", user.UserName)
+			continue
+		}
+
+		if err := h.sweepUserTokens(user.UserName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sweepUserTokens deletes the access tokens of the given user that have been created by the provisioner but don't
+// belong to one of its repositories
+func (h *GiteaProvisioner) sweepUserTokens(username string) error {
+	if h.locker != nil {
+		unlock, err := h.locker.Lock(username)
+		if err != nil {
+			return fmt.Errorf("unable to lock user %s: %w", username, err)
+		}
+		defer unlock()
+	}
+
+	repos, err := h.ListUserRepositories(username)
+	if err != nil {
+		return err
+	}
+
+	expectedTokens := map[string]bool{}
+	for _, repo := range repos {
+		expectedTokens[h.GetAccessTokenName(h.projectOfRepository(repo))] = true
+	}
+
+	userClient, err := h.newClientFunc(h.endpoint, h.credentials, gitea.SetSudo(username))
+	if err != nil {
+		return fmt.Errorf("unable to create gitea client: %w", err)
+	}
+
+	// The tokens are deleted after all pages have been read, such that deletions don't shift the pages
+	var staleTokens []*gitea.AccessToken
+	for page := 1; ; page++ {
+		tokens, _, err := userClient.ListAccessTokens(gitea.ListAccessTokensOptions{
+			ListOptions: gitea.ListOptions{Page: page, PageSize: listPageSize},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to list access tokens of user %s: %w", username, err)
+		}
+
+		for _, token := range tokens {
+			if h.isProvisionerToken(token.Name) && !expectedTokens[token.Name] {
+				staleTokens = append(staleTokens, token)
+			}
+		}
+
+		if len(tokens) < listPageSize {
+			break
+		}
+	}
+
+	for _, token := range staleTokens {
+		log.Printf("Deleting stale access token %s of user %s\n", token.Name, username)
+		if _, err := userClient.DeleteAccessToken(token.ID); err != nil {
+			return fmt.Errorf("unable to delete access token %s of user %s: %w", token.Name, username, err)
+		}
+	}
+
+	return nil
+}
+
+// isProvisionerToken returns true if the name of the access token has been generated by GetAccessTokenName or is the
+// one of a temporary token of a backup or restore. Without a token prefix, names that Gitea accepts unchanged can't be
+// told apart from the project tokens, which is why only tokens of provisioned users are swept.
+func (h *GiteaProvisioner) isProvisionerToken(name string) bool {
+	if h.isTemporaryToken(name) {
+		return true
+	}
+
+	if !strings.HasPrefix(name, h.TokenPrefix) {
+		return false
+	}
+
+	return h.GetAccessTokenName(strings.TrimPrefix(name, h.TokenPrefix)) == name
+}
+
+// LogInventory logs the number of users and repositories that are managed by the provisioner
+func (h *GiteaProvisioner) LogInventory(ctx context.Context) error {
+	users, err := h.ListManagedUsers()
+	if err != nil {
+		return err
+	}
+
+	repositories := 0
+	size := 0
+	for _, user := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		repos, err := h.ListUserRepositories(user.UserName)
+		if err != nil {
+			return err
+		}
+
+		repositories += len(repos)
+		for _, repo := range repos {
+			size += repo.Size
+		}
+	}
+
+	log.Printf("Inventory: %d managed users, %d managed repositories, %d KiB total repository size\n",
+		len(users), repositories, size,
+	)
+
+	return nil
+}
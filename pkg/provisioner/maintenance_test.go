@@ -0,0 +1,143 @@
+package provisioner
+
+import (
+	"code.gitea.io/sdk/gitea"
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+	"net/http"
+	"testing"
+)
+
+func TestGiteaProvisioner_CountProjects(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+	}
+
+	giteaClient.EXPECT().ListUserRepos("keptn", gomock.Any()).Times(1).Return([]*gitea.Repository{
+		{Name: "podtato-head"},
+		{Name: "sockshop"},
+		{Name: "deleted", Archived: true},
+	}, createResponse(http.StatusOK), nil)
+
+	count, err := giteaProvisioner.CountProjects("keptn")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func TestGiteaProvisioner_CleanupOrphanedUsers(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client:          giteaClient,
+		locker:          NewKeyedMutex(),
+		UsernamePrefix:  "keptn-",
+		UserEmailDomain: "provisioner.local",
+	}
+
+	giteaClient.EXPECT().AdminListUsers(gomock.Any()).Times(1).Return([]*gitea.User{
+		{UserName: "keptn-orphan", Email: "keptn-orphan@provisioner.local"},
+		{UserName: "keptn-active", Email: "keptn-active@provisioner.local"},
+		{UserName: "keptn-human", Email: "keptn-human@company.com"},
+		{UserName: "admin", Email: "admin@provisioner.local"},
+	}, createResponse(http.StatusOK), nil)
+
+	giteaClient.EXPECT().ListUserRepos("keptn-orphan", gomock.Any()).Times(1).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListUserRepos("keptn-active", gomock.Any()).Times(1).Return([]*gitea.Repository{{Name: "project"}}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminDeleteUser("keptn-orphan").Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	require.NoError(t, giteaProvisioner.CleanupOrphanedUsers(context.Background()))
+}
+
+func TestGiteaProvisioner_CleanupOrphanedUsersWithoutPrefix(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client:          giteaClient,
+		locker:          NewKeyedMutex(),
+		UserEmailDomain: "provisioner.local",
+	}
+
+	// Only the user whose full name is its namespace is known to be provisioned
+	giteaClient.EXPECT().AdminListUsers(gomock.Any()).Times(1).Return([]*gitea.User{
+		{UserName: "dev", FullName: "dev", Email: "dev@provisioner.local"},
+		{UserName: "alice", FullName: "Alice", Email: "alice@provisioner.local"},
+		{UserName: "bob", Email: "bob@provisioner.local"},
+		{UserName: "admin", FullName: "admin", Email: "admin@provisioner.local", IsAdmin: true},
+	}, createResponse(http.StatusOK), nil)
+
+	giteaClient.EXPECT().ListUserRepos("dev", gomock.Any()).Times(1).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminDeleteUser("dev").Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	require.NoError(t, giteaProvisioner.CleanupOrphanedUsers(context.Background()))
+}
+
+func TestGiteaProvisioner_SweepStaleTokens(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+		newClientFunc: func(url string, options ...gitea.ClientOption) (GiteaClient, error) {
+			return giteaClient, nil
+		},
+		UserEmailDomain: "provisioner.local",
+		ProjectPrefix:   "project-",
+		TokenPrefix:     "token-",
+	}
+
+	giteaClient.EXPECT().AdminListUsers(gomock.Any()).Times(1).Return([]*gitea.User{
+		{UserName: "keptn", FullName: "keptn", Email: "keptn@provisioner.local"},
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListUserRepos("keptn", gomock.Any()).Times(1).Return([]*gitea.Repository{{Name: "project-podtato"}}, createResponse(http.StatusOK), nil)
+
+	// The stale token on the second page is found as well, tokens with other names are kept
+	firstPage := []*gitea.AccessToken{{ID: 1, Name: "token-podtato"}, {ID: 2, Name: "token-deleted"}, {ID: 5, Name: "token-my laptop"}}
+	for len(firstPage) < listPageSize {
+		firstPage = append(firstPage, &gitea.AccessToken{ID: 3, Name: "personal"})
+	}
+	giteaClient.EXPECT().ListAccessTokens(gitea.ListAccessTokensOptions{ListOptions: gitea.ListOptions{Page: 1, PageSize: listPageSize}}).Times(1).Return(firstPage, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListAccessTokens(gitea.ListAccessTokensOptions{ListOptions: gitea.ListOptions{Page: 2, PageSize: listPageSize}}).Times(1).Return([]*gitea.AccessToken{
+		{ID: 4, Name: "token-other"}, {ID: 6, Name: "token-backup-20220301120000"},
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteAccessToken(int64(2)).Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().DeleteAccessToken(int64(4)).Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().DeleteAccessToken(int64(6)).Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	require.NoError(t, giteaProvisioner.SweepStaleTokens(context.Background()))
+}
+
+func TestGiteaProvisioner_SweepStaleTokensSkipsHumanUsers(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+		newClientFunc: func(url string, options ...gitea.ClientOption) (GiteaClient, error) {
+			return giteaClient, nil
+		},
+		UserEmailDomain: "example.com",
+	}
+
+	// Without username and token prefix, a human user with the same e-mail domain looks like a managed user
+	giteaClient.EXPECT().AdminListUsers(gomock.Any()).Times(1).Return([]*gitea.User{
+		{UserName: "jane", FullName: "Jane Doe", Email: "jane@example.com"},
+		{UserName: "admin", FullName: "admin", Email: "admin@example.com", IsAdmin: true},
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListUserRepos(gomock.Any(), gomock.Any()).Times(0)
+	giteaClient.EXPECT().ListAccessTokens(gomock.Any()).Times(0)
+	giteaClient.EXPECT().DeleteAccessToken(gomock.Any()).Times(0)
+
+	require.NoError(t, giteaProvisioner.SweepStaleTokens(context.Background()))
+}
@@ -0,0 +1,172 @@
+package provisioner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"code.gitea.io/sdk/gitea"
+)
+
+// ErrNameCollision indicates that the Gitea name of a namespace or project is already used by a different namespace or
+// project, e.g. because two long names were truncated to the same prefix
+var /*const*/ ErrNameCollision = errors.New("the Gitea name is already used by a different namespace or project")
+
+// nameHashLength is the number of hex characters of the hash suffix that is appended to sanitized names
+const nameHashLength = 8
+
+// projectDescriptionPrefix is the start of the description of every provisioned repository, the original Keptn project
+// name follows the prefix such that it can be recovered from a sanitized repository name
+const projectDescriptionPrefix = "Repository was automatically provisioned by keptn-gitea-GitProvisioner for project "
+
+// nameSpecialChars are the characters Gitea accepts in names besides alphanumeric characters
+const nameSpecialChars = "-_."
+
+// giteaNameRules describe which names Gitea accepts for a kind of resource
+type giteaNameRules struct {
+	pattern   *regexp.Regexp
+	maxLength int
+}
+
+var (
+	// usernameRules: alphanumeric, dash, underscore and dot, without consecutive or leading/trailing special characters
+	usernameRules = giteaNameRules{
+		pattern:   regexp.MustCompile(`^[a-zA-Z0-9]+([-_.][a-zA-Z0-9]+)*$`),
+		maxLength: 40,
+	}
+	// repositoryNameRules: alphanumeric, dash, underscore and dot
+	repositoryNameRules = giteaNameRules{
+		pattern:   regexp.MustCompile(`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`),
+		maxLength: 100,
+	}
+	// accessTokenNameRules: the name of an access token is only limited by the column size
+	accessTokenNameRules = giteaNameRules{
+		pattern:   regexp.MustCompile(`^[-_.a-zA-Z0-9]+$`),
+		maxLength: 255,
+	}
+)
+
+// giteaName returns prefix+name if Gitea accepts it. Otherwise, the name is sanitized by replacing invalid characters,
+// truncated and suffixed with a hash of the original name, such that the result is deterministic, valid and names
+// that sanitize to the same string still map to different Gitea names. The original name can't be derived from the
+// result and has to be stored alongside the Gitea resource.
+func giteaName(prefix string, name string, rules giteaNameRules) string {
+	original := prefix + name
+	if len(original) <= rules.maxLength && rules.pattern.MatchString(original) {
+		return original
+	}
+
+	hash := sha256.Sum256([]byte(original))
+	suffix := "-" + hex.EncodeToString(hash[:])[:nameHashLength]
+
+	sanitized := sanitizeName(original)
+	if maxLength := rules.maxLength - len(suffix); len(sanitized) > maxLength {
+		sanitized = strings.TrimRight(sanitized[:maxLength], nameSpecialChars)
+	}
+
+	if sanitized == "" {
+		// The suffix alone must not start with a special character
+		return suffix[1:]
+	}
+
+	return sanitized + suffix
+}
+
+// sanitizeName replaces all characters Gitea doesn't accept with a dash, collapses consecutive special characters and
+// removes special characters from the start and end of the name
+func sanitizeName(name string) string {
+	var builder strings.Builder
+	lastSpecial := true
+
+	for _, char := range name {
+		isAlphanumeric := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+		if isAlphanumeric {
+			builder.WriteRune(char)
+			lastSpecial = false
+			continue
+		}
+
+		if lastSpecial {
+			continue
+		}
+
+		if strings.ContainsRune(nameSpecialChars, char) {
+			builder.WriteRune(char)
+		} else {
+			builder.WriteRune('-')
+		}
+		lastSpecial = true
+	}
+
+	return strings.TrimRight(builder.String(), nameSpecialChars)
+}
+
+// projectDescription returns the description of the repository of the given project
+func projectDescription(project string) string {
+	return projectDescriptionPrefix + project
+}
+
+// projectOfRepository returns the Keptn project of a provisioned repository. The project is read from the repository
+// description, repositories whose description doesn't refer to their own name (e.g. created by older versions that
+// stored the prefixed name) fall back to the repository name without the project prefix.
+func (h *GiteaProvisioner) projectOfRepository(repository *gitea.Repository) string {
+	if strings.HasPrefix(repository.Description, projectDescriptionPrefix) {
+		project := strings.TrimPrefix(repository.Description, projectDescriptionPrefix)
+		if project != "" && strings.EqualFold(h.GetProjectName(project), repository.Name) {
+			return project
+		}
+	}
+
+	return strings.TrimPrefix(repository.Name, h.ProjectPrefix)
+}
+
+// isRedirected returns true if Gitea answered the request for the repository owner/name with a different repository.
+// Gitea redirects the old name of a renamed or transferred repository until a repository with that name is created.
+func isRedirected(repository *gitea.Repository, owner string, name string) bool {
+	if !strings.EqualFold(repository.Name, name) {
+		return true
+	}
+
+	return repository.Owner != nil && !strings.EqualFold(repository.Owner.UserName, owner)
+}
+
+// getRepository returns the repository owner/name, ErrRepositoryDoesNotExist is returned if it doesn't exist or the
+// name is only redirected to a renamed or transferred repository
+func (h *GiteaProvisioner) getRepository(owner string, name string) (*gitea.Repository, error) {
+	repository, r, err := h.client.GetRepo(owner, name)
+	if r != nil && r.StatusCode == http.StatusNotFound {
+		return nil, ErrRepositoryDoesNotExist
+	}
+
+	if err != nil || repository == nil {
+		return nil, fmt.Errorf("unable to get repository %s/%s: %w", owner, name, err)
+	}
+
+	if isRedirected(repository, owner, name) {
+		return nil, fmt.Errorf("%w: %s/%s redirects to repository %s", ErrRepositoryDoesNotExist, owner, name, repository.Name)
+	}
+
+	return repository, nil
+}
+
+// getProjectRepository returns the repository of the project owned by the given user. Next to the errors of
+// getRepository, ErrNameCollision is returned if the repository belongs to a different project, such that destructive
+// calls never hit the repository of another project.
+func (h *GiteaProvisioner) getProjectRepository(username string, project string) (*gitea.Repository, error) {
+	repository, err := h.getRepository(username, h.GetProjectName(project))
+	if err != nil {
+		return nil, err
+	}
+
+	if h.projectOfRepository(repository) != project {
+		return nil, fmt.Errorf("%w: repository %s/%s belongs to project %s",
+			ErrNameCollision, username, repository.Name, h.projectOfRepository(repository),
+		)
+	}
+
+	return repository, nil
+}
@@ -0,0 +1,149 @@
+package provisioner
+
+import (
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGiteaName_KeptnNamesAreUnchanged(t *testing.T) {
+	// Kubernetes namespaces are DNS-1123 labels, Keptn project names start with a letter followed by lowercase
+	// alphanumeric characters and dashes
+	names := []string{"keptn", "keptn-dev", "podtato-head", "a", "project1", "sockshop-2022"}
+	for _, name := range names {
+		assert.Equal(t, "keptn-"+name, giteaName("keptn-", name, usernameRules))
+		assert.Equal(t, "project-"+name, giteaName("project-", name, repositoryNameRules))
+		assert.Equal(t, "token-"+name, giteaName("token-", name, accessTokenNameRules))
+	}
+
+	// Consecutive dashes are accepted in repository names but not in usernames
+	assert.Equal(t, "a--b", giteaName("", "a--b", repositoryNameRules))
+	assert.NotEqual(t, "a--b", giteaName("", "a--b", usernameRules))
+}
+
+func TestGiteaName_LongNamespace(t *testing.T) {
+	// The longest Kubernetes namespace is 63 characters long
+	namespace := strings.Repeat("n", 30) + "-" + strings.Repeat("s", 32)
+
+	name := giteaName("keptn-", namespace, usernameRules)
+	assert.Len(t, name, usernameRules.maxLength)
+	assert.True(t, strings.HasPrefix(name, "keptn-nnnn"))
+	assert.Regexp(t, usernameRules.pattern, name)
+
+	// Deterministic
+	assert.Equal(t, name, giteaName("keptn-", namespace, usernameRules))
+
+	// Names that only differ after the truncation point are still distinct
+	other := giteaName("keptn-", strings.Repeat("n", 30)+"-"+strings.Repeat("s", 31)+"t", usernameRules)
+	assert.NotEqual(t, name, other)
+	assert.Len(t, other, usernameRules.maxLength)
+}
+
+func TestGiteaName_InvalidCharacters(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules giteaNameRules
+	}{
+		{name: "keptn_dev.", rules: usernameRules},
+		{name: "-keptn", rules: usernameRules},
+		{name: "käptn", rules: usernameRules},
+		{name: "project/with spaces", rules: repositoryNameRules},
+		{name: "---", rules: repositoryNameRules},
+		{name: "project:token", rules: accessTokenNameRules},
+		{name: strings.Repeat("p", 120), rules: repositoryNameRules},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := giteaName("", test.name, test.rules)
+			assert.Regexp(t, test.rules.pattern, name)
+			assert.LessOrEqual(t, len(name), test.rules.maxLength)
+		})
+	}
+
+	// Names that sanitize to the same string map to different names
+	assert.NotEqual(t, giteaName("", "keptn dev", usernameRules), giteaName("", "keptn/dev", usernameRules))
+}
+
+func TestGiteaProvisioner_ProjectOfRepository(t *testing.T) {
+	giteaProvisioner := GiteaProvisioner{ProjectPrefix: "project-"}
+	project := strings.Repeat("p", 120)
+
+	repository := &gitea.Repository{
+		Name:        giteaProvisioner.GetProjectName(project),
+		Description: projectDescription(project),
+	}
+	assert.Equal(t, project, giteaProvisioner.projectOfRepository(repository))
+
+	// Repositories of older versions have the prefixed name in the description
+	repository = &gitea.Repository{
+		Name:        "project-podtato-head",
+		Description: projectDescription("project-podtato-head"),
+	}
+	assert.Equal(t, "podtato-head", giteaProvisioner.projectOfRepository(repository))
+}
+
+func TestGiteaProvisioner_CreateUserCollision(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+	}
+
+	namespace := strings.Repeat("n", 63)
+	username := giteaProvisioner.GetUsername(namespace)
+
+	giteaClient.EXPECT().GetUserInfo(username).Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+	giteaClient.EXPECT().AdminCreateUser(gomock.Any()).Times(1).DoAndReturn(func(opt gitea.CreateUserOption) (*gitea.User, *gitea.Response, error) {
+		assert.Equal(t, username, opt.Username)
+		assert.Equal(t, namespace, opt.FullName)
+		return nil, createResponse(http.StatusCreated), nil
+	})
+
+	_, err := giteaProvisioner.CreateUser(namespace)
+	require.NoError(t, err)
+
+	// The user was created for the same namespace
+	giteaClient.EXPECT().GetUserInfo(username).Times(1).Return(&gitea.User{UserName: username, FullName: namespace}, createResponse(http.StatusOK), nil)
+	_, err = giteaProvisioner.CreateUser(namespace)
+	require.NoError(t, err)
+
+	// The user was created for a different namespace
+	giteaClient.EXPECT().GetUserInfo(username).Times(1).Return(&gitea.User{UserName: username, FullName: "other"}, createResponse(http.StatusOK), nil)
+	_, err = giteaProvisioner.CreateUser(namespace)
+	require.ErrorIs(t, err, ErrNameCollision)
+
+	// Users of older versions have the username as full name
+	giteaClient.EXPECT().GetUserInfo("keptn").Times(1).Return(&gitea.User{UserName: "keptn", FullName: "keptn"}, createResponse(http.StatusOK), nil)
+	_, err = giteaProvisioner.CreateUser("keptn")
+	require.NoError(t, err)
+}
+
+func TestGiteaProvisioner_CreateRepositoryCollision(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+	}
+
+	project := "project/one"
+	projectName := giteaProvisioner.GetProjectName(project)
+
+	giteaClient.EXPECT().AdminCreateRepo("keptn", gomock.Any()).Times(1).Return(nil, createResponse(http.StatusConflict), nil)
+	giteaClient.EXPECT().GetRepo("keptn", projectName).Times(1).Return(&gitea.Repository{
+		Name:        projectName,
+		Description: projectDescription("project one"),
+	}, createResponse(http.StatusOK), nil)
+
+	_, err := giteaProvisioner.CreateRepository("keptn", project)
+	require.ErrorIs(t, err, ErrNameCollision)
+}
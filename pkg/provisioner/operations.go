@@ -0,0 +1,125 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OperationTracker keeps track of in-flight provisioning and deletion requests such that they can be drained when the
+// service is shut down
+type OperationTracker struct {
+	mutex      sync.Mutex
+	nextID     uint64
+	operations map[uint64]string
+	done       chan struct{}
+}
+
+// NewOperationTracker creates a new OperationTracker without any in-flight operations
+func NewOperationTracker() *OperationTracker {
+	return &OperationTracker{
+		operations: map[uint64]string{},
+	}
+}
+
+// Begin registers an in-flight operation with the given description, the returned function must be called once the
+// operation has finished
+func (t *OperationTracker) Begin(description string) func() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	id := t.nextID
+	t.nextID++
+	t.operations[id] = fmt.Sprintf("%s (started %s)", description, time.Now().Format(time.RFC3339))
+
+	return func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+
+		delete(t.operations, id)
+		if len(t.operations) == 0 && t.done != nil {
+			close(t.done)
+			t.done = nil
+		}
+	}
+}
+
+// InFlight returns the descriptions of all operations that are currently in-flight
+func (t *OperationTracker) InFlight() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	operations := make([]string, 0, len(t.operations))
+	for _, description := range t.operations {
+		operations = append(operations, description)
+	}
+
+	sort.Strings(operations)
+	return operations
+}
+
+// Wait blocks until all in-flight operations have finished or the context is done, in the latter case the
+// descriptions of the operations that are still running are returned
+func (t *OperationTracker) Wait(ctx context.Context) []string {
+	t.mutex.Lock()
+	if len(t.operations) == 0 {
+		t.mutex.Unlock()
+		return nil
+	}
+
+	if t.done == nil {
+		t.done = make(chan struct{})
+	}
+	done := t.done
+	t.mutex.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return t.InFlight()
+	}
+}
+
+// Track wraps the given handler such that every request that modifies a repository is registered as an operation
+func (t *OperationTracker) Track(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			next(w, req)
+			return
+		}
+
+		finish := t.Begin(describeRequest(req))
+		defer finish()
+
+		next(w, req)
+	}
+}
+
+// describeRequest creates a human-readable description of the request, the body is restored after reading it
+func describeRequest(req *http.Request) string {
+	description := fmt.Sprintf("%s %s", req.Method, req.URL.Path)
+	if req.Body == nil {
+		return description
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return description
+	}
+
+	request := keptn.ProvisionRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return description
+	}
+
+	return fmt.Sprintf("%s for project \"%s\" in namespace \"%s\"", description, request.Project, request.Namespace)
+}
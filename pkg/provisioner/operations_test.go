@@ -0,0 +1,68 @@
+package provisioner
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOperationTracker_WaitForOperations(t *testing.T) {
+	tracker := NewOperationTracker()
+	require.Nil(t, tracker.Wait(context.Background()))
+
+	finish := tracker.Begin("provision")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		finish()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.Nil(t, tracker.Wait(ctx))
+	require.Empty(t, tracker.InFlight())
+}
+
+func TestOperationTracker_AbandonedOperations(t *testing.T) {
+	tracker := NewOperationTracker()
+	tracker.Begin("provision")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	abandoned := tracker.Wait(ctx)
+	require.Len(t, abandoned, 1)
+	assert.Contains(t, abandoned[0], "provision")
+}
+
+func TestOperationTracker_Track(t *testing.T) {
+	tracker := NewOperationTracker()
+
+	handler := tracker.Track(func(w http.ResponseWriter, req *http.Request) {
+		inFlight := tracker.InFlight()
+		require.Len(t, inFlight, 1)
+		assert.Contains(t, inFlight[0], `POST /repository for project "test" in namespace "keptn"`)
+
+		// The body must still be readable by the wrapped handler
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"namespace":"keptn","project":"test"}`, string(body))
+
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository",
+		strings.NewReader(`{"namespace":"keptn","project":"test"}`),
+	)
+	response := httptest.NewRecorder()
+
+	handler(response, request)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Empty(t, tracker.InFlight())
+}
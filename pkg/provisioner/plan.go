@@ -0,0 +1,206 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/audit"
+)
+
+// Kinds of the Gitea objects that are part of a Plan
+const (
+	ObjectUser        = "user"
+	ObjectRepository  = "repository"
+	ObjectAccessToken = "accessToken"
+	ObjectBackup      = "backup"
+)
+
+// Actions of the changes that are part of a Plan
+const (
+	PlanCreate   = "create"
+	PlanDelete   = "delete"
+	PlanKeep     = "keep"
+	PlanArchive  = "archive"
+	PlanTransfer = "transfer"
+)
+
+// PlannedChange is a single change of a Gitea object that a request would cause
+type PlannedChange struct {
+	Action string `json:"action"`
+	Object string `json:"object"`
+	Name   string `json:"name"`
+	// Reason explains why the change is planned, e.g. why an existing user is kept
+	Reason string `json:"reason,omitempty"`
+}
+
+// Plan lists the changes a provisioning or deletion request would cause without applying them
+type Plan struct {
+	DryRun    bool            `json:"dryRun"`
+	Action    string          `json:"action"`
+	Namespace string          `json:"namespace"`
+	Project   string          `json:"project"`
+	Changes   []PlannedChange `json:"changes"`
+}
+
+// Planner is implemented by provisioners that support dry runs. Plans are computed with read calls only and fail with
+// the same errors as the actual request would.
+type Planner interface {
+	PlanProvision(namespace string, project string) (*Plan, error)
+	PlanDelete(namespace string, project string) (*Plan, error)
+}
+
+// newPlan creates an empty plan for the given action
+func newPlan(action string, namespace string, project string) *Plan {
+	return &Plan{
+		DryRun:    true,
+		Action:    action,
+		Namespace: namespaceOrDefault(namespace),
+		Project:   project,
+		Changes:   []PlannedChange{},
+	}
+}
+
+// add appends a change to the plan
+func (p *Plan) add(action string, object string, name string, reason string) {
+	p.Changes = append(p.Changes, PlannedChange{Action: action, Object: object, Name: name, Reason: reason})
+}
+
+// PlanProvision returns the changes ProvisionRepository would apply for the given project
+func (h *GiteaProvisioner) PlanProvision(namespace string, project string) (*Plan, error) {
+	if project == "" {
+		return nil, fmt.Errorf("%w: unable to create project with an empty name", ErrInvalidRequest)
+	}
+
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := h.checkQuota(namespace); err != nil {
+		return nil, err
+	}
+
+	plan := newPlan(audit.ActionProvision, namespace, project)
+	objects := h.GiteaObjects(namespace, project)
+
+	// Only a missing user is planned to be created, other errors don't tell whether the user exists
+	user, r, err := h.client.GetUserInfo(objects.User)
+	if r != nil && r.StatusCode == http.StatusNotFound {
+		reason := "the namespace has no user yet"
+		if h.quota.MaxRepositories > 0 {
+			reason = fmt.Sprintf("%s, its repository limit is set to %d", reason, h.quota.MaxRepositories)
+		}
+
+		plan.add(PlanCreate, ObjectUser, objects.User, reason)
+		plan.add(PlanCreate, ObjectRepository, objects.Repository, "")
+		plan.add(PlanCreate, ObjectAccessToken, objects.AccessToken, "")
+		return plan, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user info for user %s: %w", objects.User, err)
+	}
+
+	if err := checkUserNamespace(user, namespace); err != nil {
+		return nil, err
+	}
+	plan.add(PlanKeep, ObjectUser, objects.User, "the user of the namespace already exists")
+
+	existing, err := h.getRepository(objects.User, objects.Repository)
+	if err != nil && !errors.Is(err, ErrRepositoryDoesNotExist) {
+		return nil, err
+	}
+
+	if err == nil {
+		if h.projectOfRepository(existing) != project {
+			return nil, fmt.Errorf("%w: repository %s/%s belongs to project %s",
+				ErrNameCollision, objects.User, objects.Repository, h.projectOfRepository(existing),
+			)
+		}
+
+		if existing.Archived {
+			return nil, fmt.Errorf("%w: %s/%s", ErrRepositoryArchived, objects.User, objects.Repository)
+		}
+
+		return nil, ErrRepositoryAlreadyExists
+	}
+	plan.add(PlanCreate, ObjectRepository, objects.Repository, "")
+
+	token, err := h.findAccessToken(objects.User, objects.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := ""
+	if token != nil {
+		reason = "a stale access token with this name exists, Gitea will reject the creation"
+	}
+	plan.add(PlanCreate, ObjectAccessToken, objects.AccessToken, reason)
+
+	return plan, nil
+}
+
+// PlanDelete returns the changes DeleteRepository would apply for the given project
+func (h *GiteaProvisioner) PlanDelete(namespace string, project string) (*Plan, error) {
+	if project == "" {
+		return nil, fmt.Errorf("%w: unable to delete project with an empty name", ErrInvalidRequest)
+	}
+
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	plan := newPlan(audit.ActionDelete, namespace, project)
+	objects := h.GiteaObjects(namespace, project)
+
+	existing, err := h.getProjectRepository(objects.User, project)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.backup.Store != nil && h.deletion.policy() != DeletionPolicyArchive {
+		plan.add(PlanCreate, ObjectBackup, objects.Repository, "a bundle of the repository is stored before the deletion")
+	}
+
+	switch h.deletion.policy() {
+	case DeletionPolicyArchive:
+		if existing.Archived {
+			return nil, ErrRepositoryDoesNotExist
+		}
+		plan.add(PlanArchive, ObjectRepository, objects.Repository, "")
+	case DeletionPolicyGraveyard:
+		plan.add(PlanTransfer, ObjectRepository, objects.Repository,
+			fmt.Sprintf("the repository is moved to the organization %s", h.deletion.graveyardOrganization()),
+		)
+	default:
+		plan.add(PlanDelete, ObjectRepository, objects.Repository, "")
+	}
+
+	token, err := h.findAccessToken(objects.User, objects.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != nil {
+		plan.add(PlanDelete, ObjectAccessToken, objects.AccessToken, "")
+	}
+
+	repositories, err := h.ListUserRepositories(objects.User)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.deletion.policy() == DeletionPolicyArchive {
+		plan.add(PlanKeep, ObjectUser, objects.User, "the user owns the archived repository")
+	} else if len(repositories) <= 1 {
+		plan.add(PlanDelete, ObjectUser, objects.User, "the namespace has no other repositories")
+	} else {
+		plan.add(PlanKeep, ObjectUser, objects.User, fmt.Sprintf("the namespace has %d other repositories", len(repositories)-1))
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,165 @@
+package provisioner
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+)
+
+// planChanges returns the action, object and name of every change of the plan
+func planChanges(plan *Plan) []string {
+	var changes []string
+	for _, change := range plan.Changes {
+		changes = append(changes, change.Action+" "+change.Object+" "+change.Name)
+	}
+
+	return changes
+}
+
+func TestGiteaProvisioner_PlanProvisionNewNamespace(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+
+	plan, err := giteaProvisioner.PlanProvision("dev", "podtato")
+	require.NoError(t, err)
+	assert.True(t, plan.DryRun)
+	assert.Equal(t, "dev", plan.Namespace)
+	assert.Equal(t, []string{
+		"create user keptn-dev", "create repository project-podtato", "create accessToken token-podtato",
+	}, planChanges(plan))
+}
+
+func TestGiteaProvisioner_PlanProvisionUserLookupFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	// Neither a server error nor a forbidden lookup means that the user is missing
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(1).Return(nil, createResponse(http.StatusInternalServerError), errors.New("internal error"))
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(1).Return(nil, createResponse(http.StatusForbidden), errors.New("forbidden"))
+
+	for i := 0; i < 2; i++ {
+		plan, err := giteaProvisioner.PlanProvision("dev", "podtato")
+		require.Error(t, err)
+		assert.Nil(t, plan)
+	}
+}
+
+func TestGiteaProvisioner_PlanProvisionExistingUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(1).Return(&gitea.User{UserName: "keptn-dev", FullName: "dev"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+	giteaClient.EXPECT().ListAccessTokens(gomock.Any()).Times(1).Return([]*gitea.AccessToken{
+		{Name: "token-podtato"},
+	}, createResponse(http.StatusOK), nil)
+
+	plan, err := giteaProvisioner.PlanProvision("dev", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"keep user keptn-dev", "create repository project-podtato", "create accessToken token-podtato",
+	}, planChanges(plan))
+	assert.Contains(t, plan.Changes[2].Reason, "stale access token")
+}
+
+func TestGiteaProvisioner_PlanProvisionExistingRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(2).Return(&gitea.User{UserName: "keptn-dev", FullName: "dev"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{
+		Name:        "project-podtato",
+		Description: projectDescription("podtato"),
+	}, createResponse(http.StatusOK), nil)
+	sanitizedName := giteaProvisioner.GetProjectName("pod/tato")
+	giteaClient.EXPECT().GetRepo("keptn-dev", sanitizedName).Times(1).Return(&gitea.Repository{
+		Name:        sanitizedName,
+		Description: projectDescription("pod tato"),
+	}, createResponse(http.StatusOK), nil)
+
+	_, err := giteaProvisioner.PlanProvision("dev", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryAlreadyExists)
+
+	_, err = giteaProvisioner.PlanProvision("dev", "pod/tato")
+	assert.ErrorIs(t, err, ErrNameCollision)
+}
+
+func TestGiteaProvisioner_PlanProvisionQuotaExceeded(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.quota = QuotaOptions{MaxRepositories: 1}
+
+	giteaClient.EXPECT().ListUserRepos("keptn-dev", gomock.Any()).Times(1).Return([]*gitea.Repository{{Name: "project-one"}}, createResponse(http.StatusOK), nil)
+
+	_, err := giteaProvisioner.PlanProvision("dev", "podtato")
+	var quotaErr *QuotaExceededError
+	assert.ErrorAs(t, err, &quotaErr)
+}
+
+func TestGiteaProvisioner_PlanDelete(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(2).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListAccessTokens(gomock.Any()).Times(2).Return([]*gitea.AccessToken{
+		{Name: "token-podtato"},
+	}, createResponse(http.StatusOK), nil)
+	gomock.InOrder(
+		giteaClient.EXPECT().ListUserRepos("keptn-dev", gomock.Any()).Times(1).Return([]*gitea.Repository{
+			{Name: "project-podtato"},
+		}, createResponse(http.StatusOK), nil),
+		giteaClient.EXPECT().ListUserRepos("keptn-dev", gomock.Any()).Times(1).Return([]*gitea.Repository{
+			{Name: "project-podtato"}, {Name: "project-other"},
+		}, createResponse(http.StatusOK), nil),
+	)
+
+	plan, err := giteaProvisioner.PlanDelete("dev", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"delete repository project-podtato", "delete accessToken token-podtato", "delete user keptn-dev",
+	}, planChanges(plan))
+
+	plan, err = giteaProvisioner.PlanDelete("dev", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, "keep user keptn-dev", planChanges(plan)[2])
+}
+
+func TestGiteaProvisioner_PlanDeleteUnknownRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+
+	_, err := giteaProvisioner.PlanDelete("dev", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryDoesNotExist)
+}
@@ -0,0 +1,262 @@
+package provisioner
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Rules of the AdmissionPolicy, the name of the violated rule is returned to the client
+const (
+	RuleAllowedNamespaces       = "allowedNamespaces"
+	RuleDeniedNamespaces        = "deniedNamespaces"
+	RuleNamespacePattern        = "namespacePattern"
+	RuleDeniedNamespacePattern  = "deniedNamespacePattern"
+	RuleAllowedProjects         = "allowedProjects"
+	RuleDeniedProjects          = "deniedProjects"
+	RuleProjectPattern          = "projectPattern"
+	RuleDeniedProjectPattern    = "deniedProjectPattern"
+	RuleReservedNames           = "reservedNames"
+	RuleMaxProjectsPerNamespace = "maxProjectsPerNamespace"
+)
+
+// PolicyOptions defines the rules of an AdmissionPolicy, empty rules are not evaluated
+type PolicyOptions struct {
+	// AllowedNamespaces and DeniedNamespaces are exact namespace names
+	AllowedNamespaces []string
+	DeniedNamespaces  []string
+	// NamespacePattern must match, DeniedNamespacePattern must not match the namespace
+	NamespacePattern       string
+	DeniedNamespacePattern string
+	// AllowedProjects and DeniedProjects are exact project names
+	AllowedProjects []string
+	DeniedProjects  []string
+	// ProjectPattern must match, DeniedProjectPattern must not match the project name
+	ProjectPattern       string
+	DeniedProjectPattern string
+	// ReservedNames can neither be used as namespace nor as project name, e.g. names of Gitea routes like "admin"
+	ReservedNames []string
+	// MaxProjectsPerNamespace limits the number of repositories of a namespace, 0 disables the limit
+	MaxProjectsPerNamespace int
+}
+
+// ProjectCounter returns the number of projects that are provisioned for a namespace
+type ProjectCounter interface {
+	CountProjects(namespace string) (int, error)
+}
+
+// PolicyViolation is returned if a request is rejected by the AdmissionPolicy
+type PolicyViolation struct {
+	// Rule is the name of the violated rule
+	Rule string
+	// Message describes why the request has been rejected
+	Message string
+	// StatusCode is 422 if a name has an invalid format and 403 if a request is denied
+	StatusCode int
+}
+
+// Error returns the message of the violation including the name of the violated rule
+func (p *PolicyViolation) Error() string {
+	return fmt.Sprintf("%s (rule: %s)", p.Message, p.Rule)
+}
+
+// AdmissionPolicy decides whether a repository can be provisioned for a namespace and project
+type AdmissionPolicy struct {
+	options                PolicyOptions
+	namespacePattern       *regexp.Regexp
+	deniedNamespacePattern *regexp.Regexp
+	projectPattern         *regexp.Regexp
+	deniedProjectPattern   *regexp.Regexp
+	counter                ProjectCounter
+}
+
+// NewAdmissionPolicy creates an AdmissionPolicy from the given options, the counter is only required if
+// MaxProjectsPerNamespace is set
+func NewAdmissionPolicy(options PolicyOptions, counter ProjectCounter) (*AdmissionPolicy, error) {
+	policy := &AdmissionPolicy{
+		options: options,
+		counter: counter,
+	}
+
+	patterns := []struct {
+		name    string
+		pattern string
+		target  **regexp.Regexp
+	}{
+		{name: RuleNamespacePattern, pattern: options.NamespacePattern, target: &policy.namespacePattern},
+		{name: RuleDeniedNamespacePattern, pattern: options.DeniedNamespacePattern, target: &policy.deniedNamespacePattern},
+		{name: RuleProjectPattern, pattern: options.ProjectPattern, target: &policy.projectPattern},
+		{name: RuleDeniedProjectPattern, pattern: options.DeniedProjectPattern, target: &policy.deniedProjectPattern},
+	}
+
+	for _, pattern := range patterns {
+		if pattern.pattern == "" {
+			continue
+		}
+
+		compiled, err := regexp.Compile(pattern.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", pattern.name, err)
+		}
+
+		*pattern.target = compiled
+	}
+
+	if options.MaxProjectsPerNamespace > 0 && counter == nil {
+		return nil, fmt.Errorf("a project counter is required for %s", RuleMaxProjectsPerNamespace)
+	}
+
+	return policy, nil
+}
+
+// Evaluate returns a *PolicyViolation if the repository must not be provisioned, other errors indicate that the
+// policy could not be evaluated
+func (a *AdmissionPolicy) Evaluate(namespace string, project string) error {
+	if namespace == "" {
+		namespace = DefaultKeptnNamespace
+	}
+
+	if err := a.EvaluateNames(namespace, project); err != nil {
+		return err
+	}
+
+	// The count rejects requests before the namespace is locked, the provisioner evaluates the rule again while
+	// holding the lock (see QuotaOptions.MaxProjectsPerNamespace)
+	if a.options.MaxProjectsPerNamespace > 0 {
+		count, err := a.counter.CountProjects(namespace)
+		if err != nil {
+			return fmt.Errorf("unable to count projects of namespace %s: %w", namespace, err)
+		}
+
+		if count >= a.options.MaxProjectsPerNamespace {
+			return maxProjectsViolation(namespace, count, a.options.MaxProjectsPerNamespace)
+		}
+	}
+
+	return nil
+}
+
+// maxProjectsViolation returns the violation of the maxProjectsPerNamespace rule
+func maxProjectsViolation(namespace string, count int, limit int) *PolicyViolation {
+	return &PolicyViolation{
+		Rule:       RuleMaxProjectsPerNamespace,
+		Message:    fmt.Sprintf("namespace %s already has %d of %d allowed projects", namespace, count, limit),
+		StatusCode: http.StatusForbidden,
+	}
+}
+
+// EvaluateNames returns a *PolicyViolation if the namespace or project name is denied, the number of projects of the
+// namespace isn't limited. It applies to operations that don't add a project to the namespace, e.g. a rename.
+func (a *AdmissionPolicy) EvaluateNames(namespace string, project string) error {
+	if namespace == "" {
+		namespace = DefaultKeptnNamespace
+	}
+
+	if violation := a.checkName("namespace", namespace, a.namespaceRules()); violation != nil {
+		return violation
+	}
+
+	if violation := a.checkName("project", project, a.projectRules()); violation != nil {
+		return violation
+	}
+
+	return nil
+}
+
+// nameRules are the rules that are evaluated for a namespace or project name
+type nameRules struct {
+	allowed           []string
+	allowedRule       string
+	denied            []string
+	deniedRule        string
+	pattern           *regexp.Regexp
+	patternRule       string
+	deniedPattern     *regexp.Regexp
+	deniedPatternRule string
+}
+
+// namespaceRules returns the rules that are evaluated for namespaces
+func (a *AdmissionPolicy) namespaceRules() nameRules {
+	return nameRules{
+		allowed:           a.options.AllowedNamespaces,
+		allowedRule:       RuleAllowedNamespaces,
+		denied:            a.options.DeniedNamespaces,
+		deniedRule:        RuleDeniedNamespaces,
+		pattern:           a.namespacePattern,
+		patternRule:       RuleNamespacePattern,
+		deniedPattern:     a.deniedNamespacePattern,
+		deniedPatternRule: RuleDeniedNamespacePattern,
+	}
+}
+
+// projectRules returns the rules that are evaluated for project names
+func (a *AdmissionPolicy) projectRules() nameRules {
+	return nameRules{
+		allowed:           a.options.AllowedProjects,
+		allowedRule:       RuleAllowedProjects,
+		denied:            a.options.DeniedProjects,
+		deniedRule:        RuleDeniedProjects,
+		pattern:           a.projectPattern,
+		patternRule:       RuleProjectPattern,
+		deniedPattern:     a.deniedProjectPattern,
+		deniedPatternRule: RuleDeniedProjectPattern,
+	}
+}
+
+// checkName evaluates the given rules and the reserved names for a namespace or project name
+func (a *AdmissionPolicy) checkName(kind string, name string, rules nameRules) *PolicyViolation {
+	if rules.pattern != nil && !rules.pattern.MatchString(name) {
+		return &PolicyViolation{
+			Rule:       rules.patternRule,
+			Message:    fmt.Sprintf("%s %s does not match %s", kind, name, rules.pattern),
+			StatusCode: http.StatusUnprocessableEntity,
+		}
+	}
+
+	if rules.deniedPattern != nil && rules.deniedPattern.MatchString(name) {
+		return &PolicyViolation{
+			Rule:       rules.deniedPatternRule,
+			Message:    fmt.Sprintf("%s %s matches the denied pattern %s", kind, name, rules.deniedPattern),
+			StatusCode: http.StatusForbidden,
+		}
+	}
+
+	if containsName(a.options.ReservedNames, name) {
+		return &PolicyViolation{
+			Rule:       RuleReservedNames,
+			Message:    fmt.Sprintf("%s %s is a reserved name", kind, name),
+			StatusCode: http.StatusForbidden,
+		}
+	}
+
+	if containsName(rules.denied, name) {
+		return &PolicyViolation{
+			Rule:       rules.deniedRule,
+			Message:    fmt.Sprintf("%s %s is denied", kind, name),
+			StatusCode: http.StatusForbidden,
+		}
+	}
+
+	if len(rules.allowed) > 0 && !containsName(rules.allowed, name) {
+		return &PolicyViolation{
+			Rule:       rules.allowedRule,
+			Message:    fmt.Sprintf("%s %s is not allowed", kind, name),
+			StatusCode: http.StatusForbidden,
+		}
+	}
+
+	return nil
+}
+
+// containsName returns true if the list contains the name, names are compared case-insensitive since Gitea treats
+// user and repository names case-insensitive
+func containsName(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+
+	return false
+}
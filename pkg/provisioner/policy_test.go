@@ -0,0 +1,130 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type staticProjectCounter struct {
+	count int
+	err   error
+}
+
+func (s staticProjectCounter) CountProjects(string) (int, error) {
+	return s.count, s.err
+}
+
+func TestAdmissionPolicy_Evaluate(t *testing.T) {
+	policy, err := NewAdmissionPolicy(PolicyOptions{
+		AllowedNamespaces:    []string{"keptn", "keptn-dev"},
+		DeniedNamespaces:     []string{"keptn-dev"},
+		NamespacePattern:     "^[a-z0-9-]+$",
+		DeniedProjects:       []string{"legacy"},
+		ProjectPattern:       "^[a-z][a-z0-9-]*$",
+		DeniedProjectPattern: "^tmp-",
+		ReservedNames:        []string{"admin", "api"},
+	}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		namespace  string
+		project    string
+		rule       string
+		statusCode int
+	}{
+		{name: "admitted", namespace: "keptn", project: "podtato-head"},
+		{name: "default namespace", namespace: "", project: "podtato-head"},
+		{name: "namespace not allowed", namespace: "other", project: "podtato-head", rule: RuleAllowedNamespaces, statusCode: http.StatusForbidden},
+		{name: "namespace denied", namespace: "keptn-dev", project: "podtato-head", rule: RuleDeniedNamespaces, statusCode: http.StatusForbidden},
+		{name: "namespace format", namespace: "Keptn_Dev", project: "podtato-head", rule: RuleNamespacePattern, statusCode: http.StatusUnprocessableEntity},
+		{name: "project format", namespace: "keptn", project: "1project", rule: RuleProjectPattern, statusCode: http.StatusUnprocessableEntity},
+		{name: "project denied", namespace: "keptn", project: "legacy", rule: RuleDeniedProjects, statusCode: http.StatusForbidden},
+		{name: "project denied pattern", namespace: "keptn", project: "tmp-test", rule: RuleDeniedProjectPattern, statusCode: http.StatusForbidden},
+		{name: "reserved project", namespace: "keptn", project: "admin", rule: RuleReservedNames, statusCode: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Evaluate(test.namespace, test.project)
+			if test.rule == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			var violation *PolicyViolation
+			require.True(t, errors.As(err, &violation))
+			assert.Equal(t, test.rule, violation.Rule)
+			assert.Equal(t, test.statusCode, violation.StatusCode)
+		})
+	}
+}
+
+func TestAdmissionPolicy_MaxProjectsPerNamespace(t *testing.T) {
+	_, err := NewAdmissionPolicy(PolicyOptions{MaxProjectsPerNamespace: 2}, nil)
+	require.Error(t, err)
+
+	policy, err := NewAdmissionPolicy(PolicyOptions{MaxProjectsPerNamespace: 2}, staticProjectCounter{count: 1})
+	require.NoError(t, err)
+	require.NoError(t, policy.Evaluate("keptn", "project"))
+
+	policy, err = NewAdmissionPolicy(PolicyOptions{MaxProjectsPerNamespace: 2}, staticProjectCounter{count: 2})
+	require.NoError(t, err)
+
+	var violation *PolicyViolation
+	require.True(t, errors.As(policy.Evaluate("keptn", "project"), &violation))
+	assert.Equal(t, RuleMaxProjectsPerNamespace, violation.Rule)
+
+	// Operations that don't add a project only check the names
+	require.NoError(t, policy.EvaluateNames("keptn", "project"))
+
+	// Errors while counting are not reported as violation
+	policy, err = NewAdmissionPolicy(PolicyOptions{MaxProjectsPerNamespace: 2}, staticProjectCounter{err: errors.New("gitea unavailable")})
+	require.NoError(t, err)
+
+	err = policy.Evaluate("keptn", "project")
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &violation))
+}
+
+func TestNewAdmissionPolicy_InvalidPattern(t *testing.T) {
+	_, err := NewAdmissionPolicy(PolicyOptions{ProjectPattern: "[a-z"}, nil)
+	require.Error(t, err)
+}
+
+func TestProvisionHandler_PolicyViolation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	policy, err := NewAdmissionPolicy(PolicyOptions{ReservedNames: []string{"admin"}}, nil)
+	require.NoError(t, err)
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	provisioner.EXPECT().ProvisionRepository(gomock.Any(), gomock.Any()).Times(0)
+
+	handler := ProvisionHandler{
+		Provisioner: provisioner,
+		Policy:      policy,
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository",
+		strings.NewReader(`{"namespace":"keptn","project":"admin"}`),
+	)
+	response := httptest.NewRecorder()
+
+	handler.HandleProvisionRepoRequest(response, request)
+	require.Equal(t, http.StatusForbidden, response.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	assert.Equal(t, RuleReservedNames, body["rule"])
+	assert.Equal(t, float64(http.StatusForbidden), body["code"])
+}
@@ -1,20 +1,31 @@
 package provisioner
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/audit"
 	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
 	"log"
 	"net/http"
+	"strconv"
 )
 
 // ErrRepositoryAlreadyExists indicates that the repository already exists
 var /*const*/ ErrRepositoryAlreadyExists = errors.New("the repository already exists")
 
+// ErrRepositoryArchived indicates that the repository of the project has been archived by the archive deletion policy
+var /*const*/ ErrRepositoryArchived = errors.New("the repository has been archived, restore the project to bring it back")
+
 // ErrRepositoryDoesNotExist indicates that the repository does not exist
 var /*const*/ ErrRepositoryDoesNotExist = errors.New("the repository does not exist")
 
+// DryRunHeader is the request header that enables the dry run of a single request
+const DryRunHeader = "X-Dry-Run"
+
 // ErrInvalidRequest indicates that the request body wasn't valid
 var /*const*/ ErrInvalidRequest = errors.New("request body is not valid")
 
@@ -24,26 +35,96 @@ type GitProvisioner interface {
 	DeleteRepository(namespace string, project string) error
 	// ProvisionRepository creates all required resources for the given request
 	ProvisionRepository(namespace string, project string) (*keptn.ProvisionResponse, error)
+	// RestoreRepository brings back the repository of a deleted project and creates a new token
+	RestoreRepository(namespace string, project string) (*keptn.ProvisionResponse, error)
+	// RenameRepository renames the repository of a project to the one of the new project and recreates the token
+	RenameRepository(namespace string, project string, newProject string) (*keptn.RenameResponse, error)
 }
 
 //go:generate mockgen -destination=fake/provisioner_mock.go -package=fake . GitProvisioner
 
+// GiteaObjects are the names of the Gitea objects that belong to a Keptn project
+type GiteaObjects struct {
+	User        string
+	Repository  string
+	AccessToken string
+}
+
+// ObjectNamer is implemented by provisioners that can name the Gitea objects of a Keptn project, the names are part of
+// the audit trail
+type ObjectNamer interface {
+	GiteaObjects(namespace string, project string) GiteaObjects
+}
+
 // The ProvisionHandler provides the HandleProvisionRepoRequest method which can be used within a HTTPListener to process
 // repository provision and deletion requests from Keptn
 type ProvisionHandler struct {
 	Provisioner GitProvisioner
+	// Policy is evaluated before a repository is provisioned if set
+	Policy *AdmissionPolicy
+	// Audit records every provisioning and deletion request if set
+	Audit *audit.Recorder
+	// TrustedProxies may set the caller of the audit events, the caller headers of other clients are ignored
+	TrustedProxies audit.TrustedProxies
+	// Events publishes the upstream lifecycle events to Keptn if set
+	Events *keptn.EventPublisher
+	// DryRun makes every request return the Plan of the Planner instead of modifying Gitea, single requests can enable
+	// the dry run with the DryRunHeader
+	DryRun bool
+	// Jobs runs the provisioning requests that set the AsyncHeader if set, otherwise async requests are rejected
+	Jobs *JobQueue
+}
+
+// policyViolationResponse is the response body if a request is rejected by the AdmissionPolicy
+type policyViolationResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Rule    string `json:"rule"`
 }
 
-// HandleProvisionRepoRequest handles a GET or POST http request and provisions or deletes the defined repository in the request
+// errorResponse is the response body of errors that need an explanation beyond the status code
+type errorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// quotaExceededResponse is the response body if a namespace exceeded one of its quotas, the rule is the name of the
+// quota like for the rules of the AdmissionPolicy
+type quotaExceededResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Rule    string `json:"rule"`
+	Quota   string `json:"quota"`
+	Usage   int64  `json:"usage"`
+	Limit   int64  `json:"limit"`
+}
+
+// HandleProvisionRepoRequest handles a GET or POST http request and provisions or deletes the defined repository in the request,
+// provisioning requests with the AsyncHeader return a Job that can be polled instead of waiting for the repository
 func (p *ProvisionHandler) HandleProvisionRepoRequest(w http.ResponseWriter, req *http.Request) {
 
 	switch req.Method {
 	case http.MethodPost:
-		p.handleProvisionRepository(w, req)
+		async, err := p.isAsync(req)
+		if err != nil {
+			p.audited(audit.ActionProvision, w, req, func(w http.ResponseWriter, req *http.Request, event *audit.Event) {
+				log.Printf("Unable to process request: %s\n", err)
+				event.Error = err.Error()
+				w.WriteHeader(http.StatusBadRequest)
+			})
+			break
+		}
+
+		if async {
+			p.enqueue(audit.ActionProvision, w, req, p.handleProvisionRepository)
+			break
+		}
+
+		p.audited(audit.ActionProvision, w, req, p.handleProvisionRepository)
 		break
 
 	case http.MethodDelete:
-		p.handleDeleteRepository(w, req)
+		p.audited(audit.ActionDelete, w, req, p.handleDeleteRepository)
 		break
 
 	default:
@@ -52,6 +133,174 @@ func (p *ProvisionHandler) HandleProvisionRepoRequest(w http.ResponseWriter, req
 
 }
 
+// HandleRestoreRequest handles a POST http request and restores the repository of a deleted project
+func (p *ProvisionHandler) HandleRestoreRequest(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	p.audited(audit.ActionRestore, w, req, p.handleRestoreRepository)
+}
+
+// HandleRenameRequest handles a POST http request and renames the repository of a project
+func (p *ProvisionHandler) HandleRenameRequest(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	p.audited(audit.ActionRename, w, req, p.handleRenameRepository)
+}
+
+// statusRecorder remembers the status code that has been written, such that it can be part of the audit trail
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+// WriteHeader records the status code and writes it to the underlying http.ResponseWriter
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	s.statusCode = statusCode
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+// audited runs the handler and records the request in the audit trail afterwards, the handler fills in the namespace,
+// project and error of the event. The Gitea objects of a rename are the ones of the new project.
+func (p *ProvisionHandler) audited(action string, w http.ResponseWriter, req *http.Request, handle func(http.ResponseWriter, *http.Request, *audit.Event)) {
+	if p.Audit == nil {
+		handle(w, req, &audit.Event{})
+		return
+	}
+
+	event := audit.NewEvent(action, req, p.TrustedProxies)
+	recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+	handle(recorder, req, &event)
+
+	event.StatusCode = recorder.statusCode
+	event.Outcome = audit.OutcomeOf(recorder.statusCode)
+
+	// Rejected requests didn't touch any Gitea object
+	namer, ok := p.Provisioner.(ObjectNamer)
+	if ok && event.Project != "" && event.Outcome != audit.OutcomeRejected {
+		project := event.Project
+		if event.NewProject != "" {
+			project = event.NewProject
+		}
+
+		objects := namer.GiteaObjects(event.Namespace, project)
+		event.GiteaUser = objects.User
+		event.GiteaRepository = objects.Repository
+		event.GiteaAccessToken = objects.AccessToken
+	}
+
+	p.Audit.Record(event)
+}
+
+// isDryRun returns true if the handler or the request enable the dry run, the header can't disable a dry run of the
+// handler
+func (p *ProvisionHandler) isDryRun(req *http.Request) (bool, error) {
+	value := req.Header.Get(DryRunHeader)
+	if value == "" {
+		return p.DryRun, nil
+	}
+
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s header: %w", DryRunHeader, err)
+	}
+
+	return p.DryRun || dryRun, nil
+}
+
+// isAsync returns true if the request asks to be processed as a Job of the JobQueue
+func (p *ProvisionHandler) isAsync(req *http.Request) (bool, error) {
+	value := req.Header.Get(AsyncHeader)
+	if value == "" {
+		return false, nil
+	}
+
+	async, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s header: %w", AsyncHeader, err)
+	}
+
+	return async, nil
+}
+
+// enqueue submits the request as a Job that is processed by the handler in the background, the job is audited once it
+// ran and its result contains the status code and body of the synchronous request. enqueue will generate the following
+// status codes:
+//   - 202  If the job has been queued, the Job is part of the body and its Location is set
+//   - 400  If the request body can not be read or decoded, the request is processed synchronously in the latter case
+//   - 501  If the handler has no JobQueue, e.g. because lease locking is enabled and other replicas couldn't serve the
+//     job
+//   - 503  If the job queue is full
+func (p *ProvisionHandler) enqueue(action string, w http.ResponseWriter, req *http.Request, handle func(http.ResponseWriter, *http.Request, *audit.Event)) {
+	if p.Jobs == nil {
+		log.Printf("Unable to process async request: no job queue configured\n")
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		log.Printf("Unable to read request body: %s\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// Invalid requests are rejected right away by the synchronous handler
+	request := keptn.ProvisionRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		p.audited(action, w, req, handle)
+		return
+	}
+
+	// The job outlives the request, so it must not be canceled with it
+	jobRequest := req.Clone(context.Background())
+	job, err := p.Jobs.submit(action, namespaceOrDefault(request.Namespace), request.Project, func() jobResult {
+		jobRequest.Body = ioutil.NopCloser(bytes.NewReader(body))
+		response := newBufferedResponse()
+
+		var message string
+		p.audited(action, response, jobRequest, func(w http.ResponseWriter, req *http.Request, event *audit.Event) {
+			handle(w, req, event)
+			message = event.Error
+		})
+
+		return jobResult{statusCode: response.statusCode, body: response.body.Bytes(), error: message, retryAfter: response.retryAfter()}
+	})
+	if errors.Is(err, ErrJobQueueFull) {
+		log.Printf("Rejected async request for project \"%s\" in namespace \"%s\": %s\n", request.Project, request.Namespace, err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Unable to queue async request: %s\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Queued %s job %s for project \"%s\" in namespace \"%s\"\n", action, job.ID, request.Project, request.Namespace)
+
+	w.Header().Set("Location", JobsPath+job.ID)
+	p.writeJSONResponse(w, http.StatusAccepted, job)
+}
+
+// planner returns the Planner of the provisioner or an error if it doesn't support dry runs
+func (p *ProvisionHandler) planner() (Planner, error) {
+	planner, ok := p.Provisioner.(Planner)
+	if !ok {
+		return nil, fmt.Errorf("the provisioner doesn't support dry runs")
+	}
+
+	return planner, nil
+}
+
 // decodeRequestBody decodes the body of the given http request into a keptn.ProvisionRequest or throws an error
 // if the body cannot be decoded correctly
 func (p *ProvisionHandler) decodeRequestBody(request *http.Request) (*keptn.ProvisionRequest, error) {
@@ -67,36 +316,57 @@ func (p *ProvisionHandler) decodeRequestBody(request *http.Request) (*keptn.Prov
 }
 
 // handleProvisionRepository processes the request of provisioning a repository and will generate the following status code:
-//	- 201	If the repository, token and optionally a user have been created successfully
-//	- 400 	If the request body can not be decoded
-//  - 409	If the repository already exists on the Gitea server
-//  - 424 	If the upstream Gitea repository is not available
-func (p *ProvisionHandler) handleProvisionRepository(w http.ResponseWriter, req *http.Request) {
+//   - 200	If the request is a dry run, the Plan is part of the body
+//   - 201	If the repository, token and optionally a user have been created successfully
+//   - 400 	If the request body or the dry run header can not be decoded
+//   - 403	If the namespace or project is denied by the admission policy or the namespace exceeded a quota, the rule or
+//     quota is part of the body
+//   - 409	If the repository already exists on the Gitea server or its Gitea name is used by a different project, the
+//     body points at the restore if the repository has been archived
+//   - 422	If the namespace or project name has an invalid format, the rule is part of the body
+//   - 424 	If the upstream Gitea repository is not available
+//   - 429	If the namespace exceeded a quota and the quota status code is configured to 429
+//   - 501	If the request is a dry run and the provisioner doesn't support dry runs
+//   - 503 	If the upstream Gitea server is considered unavailable, a Retry-After header is set
+func (p *ProvisionHandler) handleProvisionRepository(w http.ResponseWriter, req *http.Request, event *audit.Event) {
+	dryRun, err := p.isDryRun(req)
+	if err != nil {
+		log.Printf("Unable to process request: %s\n", err)
+		event.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	event.DryRun = dryRun
+
 	request, err := p.decodeRequestBody(req)
 	if err != nil {
 		log.Printf("Unable to process request body: %s\n", err)
+		event.Error = err.Error()
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Provisioning repository \"%s\" for namespace \"%s\"\n", request.Project, request.Namespace)
+	event.Namespace = namespaceOrDefault(request.Namespace)
+	event.Project = request.Project
 
-	response, err := p.Provisioner.ProvisionRepository(request.Namespace, request.Project)
-	if err != nil {
-		if errors.Is(err, ErrRepositoryAlreadyExists) {
-			log.Printf("Unable to provision repository: %s\n", err.Error())
-			w.WriteHeader(http.StatusConflict)
-			return
-		}
+	if dryRun {
+		p.handlePlan(w, event, func(planner Planner) (*Plan, error) {
+			return p.planProvision(planner, request)
+		}, p.writeProvisionError)
+		return
+	}
 
-		if errors.Is(err, ErrInvalidRequest) {
-			log.Printf("Unable to provision repository: %s for body: %#v\n", err, request)
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			return
-		}
+	log.Printf("Provisioning repository \"%s\" for namespace \"%s\"\n", request.Project, request.Namespace)
 
-		log.Printf("Unable to create repository: %s\n", err.Error())
-		w.WriteHeader(http.StatusFailedDependency)
+	response, err := p.provisionRepository(request)
+	if err != nil {
+		event.Error = err.Error()
+		p.writeFailure(w, err, p.writeProvisionError, keptn.UpstreamEventData{
+			Project:   request.Project,
+			Namespace: event.Namespace,
+			Action:    audit.ActionProvision,
+			Message:   err.Error(),
+		})
 		return
 	}
 
@@ -107,6 +377,14 @@ func (p *ProvisionHandler) handleProvisionRepository(w http.ResponseWriter, req
 		return
 	}
 
+	p.publishEvent(keptn.UpstreamProvisionedEventType, keptn.UpstreamEventData{
+		Project:      request.Project,
+		Namespace:    event.Namespace,
+		Action:       audit.ActionProvision,
+		GitRemoteURL: response.GitRemoteURL,
+		GitUser:      response.GitUser,
+	})
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusCreated)
 	_, err = w.Write(responseJson)
@@ -115,39 +393,423 @@ func (p *ProvisionHandler) handleProvisionRepository(w http.ResponseWriter, req
 	}
 }
 
+// handlePlan writes the plan that is computed by the planner of the provisioner with 200, errors are written by
+// writeError the same way as errors of the actual request
+func (p *ProvisionHandler) handlePlan(w http.ResponseWriter, event *audit.Event, plan func(Planner) (*Plan, error), writeError func(http.ResponseWriter, error)) {
+	log.Printf("Planning %s of repository \"%s\" for namespace \"%s\"\n", event.Action, event.Project, event.Namespace)
+
+	planner, err := p.planner()
+	if err != nil {
+		log.Printf("Unable to plan request: %s\n", err)
+		event.Error = err.Error()
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	result, err := plan(planner)
+	if err != nil {
+		event.Error = err.Error()
+		writeError(w, err)
+		return
+	}
+
+	p.writeJSONResponse(w, http.StatusOK, result)
+}
+
+// planProvision evaluates the admission policy and plans the provisioning if it is admitted
+func (p *ProvisionHandler) planProvision(planner Planner, request *keptn.ProvisionRequest) (*Plan, error) {
+	if p.Policy != nil {
+		if err := p.Policy.Evaluate(request.Namespace, request.Project); err != nil {
+			return nil, err
+		}
+	}
+
+	return planner.PlanProvision(request.Namespace, request.Project)
+}
+
+// writeProvisionError writes the status code and body of an error of the provisioning
+func (p *ProvisionHandler) writeProvisionError(w http.ResponseWriter, err error) {
+	var violation *PolicyViolation
+	if errors.As(err, &violation) {
+		log.Printf("Rejected provisioning of repository: %s\n", err.Error())
+		p.writePolicyViolation(w, violation)
+		return
+	}
+
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		log.Printf("Rejected provisioning of repository: %s\n", err.Error())
+		p.writeJSONResponse(w, quotaErr.StatusCode, quotaExceededResponse{
+			Code:    quotaErr.StatusCode,
+			Message: quotaErr.Error(),
+			Rule:    quotaErr.Quota,
+			Quota:   quotaErr.Quota,
+			Usage:   quotaErr.Usage,
+			Limit:   quotaErr.Limit,
+		})
+		return
+	}
+
+	if errors.Is(err, ErrRepositoryArchived) {
+		log.Printf("Unable to provision repository: %s\n", err.Error())
+		p.writeJSONResponse(w, http.StatusConflict, errorResponse{
+			Code:    http.StatusConflict,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, ErrRepositoryAlreadyExists) || errors.Is(err, ErrNameCollision) {
+		log.Printf("Unable to provision repository: %s\n", err.Error())
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if errors.Is(err, ErrInvalidRequest) {
+		log.Printf("Unable to provision repository: %s\n", err.Error())
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	var unavailableErr *UpstreamUnavailableError
+	if errors.As(err, &unavailableErr) {
+		log.Printf("Unable to provision repository: %s\n", err.Error())
+		w.Header().Set("Retry-After", strconv.Itoa(unavailableErr.RetryAfterSeconds()))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	log.Printf("Unable to create repository: %s\n", err.Error())
+	w.WriteHeader(http.StatusFailedDependency)
+}
+
+// provisionRepository evaluates the admission policy and provisions the repository if it is admitted
+func (p *ProvisionHandler) provisionRepository(request *keptn.ProvisionRequest) (*keptn.ProvisionResponse, error) {
+	if p.Policy != nil {
+		if err := p.Policy.Evaluate(request.Namespace, request.Project); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.Provisioner.ProvisionRepository(request.Namespace, request.Project)
+}
+
+// writePolicyViolation writes the status code of the violation and a body that contains the violated rule
+func (p *ProvisionHandler) writePolicyViolation(w http.ResponseWriter, violation *PolicyViolation) {
+	p.writeJSONResponse(w, violation.StatusCode, policyViolationResponse{
+		Code:    violation.StatusCode,
+		Message: violation.Message,
+		Rule:    violation.Rule,
+	})
+}
+
+// writeJSONResponse writes the status code and the given body as JSON
+func (p *ProvisionHandler) writeJSONResponse(w http.ResponseWriter, statusCode int, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Unable to marshal reponse: %s\n", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Encountered error while writing response body: %s\n", err.Error())
+	}
+}
+
 // handleDeleteRepository processes the request of deleting a repository and will generate the following status codes:
+//   - 200  If the request is a dry run, the Plan is part of the body
 //   - 204  If the repository has been deleted successfully
-//   - 400 	If the request body can not be decoded
-//   - 404 	If the given repository cannot be found
+//   - 400 	If the request body or the dry run header can not be decoded
+//   - 404 	If the given repository cannot be found, e.g. because its name only redirects to a renamed repository
+//   - 409  If the repository with the Gitea name of the project belongs to a different project
 //   - 424  If the upstream Gitea repository is not available
-func (p *ProvisionHandler) handleDeleteRepository(w http.ResponseWriter, req *http.Request) {
+//   - 501  If the request is a dry run and the provisioner doesn't support dry runs
+//   - 503  If the upstream Gitea server is considered unavailable, a Retry-After header is set
+func (p *ProvisionHandler) handleDeleteRepository(w http.ResponseWriter, req *http.Request, event *audit.Event) {
+	dryRun, err := p.isDryRun(req)
+	if err != nil {
+		log.Printf("Unable to process request: %s\n", err)
+		event.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	event.DryRun = dryRun
+
 	request, err := p.decodeRequestBody(req)
 	if err != nil {
 		log.Printf("Unable to process request body: %s\n", err)
+		event.Error = err.Error()
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	event.Namespace = namespaceOrDefault(request.Namespace)
+	event.Project = request.Project
+
+	if dryRun {
+		p.handlePlan(w, event, func(planner Planner) (*Plan, error) {
+			return planner.PlanDelete(request.Namespace, request.Project)
+		}, p.writeDeleteError)
+		return
+	}
+
 	log.Printf("Deleting repository %s in namspace %s\n", request.Project, request.Namespace)
 
 	err = p.Provisioner.DeleteRepository(request.Namespace, request.Project)
 	if err != nil {
-		if errors.Is(err, ErrRepositoryDoesNotExist) {
-			log.Printf("Unable to delete repository, does not exist!\n")
-			w.WriteHeader(http.StatusNotFound)
-			return
+		event.Error = err.Error()
+		p.writeFailure(w, err, p.writeDeleteError, keptn.UpstreamEventData{
+			Project:   request.Project,
+			Namespace: event.Namespace,
+			Action:    audit.ActionDelete,
+			Message:   err.Error(),
+		})
+		return
+	}
+
+	p.publishEvent(keptn.UpstreamDeletedEventType, keptn.UpstreamEventData{
+		Project:   request.Project,
+		Namespace: event.Namespace,
+		Action:    audit.ActionDelete,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeDeleteError writes the status code of an error of the deletion
+func (p *ProvisionHandler) writeDeleteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrRepositoryDoesNotExist) {
+		log.Printf("Unable to delete repository, does not exist!\n")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, ErrNameCollision) {
+		log.Printf("Unable to delete repository: %s\n", err.Error())
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if errors.Is(err, ErrInvalidRequest) {
+		log.Printf("Unable to delete repository: %s\n", err.Error())
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	var unavailableErr *UpstreamUnavailableError
+	if errors.As(err, &unavailableErr) {
+		log.Printf("Unable to delete repository: %s\n", err.Error())
+		w.Header().Set("Retry-After", strconv.Itoa(unavailableErr.RetryAfterSeconds()))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	log.Printf("Unable to delete repository: %s\n", err.Error())
+	w.WriteHeader(http.StatusFailedDependency)
+}
+
+// handleRestoreRepository processes the request of restoring a repository and will generate the following status codes:
+//   - 201  If the repository has been restored and a new token has been created, the body is the same as for a
+//     provisioned repository
+//   - 400  If the request body or the dry run header can not be decoded
+//   - 403  If the namespace or project is denied by the admission policy or the namespace exceeded a quota, the rule or
+//     quota is part of the body
+//   - 404  If the project has no archived repository, no repository in the graveyard and no backup
+//   - 409  If the repository exists and isn't archived, or its Gitea name is used by a different project
+//   - 422  If the namespace or project name has an invalid format, the rule is part of the body
+//   - 424  If the upstream Gitea repository is not available
+//   - 429  If the namespace exceeded a quota and the quota status code is configured to 429
+//   - 501  If the request is a dry run, restores can't be planned
+//   - 503  If the upstream Gitea server is considered unavailable, a Retry-After header is set
+func (p *ProvisionHandler) handleRestoreRepository(w http.ResponseWriter, req *http.Request, event *audit.Event) {
+	dryRun, err := p.isDryRun(req)
+	if err != nil {
+		log.Printf("Unable to process request: %s\n", err)
+		event.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	event.DryRun = dryRun
+
+	request, err := p.decodeRequestBody(req)
+	if err != nil {
+		log.Printf("Unable to process request body: %s\n", err)
+		event.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	event.Namespace = namespaceOrDefault(request.Namespace)
+	event.Project = request.Project
+
+	if dryRun {
+		log.Printf("Unable to plan the restore of repository \"%s\", restores don't support dry runs\n", request.Project)
+		event.Error = "restores don't support dry runs"
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	log.Printf("Restoring repository \"%s\" for namespace \"%s\"\n", request.Project, request.Namespace)
+
+	response, err := p.restoreRepository(request)
+	if err != nil {
+		event.Error = err.Error()
+		p.writeFailure(w, err, p.writeRestoreError, keptn.UpstreamEventData{
+			Project:   request.Project,
+			Namespace: event.Namespace,
+			Action:    audit.ActionRestore,
+			Message:   err.Error(),
+		})
+		return
+	}
+
+	p.publishEvent(keptn.UpstreamProvisionedEventType, keptn.UpstreamEventData{
+		Project:      request.Project,
+		Namespace:    event.Namespace,
+		Action:       audit.ActionRestore,
+		GitRemoteURL: response.GitRemoteURL,
+		GitUser:      response.GitUser,
+	})
+
+	p.writeJSONResponse(w, http.StatusCreated, response)
+}
+
+// restoreRepository evaluates the admission policy and restores the repository if it is admitted, a restored project
+// must satisfy the same rules as a newly provisioned one
+func (p *ProvisionHandler) restoreRepository(request *keptn.ProvisionRequest) (*keptn.ProvisionResponse, error) {
+	if p.Policy != nil {
+		if err := p.Policy.Evaluate(request.Namespace, request.Project); err != nil {
+			return nil, err
 		}
+	}
+
+	return p.Provisioner.RestoreRepository(request.Namespace, request.Project)
+}
+
+// handleRenameRepository processes the request of renaming a repository and will generate the following status codes:
+//   - 200  If the repository has been renamed and a new token has been created, the body is the same as for a
+//     provisioned repository with the previous remote URL and its redirect
+//   - 400  If the request body or the dry run header can not be decoded
+//   - 403  If the new project is denied by the admission policy, the rule is part of the body
+//   - 404  If the repository of the project doesn't exist
+//   - 409  If the repository of the new project already exists
+//   - 422  If a project name is missing or has an invalid format, the rule is part of the body
+//   - 424  If the upstream Gitea repository is not available
+//   - 501  If the request is a dry run, renames can't be planned
+//   - 503  If the upstream Gitea server is considered unavailable, a Retry-After header is set
+func (p *ProvisionHandler) handleRenameRepository(w http.ResponseWriter, req *http.Request, event *audit.Event) {
+	dryRun, err := p.isDryRun(req)
+	if err != nil {
+		log.Printf("Unable to process request: %s\n", err)
+		event.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	event.DryRun = dryRun
+
+	request := &keptn.RenameRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		log.Printf("Unable to process request body: %s\n", err)
+		event.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
-		if errors.Is(err, ErrInvalidRequest) {
-			log.Printf("Unable to delte repository: %s for body: %#v\n", err, request)
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			return
+	event.Namespace = namespaceOrDefault(request.Namespace)
+	event.Project = request.Project
+	event.NewProject = request.NewProject
+
+	if dryRun {
+		log.Printf("Unable to plan the rename of repository \"%s\", renames don't support dry runs\n", request.Project)
+		event.Error = "renames don't support dry runs"
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	log.Printf("Renaming repository \"%s\" to \"%s\" for namespace \"%s\"\n", request.Project, request.NewProject, request.Namespace)
+
+	response, err := p.renameRepository(request)
+	if err != nil {
+		event.Error = err.Error()
+		p.writeFailure(w, err, p.writeRenameError, keptn.UpstreamEventData{
+			Project:   request.NewProject,
+			Namespace: event.Namespace,
+			Action:    audit.ActionRename,
+			Message:   err.Error(),
+		})
+		return
+	}
+
+	p.publishEvent(keptn.UpstreamProvisionedEventType, keptn.UpstreamEventData{
+		Project:      request.NewProject,
+		Namespace:    event.Namespace,
+		Action:       audit.ActionRename,
+		GitRemoteURL: response.GitRemoteURL,
+		GitUser:      response.GitUser,
+	})
+
+	p.writeJSONResponse(w, http.StatusOK, response)
+}
+
+// writeRenameError writes the status code of a failed rename, which is the status code of a failed provisioning
+// unless the repository of the project doesn't exist
+func (p *ProvisionHandler) writeRenameError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrRepositoryDoesNotExist) {
+		log.Printf("Unable to rename repository: %s\n", err.Error())
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	p.writeProvisionError(w, err)
+}
+
+// renameRepository evaluates the name rules of the admission policy for the new project and renames the repository if
+// it is admitted, the number of projects doesn't change
+func (p *ProvisionHandler) renameRepository(request *keptn.RenameRequest) (*keptn.RenameResponse, error) {
+	if p.Policy != nil {
+		if err := p.Policy.EvaluateNames(request.Namespace, request.NewProject); err != nil {
+			return nil, err
 		}
+	}
 
-		log.Printf("Unable to delete repository: %s\n", err.Error())
-		w.WriteHeader(http.StatusFailedDependency)
+	return p.Provisioner.RenameRepository(request.Namespace, request.Project, request.NewProject)
+}
+
+// writeRestoreError writes the status code of a failed restore, which is the status code of a failed provisioning
+// unless there is nothing to restore
+func (p *ProvisionHandler) writeRestoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNothingToRestore) {
+		log.Printf("Unable to restore repository: %s\n", err.Error())
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	p.writeProvisionError(w, err)
+}
+
+// writeFailure writes the error with the given function and publishes the failed event if Gitea failed (424) or is
+// unavailable (503). Rejected requests, e.g. because of the policy, a quota or a conflict, are only answered since
+// they didn't touch Gitea and the caller can fix the request.
+func (p *ProvisionHandler) writeFailure(w http.ResponseWriter, err error, writeError func(http.ResponseWriter, error), data keptn.UpstreamEventData) {
+	recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+	writeError(recorder, err)
+
+	if recorder.statusCode == http.StatusFailedDependency || recorder.statusCode == http.StatusServiceUnavailable {
+		p.publishEvent(keptn.UpstreamFailedEventType, data)
+	}
+}
+
+// publishEvent queues the upstream lifecycle event for Keptn if a publisher is configured, such that a slow Keptn API
+// doesn't delay the response. Failures are only logged since Gitea has already been modified at this point.
+func (p *ProvisionHandler) publishEvent(eventType string, data keptn.UpstreamEventData) {
+	if p.Events == nil {
+		return
+	}
+
+	if err := p.Events.Enqueue(eventType, data); err != nil {
+		log.Printf("Unable to publish event for project %s: %s\n", data.Project, err)
+	}
 }
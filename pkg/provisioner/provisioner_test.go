@@ -1,17 +1,21 @@
 package provisioner
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/audit"
 	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
 	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestProvisionHandler_CreateRepository(t *testing.T) {
@@ -123,7 +127,7 @@ func TestProvisionHandler_InvalidRequestBody(t *testing.T) {
 	provisioner.EXPECT().DeleteRepository("", "").Times(1).Return(ErrInvalidRequest)
 
 	handler := ProvisionHandler{
-		provisioner,
+		Provisioner: provisioner,
 	}
 
 	tests := []struct {
@@ -191,7 +195,7 @@ func TestProvisionHandler_UnresponsiveUpstream(t *testing.T) {
 	provisioner.EXPECT().DeleteRepository("keptn", "test").Times(1).Return(fmt.Errorf("upstream error"))
 
 	handler := ProvisionHandler{
-		provisioner,
+		Provisioner: provisioner,
 	}
 
 	tests := []struct {
@@ -222,3 +226,555 @@ func TestProvisionHandler_UnresponsiveUpstream(t *testing.T) {
 	}
 
 }
+
+// namingProvisioner adds the ObjectNamer interface to a mocked GitProvisioner
+type namingProvisioner struct {
+	*fake.MockGitProvisioner
+}
+
+func (n namingProvisioner) GiteaObjects(namespace string, project string) GiteaObjects {
+	return GiteaObjects{User: namespace, Repository: project, AccessToken: project}
+}
+
+func TestProvisionHandler_Audit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	trustedProxies, err := audit.ParseTrustedProxies([]string{"10.0.0.1"})
+	require.NoError(t, err)
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	handler := ProvisionHandler{
+		Provisioner:    namingProvisioner{provisioner},
+		Audit:          audit.NewRecorder(sink),
+		TrustedProxies: trustedProxies,
+	}
+
+	provisioner.EXPECT().ProvisionRepository("", "test").Times(1).Return(&keptn.ProvisionResponse{}, nil)
+	provisioner.EXPECT().DeleteRepository("keptn", "test").Times(1).Return(ErrRepositoryDoesNotExist)
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"project":"test"}`))
+	request.RemoteAddr = "10.0.0.1:43210"
+	request.Header.Set("X-Forwarded-User", "alice")
+	handler.HandleProvisionRepoRequest(httptest.NewRecorder(), request)
+
+	request, _ = http.NewRequest(http.MethodDelete, "/repository", strings.NewReader(`{"namespace":"keptn","project":"test"}`))
+	handler.HandleProvisionRepoRequest(httptest.NewRecorder(), request)
+
+	request, _ = http.NewRequest(http.MethodDelete, "/repository", strings.NewReader(`invalid`))
+	handler.HandleProvisionRepoRequest(httptest.NewRecorder(), request)
+
+	events, err := sink.Query(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	assert.Equal(t, audit.ActionProvision, events[0].Action)
+	assert.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+	assert.Equal(t, http.StatusCreated, events[0].StatusCode)
+	assert.Equal(t, "alice", events[0].Caller)
+	assert.Equal(t, "10.0.0.1", events[0].SourceIP)
+	assert.Equal(t, DefaultKeptnNamespace, events[0].Namespace)
+	assert.Equal(t, "keptn", events[0].GiteaUser)
+	assert.Equal(t, "test", events[0].GiteaRepository)
+
+	assert.Equal(t, audit.ActionDelete, events[1].Action)
+	assert.Equal(t, audit.OutcomeRejected, events[1].Outcome)
+	assert.Equal(t, ErrRepositoryDoesNotExist.Error(), events[1].Error)
+	assert.Empty(t, events[1].GiteaRepository)
+
+	assert.Equal(t, http.StatusBadRequest, events[2].StatusCode)
+	assert.NotEmpty(t, events[2].Error)
+}
+
+func TestProvisionHandler_Events(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	var eventTypes []string
+	var data []keptn.UpstreamEventData
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			Type string                  `json:"type"`
+			Data keptn.UpstreamEventData `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		eventTypes = append(eventTypes, event.Type)
+		data = append(data, event.Data)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"keptnContext":"context"}`))
+	}))
+	defer server.Close()
+
+	publisher, err := keptn.NewEventPublisher(server.URL+"/api", "token")
+	require.NoError(t, err)
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	handler := ProvisionHandler{
+		Provisioner: provisioner,
+		Events:      publisher,
+	}
+
+	provisioner.EXPECT().ProvisionRepository("keptn", "test").Times(1).Return(&keptn.ProvisionResponse{
+		GitRemoteURL: "http://gitea:3000/keptn/test.git",
+		GitUser:      "keptn",
+		GitToken:     "secret-token",
+	}, nil)
+	provisioner.EXPECT().DeleteRepository("keptn", "test").Times(1).Return(nil)
+	provisioner.EXPECT().DeleteRepository("keptn", "test").Times(1).Return(fmt.Errorf("upstream error"))
+	provisioner.EXPECT().ProvisionRepository("keptn", "test").Times(1).Return(nil, ErrRepositoryAlreadyExists)
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"namespace":"keptn","project":"test"}`))
+	handler.HandleProvisionRepoRequest(httptest.NewRecorder(), request)
+
+	for i := 0; i < 2; i++ {
+		request, _ = http.NewRequest(http.MethodDelete, "/repository", strings.NewReader(`{"namespace":"keptn","project":"test"}`))
+		handler.HandleProvisionRepoRequest(httptest.NewRecorder(), request)
+	}
+
+	// Rejected requests didn't touch Gitea and are not reported as failure
+	request, _ = http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"namespace":"keptn","project":"test"}`))
+	response := httptest.NewRecorder()
+	handler.HandleProvisionRepoRequest(response, request)
+	require.Equal(t, http.StatusConflict, response.Code)
+
+	// The events are sent in the background
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, publisher.Flush(ctx))
+
+	require.Equal(t, []string{
+		keptn.UpstreamProvisionedEventType,
+		keptn.UpstreamDeletedEventType,
+		keptn.UpstreamFailedEventType,
+	}, eventTypes)
+	assert.Equal(t, "http://gitea:3000/keptn/test.git", data[0].GitRemoteURL)
+	assert.Equal(t, "upstream error", data[2].Message)
+	assert.Equal(t, "delete", data[2].Action)
+}
+
+// planningProvisioner adds the Planner interface to a mocked GitProvisioner, the plans are computed by the functions
+type planningProvisioner struct {
+	*fake.MockGitProvisioner
+	planProvision func(namespace string, project string) (*Plan, error)
+	planDelete    func(namespace string, project string) (*Plan, error)
+}
+
+func (p planningProvisioner) PlanProvision(namespace string, project string) (*Plan, error) {
+	return p.planProvision(namespace, project)
+}
+
+func (p planningProvisioner) PlanDelete(namespace string, project string) (*Plan, error) {
+	return p.planDelete(namespace, project)
+}
+
+func TestProvisionHandler_DryRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// The mocked provisioner fails the test if it is called
+	handler := ProvisionHandler{
+		Provisioner: planningProvisioner{
+			MockGitProvisioner: fake.NewMockGitProvisioner(mockCtrl),
+			planProvision: func(namespace string, project string) (*Plan, error) {
+				plan := newPlan(audit.ActionProvision, namespace, project)
+				plan.add(PlanCreate, ObjectRepository, project, "")
+				return plan, nil
+			},
+			planDelete: func(namespace string, project string) (*Plan, error) {
+				return nil, ErrRepositoryDoesNotExist
+			},
+		},
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"project":"test"}`))
+	request.Header.Set(DryRunHeader, "true")
+	recorder := httptest.NewRecorder()
+	handler.HandleProvisionRepoRequest(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	plan := &Plan{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), plan))
+	assert.True(t, plan.DryRun)
+	assert.Equal(t, DefaultKeptnNamespace, plan.Namespace)
+	assert.Equal(t, []PlannedChange{{Action: PlanCreate, Object: ObjectRepository, Name: "test"}}, plan.Changes)
+
+	// Errors of a plan result in the same status code as the actual request
+	request, _ = http.NewRequest(http.MethodDelete, "/repository", strings.NewReader(`{"project":"test"}`))
+	request.Header.Set(DryRunHeader, "1")
+	recorder = httptest.NewRecorder()
+	handler.HandleProvisionRepoRequest(recorder, request)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	request, _ = http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"project":"test"}`))
+	request.Header.Set(DryRunHeader, "maybe")
+	recorder = httptest.NewRecorder()
+	handler.HandleProvisionRepoRequest(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestProvisionHandler_DryRunServiceWide(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	policy, err := NewAdmissionPolicy(PolicyOptions{DeniedProjects: []string{"denied"}}, nil)
+	require.NoError(t, err)
+
+	handler := ProvisionHandler{
+		Provisioner: planningProvisioner{
+			MockGitProvisioner: fake.NewMockGitProvisioner(mockCtrl),
+			planProvision: func(namespace string, project string) (*Plan, error) {
+				return newPlan(audit.ActionProvision, namespace, project), nil
+			},
+		},
+		Policy: policy,
+		DryRun: true,
+	}
+
+	// The header can't disable the dry run of the handler
+	request, _ := http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"project":"test"}`))
+	request.Header.Set(DryRunHeader, "false")
+	recorder := httptest.NewRecorder()
+	handler.HandleProvisionRepoRequest(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// The admission policy is evaluated in dry runs
+	request, _ = http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"project":"denied"}`))
+	recorder = httptest.NewRecorder()
+	handler.HandleProvisionRepoRequest(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestProvisionHandler_DryRunNotSupported(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	handler := ProvisionHandler{
+		Provisioner: fake.NewMockGitProvisioner(mockCtrl),
+		DryRun:      true,
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, "/repository", strings.NewReader(`{"project":"test"}`))
+	recorder := httptest.NewRecorder()
+	handler.HandleProvisionRepoRequest(recorder, request)
+	assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+}
+
+func TestProvisionHandler_RestoreRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	handler := ProvisionHandler{
+		Provisioner: provisioner,
+	}
+
+	provisioner.EXPECT().RestoreRepository("keptn", "test").Times(1).Return(&keptn.ProvisionResponse{
+		GitRemoteURL: "http://some.git.server:9999/user-keptn/repository-test",
+		GitToken:     "8399p4q8cbunq983N489VNB2Q89T7B09",
+		GitUser:      "user-keptn",
+	}, nil)
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository/restore", strings.NewReader(`{"namespace":"keptn","project":"test"}`))
+	response := httptest.NewRecorder()
+	handler.HandleRestoreRequest(response, request)
+	require.Equal(t, http.StatusCreated, response.Code)
+
+	var responseBody keptn.ProvisionResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &responseBody))
+	assert.Equal(t, "8399p4q8cbunq983N489VNB2Q89T7B09", responseBody.GitToken)
+}
+
+func TestProvisionHandler_RestoreRepositoryError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{err: ErrNothingToRestore, code: http.StatusNotFound},
+		{err: ErrRepositoryAlreadyExists, code: http.StatusConflict},
+		{err: fmt.Errorf("%w: invalid name", ErrInvalidRequest), code: http.StatusUnprocessableEntity},
+		{err: fmt.Errorf("unable to push"), code: http.StatusFailedDependency},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err.Error(), func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			provisioner := fake.NewMockGitProvisioner(mockCtrl)
+			handler := ProvisionHandler{
+				Provisioner: provisioner,
+			}
+
+			provisioner.EXPECT().RestoreRepository("keptn", "test").Times(1).Return(nil, test.err)
+
+			request, _ := http.NewRequest(http.MethodPost, "/repository/restore", strings.NewReader(`{"namespace":"keptn","project":"test"}`))
+			response := httptest.NewRecorder()
+			handler.HandleRestoreRequest(response, request)
+			assert.Equal(t, test.code, response.Code)
+		})
+	}
+}
+
+func TestProvisionHandler_RestoreInvalidRequest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	handler := ProvisionHandler{
+		Provisioner: fake.NewMockGitProvisioner(mockCtrl),
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, "/repository/restore", strings.NewReader(`{"project":"test"}`))
+	recorder := httptest.NewRecorder()
+	handler.HandleRestoreRequest(recorder, request)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	// Restores can't be planned
+	request, _ = http.NewRequest(http.MethodPost, "/repository/restore", strings.NewReader(`{"project":"test"}`))
+	request.Header.Set(DryRunHeader, "true")
+	recorder = httptest.NewRecorder()
+	handler.HandleRestoreRequest(recorder, request)
+	assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+}
+
+func TestProvisionHandler_RenameRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	handler := ProvisionHandler{
+		Provisioner: provisioner,
+	}
+
+	provisioner.EXPECT().RenameRepository("keptn", "test", "renamed").Times(1).Return(&keptn.RenameResponse{
+		ProvisionResponse: keptn.ProvisionResponse{
+			GitRemoteURL: "http://some.git.server:9999/user-keptn/repository-renamed",
+			GitToken:     "8399p4q8cbunq983N489VNB2Q89T7B09",
+			GitUser:      "user-keptn",
+		},
+		PreviousGitRemoteURL: "http://some.git.server:9999/user-keptn/repository-test",
+		Redirect:             "redirected",
+	}, nil)
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository/rename", strings.NewReader(`{"namespace":"keptn","project":"test","newProject":"renamed"}`))
+	response := httptest.NewRecorder()
+	handler.HandleRenameRequest(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var responseBody map[string]string
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &responseBody))
+	assert.Equal(t, map[string]string{
+		"gitRemoteURL":         "http://some.git.server:9999/user-keptn/repository-renamed",
+		"gitToken":             "8399p4q8cbunq983N489VNB2Q89T7B09",
+		"gitUser":              "user-keptn",
+		"previousGitRemoteURL": "http://some.git.server:9999/user-keptn/repository-test",
+		"redirect":             "redirected",
+	}, responseBody)
+}
+
+func TestProvisionHandler_RenameRepositoryError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{err: ErrRepositoryDoesNotExist, code: http.StatusNotFound},
+		{err: ErrRepositoryAlreadyExists, code: http.StatusConflict},
+		{err: fmt.Errorf("%w: empty name", ErrInvalidRequest), code: http.StatusUnprocessableEntity},
+		{err: fmt.Errorf("unable to create access token"), code: http.StatusFailedDependency},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err.Error(), func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			provisioner := fake.NewMockGitProvisioner(mockCtrl)
+			handler := ProvisionHandler{
+				Provisioner: provisioner,
+			}
+
+			provisioner.EXPECT().RenameRepository("keptn", "test", "renamed").Times(1).Return(nil, test.err)
+
+			request, _ := http.NewRequest(http.MethodPost, "/repository/rename", strings.NewReader(`{"namespace":"keptn","project":"test","newProject":"renamed"}`))
+			response := httptest.NewRecorder()
+			handler.HandleRenameRequest(response, request)
+			assert.Equal(t, test.code, response.Code)
+		})
+	}
+}
+
+func TestProvisionHandler_RenameRepositoryAuditAndEvents(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	var eventTypes []string
+	var data []keptn.UpstreamEventData
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			Type string                  `json:"type"`
+			Data keptn.UpstreamEventData `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		eventTypes = append(eventTypes, event.Type)
+		data = append(data, event.Data)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"keptnContext":"context"}`))
+	}))
+	defer server.Close()
+
+	publisher, err := keptn.NewEventPublisher(server.URL+"/api", "token")
+	require.NoError(t, err)
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	handler := ProvisionHandler{
+		Provisioner: namingProvisioner{provisioner},
+		Audit:       audit.NewRecorder(sink),
+		Events:      publisher,
+	}
+
+	provisioner.EXPECT().RenameRepository("keptn", "test", "renamed").Times(1).Return(&keptn.RenameResponse{
+		ProvisionResponse: keptn.ProvisionResponse{GitRemoteURL: "http://gitea:3000/keptn/renamed.git", GitUser: "keptn"},
+	}, nil)
+	provisioner.EXPECT().RenameRepository("keptn", "test", "renamed").Times(1).Return(nil, fmt.Errorf("unable to create access token"))
+
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequest(http.MethodPost, "/repository/rename", strings.NewReader(`{"namespace":"keptn","project":"test","newProject":"renamed"}`))
+		handler.HandleRenameRequest(httptest.NewRecorder(), request)
+	}
+
+	// The events are sent in the background
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, publisher.Flush(ctx))
+
+	require.Equal(t, []string{keptn.UpstreamProvisionedEventType, keptn.UpstreamFailedEventType}, eventTypes)
+	assert.Equal(t, "renamed", data[0].Project)
+	assert.Equal(t, audit.ActionRename, data[0].Action)
+	assert.Equal(t, "http://gitea:3000/keptn/renamed.git", data[0].GitRemoteURL)
+	assert.Equal(t, "renamed", data[1].Project)
+	assert.Equal(t, "unable to create access token", data[1].Message)
+
+	// The audit trail contains the Gitea objects of the new project
+	events, err := sink.Query(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	for _, event := range events {
+		assert.Equal(t, audit.ActionRename, event.Action)
+		assert.Equal(t, "test", event.Project)
+		assert.Equal(t, "renamed", event.NewProject)
+		assert.Equal(t, "renamed", event.GiteaRepository)
+		assert.Equal(t, "renamed", event.GiteaAccessToken)
+	}
+	assert.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+	assert.Equal(t, audit.OutcomeFailed, events[1].Outcome)
+}
+
+func TestProvisionHandler_Async(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	queue := NewJobQueue(JobOptions{})
+	handler := ProvisionHandler{
+		Provisioner: provisioner,
+		Audit:       audit.NewRecorder(sink),
+		Jobs:        queue,
+	}
+
+	provisioner.EXPECT().ProvisionRepository("keptn", "test").Times(1).Return(&keptn.ProvisionResponse{
+		GitRemoteURL: "http://some.git.server:9999/user-keptn/repository-test",
+		GitToken:     "8399p4q8cbunq983N489VNB2Q89T7B09",
+		GitUser:      "user-keptn",
+	}, nil)
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"namespace":"keptn","project":"test"}`))
+	request.Header.Set(AsyncHeader, "true")
+	response := httptest.NewRecorder()
+
+	handler.HandleProvisionRepoRequest(response, request)
+	require.Equal(t, http.StatusAccepted, response.Code)
+
+	accepted := Job{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &accepted))
+	assert.Equal(t, JobsPath+accepted.ID, response.Header().Get("Location"))
+	assert.Equal(t, JobQueued, accepted.Status)
+	assert.Equal(t, "keptn", accepted.Namespace)
+	assert.Equal(t, "test", accepted.Project)
+
+	runJobQueue(t, queue)
+	job := waitForJob(t, queue, accepted.ID)
+	assert.Equal(t, JobSucceeded, job.Status)
+	assert.Equal(t, http.StatusCreated, job.StatusCode)
+
+	result := keptn.ProvisionResponse{}
+	require.NoError(t, json.Unmarshal(job.Response, &result))
+	assert.Equal(t, "user-keptn", result.GitUser)
+
+	// The job is audited with the outcome of the provisioning instead of its acceptance
+	events, err := sink.Query(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, http.StatusCreated, events[0].StatusCode)
+}
+
+func TestProvisionHandler_AsyncInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		content string
+		jobs    *JobQueue
+		code    int
+	}{
+		{name: "invalid header", header: "maybe", content: `{"project":"test"}`, jobs: NewJobQueue(JobOptions{}), code: http.StatusBadRequest},
+		{name: "invalid body", header: "true", content: `invalid`, jobs: NewJobQueue(JobOptions{}), code: http.StatusBadRequest},
+		{name: "no job queue", header: "true", content: `{"project":"test"}`, code: http.StatusNotImplemented},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := ProvisionHandler{
+				Jobs: test.jobs,
+			}
+
+			request, _ := http.NewRequest(http.MethodPost, "/repository", strings.NewReader(test.content))
+			request.Header.Set(AsyncHeader, test.header)
+			response := httptest.NewRecorder()
+
+			handler.HandleProvisionRepoRequest(response, request)
+			assert.Equal(t, test.code, response.Code)
+		})
+	}
+}
+
+func TestProvisionHandler_AsyncQueueFull(t *testing.T) {
+	queue := NewJobQueue(JobOptions{QueueSize: 1})
+	handler := ProvisionHandler{
+		Jobs: queue,
+	}
+
+	codes := make([]int, 2)
+	for i := range codes {
+		request, _ := http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"project":"test"}`))
+		request.Header.Set(AsyncHeader, "true")
+		response := httptest.NewRecorder()
+
+		handler.HandleProvisionRepoRequest(response, request)
+		codes[i] = response.Code
+	}
+
+	assert.Equal(t, []int{http.StatusAccepted, http.StatusServiceUnavailable}, codes)
+}
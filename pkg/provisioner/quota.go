@@ -0,0 +1,139 @@
+package provisioner
+
+import (
+	"fmt"
+	"net/http"
+
+	"code.gitea.io/sdk/gitea"
+)
+
+// Quotas that can be exceeded by a namespace, the name of the exceeded quota is returned to the client
+const (
+	QuotaMaxRepositories = "maxRepositories"
+	QuotaMaxTotalSize    = "maxTotalSize"
+)
+
+// QuotaOptions limits the resources a single Keptn namespace can use in Gitea, zero values disable a limit
+type QuotaOptions struct {
+	// MaxRepositories limits the number of repositories of a namespace, it is also set as MaxRepoCreation of the
+	// users created by the provisioner
+	MaxRepositories int
+	// MaxTotalSizeKB limits the summed up size of all repositories of a namespace in kilobytes, as reported by Gitea
+	MaxTotalSizeKB int64
+	// StatusCode is returned when a quota is exceeded, either 403 (default) or 429
+	StatusCode int
+	// MaxProjectsPerNamespace is the maxProjectsPerNamespace rule of the admission policy. The policy only counts the
+	// projects before the namespace is locked, so the rule is evaluated again with the quotas and returned as
+	// *PolicyViolation.
+	MaxProjectsPerNamespace int
+}
+
+// QuotaExceededError is returned if a namespace can't provision another repository without exceeding a quota
+type QuotaExceededError struct {
+	// Quota is the name of the exceeded quota
+	Quota string
+	// Usage and Limit of the exceeded quota
+	Usage int64
+	Limit int64
+	// Namespace that exceeded the quota
+	Namespace string
+	// StatusCode is the status code that is returned to the client
+	StatusCode int
+}
+
+// Error returns a message that contains the exceeded quota and the current usage
+func (q *QuotaExceededError) Error() string {
+	return fmt.Sprintf("namespace %s exceeded quota %s (usage: %d, limit: %d)", q.Namespace, q.Quota, q.Usage, q.Limit)
+}
+
+// enabled returns true if at least one quota is configured
+func (q QuotaOptions) enabled() bool {
+	return q.MaxRepositories > 0 || q.MaxTotalSizeKB > 0 || q.MaxProjectsPerNamespace > 0
+}
+
+// statusCode returns the configured status code, 403 if none is configured
+func (q QuotaOptions) statusCode() int {
+	if q.StatusCode == 0 {
+		return http.StatusForbidden
+	}
+
+	return q.StatusCode
+}
+
+// checkQuota returns a *QuotaExceededError if the namespace can't provision another repository, or a *PolicyViolation
+// if it reached the maxProjectsPerNamespace rule. It must be called while holding the lock of the namespace, such that
+// concurrent requests can't exceed the quota together.
+func (h *GiteaProvisioner) checkQuota(namespace string) error {
+	if !h.quota.enabled() {
+		return nil
+	}
+
+	all, err := h.ListUserRepositories(h.GetUsername(namespace))
+	if err != nil {
+		return fmt.Errorf("unable to query the quota usage of namespace %s: %w", namespace, err)
+	}
+
+	// Archived repositories belong to deleted projects and don't count towards the quotas
+	var repositories []*gitea.Repository
+	for _, repository := range all {
+		if !repository.Archived {
+			repositories = append(repositories, repository)
+		}
+	}
+
+	if h.quota.MaxProjectsPerNamespace > 0 && len(repositories) >= h.quota.MaxProjectsPerNamespace {
+		return maxProjectsViolation(namespaceOrDefault(namespace), len(repositories), h.quota.MaxProjectsPerNamespace)
+	}
+
+	if h.quota.MaxRepositories > 0 && len(repositories) >= h.quota.MaxRepositories {
+		return &QuotaExceededError{
+			Quota:      QuotaMaxRepositories,
+			Usage:      int64(len(repositories)),
+			Limit:      int64(h.quota.MaxRepositories),
+			Namespace:  namespaceOrDefault(namespace),
+			StatusCode: h.quota.statusCode(),
+		}
+	}
+
+	var totalSize int64
+	for _, repository := range repositories {
+		totalSize += int64(repository.Size)
+	}
+
+	if h.quota.MaxTotalSizeKB > 0 && totalSize >= h.quota.MaxTotalSizeKB {
+		return &QuotaExceededError{
+			Quota:      QuotaMaxTotalSize,
+			Usage:      totalSize,
+			Limit:      h.quota.MaxTotalSizeKB,
+			Namespace:  namespaceOrDefault(namespace),
+			StatusCode: h.quota.statusCode(),
+		}
+	}
+
+	return nil
+}
+
+// applyUserQuota sets the repository limit on a user created by the provisioner, such that the user can't exceed the
+// quota with its own access token either
+func (h *GiteaProvisioner) applyUserQuota(username string) error {
+	if h.quota.MaxRepositories <= 0 {
+		return nil
+	}
+
+	maxRepositories := h.quota.MaxRepositories
+	r, err := h.client.AdminEditUser(username, gitea.EditUserOption{
+		LoginName:       username,
+		MaxRepoCreation: &maxRepositories,
+	})
+	if err != nil && r == nil {
+		return fmt.Errorf("unable to set the repository limit of user %s: %w", username, err)
+	}
+
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to set the repository limit of user %s, received unexpected status code: %d",
+			username, r.StatusCode,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package provisioner
+
+import (
+	"code.gitea.io/sdk/gitea"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGiteaProvisioner_QuotaMaxRepositories(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+		quota:  QuotaOptions{MaxRepositories: 2},
+	}
+
+	giteaClient.EXPECT().ListUserRepos("keptn", gomock.Any()).Times(1).Return([]*gitea.Repository{{}, {}}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminCreateRepo(gomock.Any(), gomock.Any()).Times(0)
+
+	_, err := giteaProvisioner.ProvisionRepository("keptn", "project")
+
+	var quotaErr *QuotaExceededError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, QuotaMaxRepositories, quotaErr.Quota)
+	assert.Equal(t, int64(2), quotaErr.Usage)
+	assert.Equal(t, http.StatusForbidden, quotaErr.StatusCode)
+}
+
+func TestGiteaProvisioner_QuotaMaxProjectsPerNamespace(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+		quota:  QuotaOptions{MaxProjectsPerNamespace: 2},
+	}
+
+	// The project admitted by the policy of a concurrent request is counted while holding the namespace lock
+	giteaClient.EXPECT().ListUserRepos("keptn", gomock.Any()).Times(1).Return([]*gitea.Repository{{}, {}, {Archived: true}}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminCreateRepo(gomock.Any(), gomock.Any()).Times(0)
+
+	_, err := giteaProvisioner.ProvisionRepository("keptn", "project")
+
+	var violation *PolicyViolation
+	require.True(t, errors.As(err, &violation))
+	assert.Equal(t, RuleMaxProjectsPerNamespace, violation.Rule)
+	assert.Equal(t, http.StatusForbidden, violation.StatusCode)
+	assert.Contains(t, violation.Message, "already has 2 of 2 allowed projects")
+
+	giteaClient.EXPECT().ListUserRepos("keptn", gomock.Any()).Times(1).Return([]*gitea.Repository{{}, {Archived: true}}, createResponse(http.StatusOK), nil)
+	require.NoError(t, giteaProvisioner.checkQuota("keptn"))
+}
+
+func TestGiteaProvisioner_QuotaMaxTotalSize(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+		quota:  QuotaOptions{MaxTotalSizeKB: 1024, StatusCode: http.StatusTooManyRequests},
+	}
+
+	giteaClient.EXPECT().ListUserRepos("keptn", gomock.Any()).Times(1).Return([]*gitea.Repository{{Size: 512}, {Size: 512}}, createResponse(http.StatusOK), nil)
+
+	var quotaErr *QuotaExceededError
+	require.True(t, errors.As(giteaProvisioner.checkQuota("keptn"), &quotaErr))
+	assert.Equal(t, QuotaMaxTotalSize, quotaErr.Quota)
+	assert.Equal(t, http.StatusTooManyRequests, quotaErr.StatusCode)
+
+	giteaClient.EXPECT().ListUserRepos("keptn", gomock.Any()).Times(1).Return([]*gitea.Repository{{Size: 512}}, createResponse(http.StatusOK), nil)
+	require.NoError(t, giteaProvisioner.checkQuota("keptn"))
+
+	// A namespace without user has no usage
+	giteaClient.EXPECT().ListUserRepos("keptn", gomock.Any()).Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	require.NoError(t, giteaProvisioner.checkQuota("keptn"))
+}
+
+func TestGiteaProvisioner_QuotaIgnoresArchived(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+		quota:  QuotaOptions{MaxRepositories: 2, MaxTotalSizeKB: 1024},
+	}
+
+	giteaClient.EXPECT().ListUserRepos("keptn", gomock.Any()).Times(1).Return([]*gitea.Repository{
+		{Size: 512},
+		{Size: 2048, Archived: true},
+		{Size: 2048, Archived: true},
+	}, createResponse(http.StatusOK), nil)
+
+	require.NoError(t, giteaProvisioner.checkQuota("keptn"))
+}
+
+func TestGiteaProvisioner_CreateUserSetsRepositoryLimit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client: giteaClient,
+		quota:  QuotaOptions{MaxRepositories: 3},
+	}
+
+	maxRepositories := 3
+	giteaClient.EXPECT().GetUserInfo("keptn").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+	giteaClient.EXPECT().AdminCreateUser(gomock.Any()).Times(1).Return(nil, createResponse(http.StatusCreated), nil)
+	giteaClient.EXPECT().AdminEditUser("keptn", gitea.EditUserOption{
+		LoginName:       "keptn",
+		MaxRepoCreation: &maxRepositories,
+	}).Times(1).Return(createResponse(http.StatusOK), nil)
+
+	_, err := giteaProvisioner.CreateUser("keptn")
+	require.NoError(t, err)
+}
+
+func TestProvisionHandler_QuotaExceeded(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	provisioner.EXPECT().ProvisionRepository("keptn", "project").Times(1).Return(nil, &QuotaExceededError{
+		Quota:      QuotaMaxRepositories,
+		Usage:      2,
+		Limit:      2,
+		Namespace:  "keptn",
+		StatusCode: http.StatusTooManyRequests,
+	})
+
+	handler := ProvisionHandler{
+		Provisioner: provisioner,
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository",
+		strings.NewReader(`{"namespace":"keptn","project":"project"}`),
+	)
+	response := httptest.NewRecorder()
+
+	handler.HandleProvisionRepoRequest(response, request)
+	require.Equal(t, http.StatusTooManyRequests, response.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	assert.Equal(t, QuotaMaxRepositories, body["quota"])
+	assert.Equal(t, QuotaMaxRepositories, body["rule"])
+	assert.Equal(t, float64(2), body["limit"])
+}
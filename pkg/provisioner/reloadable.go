@@ -0,0 +1,102 @@
+package provisioner
+
+import (
+	"context"
+	"sync"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+)
+
+// The ReloadableProvisioner delegates to a GiteaProvisioner that can be swapped at runtime, e.g. when the credentials
+// have been rotated. Operations that already started keep using the provisioner they started with, such that no
+// in-flight request is dropped by a swap. Provisioners that are swapped in should share the same NamespaceLocker.
+type ReloadableProvisioner struct {
+	mutex   sync.RWMutex
+	current *GiteaProvisioner
+}
+
+// NewReloadableProvisioner creates a ReloadableProvisioner that initially delegates to the given provisioner
+func NewReloadableProvisioner(provisioner *GiteaProvisioner) *ReloadableProvisioner {
+	return &ReloadableProvisioner{current: provisioner}
+}
+
+// Current returns the provisioner new operations are delegated to
+func (r *ReloadableProvisioner) Current() *GiteaProvisioner {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.current
+}
+
+// Swap replaces the provisioner new operations are delegated to
+func (r *ReloadableProvisioner) Swap(provisioner *GiteaProvisioner) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.current = provisioner
+}
+
+// ProvisionRepository delegates to GiteaProvisioner.ProvisionRepository of the current provisioner
+func (r *ReloadableProvisioner) ProvisionRepository(namespace string, project string) (*keptn.ProvisionResponse, error) {
+	return r.Current().ProvisionRepository(namespace, project)
+}
+
+// DeleteRepository delegates to GiteaProvisioner.DeleteRepository of the current provisioner
+func (r *ReloadableProvisioner) DeleteRepository(namespace string, project string) error {
+	return r.Current().DeleteRepository(namespace, project)
+}
+
+// RestoreRepository delegates to GiteaProvisioner.RestoreRepository of the current provisioner
+func (r *ReloadableProvisioner) RestoreRepository(namespace string, project string) (*keptn.ProvisionResponse, error) {
+	return r.Current().RestoreRepository(namespace, project)
+}
+
+// RenameRepository delegates to GiteaProvisioner.RenameRepository of the current provisioner
+func (r *ReloadableProvisioner) RenameRepository(namespace string, project string, newProject string) (*keptn.RenameResponse, error) {
+	return r.Current().RenameRepository(namespace, project, newProject)
+}
+
+// PlanProvision delegates to GiteaProvisioner.PlanProvision of the current provisioner
+func (r *ReloadableProvisioner) PlanProvision(namespace string, project string) (*Plan, error) {
+	return r.Current().PlanProvision(namespace, project)
+}
+
+// PlanDelete delegates to GiteaProvisioner.PlanDelete of the current provisioner
+func (r *ReloadableProvisioner) PlanDelete(namespace string, project string) (*Plan, error) {
+	return r.Current().PlanDelete(namespace, project)
+}
+
+// PurgeGraveyard delegates to GiteaProvisioner.PurgeGraveyard of the current provisioner
+func (r *ReloadableProvisioner) PurgeGraveyard(ctx context.Context) error {
+	return r.Current().PurgeGraveyard(ctx)
+}
+
+// CountProjects delegates to GiteaProvisioner.CountProjects of the current provisioner
+func (r *ReloadableProvisioner) CountProjects(namespace string) (int, error) {
+	return r.Current().CountProjects(namespace)
+}
+
+// GiteaObjects delegates to GiteaProvisioner.GiteaObjects of the current provisioner
+func (r *ReloadableProvisioner) GiteaObjects(namespace string, project string) GiteaObjects {
+	return r.Current().GiteaObjects(namespace, project)
+}
+
+// CheckHealth delegates to GiteaProvisioner.CheckHealth of the current provisioner
+func (r *ReloadableProvisioner) CheckHealth() error {
+	return r.Current().CheckHealth()
+}
+
+// CleanupOrphanedUsers delegates to GiteaProvisioner.CleanupOrphanedUsers of the current provisioner
+func (r *ReloadableProvisioner) CleanupOrphanedUsers(ctx context.Context) error {
+	return r.Current().CleanupOrphanedUsers(ctx)
+}
+
+// SweepStaleTokens delegates to GiteaProvisioner.SweepStaleTokens of the current provisioner
+func (r *ReloadableProvisioner) SweepStaleTokens(ctx context.Context) error {
+	return r.Current().SweepStaleTokens(ctx)
+}
+
+// LogInventory delegates to GiteaProvisioner.LogInventory of the current provisioner
+func (r *ReloadableProvisioner) LogInventory(ctx context.Context) error {
+	return r.Current().LogInventory(ctx)
+}
@@ -0,0 +1,46 @@
+package provisioner
+
+import (
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+	"net/http"
+	"testing"
+)
+
+func TestReloadableProvisioner_Swap(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	oldClient := fake.NewMockGiteaClient(mockCtrl)
+	newClient := fake.NewMockGiteaClient(mockCtrl)
+	oldProvisioner := &GiteaProvisioner{client: oldClient}
+	newProvisioner := &GiteaProvisioner{client: newClient}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	oldClient.EXPECT().GetMyUserInfo().Times(1).DoAndReturn(func() (*gitea.User, *gitea.Response, error) {
+		close(started)
+		<-release
+		return &gitea.User{IsAdmin: true}, createResponse(http.StatusOK), nil
+	})
+	newClient.EXPECT().GetMyUserInfo().Times(1).Return(&gitea.User{IsAdmin: true}, createResponse(http.StatusOK), nil)
+
+	reloadable := NewReloadableProvisioner(oldProvisioner)
+
+	inFlight := make(chan error)
+	go func() {
+		inFlight <- reloadable.CheckHealth()
+	}()
+	<-started
+
+	// Swapping while an operation is in-flight lets it finish with the old provisioner
+	reloadable.Swap(newProvisioner)
+	assert.Same(t, newProvisioner, reloadable.Current())
+	require.NoError(t, reloadable.CheckHealth())
+
+	close(release)
+	require.NoError(t, <-inFlight)
+}
@@ -0,0 +1,84 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"code.gitea.io/sdk/gitea"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+)
+
+// RenameRepository renames the repository of a project to the repository name of the new project, such that a Keptn
+// project that is recreated under the new name keeps its git history. A token with the name of the new project is
+// issued and the access token of the old project is revoked afterwards.
+func (h *GiteaProvisioner) RenameRepository(namespace string, project string, newProject string) (*keptn.RenameResponse, error) {
+	if project == "" || newProject == "" {
+		return nil, fmt.Errorf("%w: unable to rename a project from or to an empty name", ErrInvalidRequest)
+	}
+
+	if project == newProject {
+		return nil, fmt.Errorf("%w: the project already has the name %s", ErrInvalidRequest, newProject)
+	}
+
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	username := h.GetUsername(namespace)
+	repository := h.GetProjectName(project)
+	newRepository := h.GetProjectName(newProject)
+
+	// The old name of a previous rename redirects to the renamed repository, which must not be renamed again
+	existing, err := h.getProjectRepository(username, project)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = h.getRepository(username, newRepository)
+	if err == nil {
+		return nil, fmt.Errorf("%w: %s/%s", ErrRepositoryAlreadyExists, username, newRepository)
+	}
+
+	if !errors.Is(err, ErrRepositoryDoesNotExist) {
+		return nil, err
+	}
+
+	// The description records the project, such that the repository isn't mistaken for the one of the old project
+	description := projectDescription(newProject)
+	renamed, _, err := h.client.EditRepo(username, repository, gitea.EditRepoOption{Name: &newRepository, Description: &description})
+	if err != nil {
+		return nil, fmt.Errorf("unable to rename repository %s/%s to %s: %w", username, repository, newRepository, err)
+	}
+
+	log.Printf("Renamed repository %s/%s of project %s to %s for project %s\n", username, repository, project, newRepository, newProject)
+
+	// The old token is only revoked once the new one exists, the old project keeps working through the redirect
+	// until then and the token of the new project can be issued again with a rotation
+	response, err := h.issueToken(namespace, newProject, renamed.CloneURL)
+	if err != nil {
+		return nil, fmt.Errorf("repository %s/%s has been renamed to %s, but the token of project %s could not be "+
+			"issued and the token of project %s is still valid: %w", username, repository, newRepository, newProject, project, err)
+	}
+
+	if err := h.revokeToken(namespace, project); err != nil {
+		return nil, err
+	}
+
+	if h.credentialSink != nil {
+		if err := h.credentialSink.Delete(namespace, project); err != nil {
+			log.Printf("Unable to delete the credential copy of project %s: %s\n", project, err)
+		}
+	}
+
+	return &keptn.RenameResponse{
+		ProvisionResponse:    *response,
+		PreviousGitRemoteURL: existing.CloneURL,
+		Redirect: fmt.Sprintf("Gitea redirects %s to %s until a repository named %s is created for user %s",
+			existing.CloneURL, renamed.CloneURL, repository, username,
+		),
+	}, nil
+}
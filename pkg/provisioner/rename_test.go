@@ -0,0 +1,133 @@
+package provisioner
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+)
+
+func TestGiteaProvisioner_RenameRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	name := "project-podtato-head"
+	description := projectDescription("podtato-head")
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato", CloneURL: "http://gitea/keptn-dev/project-podtato.git"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato-head").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().EditRepo("keptn-dev", "project-podtato", gitea.EditRepoOption{Name: &name, Description: &description}).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn-dev/project-podtato-head.git"}, createResponse(http.StatusOK), nil)
+	// The old token is revoked after the new one has been created
+	gomock.InOrder(
+		giteaClient.EXPECT().DeleteAccessToken("token-podtato-head").Times(1).Return(createResponse(http.StatusNotFound), errors.New("404 Not Found")),
+		giteaClient.EXPECT().CreateAccessToken(gitea.CreateAccessTokenOption{Name: "token-podtato-head"}).Times(1).Return(&gitea.AccessToken{Token: "new-token"}, createResponse(http.StatusCreated), nil),
+		giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil),
+	)
+
+	response, err := giteaProvisioner.RenameRepository("dev", "podtato", "podtato-head")
+	require.NoError(t, err)
+	assert.Equal(t, "http://gitea/keptn-dev/project-podtato-head.git", response.GitRemoteURL)
+	assert.Equal(t, "new-token", response.GitToken)
+	assert.Equal(t, "http://gitea/keptn-dev/project-podtato.git", response.PreviousGitRemoteURL)
+	assert.Contains(t, response.Redirect, "until a repository named project-podtato is created")
+}
+
+func TestGiteaProvisioner_RenameRepositoryKeepsOldTokenOnFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	name := "project-podtato-head"
+	description := projectDescription("podtato-head")
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato", CloneURL: "http://gitea/keptn-dev/project-podtato.git"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato-head").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().EditRepo("keptn-dev", "project-podtato", gitea.EditRepoOption{Name: &name, Description: &description}).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn-dev/project-podtato-head.git"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato-head").Times(1).Return(createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().CreateAccessToken(gitea.CreateAccessTokenOption{Name: "token-podtato-head"}).Times(1).Return(nil, createResponse(http.StatusInternalServerError), errors.New("500 Internal Server Error"))
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(0)
+
+	_, err := giteaProvisioner.RenameRepository("dev", "podtato", "podtato-head")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the token of project podtato is still valid")
+}
+
+func TestGiteaProvisioner_RenameRepositoryConflicts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	_, err := giteaProvisioner.RenameRepository("dev", "podtato", "podtato")
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+
+	_, err = giteaProvisioner.RenameRepository("dev", "podtato", "")
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-missing").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	_, err = giteaProvisioner.RenameRepository("dev", "missing", "podtato-head")
+	assert.ErrorIs(t, err, ErrRepositoryDoesNotExist)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato-head").Times(1).Return(&gitea.Repository{Name: "project-podtato-head"}, createResponse(http.StatusOK), nil)
+	_, err = giteaProvisioner.RenameRepository("dev", "podtato", "podtato-head")
+	assert.ErrorIs(t, err, ErrRepositoryAlreadyExists)
+}
+
+func TestGiteaProvisioner_RenamedRepositoryRedirect(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	// Gitea redirects the old name to the renamed repository of project podtato-head
+	renamed := &gitea.Repository{Name: "project-podtato-head", Description: projectDescription("podtato-head")}
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").AnyTimes().Return(renamed, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteRepo(gomock.Any(), gomock.Any()).Times(0)
+	giteaClient.EXPECT().EditRepo(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	giteaClient.EXPECT().TransferRepo(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	assert.ErrorIs(t, giteaProvisioner.DeleteRepository("dev", "podtato"), ErrRepositoryDoesNotExist)
+
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyGraveyard}
+	assert.ErrorIs(t, giteaProvisioner.DeleteRepository("dev", "podtato"), ErrRepositoryDoesNotExist)
+
+	_, err := giteaProvisioner.PlanDelete("dev", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryDoesNotExist)
+
+	_, err = giteaProvisioner.TransferRepository("dev", "prod", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryDoesNotExist)
+
+	_, err = giteaProvisioner.RotateToken("dev", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryDoesNotExist)
+
+	// The restore looks for the deleted repository instead of taking over the renamed one
+	giteaClient.EXPECT().ListOrgRepos(DefaultGraveyardOrganization, gomock.Any()).Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	_, err = giteaProvisioner.RestoreRepository("dev", "podtato")
+	assert.ErrorIs(t, err, ErrNothingToRestore)
+}
+
+func TestGiteaProvisioner_DeleteRepositoryOfOtherProject(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	other := &gitea.Repository{Name: "project-podtato", Description: projectDescription("Podtato")}
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(other, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteRepo(gomock.Any(), gomock.Any()).Times(0)
+
+	assert.ErrorIs(t, giteaProvisioner.DeleteRepository("dev", "podtato"), ErrNameCollision)
+}
@@ -0,0 +1,408 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.gitea.io/sdk/gitea"
+)
+
+// ErrUpstreamUnavailable indicates that the Gitea server is considered to be unavailable and requests are not forwarded
+var /*const*/ ErrUpstreamUnavailable = errors.New("the upstream Gitea server is unavailable")
+
+// UpstreamUnavailableError is returned by the ResilientGiteaClient if the circuit breaker is open, it contains the
+// duration after which the request should be retried by the caller
+type UpstreamUnavailableError struct {
+	RetryAfter time.Duration
+}
+
+// Error returns the error message of the UpstreamUnavailableError
+func (e *UpstreamUnavailableError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrUpstreamUnavailable.Error(), e.RetryAfter)
+}
+
+// Is allows errors.Is to match the UpstreamUnavailableError with ErrUpstreamUnavailable
+func (e *UpstreamUnavailableError) Is(target error) bool {
+	return target == ErrUpstreamUnavailable
+}
+
+// RetryAfterSeconds returns the retry duration in full seconds, as required by the Retry-After http header
+func (e *UpstreamUnavailableError) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+
+	return seconds
+}
+
+// ResilienceOptions defines how often and how long requests against Gitea are retried and when the circuit breaker opens
+type ResilienceOptions struct {
+	// MaxRetries is the number of retries for idempotent operations, 0 disables retries
+	MaxRetries int
+	// InitialBackoff is the upper bound of the first (jittered) backoff
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper bound of every (jittered) backoff
+	MaxBackoff time.Duration
+	// FailureThreshold is the number of consecutive failures after which the circuit breaker opens, 0 disables it
+	FailureThreshold int
+	// OpenDuration is the time the circuit breaker stays open before a request is allowed again
+	OpenDuration time.Duration
+}
+
+// CircuitBreaker keeps track of consecutive failures against Gitea and rejects requests for a certain time once the
+// configured failure threshold has been reached
+type CircuitBreaker struct {
+	mutex            sync.Mutex
+	failureThreshold int
+	openDuration     time.Duration
+	failures         int
+	openUntil        time.Time
+	now              func() time.Time
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker, a failureThreshold of 0 creates a breaker that never opens
+func NewCircuitBreaker(failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		now:              time.Now,
+	}
+}
+
+// Allow returns an UpstreamUnavailableError if the circuit breaker is open, otherwise nil. Once the open duration has
+// elapsed a single trial request is let through (half-open), which either closes or re-opens the breaker.
+func (b *CircuitBreaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failureThreshold <= 0 || b.failures < b.failureThreshold {
+		return nil
+	}
+
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return &UpstreamUnavailableError{RetryAfter: b.openUntil.Sub(now)}
+	}
+
+	// Half-open: block everyone else until the trial request reports back
+	b.openUntil = now.Add(b.openDuration)
+	return nil
+}
+
+// Success resets the consecutive failure counter and closes the circuit breaker
+func (b *CircuitBreaker) Success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures = 0
+}
+
+// Failure records a failure and opens the circuit breaker if the threshold has been reached
+func (b *CircuitBreaker) Failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+	if b.failureThreshold > 0 && b.failures == b.failureThreshold {
+		b.openUntil = b.now().Add(b.openDuration)
+	}
+}
+
+// ResilientGiteaClient decorates a GiteaClient and retries idempotent operations on transient errors, all requests
+// are guarded by a CircuitBreaker which fast-fails while Gitea is unavailable
+type ResilientGiteaClient struct {
+	client  GiteaClient
+	breaker *CircuitBreaker
+	options ResilienceOptions
+	sleep   func(time.Duration)
+}
+
+// NewResilientGiteaClient wraps the given client, the breaker may be shared between multiple clients of the same Gitea
+func NewResilientGiteaClient(client GiteaClient, breaker *CircuitBreaker, options ResilienceOptions) *ResilientGiteaClient {
+	return &ResilientGiteaClient{
+		client:  client,
+		breaker: breaker,
+		options: options,
+		sleep:   time.Sleep,
+	}
+}
+
+// NewResilientClientBuilder wraps the given client builder such that all clients it creates share the same CircuitBreaker,
+// building a client reports to the breaker like any other request
+func NewResilientClientBuilder(builder func(url string, options ...gitea.ClientOption) (GiteaClient, error), options ResilienceOptions) func(url string, options ...gitea.ClientOption) (GiteaClient, error) {
+	breaker := NewCircuitBreaker(options.FailureThreshold, options.OpenDuration)
+
+	return func(url string, clientOptions ...gitea.ClientOption) (GiteaClient, error) {
+		if err := breaker.Allow(); err != nil {
+			return nil, err
+		}
+
+		client, err := builder(url, clientOptions...)
+		if err != nil {
+			// The gitea client queries the server version when created, so this is most likely a connection problem
+			breaker.Failure()
+			return nil, err
+		}
+
+		breaker.Success()
+		return NewResilientGiteaClient(client, breaker, options), nil
+	}
+}
+
+// isTransientFailure returns true if the request failed because of a connection problem or a server side error
+func isTransientFailure(r *gitea.Response, err error) bool {
+	if r == nil || r.Response == nil {
+		return err != nil
+	}
+
+	return r.StatusCode >= http.StatusInternalServerError
+}
+
+// backoff returns a random duration between zero and the exponential backoff of the given attempt (full jitter)
+func (c *ResilientGiteaClient) backoff(attempt int) time.Duration {
+	upperBound := c.options.InitialBackoff * time.Duration(1<<uint(attempt))
+	if upperBound <= 0 || upperBound > c.options.MaxBackoff {
+		upperBound = c.options.MaxBackoff
+	}
+
+	if upperBound <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(upperBound)))
+}
+
+// do executes the given call through the circuit breaker and retries it if it is idempotent and failed transiently
+func (c *ResilientGiteaClient) do(idempotent bool, call func() (*gitea.Response, error)) (*gitea.Response, error) {
+	maxRetries := 0
+	if idempotent {
+		maxRetries = c.options.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.breaker.Allow(); err != nil {
+			return nil, err
+		}
+
+		r, err := call()
+		if !isTransientFailure(r, err) {
+			c.breaker.Success()
+			return r, err
+		}
+
+		c.breaker.Failure()
+		if attempt >= maxRetries {
+			return r, err
+		}
+
+		c.sleep(c.backoff(attempt))
+	}
+}
+
+// GetMyUserInfo retries on transient errors
+func (c *ResilientGiteaClient) GetMyUserInfo() (*gitea.User, *gitea.Response, error) {
+	var result *gitea.User
+	r, err := c.do(true, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.GetMyUserInfo()
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// GetUserInfo retries on transient errors
+func (c *ResilientGiteaClient) GetUserInfo(user string) (*gitea.User, *gitea.Response, error) {
+	var result *gitea.User
+	r, err := c.do(true, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.GetUserInfo(user)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// AdminCreateUser is not retried, because it is not idempotent
+func (c *ResilientGiteaClient) AdminCreateUser(opt gitea.CreateUserOption) (*gitea.User, *gitea.Response, error) {
+	var result *gitea.User
+	r, err := c.do(false, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.AdminCreateUser(opt)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// AdminCreateRepo is not retried, because it is not idempotent
+func (c *ResilientGiteaClient) AdminCreateRepo(username string, opt gitea.CreateRepoOption) (*gitea.Repository, *gitea.Response, error) {
+	var result *gitea.Repository
+	r, err := c.do(false, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.AdminCreateRepo(username, opt)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// GetRepo retries on transient errors
+func (c *ResilientGiteaClient) GetRepo(owner string, reponame string) (*gitea.Repository, *gitea.Response, error) {
+	var result *gitea.Repository
+	r, err := c.do(true, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.GetRepo(owner, reponame)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// DeleteRepo retries on transient errors. A 404 of a retry counts as success, because the previous attempt may have
+// deleted the repository before its response was lost.
+func (c *ResilientGiteaClient) DeleteRepo(username string, repository string) (*gitea.Response, error) {
+	attempts := 0
+	return c.do(true, func() (*gitea.Response, error) {
+		attempts++
+		r, err := c.client.DeleteRepo(username, repository)
+		if attempts > 1 && r != nil && r.Response != nil && r.StatusCode == http.StatusNotFound {
+			return &gitea.Response{Response: &http.Response{StatusCode: http.StatusNoContent}}, nil
+		}
+
+		return r, err
+	})
+}
+
+// CreateAccessToken is not retried, because it is not idempotent
+func (c *ResilientGiteaClient) CreateAccessToken(opt gitea.CreateAccessTokenOption) (*gitea.AccessToken, *gitea.Response, error) {
+	var result *gitea.AccessToken
+	r, err := c.do(false, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.CreateAccessToken(opt)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// DeleteAccessToken retries on transient errors
+func (c *ResilientGiteaClient) DeleteAccessToken(value interface{}) (*gitea.Response, error) {
+	return c.do(true, func() (*gitea.Response, error) {
+		return c.client.DeleteAccessToken(value)
+	})
+}
+
+// ListMyRepos retries on transient errors
+func (c *ResilientGiteaClient) ListMyRepos(opt gitea.ListReposOptions) ([]*gitea.Repository, *gitea.Response, error) {
+	var result []*gitea.Repository
+	r, err := c.do(true, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.ListMyRepos(opt)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// AdminEditUser retries on transient errors, editing a user to the same values is idempotent
+func (c *ResilientGiteaClient) AdminEditUser(user string, opt gitea.EditUserOption) (*gitea.Response, error) {
+	return c.do(true, func() (*gitea.Response, error) {
+		return c.client.AdminEditUser(user, opt)
+	})
+}
+
+// AdminDeleteUser retries on transient errors
+func (c *ResilientGiteaClient) AdminDeleteUser(user string) (*gitea.Response, error) {
+	return c.do(true, func() (*gitea.Response, error) {
+		return c.client.AdminDeleteUser(user)
+	})
+}
+
+// AdminListUsers retries on transient errors
+func (c *ResilientGiteaClient) AdminListUsers(opt gitea.AdminListUsersOptions) ([]*gitea.User, *gitea.Response, error) {
+	var result []*gitea.User
+	r, err := c.do(true, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.AdminListUsers(opt)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// ListUserRepos retries on transient errors
+func (c *ResilientGiteaClient) ListUserRepos(user string, opt gitea.ListReposOptions) ([]*gitea.Repository, *gitea.Response, error) {
+	var result []*gitea.Repository
+	r, err := c.do(true, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.ListUserRepos(user, opt)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// ListAccessTokens retries on transient errors
+func (c *ResilientGiteaClient) ListAccessTokens(opts gitea.ListAccessTokensOptions) ([]*gitea.AccessToken, *gitea.Response, error) {
+	var result []*gitea.AccessToken
+	r, err := c.do(true, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.ListAccessTokens(opts)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// EditRepo retries on transient errors, editing a repository to the same values is idempotent. Renames are not
+// retried, because a retry after a lost response addresses the old name which Gitea only redirects for reads.
+func (c *ResilientGiteaClient) EditRepo(owner string, reponame string, opt gitea.EditRepoOption) (*gitea.Repository, *gitea.Response, error) {
+	var result *gitea.Repository
+	r, err := c.do(opt.Name == nil, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.EditRepo(owner, reponame, opt)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// TransferRepo is not retried, because it is not idempotent
+func (c *ResilientGiteaClient) TransferRepo(owner string, reponame string, opt gitea.TransferRepoOption) (*gitea.Repository, *gitea.Response, error) {
+	var result *gitea.Repository
+	r, err := c.do(false, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.TransferRepo(owner, reponame, opt)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// GetOrg retries on transient errors
+func (c *ResilientGiteaClient) GetOrg(orgname string) (*gitea.Organization, *gitea.Response, error) {
+	var result *gitea.Organization
+	r, err := c.do(true, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.GetOrg(orgname)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// CreateOrg is not retried, because it is not idempotent
+func (c *ResilientGiteaClient) CreateOrg(opt gitea.CreateOrgOption) (*gitea.Organization, *gitea.Response, error) {
+	var result *gitea.Organization
+	r, err := c.do(false, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.CreateOrg(opt)
+		return r, err
+	})
+
+	return result, r, err
+}
+
+// ListOrgRepos retries on transient errors
+func (c *ResilientGiteaClient) ListOrgRepos(org string, opt gitea.ListOrgReposOptions) ([]*gitea.Repository, *gitea.Response, error) {
+	var result []*gitea.Repository
+	r, err := c.do(true, func() (r *gitea.Response, err error) {
+		result, r, err = c.client.ListOrgRepos(org, opt)
+		return r, err
+	})
+
+	return result, r, err
+}
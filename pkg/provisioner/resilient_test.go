@@ -0,0 +1,288 @@
+package provisioner
+
+import (
+	"code.gitea.io/sdk/gitea"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createResilientClient(client GiteaClient, options ResilienceOptions) *ResilientGiteaClient {
+	resilientClient := NewResilientGiteaClient(client, NewCircuitBreaker(options.FailureThreshold, options.OpenDuration), options)
+	resilientClient.sleep = func(time.Duration) {}
+	return resilientClient
+}
+
+func TestResilientGiteaClient_RetryIdempotent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	client := createResilientClient(giteaClient, ResilienceOptions{MaxRetries: 3})
+
+	user := &gitea.User{UserName: "keptn"}
+	gomock.InOrder(
+		giteaClient.EXPECT().GetUserInfo("keptn").Times(1).Return(nil, nil, fmt.Errorf("connection refused")),
+		giteaClient.EXPECT().GetUserInfo("keptn").Times(1).Return(nil, createResponse(http.StatusBadGateway), fmt.Errorf("502")),
+		giteaClient.EXPECT().GetUserInfo("keptn").Times(1).Return(user, createResponse(http.StatusOK), nil),
+	)
+
+	result, r, err := client.GetUserInfo("keptn")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, r.StatusCode)
+	require.Equal(t, user, result)
+}
+
+func TestResilientGiteaClient_RetryExhausted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	client := createResilientClient(giteaClient, ResilienceOptions{MaxRetries: 2})
+
+	giteaClient.EXPECT().DeleteRepo("keptn", "project").Times(3).Return(createResponse(http.StatusInternalServerError), fmt.Errorf("500"))
+
+	r, err := client.DeleteRepo("keptn", "project")
+	require.Error(t, err)
+	require.Equal(t, http.StatusInternalServerError, r.StatusCode)
+}
+
+func TestResilientGiteaClient_NoRetryForNonIdempotent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	client := createResilientClient(giteaClient, ResilienceOptions{MaxRetries: 3})
+
+	giteaClient.EXPECT().AdminCreateRepo("keptn", gomock.Any()).Times(1).Return(nil, createResponse(http.StatusServiceUnavailable), fmt.Errorf("503"))
+
+	_, r, err := client.AdminCreateRepo("keptn", gitea.CreateRepoOption{})
+	require.Error(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, r.StatusCode)
+}
+
+func TestResilientGiteaClient_NoRetryForRename(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	client := createResilientClient(giteaClient, ResilienceOptions{MaxRetries: 3})
+
+	archived := true
+	giteaClient.EXPECT().EditRepo("keptn", "project", gitea.EditRepoOption{Archived: &archived}).Times(2).Return(nil, createResponse(http.StatusBadGateway), fmt.Errorf("502"))
+	giteaClient.EXPECT().EditRepo("keptn", "project", gitea.EditRepoOption{Archived: &archived}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusOK), nil)
+
+	_, _, err := client.EditRepo("keptn", "project", gitea.EditRepoOption{Archived: &archived})
+	require.NoError(t, err)
+
+	// A retried rename would address the old name after a lost response
+	name := "renamed"
+	giteaClient.EXPECT().EditRepo("keptn", "project", gitea.EditRepoOption{Name: &name}).Times(1).Return(nil, createResponse(http.StatusBadGateway), fmt.Errorf("502"))
+
+	_, r, err := client.EditRepo("keptn", "project", gitea.EditRepoOption{Name: &name})
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadGateway, r.StatusCode)
+}
+
+func TestResilientGiteaClient_NoRetryForClientErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	client := createResilientClient(giteaClient, ResilienceOptions{MaxRetries: 3, FailureThreshold: 1})
+
+	giteaClient.EXPECT().GetUserInfo("keptn").Times(2).Return(nil, createResponse(http.StatusNotFound), fmt.Errorf("404"))
+
+	_, r, _ := client.GetUserInfo("keptn")
+	require.Equal(t, http.StatusNotFound, r.StatusCode)
+
+	// A 404 must not open the circuit breaker
+	_, r, _ = client.GetUserInfo("keptn")
+	require.Equal(t, http.StatusNotFound, r.StatusCode)
+}
+
+func TestResilientGiteaClient_CircuitBreaker(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	client := createResilientClient(giteaClient, ResilienceOptions{FailureThreshold: 2, OpenDuration: 30 * time.Second})
+	client.breaker.now = func() time.Time { return now }
+
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(2).Return(nil, nil, fmt.Errorf("connection refused"))
+
+	for i := 0; i < 2; i++ {
+		_, _, err := client.ListMyRepos(gitea.ListReposOptions{})
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrUpstreamUnavailable)
+	}
+
+	// Breaker is open, requests must not reach Gitea
+	now = now.Add(10 * time.Second)
+	_, _, err := client.ListMyRepos(gitea.ListReposOptions{})
+	require.ErrorIs(t, err, ErrUpstreamUnavailable)
+
+	var unavailableErr *UpstreamUnavailableError
+	require.ErrorAs(t, err, &unavailableErr)
+	assert.Equal(t, 20, unavailableErr.RetryAfterSeconds())
+
+	// After the open duration a trial request is allowed which closes the breaker again
+	now = now.Add(30 * time.Second)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(2).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
+
+	_, _, err = client.ListMyRepos(gitea.ListReposOptions{})
+	require.NoError(t, err)
+	_, _, err = client.ListMyRepos(gitea.ListReposOptions{})
+	require.NoError(t, err)
+}
+
+func TestResilientGiteaClient_RetriedDeleteNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	client := createResilientClient(giteaClient, ResilienceOptions{MaxRetries: 2})
+
+	// The first attempt deleted the repository, but its response got lost
+	gomock.InOrder(
+		giteaClient.EXPECT().DeleteRepo("keptn", "project").Times(1).Return(createResponse(http.StatusBadGateway), fmt.Errorf("502")),
+		giteaClient.EXPECT().DeleteRepo("keptn", "project").Times(1).Return(createResponse(http.StatusNotFound), fmt.Errorf("404")),
+	)
+
+	r, err := client.DeleteRepo("keptn", "project")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, r.StatusCode)
+}
+
+func TestResilientGiteaClient_DeleteNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	client := createResilientClient(giteaClient, ResilienceOptions{MaxRetries: 2})
+
+	giteaClient.EXPECT().DeleteRepo("keptn", "project").Times(1).Return(createResponse(http.StatusNotFound), fmt.Errorf("404"))
+
+	r, err := client.DeleteRepo("keptn", "project")
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, r.StatusCode)
+}
+
+func TestNewResilientClientBuilder_SuccessResetsBreaker(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	failures := 0
+	builder := NewResilientClientBuilder(func(url string, options ...gitea.ClientOption) (GiteaClient, error) {
+		if failures > 0 {
+			failures--
+			return nil, fmt.Errorf("connection refused")
+		}
+
+		return giteaClient, nil
+	}, ResilienceOptions{FailureThreshold: 2, OpenDuration: time.Minute})
+
+	// Failures separated by a successfully built client are not consecutive
+	failures = 1
+	_, err := builder("http://gitea:3000")
+	require.Error(t, err)
+
+	_, err = builder("http://gitea:3000")
+	require.NoError(t, err)
+
+	failures = 1
+	_, err = builder("http://gitea:3000")
+	require.Error(t, err)
+
+	_, err = builder("http://gitea:3000")
+	require.NoError(t, err)
+}
+
+func TestNewResilientClientBuilder_SharedBreaker(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	builder := NewResilientClientBuilder(func(url string, options ...gitea.ClientOption) (GiteaClient, error) {
+		return giteaClient, nil
+	}, ResilienceOptions{FailureThreshold: 1, OpenDuration: time.Minute})
+
+	adminClient, err := builder("http://gitea:3000")
+	require.NoError(t, err)
+
+	giteaClient.EXPECT().AdminDeleteUser("keptn").Times(1).Return(nil, fmt.Errorf("connection reset"))
+	_, err = adminClient.AdminDeleteUser("keptn")
+	require.Error(t, err)
+
+	_, err = builder("http://gitea:3000", gitea.SetSudo("keptn"))
+	require.ErrorIs(t, err, ErrUpstreamUnavailable)
+}
+
+func TestProvisionHandler_UpstreamUnavailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	unavailableErr := fmt.Errorf("unable to create user: %w", &UpstreamUnavailableError{RetryAfter: 1500 * time.Millisecond})
+	provisioner.EXPECT().ProvisionRepository("keptn", "test").Times(1).Return(nil, unavailableErr)
+	provisioner.EXPECT().DeleteRepository("keptn", "test").Times(1).Return(unavailableErr)
+
+	handler := ProvisionHandler{
+		Provisioner: provisioner,
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			request, _ := http.NewRequest(method, "/repository",
+				strings.NewReader(`{"namespace":"keptn","project":"test"}`),
+			)
+			response := httptest.NewRecorder()
+
+			handler.HandleProvisionRepoRequest(response, request)
+			assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+			assert.Equal(t, "2", response.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestProvisionHandler_AsyncUpstreamUnavailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	provisioner := fake.NewMockGitProvisioner(mockCtrl)
+	unavailableErr := fmt.Errorf("unable to create user: %w", &UpstreamUnavailableError{RetryAfter: 1500 * time.Millisecond})
+	provisioner.EXPECT().ProvisionRepository("keptn", "test").Times(1).Return(nil, unavailableErr)
+
+	queue := NewJobQueue(JobOptions{})
+	handler := ProvisionHandler{
+		Provisioner: provisioner,
+		Jobs:        queue,
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "/repository", strings.NewReader(`{"namespace":"keptn","project":"test"}`))
+	request.Header.Set(AsyncHeader, "true")
+	response := httptest.NewRecorder()
+
+	handler.HandleProvisionRepoRequest(response, request)
+	require.Equal(t, http.StatusAccepted, response.Code)
+
+	accepted := Job{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &accepted))
+
+	// The Retry-After header of the synchronous request is kept in the job
+	runJobQueue(t, queue)
+	job := waitForJob(t, queue, accepted.ID)
+	assert.Equal(t, JobFailed, job.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, job.StatusCode)
+	assert.Equal(t, 2, job.RetryAfter)
+}
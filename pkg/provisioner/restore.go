@@ -0,0 +1,219 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"code.gitea.io/sdk/gitea"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/backup"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+)
+
+// ErrNothingToRestore indicates that the project has neither an archived repository, nor a repository in the
+// graveyard, nor a backup
+var /*const*/ ErrNothingToRestore = errors.New("the project has no repository to restore")
+
+// RestoreRepository brings back the repository of a deleted project and issues a new access token. An archived
+// repository is unarchived, otherwise the most recently deleted repository is restored, either by moving it back from
+// the graveyard or by pushing its backup into a new repository. The user of the namespace is created again if the
+// deletion removed it.
+func (h *GiteaProvisioner) RestoreRepository(namespace string, project string) (*keptn.ProvisionResponse, error) {
+	if project == "" {
+		return nil, fmt.Errorf("%w: unable to restore project with an empty name", ErrInvalidRequest)
+	}
+
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	objects := h.GiteaObjects(namespace, project)
+
+	existing, err := h.getProjectRepository(objects.User, project)
+	if err == nil {
+		if !existing.Archived {
+			return nil, ErrRepositoryAlreadyExists
+		}
+
+		// Archived repositories don't count towards the quotas, the unarchived one does
+		if err := h.checkQuota(namespace); err != nil {
+			return nil, err
+		}
+
+		cloneURL, err := h.unarchiveRepository(objects.User, objects.Repository)
+		if err != nil {
+			return nil, err
+		}
+
+		return h.issueToken(namespace, project, cloneURL)
+	}
+
+	if !errors.Is(err, ErrRepositoryDoesNotExist) {
+		return nil, err
+	}
+
+	buried, buriedAt, err := h.findBuriedRepository(objects.User, objects.Repository)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := h.latestBackup(namespace, project)
+	if err != nil {
+		return nil, err
+	}
+
+	if buried == "" && manifest == nil {
+		return nil, ErrNothingToRestore
+	}
+
+	if err := h.checkQuota(namespace); err != nil {
+		return nil, err
+	}
+
+	if _, err := h.CreateUser(namespace); err != nil {
+		return nil, fmt.Errorf("unable to create user: %w", err)
+	}
+
+	// The graveyard name only has a precision of seconds, the backup of the same deletion is taken right before
+	var cloneURL string
+	if buried != "" && (manifest == nil || !buriedAt.Before(manifest.DeletedAt.Truncate(time.Second))) {
+		cloneURL, err = h.exhumeRepository(objects.User, objects.Repository, buried)
+	} else {
+		cloneURL, err = h.importRepository(namespace, project, *manifest)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return h.issueToken(namespace, project, cloneURL)
+}
+
+// unarchiveRepository makes an archived repository writable again and returns its clone URL
+func (h *GiteaProvisioner) unarchiveRepository(username string, repository string) (string, error) {
+	archived := false
+	unarchived, _, err := h.client.EditRepo(username, repository, gitea.EditRepoOption{Archived: &archived})
+	if err != nil {
+		return "", fmt.Errorf("unable to unarchive repository %s/%s: %w", username, repository, err)
+	}
+
+	log.Printf("Unarchived repository %s/%s\n", username, repository)
+	return unarchived.CloneURL, nil
+}
+
+// findBuriedRepository returns the name and deletion time of the most recently buried repository of the owner in the
+// graveyard organization, the name is empty if there is none
+func (h *GiteaProvisioner) findBuriedRepository(owner string, repository string) (string, time.Time, error) {
+	organization := h.deletion.graveyardOrganization()
+
+	var buried string
+	var buriedAt time.Time
+	for page := 1; ; page++ {
+		repositories, r, err := h.client.ListOrgRepos(organization, gitea.ListOrgReposOptions{
+			ListOptions: gitea.ListOptions{Page: page, PageSize: listPageSize},
+		})
+		if r != nil && r.StatusCode == http.StatusNotFound {
+			return "", time.Time{}, nil
+		}
+
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("unable to list repositories of organization %s: %w", organization, err)
+		}
+
+		for _, candidate := range repositories {
+			// The name is compared as a whole, such that the repositories of owners with a common prefix don't mix
+			deletedAt, ok := graveyardDeletionTime(candidate.Name)
+			if ok && graveyardName(owner, repository, deletedAt) == candidate.Name && deletedAt.After(buriedAt) {
+				buried = candidate.Name
+				buriedAt = deletedAt
+			}
+		}
+
+		if len(repositories) < listPageSize {
+			return buried, buriedAt, nil
+		}
+	}
+}
+
+// exhumeRepository transfers the buried repository from the graveyard organization back to the owner and restores its
+// original name
+func (h *GiteaProvisioner) exhumeRepository(owner string, repository string, buried string) (string, error) {
+	organization := h.deletion.graveyardOrganization()
+
+	_, _, err := h.client.TransferRepo(organization, buried, gitea.TransferRepoOption{NewOwner: owner})
+	if err != nil {
+		return "", fmt.Errorf("unable to transfer repository %s/%s to %s: %w", organization, buried, owner, err)
+	}
+
+	restored, _, err := h.client.EditRepo(owner, buried, gitea.EditRepoOption{Name: &repository})
+	if err != nil {
+		// Move the repository back to the graveyard, such that the restore can be retried
+		if _, _, transferErr := h.client.TransferRepo(owner, buried, gitea.TransferRepoOption{NewOwner: organization}); transferErr != nil {
+			log.Printf("Unable to move repository %s/%s back to %s: %s\n", owner, buried, organization, transferErr)
+		}
+
+		return "", fmt.Errorf("unable to rename repository %s/%s to %s: %w", owner, buried, repository, err)
+	}
+
+	log.Printf("Moved repository %s/%s back to %s/%s\n", organization, buried, owner, repository)
+	return restored.CloneURL, nil
+}
+
+// latestBackup returns the manifest of the latest backup of the project, nil if backups are disabled or the project
+// has no backup
+func (h *GiteaProvisioner) latestBackup(namespace string, project string) (*backup.Manifest, error) {
+	if h.backup.Store == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.backup.timeout())
+	defer cancel()
+
+	manifest, err := backup.LatestManifest(ctx, h.backup.Store, namespaceOrDefault(namespace), project)
+	if errors.Is(err, backup.ErrNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// importRepository creates an empty repository for the project and pushes the bundle of the backup into it, the
+// repository is deleted again if the push fails such that the restore can be retried
+func (h *GiteaProvisioner) importRepository(namespace string, project string, manifest backup.Manifest) (string, error) {
+	cloneURL, err := h.CreateRepository(namespace, project)
+	if err != nil {
+		return "", fmt.Errorf("unable to create repository: %w", err)
+	}
+
+	objects := h.GiteaObjects(namespace, project)
+	err = h.withTemporaryToken(objects.User, temporaryTokenRestore, func(token string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), h.backup.timeout())
+		defer cancel()
+
+		return backup.Import(ctx, h.backup.Store, h.pushFunc, manifest, backup.Source{
+			CloneURL: h.repositoryURL(objects.User, objects.Repository),
+			Username: objects.User,
+			Password: token,
+		})
+	})
+	if err != nil {
+		if _, deleteErr := h.client.DeleteRepo(objects.User, objects.Repository); deleteErr != nil {
+			log.Printf("Unable to delete the partially restored repository %s/%s: %s\n", objects.User, objects.Repository, deleteErr)
+		}
+
+		return "", fmt.Errorf("unable to restore the backup of %s: %w", manifest.DeletedAt, err)
+	}
+
+	log.Printf("Restored repository %s/%s from the backup of %s\n", objects.User, objects.Repository, manifest.DeletedAt)
+	return cloneURL, nil
+}
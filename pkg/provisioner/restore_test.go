@@ -0,0 +1,224 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/backup"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+)
+
+// expectNewToken sets up the expectations of issuing the access token of the restored project
+func expectNewToken(giteaClient *fake.MockGiteaClient) {
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().CreateAccessToken(gitea.CreateAccessTokenOption{Name: "token-podtato"}).Times(1).Return(&gitea.AccessToken{Token: "restored-token"}, createResponse(http.StatusCreated), nil)
+}
+
+// expectNewUser sets up the expectations of creating the user that has been removed by the deletion
+func expectNewUser(giteaClient *fake.MockGiteaClient) {
+	giteaClient.EXPECT().GetUserInfo("keptn-dev").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+	giteaClient.EXPECT().AdminCreateUser(gomock.Any()).Times(1).Return(&gitea.User{}, createResponse(http.StatusCreated), nil)
+}
+
+func TestGiteaProvisioner_RestoreArchivedRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	archived := false
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato", Archived: true}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().EditRepo("keptn-dev", "project-podtato", gitea.EditRepoOption{Archived: &archived}).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn-dev/project-podtato.git"}, createResponse(http.StatusOK), nil)
+	expectNewToken(giteaClient)
+
+	response, err := giteaProvisioner.RestoreRepository("dev", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, "http://gitea/keptn-dev/project-podtato.git", response.GitRemoteURL)
+	assert.Equal(t, "keptn-dev", response.GitUser)
+	assert.Equal(t, "restored-token", response.GitToken)
+}
+
+func TestGiteaProvisioner_RestoreArchivedRepositoryQuotaExceeded(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.quota = QuotaOptions{MaxRepositories: 1}
+
+	archivedRepository := &gitea.Repository{Name: "project-podtato", Archived: true}
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(archivedRepository, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().ListUserRepos("keptn-dev", gomock.Any()).Times(1).Return([]*gitea.Repository{
+		archivedRepository,
+		{Name: "project-sockshop"},
+	}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().EditRepo(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	// The archived repository doesn't count towards the quota, but it does once it is unarchived
+	_, err := giteaProvisioner.RestoreRepository("dev", "podtato")
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, int64(1), quotaErr.Usage)
+}
+
+func TestGiteaProvisioner_RestoreExistingRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+
+	_, err := giteaProvisioner.RestoreRepository("dev", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryAlreadyExists)
+}
+
+func TestGiteaProvisioner_RestoreFromGraveyard(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyGraveyard, GraveyardOrganization: "graveyard"}
+
+	name := "project-podtato"
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().ListOrgRepos("graveyard", gomock.Any()).Times(1).Return([]*gitea.Repository{
+		{Name: "keptn-dev-project-podtato-20220301123000"},
+		{Name: "keptn-dev-project-podtato-20220401080000"},
+		// A later deletion of a different project whose name starts with the same prefix
+		{Name: "keptn-dev-project-podtato-2-20220501080000"},
+	}, createResponse(http.StatusOK), nil)
+	expectNewUser(giteaClient)
+	giteaClient.EXPECT().TransferRepo("graveyard", "keptn-dev-project-podtato-20220401080000", gitea.TransferRepoOption{NewOwner: "keptn-dev"}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusAccepted), nil)
+	giteaClient.EXPECT().EditRepo("keptn-dev", "keptn-dev-project-podtato-20220401080000", gitea.EditRepoOption{Name: &name}).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn-dev/project-podtato.git"}, createResponse(http.StatusOK), nil)
+	expectNewToken(giteaClient)
+
+	response, err := giteaProvisioner.RestoreRepository("dev", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, "http://gitea/keptn-dev/project-podtato.git", response.GitRemoteURL)
+}
+
+func TestGiteaProvisioner_RestoreFromGraveyardRenameFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+	giteaProvisioner.deletion = DeletionOptions{Policy: DeletionPolicyGraveyard, GraveyardOrganization: "graveyard"}
+
+	name := "project-podtato"
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().ListOrgRepos("graveyard", gomock.Any()).Times(1).Return([]*gitea.Repository{
+		{Name: "keptn-dev-project-podtato-20220401080000"},
+	}, createResponse(http.StatusOK), nil)
+	expectNewUser(giteaClient)
+	gomock.InOrder(
+		giteaClient.EXPECT().TransferRepo("graveyard", "keptn-dev-project-podtato-20220401080000", gitea.TransferRepoOption{NewOwner: "keptn-dev"}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusAccepted), nil),
+		giteaClient.EXPECT().EditRepo("keptn-dev", "keptn-dev-project-podtato-20220401080000", gitea.EditRepoOption{Name: &name}).Times(1).Return(nil, createResponse(http.StatusInternalServerError), errors.New("500 Internal Server Error")),
+		// The repository is moved back to the graveyard, such that the restore can be retried
+		giteaClient.EXPECT().TransferRepo("keptn-dev", "keptn-dev-project-podtato-20220401080000", gitea.TransferRepoOption{NewOwner: "graveyard"}).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusAccepted), nil),
+	)
+	giteaClient.EXPECT().CreateAccessToken(gomock.Any()).Times(0)
+
+	_, err := giteaProvisioner.RestoreRepository("dev", "podtato")
+	require.Error(t, err)
+}
+
+// newRestoreProvisioner creates a provisioner with a backup of project podtato in namespace dev, pushes are recorded
+// in the returned slice
+func newRestoreProvisioner(t *testing.T, giteaClient *fake.MockGiteaClient, pushErr error) (*GiteaProvisioner, *[]string) {
+	giteaProvisioner, _ := newBackupProvisioner(t, giteaClient, nil)
+
+	_, err := backup.Export(context.Background(), giteaProvisioner.backup.Store, giteaProvisioner.bundleFunc, backup.Manifest{
+		Namespace: "dev",
+		Project:   "podtato",
+		DeletedAt: time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC),
+	}, backup.Source{CloneURL: "http://gitea-http.gitea:3000/keptn-dev/project-podtato.git", Username: "keptn-dev", Password: "old"})
+	require.NoError(t, err)
+
+	var pushes []string
+	giteaProvisioner.pushFunc = func(ctx context.Context, file string, target backup.Source) error {
+		content, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+
+		pushes = append(pushes, string(content)+" -> "+target.CloneURL+" "+target.Username+":"+target.Password)
+		return pushErr
+	}
+
+	return giteaProvisioner, &pushes
+}
+
+// expectRestoreToken sets up the expectations of the temporary access token of a restore
+func expectRestoreToken(giteaClient *fake.MockGiteaClient) {
+	giteaClient.EXPECT().CreateAccessToken(gomock.Not(gitea.CreateAccessTokenOption{Name: "token-podtato"})).Times(1).Return(&gitea.AccessToken{Token: "restore-token"}, createResponse(http.StatusCreated), nil)
+	giteaClient.EXPECT().DeleteAccessToken(prefixMatcher("token-restore-")).Times(1).Return(createResponse(http.StatusNoContent), nil)
+}
+
+func TestGiteaProvisioner_RestoreFromBackup(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner, pushes := newRestoreProvisioner(t, giteaClient, nil)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().ListOrgRepos(DefaultGraveyardOrganization, gomock.Any()).Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	expectNewUser(giteaClient)
+	giteaClient.EXPECT().AdminCreateRepo("keptn-dev", gomock.Any()).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn-dev/project-podtato.git"}, createResponse(http.StatusCreated), nil)
+	expectRestoreToken(giteaClient)
+	expectNewToken(giteaClient)
+
+	response, err := giteaProvisioner.RestoreRepository("dev", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, "http://gitea/keptn-dev/project-podtato.git", response.GitRemoteURL)
+	assert.Equal(t, []string{
+		"http://gitea-http.gitea:3000/keptn-dev/project-podtato.git keptn-dev:old -> " +
+			"http://gitea-http.gitea:3000/keptn-dev/project-podtato.git keptn-dev:restore-token",
+	}, *pushes)
+}
+
+func TestGiteaProvisioner_RestoreFromBackupFails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner, _ := newRestoreProvisioner(t, giteaClient, errors.New("git push failed"))
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().ListOrgRepos(DefaultGraveyardOrganization, gomock.Any()).Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	expectNewUser(giteaClient)
+	giteaClient.EXPECT().AdminCreateRepo("keptn-dev", gomock.Any()).Times(1).Return(&gitea.Repository{}, createResponse(http.StatusCreated), nil)
+	expectRestoreToken(giteaClient)
+
+	// The empty repository is removed again, such that the restore can be retried
+	giteaClient.EXPECT().DeleteRepo("keptn-dev", "project-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	_, err := giteaProvisioner.RestoreRepository("dev", "podtato")
+	assert.Error(t, err)
+}
+
+func TestGiteaProvisioner_RestoreNothing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().ListOrgRepos(DefaultGraveyardOrganization, gomock.Any()).Times(1).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
+
+	_, err := giteaProvisioner.RestoreRepository("dev", "podtato")
+	assert.ErrorIs(t, err, ErrNothingToRestore)
+}
@@ -0,0 +1,211 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+)
+
+// DefaultSecretNameTemplate is used to name the credential secrets if no template is configured
+const DefaultSecretNameTemplate = "gitea-credentials-{{ .Namespace }}-{{ .Project }}"
+
+// secretSinkTimeout is the timeout of all Kubernetes requests of a single Store or Delete
+const secretSinkTimeout = 30 * time.Second
+
+// Labels that are set on every credential secret to identify the owner of the secret
+const (
+	secretManagedByLabel = "app.kubernetes.io/managed-by"
+	secretManagedBy      = "keptn-gitea-provisioner"
+	secretNamespaceLabel = "keptn.sh/namespace"
+	secretProjectLabel   = "keptn.sh/project"
+)
+
+// CredentialSink receives a copy of the credentials of every provisioned repository, e.g. for break-glass access
+type CredentialSink interface {
+	// Store creates or updates the copy of the credentials of the given project
+	Store(namespace string, project string, credentials *keptn.ProvisionResponse) error
+	// Delete removes the copy of the credentials of the given project, it succeeds if no copy exists
+	Delete(namespace string, project string) error
+}
+
+// KubernetesSecretSink is a CredentialSink that writes the credentials into one Kubernetes Secret per project
+type KubernetesSecretSink struct {
+	client       kubernetes.Interface
+	namespace    string
+	nameTemplate *template.Template
+}
+
+// NewKubernetesSecretSink creates a KubernetesSecretSink that creates secrets in the given Kubernetes namespace. The
+// secret names are rendered from nameTemplate, which can refer to the Keptn {{ .Namespace }} and {{ .Project }}.
+func NewKubernetesSecretSink(client kubernetes.Interface, namespace string, nameTemplate string) (*KubernetesSecretSink, error) {
+	if nameTemplate == "" {
+		nameTemplate = DefaultSecretNameTemplate
+	}
+
+	parsedTemplate, err := template.New("secret-name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse secret name template: %w", err)
+	}
+
+	return &KubernetesSecretSink{
+		client:       client,
+		namespace:    namespace,
+		nameTemplate: parsedTemplate,
+	}, nil
+}
+
+// SecretName returns the name of the secret that contains the credentials of the given project
+func (k *KubernetesSecretSink) SecretName(namespace string, project string) (string, error) {
+	if namespace == "" {
+		namespace = DefaultKeptnNamespace
+	}
+
+	var name bytes.Buffer
+	err := k.nameTemplate.Execute(&name, struct {
+		Namespace string
+		Project   string
+	}{Namespace: namespace, Project: project})
+	if err != nil {
+		return "", fmt.Errorf("unable to render secret name: %w", err)
+	}
+
+	secretName := strings.ToLower(name.String())
+	if errs := validation.IsDNS1123Subdomain(secretName); len(errs) > 0 {
+		return "", fmt.Errorf("invalid secret name %s: %s", secretName, strings.Join(errs, ", "))
+	}
+
+	return secretName, nil
+}
+
+// Store creates the secret for the given project or updates it if it already exists, e.g. after the token has been
+// rotated
+func (k *KubernetesSecretSink) Store(namespace string, project string, credentials *keptn.ProvisionResponse) error {
+	if namespace == "" {
+		namespace = DefaultKeptnNamespace
+	}
+
+	name, err := k.SecretName(namespace, project)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretSinkTimeout)
+	defer cancel()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: k.namespace,
+			Labels: map[string]string{
+				secretManagedByLabel: secretManagedBy,
+				secretNamespaceLabel: labelValue(namespace),
+				secretProjectLabel:   labelValue(project),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			"gitRemoteURL": credentials.GitRemoteURL,
+			"gitUser":      credentials.GitUser,
+			"gitToken":     credentials.GitToken,
+		},
+	}
+
+	secrets := k.client.CoreV1().Secrets(k.namespace)
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("unable to create secret %s: %w", name, err)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to get secret %s: %w", name, err)
+	}
+
+	if err := checkSecretOwner(existing, namespace, project); err != nil {
+		return err
+	}
+
+	existing.Labels = secret.Labels
+	existing.Data = nil
+	existing.StringData = secret.StringData
+	if _, err := secrets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to update secret %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Delete removes the secret of the given project, secrets that are not managed by the provisioner or that belong to
+// another project are kept
+func (k *KubernetesSecretSink) Delete(namespace string, project string) error {
+	if namespace == "" {
+		namespace = DefaultKeptnNamespace
+	}
+
+	name, err := k.SecretName(namespace, project)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretSinkTimeout)
+	defer cancel()
+
+	secrets := k.client.CoreV1().Secrets(k.namespace)
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to get secret %s: %w", name, err)
+	}
+
+	if err := checkSecretOwner(existing, namespace, project); err != nil {
+		return err
+	}
+
+	err = secrets.Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete secret %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// checkSecretOwner returns an error if the existing secret is not managed by the provisioner or belongs to another
+// project. The name template can render the same name for different projects, e.g. the default template for the
+// project "c" of the namespace "a-b" and the project "b-c" of the namespace "a".
+func checkSecretOwner(existing *corev1.Secret, namespace string, project string) error {
+	if existing.Labels[secretManagedByLabel] != secretManagedBy {
+		return fmt.Errorf("secret %s exists but is not managed by %s", existing.Name, secretManagedBy)
+	}
+
+	if existing.Labels[secretNamespaceLabel] != labelValue(namespace) || existing.Labels[secretProjectLabel] != labelValue(project) {
+		return fmt.Errorf("secret %s belongs to project %s of namespace %s", existing.Name, existing.Labels[secretProjectLabel], existing.Labels[secretNamespaceLabel])
+	}
+
+	return nil
+}
+
+// labelValue shortens the given value such that it is a valid label value, the full value is part of the secret name
+func labelValue(value string) string {
+	if len(value) > validation.LabelValueMaxLength {
+		value = value[:validation.LabelValueMaxLength]
+	}
+
+	return strings.Trim(value, "-_.")
+}
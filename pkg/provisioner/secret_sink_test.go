@@ -0,0 +1,141 @@
+package provisioner
+
+import (
+	"code.gitea.io/sdk/gitea"
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+	"net/http"
+	"testing"
+)
+
+func TestKubernetesSecretSink_SecretName(t *testing.T) {
+	sink, err := NewKubernetesSecretSink(k8sfake.NewSimpleClientset(), "keptn", "")
+	require.NoError(t, err)
+
+	name, err := sink.SecretName("", "Podtato-Head")
+	require.NoError(t, err)
+	assert.Equal(t, "gitea-credentials-keptn-podtato-head", name)
+
+	sink, err = NewKubernetesSecretSink(k8sfake.NewSimpleClientset(), "keptn", "{{ .Project }}_credentials")
+	require.NoError(t, err)
+
+	_, err = sink.SecretName("keptn", "podtato-head")
+	require.Error(t, err)
+
+	_, err = NewKubernetesSecretSink(k8sfake.NewSimpleClientset(), "keptn", "{{ .Project")
+	require.Error(t, err)
+}
+
+func TestKubernetesSecretSink_StoreAndDelete(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	sink, err := NewKubernetesSecretSink(client, "platform", "")
+	require.NoError(t, err)
+
+	credentials := &keptn.ProvisionResponse{
+		GitRemoteURL: "http://gitea:3000/keptn/podtato-head.git",
+		GitUser:      "keptn",
+		GitToken:     "token",
+	}
+
+	require.NoError(t, sink.Store("keptn", "podtato-head", credentials))
+
+	secret, err := client.CoreV1().Secrets("platform").Get(context.Background(), "gitea-credentials-keptn-podtato-head", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "token", secret.StringData["gitToken"])
+	assert.Equal(t, "keptn", secret.Labels["keptn.sh/namespace"])
+	assert.Equal(t, "podtato-head", secret.Labels["keptn.sh/project"])
+	assert.Equal(t, "keptn-gitea-provisioner", secret.Labels["app.kubernetes.io/managed-by"])
+
+	// A rotated token updates the existing secret
+	credentials.GitToken = "rotated"
+	require.NoError(t, sink.Store("keptn", "podtato-head", credentials))
+
+	secret, err = client.CoreV1().Secrets("platform").Get(context.Background(), "gitea-credentials-keptn-podtato-head", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", secret.StringData["gitToken"])
+
+	require.NoError(t, sink.Delete("keptn", "podtato-head"))
+	_, err = client.CoreV1().Secrets("platform").Get(context.Background(), "gitea-credentials-keptn-podtato-head", metav1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	// Deleting a missing secret succeeds
+	require.NoError(t, sink.Delete("keptn", "podtato-head"))
+}
+
+func TestKubernetesSecretSink_ForeignSecret(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "gitea-credentials-keptn-podtato-head", Namespace: "platform"},
+	})
+	sink, err := NewKubernetesSecretSink(client, "platform", "")
+	require.NoError(t, err)
+
+	require.Error(t, sink.Store("keptn", "podtato-head", &keptn.ProvisionResponse{}))
+	require.Error(t, sink.Delete("keptn", "podtato-head"))
+
+	_, err = client.CoreV1().Secrets("platform").Get(context.Background(), "gitea-credentials-keptn-podtato-head", metav1.GetOptions{})
+	require.NoError(t, err)
+}
+
+func TestKubernetesSecretSink_NameCollision(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	sink, err := NewKubernetesSecretSink(client, "platform", "")
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Store("a-b", "c", &keptn.ProvisionResponse{GitToken: "token"}))
+
+	// The project "b-c" of the namespace "a" renders the same secret name
+	require.Error(t, sink.Store("a", "b-c", &keptn.ProvisionResponse{GitToken: "other"}))
+	require.Error(t, sink.Delete("a", "b-c"))
+
+	secret, err := client.CoreV1().Secrets("platform").Get(context.Background(), "gitea-credentials-a-b-c", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "token", secret.StringData["gitToken"])
+	assert.Equal(t, "a-b", secret.Labels["keptn.sh/namespace"])
+}
+
+func TestGiteaProvisioner_CredentialSink(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := k8sfake.NewSimpleClientset()
+	sink, err := NewKubernetesSecretSink(client, "platform", "")
+	require.NoError(t, err)
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := GiteaProvisioner{
+		client:         giteaClient,
+		credentialSink: sink,
+		newClientFunc: func(url string, options ...gitea.ClientOption) (GiteaClient, error) {
+			return giteaClient, nil
+		},
+	}
+
+	giteaClient.EXPECT().GetUserInfo("keptn").Times(1).Return(&gitea.User{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminCreateRepo("keptn", gomock.Any()).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn/project"}, createResponse(http.StatusCreated), nil)
+	giteaClient.EXPECT().CreateAccessToken(gomock.Any()).Times(1).Return(&gitea.AccessToken{Token: "token"}, createResponse(http.StatusCreated), nil)
+
+	_, err = giteaProvisioner.ProvisionRepository("keptn", "project")
+	require.NoError(t, err)
+
+	secret, err := client.CoreV1().Secrets("platform").Get(context.Background(), "gitea-credentials-keptn-project", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "token", secret.StringData["gitToken"])
+
+	giteaClient.EXPECT().GetRepo("keptn", "project").Times(1).Return(&gitea.Repository{Name: "project"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().DeleteRepo("keptn", "project").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().DeleteAccessToken("project").Times(1).Return(nil, nil)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(1).Return([]*gitea.Repository{{}}, createResponse(http.StatusOK), nil)
+
+	require.NoError(t, giteaProvisioner.DeleteRepository("keptn", "project"))
+
+	_, err = client.CoreV1().Secrets("platform").Get(context.Background(), "gitea-credentials-keptn-project", metav1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err))
+}
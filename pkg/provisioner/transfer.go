@@ -0,0 +1,100 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"code.gitea.io/sdk/gitea"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+)
+
+// TransferRepository moves the repository of a project from the user of one Keptn namespace to the user of another,
+// e.g. when the project moves to a different Keptn installation. The target user is created if necessary and a new
+// access token is issued for the target namespace. Afterwards, the source namespace is cleaned up like after a
+// deletion: its access token is revoked and its user is deleted if it owns no other repository.
+func (h *GiteaProvisioner) TransferRepository(namespace string, targetNamespace string, project string) (*keptn.ProvisionResponse, error) {
+	if project == "" {
+		return nil, fmt.Errorf("%w: unable to transfer project with an empty name", ErrInvalidRequest)
+	}
+
+	source := h.GiteaObjects(namespace, project)
+	target := h.GiteaObjects(targetNamespace, project)
+	if source.User == target.User {
+		return nil, fmt.Errorf("%w: namespaces %s and %s have the same user %s", ErrInvalidRequest,
+			namespaceOrDefault(namespace), namespaceOrDefault(targetNamespace), source.User,
+		)
+	}
+
+	unlock, err := h.lockNamespaces(namespace, targetNamespace)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// The source is looked up first, such that a name that Gitea redirects to a renamed repository isn't transferred
+	if _, err := h.getProjectRepository(source.User, project); err != nil {
+		return nil, err
+	}
+
+	_, err = h.getRepository(target.User, target.Repository)
+	if err == nil {
+		return nil, fmt.Errorf("%w: %s/%s", ErrRepositoryAlreadyExists, target.User, target.Repository)
+	}
+
+	if !errors.Is(err, ErrRepositoryDoesNotExist) {
+		return nil, err
+	}
+
+	if err := h.checkQuota(targetNamespace); err != nil {
+		return nil, err
+	}
+
+	if _, err := h.CreateUser(targetNamespace); err != nil {
+		return nil, fmt.Errorf("unable to create user: %w", err)
+	}
+
+	transferred, _, err := h.client.TransferRepo(source.User, source.Repository, gitea.TransferRepoOption{NewOwner: target.User})
+	if err != nil {
+		return nil, fmt.Errorf("unable to transfer repository %s/%s to %s: %w", source.User, source.Repository, target.User, err)
+	}
+
+	log.Printf("Transferred repository %s/%s of project %s to %s\n", source.User, source.Repository, project, target.User)
+
+	response, err := h.issueToken(targetNamespace, project, transferred.CloneURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// The old user lost its access with the transfer, a failed cleanup only leaves an unused token or user behind
+	if err := h.releaseProject(namespace, project); err != nil {
+		log.Printf("Unable to clean up namespace %s after the transfer of project %s: %s\n", namespaceOrDefault(namespace), project, err)
+	}
+
+	return response, nil
+}
+
+// lockNamespaces acquires the locks of both namespaces in the order of their usernames, such that two transfers in
+// opposite directions can't deadlock
+func (h *GiteaProvisioner) lockNamespaces(namespace string, otherNamespace string) (func(), error) {
+	if h.GetUsername(otherNamespace) < h.GetUsername(namespace) {
+		namespace, otherNamespace = otherNamespace, namespace
+	}
+
+	unlock, err := h.lockNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	unlockOther, err := h.lockNamespace(otherNamespace)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	return func() {
+		unlockOther()
+		unlock()
+	}, nil
+}
@@ -0,0 +1,88 @@
+package provisioner
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner/fake"
+)
+
+func TestGiteaProvisioner_TransferRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-prod", "project-podtato").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	giteaClient.EXPECT().GetUserInfo("keptn-prod").Times(1).Return(nil, createResponse(http.StatusNotFound), nil)
+	giteaClient.EXPECT().AdminCreateUser(gomock.Any()).Times(1).Return(&gitea.User{}, createResponse(http.StatusCreated), nil)
+	giteaClient.EXPECT().TransferRepo("keptn-dev", "project-podtato", gitea.TransferRepoOption{NewOwner: "keptn-prod"}).Times(1).Return(&gitea.Repository{CloneURL: "http://gitea/keptn-prod/project-podtato.git"}, createResponse(http.StatusAccepted), nil)
+	expectNewToken(giteaClient)
+
+	// The token of the old namespace is revoked and its user deleted, since it owns no other repository
+	giteaClient.EXPECT().DeleteAccessToken("token-podtato").Times(1).Return(createResponse(http.StatusNoContent), nil)
+	giteaClient.EXPECT().ListMyRepos(gomock.Any()).Times(1).Return([]*gitea.Repository{}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().AdminDeleteUser("keptn-dev").Times(1).Return(createResponse(http.StatusNoContent), nil)
+
+	response, err := giteaProvisioner.TransferRepository("dev", "prod", "podtato")
+	require.NoError(t, err)
+	assert.Equal(t, "http://gitea/keptn-prod/project-podtato.git", response.GitRemoteURL)
+	assert.Equal(t, "keptn-prod", response.GitUser)
+	assert.Equal(t, "restored-token", response.GitToken)
+}
+
+func TestGiteaProvisioner_TransferRepositoryConflicts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	giteaClient := fake.NewMockGiteaClient(mockCtrl)
+	giteaProvisioner := newInspectProvisioner(giteaClient)
+
+	_, err := giteaProvisioner.TransferRepository("dev", "dev", "podtato")
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-missing").Times(1).Return(nil, createResponse(http.StatusNotFound), errors.New("404 Not Found"))
+	_, err = giteaProvisioner.TransferRepository("dev", "prod", "missing")
+	assert.ErrorIs(t, err, ErrRepositoryDoesNotExist)
+
+	giteaClient.EXPECT().GetRepo("keptn-dev", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	giteaClient.EXPECT().GetRepo("keptn-prod", "project-podtato").Times(1).Return(&gitea.Repository{Name: "project-podtato"}, createResponse(http.StatusOK), nil)
+	_, err = giteaProvisioner.TransferRepository("dev", "prod", "podtato")
+	assert.ErrorIs(t, err, ErrRepositoryAlreadyExists)
+}
+
+// recordingLocker records the keys in the order they are locked
+type recordingLocker struct {
+	keys []string
+}
+
+// Lock records the key, the returned unlock does nothing
+func (r *recordingLocker) Lock(key string) (func(), error) {
+	r.keys = append(r.keys, key)
+	return func() {}, nil
+}
+
+func TestGiteaProvisioner_LockNamespaces(t *testing.T) {
+	locker := &recordingLocker{}
+	giteaProvisioner := newInspectProvisioner(nil)
+	giteaProvisioner.locker = locker
+
+	// Both directions lock in the same order, such that opposite transfers can't deadlock
+	unlock, err := giteaProvisioner.lockNamespaces("prod", "dev")
+	require.NoError(t, err)
+	unlock()
+
+	unlock, err = giteaProvisioner.lockNamespaces("dev", "prod")
+	require.NoError(t, err)
+	unlock()
+
+	assert.Equal(t, []string{"keptn-dev", "keptn-prod", "keptn-dev", "keptn-prod"}, locker.keys)
+}
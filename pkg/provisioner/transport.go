@@ -0,0 +1,145 @@
+package provisioner
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// TransportOptions configures TLS and proxy settings of the connection to Gitea
+type TransportOptions struct {
+	// CAFile is a PEM encoded CA bundle that is trusted in addition to the system CAs
+	CAFile string
+	// ClientCertFile and ClientKeyFile are a PEM encoded client certificate and key used for mTLS
+	ClientCertFile string
+	ClientKeyFile  string
+	// InsecureSkipVerify disables the verification of the Gitea server certificate, only use this in lab setups
+	InsecureSkipVerify bool
+	// HTTPProxy, HTTPSProxy and NoProxy override the proxy environment variables (HTTP_PROXY, HTTPS_PROXY, NO_PROXY),
+	// the environment variable is used for every setting that is empty
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+}
+
+// overridesProxy returns true if at least one of the proxy environment variables is overridden
+func (o *TransportOptions) overridesProxy() bool {
+	return o.HTTPProxy != "" || o.HTTPSProxy != "" || o.NoProxy != ""
+}
+
+// proxyConfig returns the proxy settings of the environment with the overridden ones replaced
+func (o *TransportOptions) proxyConfig() *httpproxy.Config {
+	config := httpproxy.FromEnvironment()
+	if o.HTTPProxy != "" {
+		config.HTTPProxy = o.HTTPProxy
+	}
+
+	if o.HTTPSProxy != "" {
+		config.HTTPSProxy = o.HTTPSProxy
+	}
+
+	if o.NoProxy != "" {
+		config.NoProxy = o.NoProxy
+	}
+
+	return config
+}
+
+// NewHTTPClient creates the http client that is used for all connections to Gitea, a nil options
+// value creates a client with the default transport settings
+func NewHTTPClient(options *TransportOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options == nil {
+		return &http.Client{Transport: transport}, nil
+	}
+
+	tlsConfig, err := newTLSConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if options.overridesProxy() {
+		proxyFunc := options.proxyConfig().ProxyFunc()
+
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// gitEnvironment returns the environment variables that apply the transport options to the git binary. Unlike the
+// http client, git trusts only the CA bundle if one is configured.
+func gitEnvironment(options *TransportOptions) []string {
+	if options == nil {
+		return nil
+	}
+
+	var environment []string
+	if options.CAFile != "" {
+		environment = append(environment, "GIT_SSL_CAINFO="+options.CAFile)
+	}
+
+	if options.ClientCertFile != "" {
+		environment = append(environment, "GIT_SSL_CERT="+options.ClientCertFile, "GIT_SSL_KEY="+options.ClientKeyFile)
+	}
+
+	if options.InsecureSkipVerify {
+		environment = append(environment, "GIT_SSL_NO_VERIFY=true")
+	}
+
+	if options.overridesProxy() {
+		proxy := options.proxyConfig()
+		environment = append(environment,
+			"http_proxy="+proxy.HTTPProxy,
+			"https_proxy="+proxy.HTTPSProxy,
+			"no_proxy="+proxy.NoProxy,
+		)
+	}
+
+	return environment
+}
+
+// newTLSConfig creates the tls.Config from the CA bundle, client certificate and verification settings
+func newTLSConfig(options *TransportOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CAFile != "" {
+		caBundle, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+		}
+
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("CA bundle %s does not contain any PEM encoded certificate", options.CAFile)
+		}
+
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if options.ClientCertFile != "" || options.ClientKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(options.ClientCertFile, options.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,258 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate holds a certificate and its key in PEM and parsed form
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// createTestCertificate creates a certificate from the given template that is signed by the parent, or is
+// self-signed if no parent is given
+func createTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.certificate, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// createTestPKI creates a CA, a server certificate for 127.0.0.1 and a client certificate
+func createTestPKI(t *testing.T) (ca *testCertificate, server *testCertificate, client *testCertificate) {
+	validity := func(serial int64, name string) x509.Certificate {
+		return x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+	}
+
+	caTemplate := validity(1, "test-ca")
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign
+	ca = createTestCertificate(t, &caTemplate, nil)
+
+	serverTemplate := validity(2, "gitea")
+	serverTemplate.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	serverTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	server = createTestCertificate(t, &serverTemplate, ca)
+
+	clientTemplate := validity(3, "provisioner")
+	clientTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	client = createTestCertificate(t, &clientTemplate, ca)
+
+	return ca, server, client
+}
+
+// writeTestFile writes the content into a file in a temporary directory and returns its path
+func writeTestFile(t *testing.T, name string, content []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, content, 0600))
+	return path
+}
+
+// newFakeGiteaTLSServer creates a fake Gitea that requires a client certificate signed by the given CA and answers
+// version, user info and access token requests
+func newFakeGiteaTLSServer(t *testing.T, ca *testCertificate, serverCert *testCertificate, sudoUsers *[]string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/version", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version":"1.16.8"}`))
+	})
+	mux.HandleFunc("/api/v1/user", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"login":"admin","is_admin":true}`))
+	})
+	mux.HandleFunc("/api/v1/users/admin/tokens", func(w http.ResponseWriter, r *http.Request) {
+		*sudoUsers = append(*sudoUsers, r.Header.Get("Sudo"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"name":"project","sha1":"access-token"}`))
+	})
+
+	serverKeyPair, err := tls.X509KeyPair(serverCert.certPEM, serverCert.keyPEM)
+	require.NoError(t, err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.certificate)
+
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverKeyPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+
+	return server
+}
+
+func TestNewGiteaProvisioner_MutualTLS(t *testing.T) {
+	ca, serverCert, clientCert := createTestPKI(t)
+
+	var sudoUsers []string
+	server := newFakeGiteaTLSServer(t, ca, serverCert, &sudoUsers)
+	defer server.Close()
+
+	transport := &TransportOptions{
+		CAFile:         writeTestFile(t, "ca.pem", ca.certPEM),
+		ClientCertFile: writeTestFile(t, "client.pem", clientCert.certPEM),
+		ClientKeyFile:  writeTestFile(t, "client-key.pem", clientCert.keyPEM),
+	}
+
+	giteaProvisioner, err := NewGiteaProvisioner(server.URL, "admin", "secret", &GiteaProvisionerOptions{
+		Transport: transport,
+	})
+	require.NoError(t, err)
+	require.NoError(t, giteaProvisioner.CheckHealth())
+
+	// The sudo clients must use the same TLS configuration as the admin client
+	token, err := giteaProvisioner.CreateToken("keptn", "project")
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", token)
+	assert.Equal(t, []string{"keptn"}, sudoUsers)
+}
+
+func TestNewGiteaProvisioner_UntrustedServer(t *testing.T) {
+	ca, serverCert, clientCert := createTestPKI(t)
+
+	var sudoUsers []string
+	server := newFakeGiteaTLSServer(t, ca, serverCert, &sudoUsers)
+	defer server.Close()
+
+	// Without the CA bundle the server certificate cannot be verified
+	_, err := NewGiteaProvisioner(server.URL, "admin", "secret", &GiteaProvisionerOptions{
+		Transport: &TransportOptions{
+			ClientCertFile: writeTestFile(t, "client.pem", clientCert.certPEM),
+			ClientKeyFile:  writeTestFile(t, "client-key.pem", clientCert.keyPEM),
+		},
+	})
+	require.Error(t, err)
+
+	// Unless verification is explicitly disabled
+	_, err = NewGiteaProvisioner(server.URL, "admin", "secret", &GiteaProvisionerOptions{
+		Transport: &TransportOptions{
+			ClientCertFile:     writeTestFile(t, "client.pem", clientCert.certPEM),
+			ClientKeyFile:      writeTestFile(t, "client-key.pem", clientCert.keyPEM),
+			InsecureSkipVerify: true,
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestNewHTTPClient_Proxy(t *testing.T) {
+	var proxiedURLs []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedURLs = append(proxiedURLs, r.URL.String())
+		_, _ = w.Write([]byte(`{"version":"1.16.8"}`))
+	}))
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(&TransportOptions{
+		HTTPProxy: proxy.URL,
+		NoProxy:   "direct.gitea.local",
+	})
+	require.NoError(t, err)
+
+	response, err := client.Get("http://gitea.internal:3000/api/v1/version")
+	require.NoError(t, err)
+	_ = response.Body.Close()
+
+	assert.Equal(t, []string{"http://gitea.internal:3000/api/v1/version"}, proxiedURLs)
+}
+
+func TestNewHTTPClient_ProxyFromEnvironment(t *testing.T) {
+	var proxiedURLs []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedURLs = append(proxiedURLs, r.URL.String())
+		_, _ = w.Write([]byte(`{"version":"1.16.8"}`))
+	}))
+	defer proxy.Close()
+
+	// Overriding only the excluded hosts keeps the proxy of the environment
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	client, err := NewHTTPClient(&TransportOptions{
+		NoProxy: "direct.gitea.local",
+	})
+	require.NoError(t, err)
+
+	response, err := client.Get("http://gitea.internal:3000/api/v1/version")
+	require.NoError(t, err)
+	_ = response.Body.Close()
+
+	assert.Equal(t, []string{"http://gitea.internal:3000/api/v1/version"}, proxiedURLs)
+}
+
+func TestNewHTTPClient_InvalidFiles(t *testing.T) {
+	_, err := NewHTTPClient(&TransportOptions{CAFile: "/does/not/exist.pem"})
+	require.Error(t, err)
+
+	_, err = NewHTTPClient(&TransportOptions{CAFile: writeTestFile(t, "ca.pem", []byte("no certificate"))})
+	require.Error(t, err)
+
+	_, err = NewHTTPClient(&TransportOptions{ClientCertFile: "/does/not/exist.pem"})
+	require.Error(t, err)
+}
+
+func TestGitEnvironment(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://env-proxy:3128")
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("NO_PROXY", "")
+	assert.Empty(t, gitEnvironment(nil))
+
+	environment := gitEnvironment(&TransportOptions{
+		CAFile:             "/etc/gitea-tls/ca.crt",
+		ClientCertFile:     "/etc/gitea-tls/tls.crt",
+		ClientKeyFile:      "/etc/gitea-tls/tls.key",
+		InsecureSkipVerify: true,
+		HTTPSProxy:         "http://proxy:3128",
+	})
+
+	assert.Equal(t, []string{
+		"GIT_SSL_CAINFO=/etc/gitea-tls/ca.crt",
+		"GIT_SSL_CERT=/etc/gitea-tls/tls.crt",
+		"GIT_SSL_KEY=/etc/gitea-tls/tls.key",
+		"GIT_SSL_NO_VERIFY=true",
+		"http_proxy=http://env-proxy:3128",
+		"https_proxy=http://proxy:3128",
+		"no_proxy=",
+	}, environment)
+}
@@ -0,0 +1,27 @@
+package secrets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Source provides secrets from an external secret store
+type Source interface {
+	// Lookup returns the secret with the given key, found is false if the secret store doesn't contain the key
+	Lookup(key string) (value string, found bool, err error)
+	// Snapshot reads the secret store once and returns a Source that answers all lookups from that read, such that
+	// keys that are looked up together belong to the same version of the secrets
+	Snapshot() (Source, error)
+}
+
+// ReadFile reads a secret from a mounted file, trailing newlines are removed since they are usually not part of the
+// secret but added by editors or `echo`
+func ReadFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret file: %w", err)
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
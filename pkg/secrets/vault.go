@@ -0,0 +1,148 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// vaultTimeout is the timeout of a single request against Vault, it is also applied to a given http.Client without
+// timeout such that a hanging Vault can't block the startup or the config reload
+const vaultTimeout = 10 * time.Second
+
+// VaultOptions contains the configuration of a VaultSource
+type VaultOptions struct {
+	// Address of the Vault server, e.g. https://vault.vault:8200
+	Address string
+	// Token is used to authenticate against Vault if TokenFile is not set
+	Token string
+	// TokenFile is re-read on every request, which allows a Vault agent to rotate the token
+	TokenFile string
+	// Mount is the path the KV v2 secrets engine is mounted at, e.g. secret
+	Mount string
+	// Path is the path of the secret within the secrets engine
+	Path string
+	// HTTPClient is used for all requests against Vault, e.g. to trust a custom CA
+	HTTPClient *http.Client
+}
+
+// VaultSource is a Source that reads the keys of a single secret stored in a HashiCorp Vault KV v2 secrets engine
+type VaultSource struct {
+	options    VaultOptions
+	httpClient *http.Client
+}
+
+// vaultKVResponse is the response of reading a secret from a KV v2 secrets engine
+type vaultKVResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+// NewVaultSource creates a VaultSource with the given options
+func NewVaultSource(options VaultOptions) *VaultSource {
+	httpClient := &http.Client{}
+	if options.HTTPClient != nil {
+		client := *options.HTTPClient
+		httpClient = &client
+	}
+
+	if httpClient.Timeout == 0 {
+		httpClient.Timeout = vaultTimeout
+	}
+
+	return &VaultSource{
+		options:    options,
+		httpClient: httpClient,
+	}
+}
+
+// Lookup reads the secret from Vault and returns the value of the given key
+func (v *VaultSource) Lookup(key string) (string, bool, error) {
+	snapshot, err := v.Snapshot()
+	if err != nil {
+		return "", false, err
+	}
+
+	return snapshot.Lookup(key)
+}
+
+// Snapshot reads the latest version of the secret from Vault
+func (v *VaultSource) Snapshot() (Source, error) {
+	data, err := v.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return &vaultSnapshot{path: v.options.Path, data: data}, nil
+}
+
+// vaultSnapshot is a single version of a Vault secret
+type vaultSnapshot struct {
+	path string
+	data map[string]interface{}
+}
+
+// Lookup returns the value of the given key, which must be a string
+func (s *vaultSnapshot) Lookup(key string) (string, bool, error) {
+	value, found := s.data[key]
+	if !found {
+		return "", false, nil
+	}
+
+	stringValue, ok := value.(string)
+	if !ok {
+		return "", false, fmt.Errorf("key %s of vault secret %s is not a string", key, s.path)
+	}
+
+	return stringValue, true, nil
+}
+
+// Snapshot returns the snapshot itself
+func (s *vaultSnapshot) Snapshot() (Source, error) {
+	return s, nil
+}
+
+// read fetches the latest version of the secret
+func (v *VaultSource) read() (map[string]interface{}, error) {
+	token := v.options.Token
+	if v.options.TokenFile != "" {
+		fileToken, err := ReadFile(v.options.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read vault token: %w", err)
+		}
+
+		token = fileToken
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/data/%s",
+		strings.TrimRight(v.options.Address, "/"),
+		strings.Trim(v.options.Mount, "/"),
+		strings.TrimLeft(v.options.Path, "/"),
+	)
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create vault request: %w", err)
+	}
+	request.Header.Set("X-Vault-Token", token)
+
+	response, err := v.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vault secret %s: %w", v.options.Path, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to read vault secret %s: unexpected status code %d", v.options.Path, response.StatusCode)
+	}
+
+	var kvResponse vaultKVResponse
+	if err := json.NewDecoder(response.Body).Decode(&kvResponse); err != nil {
+		return nil, fmt.Errorf("unable to decode vault secret %s: %w", v.options.Path, err)
+	}
+
+	return kvResponse.Data.Data, nil
+}
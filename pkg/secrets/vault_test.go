@@ -0,0 +1,144 @@
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeVaultServer creates a stand-in for a Vault dev server with a KV v2 secrets engine mounted at "secret", the
+// data of the secret can be modified by the test
+func newFakeVaultServer(t *testing.T, token string, path string, data map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/secret/data/"+path {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     data,
+				"metadata": map[string]interface{}{"version": 1},
+			},
+		}))
+	}))
+}
+
+func TestVaultSource_Lookup(t *testing.T) {
+	data := map[string]interface{}{"giteaPassword": "secret", "version": 3}
+	server := newFakeVaultServer(t, "root", "gitea-provisioner", data)
+	defer server.Close()
+
+	source := NewVaultSource(VaultOptions{
+		Address: server.URL + "/",
+		Token:   "root",
+		Mount:   "secret",
+		Path:    "gitea-provisioner",
+	})
+
+	value, found, err := source.Lookup("giteaPassword")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "secret", value)
+
+	_, found, err = source.Lookup("giteaToken")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, _, err = source.Lookup("version")
+	require.Error(t, err)
+
+	// Changes in Vault are picked up by the next lookup
+	data["giteaPassword"] = "rotated"
+	value, _, err = source.Lookup("giteaPassword")
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", value)
+}
+
+func TestVaultSource_Snapshot(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"data":{"data":{"giteaPassword":"secret","giteaToken":"token"}}}`))
+	}))
+	defer server.Close()
+
+	source := NewVaultSource(VaultOptions{Address: server.URL, Token: "root", Mount: "secret", Path: "gitea-provisioner"})
+
+	snapshot, err := source.Snapshot()
+	require.NoError(t, err)
+
+	password, _, err := snapshot.Lookup("giteaPassword")
+	require.NoError(t, err)
+	token, _, err := snapshot.Lookup("giteaToken")
+	require.NoError(t, err)
+
+	assert.Equal(t, "secret", password)
+	assert.Equal(t, "token", token)
+	assert.Equal(t, 1, requests)
+}
+
+func TestVaultSource_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	// A client without timeout gets the default timeout
+	source := NewVaultSource(VaultOptions{Address: server.URL, Token: "root", Mount: "secret", Path: "gitea-provisioner", HTTPClient: &http.Client{}})
+	assert.Equal(t, vaultTimeout, source.httpClient.Timeout)
+
+	source.httpClient.Timeout = 10 * time.Millisecond
+	_, _, err := source.Lookup("giteaPassword")
+	require.Error(t, err)
+}
+
+func TestVaultSource_LookupErrors(t *testing.T) {
+	server := newFakeVaultServer(t, "root", "gitea-provisioner", map[string]interface{}{})
+	defer server.Close()
+
+	forbidden := NewVaultSource(VaultOptions{Address: server.URL, Token: "wrong", Mount: "secret", Path: "gitea-provisioner"})
+	_, _, err := forbidden.Lookup("giteaPassword")
+	require.Error(t, err)
+
+	missing := NewVaultSource(VaultOptions{Address: server.URL, Token: "root", Mount: "secret", Path: "other"})
+	_, _, err = missing.Lookup("giteaPassword")
+	require.Error(t, err)
+}
+
+func TestVaultSource_TokenFile(t *testing.T) {
+	server := newFakeVaultServer(t, "agent-token", "gitea-provisioner", map[string]interface{}{"giteaToken": "token"})
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("agent-token\n"), 0600))
+
+	source := NewVaultSource(VaultOptions{
+		Address:   server.URL,
+		Token:     "outdated",
+		TokenFile: tokenFile,
+		Mount:     "secret",
+		Path:      "gitea-provisioner",
+	})
+
+	value, found, err := source.Lookup("giteaToken")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "token", value)
+}
@@ -55,7 +55,8 @@ func Test_CreateAndDeleteProject(t *testing.T) {
 	err = keptnAPI.DeleteProject(projectName)
 	require.NoError(t, err)
 
-	// Repository must also be deleted from upstream Gitea server
+	// Repository must also be deleted from upstream Gitea server, the integration tests enable backups such that the
+	// repository is only deleted if its backup could be written under the security context of the chart
 	_, r, err = client.GetRepo(projectUser, projectName)
 	require.Error(t, err)
 	require.Equal(t, http.StatusNotFound, r.StatusCode)
@@ -0,0 +1,69 @@
+package e2e
+
+import (
+	"bytes"
+	"code.gitea.io/sdk/gitea"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/keptn"
+	"keptn-sandbox/keptn-gitea-provisioner/pkg/provisioner"
+	"net/http"
+	"testing"
+)
+
+func Test_RestoreDeletedProject(t *testing.T) {
+	if !isE2ETestingAllowed() {
+		t.Skip("Skipping Test_RestoreDeletedProject, not allowed by environment")
+	}
+
+	provisionerEndpoint := readProvisionerEndpointFromEnv()
+	if provisionerEndpoint == "" {
+		t.Skip("Skipping Test_RestoreDeletedProject, PROVISIONER_ENDPOINT is not set")
+	}
+
+	keptnAPI := NewKeptAPI(readKeptnConnectionDetailsFromEnv())
+
+	giteaDetails := readGiteaConnectionDetailsFromEnv()
+	client, err := gitea.NewClient(giteaDetails.Endpoint,
+		gitea.SetBasicAuth(giteaDetails.Username, giteaDetails.Password),
+	)
+	require.NoError(t, err, "unable to connect to gitea")
+
+	projectName := "e2e-gitea-restore-project"
+	projectUser := provisioner.DefaultKeptnNamespace
+
+	// Create the project and delete it again, the integration tests enable backups such that a bundle is written
+	err = keptnAPI.CreateProject(projectName, []byte(shipyard))
+	require.NoError(t, err)
+
+	err = keptnAPI.DeleteProject(projectName)
+	require.NoError(t, err)
+
+	_, r, err := client.GetRepo(projectUser, projectName)
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, r.StatusCode)
+
+	// The backup is downloaded and pushed into a new repository under the security context of the chart
+	body, err := json.Marshal(keptn.ProvisionRequest{Project: projectName, Namespace: provisioner.DefaultKeptnNamespace})
+	require.NoError(t, err)
+
+	response, err := http.Post(provisionerEndpoint+"/repository/restore", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	defer func() {
+		if _, err := client.DeleteRepo(projectUser, projectName); err != nil {
+			t.Logf("Unable to delete restored repository: %s", err)
+		}
+	}()
+
+	// The restored repository contains the history of the deleted project
+	_, r, err = client.GetRepo(projectUser, projectName)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, r.StatusCode)
+
+	branches, _, err := client.ListRepoBranches(projectUser, projectName, gitea.ListRepoBranchesOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, branches)
+}
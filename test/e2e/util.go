@@ -49,6 +49,12 @@ func readGiteaConnectionDetailsFromEnv() GiteaConnectionDetails {
 	}
 }
 
+// readProvisionerEndpointFromEnv returns the endpoint of the provisioner service, tests that call the provisioner
+// directly are skipped if it is empty
+func readProvisionerEndpointFromEnv() string {
+	return os.Getenv("PROVISIONER_ENDPOINT")
+}
+
 // isE2ETestingAllowed checks if the E2E tests are allowed to run by parsing environment variables
 func isE2ETestingAllowed() bool {
 	boolean, err := strconv.ParseBool(os.Getenv("ENABLE_E2E_TEST"))
@@ -148,7 +154,7 @@ func createK8sSecret(ctx context.Context, clientset *kubernetes.Clientset, names
 	return func(ctx2 context.Context) {
 		err := clientset.CoreV1().Secrets(namespace).Delete(ctx2, secret.Name, metav1.DeleteOptions{})
 		if err != nil {
-			fmt.Errorf("Unable to delete secret!")
+			fmt.Printf("Unable to delete secret: %s\n", err)
 		}
 	}, nil
 }